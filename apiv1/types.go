@@ -0,0 +1,131 @@
+package apiv1
+
+import "time"
+
+// The bodies of the /api/v1 endpoints. They are kept apart from the models so
+// stored fields (Slack message timestamps, authenticator secrets...) never
+// leak into responses and the API can stay stable while the tables change.
+// The package doesn't import the models so the client can use it without
+// pulling in the tables.
+
+// Error is the body of every response with a 4xx or 5xx status
+type Error struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	Code    string `json:"code" doc:"Stable identifier of the error" enum:"bad_request,unauthorized,forbidden,not_found,conflict,invalid_code,rate_limited,internal"`
+	Message string `json:"message" doc:"Human readable description"`
+}
+
+// User is a party of a request
+type User struct {
+	ID    string `json:"id,omitempty" doc:"ID on the communication tool"`
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email,omitempty"`
+}
+
+// Request is a verification request
+type Request struct {
+	ID               string     `json:"id"`
+	Status           string     `json:"status" enum:"QUEUED,RECEIVED,SENT,COMPLETED,FAILED,CANCELLED"`
+	Requestor        User       `json:"requestor"`
+	Recipient        User       `json:"recipient"`
+	RequestorChannel string     `json:"requestor_channel,omitempty" doc:"Where the requestor gets updates"`
+	RecipientChannel string     `json:"recipient_channel,omitempty" doc:"Where the recipient got the verification"`
+	Message          string     `json:"message,omitempty"`
+	Error            string     `json:"error,omitempty" doc:"Why the request failed"`
+	BatchID          string     `json:"batch_id,omitempty"`
+	ServiceAccountID string     `json:"service_account_id,omitempty" doc:"Service account that created the request on behalf of the requestor"`
+	ResendCount      int        `json:"resend_count"`
+	CreatedAt        time.Time  `json:"created_at"`
+	CompletedAt      *time.Time `json:"completed_at,omitempty"`
+	AuthenticatedAt  *time.Time `json:"authenticated_at,omitempty"`
+}
+
+// CreateRequest starts a verification of a user of the communication tool or of an email address
+type CreateRequest struct {
+	RecipientID    string `json:"recipient_id,omitempty" doc:"ID on the communication tool, required without recipient_email"`
+	RecipientEmail string `json:"recipient_email,omitempty" doc:"For recipients without an account on the communication tool"`
+	Notify         string `json:"notify,omitempty" doc:"email or the communication tool, where the requestor gets updates"`
+	OnBehalfOf     string `json:"on_behalf_of,omitempty" doc:"Email of the user a service account acts for, they become the requestor. Required for service accounts."`
+}
+
+// RequestList is a page of requests
+type RequestList struct {
+	Requests   []Request `json:"requests"`
+	NextCursor string    `json:"next_cursor,omitempty" doc:"Pass as cursor to get the next page, missing on the last one"`
+}
+
+// Batch groups the requests of a multi-recipient verification
+type Batch struct {
+	ID          string      `json:"id"`
+	Status      string      `json:"status"`
+	Requestor   User        `json:"requestor"`
+	Message     string      `json:"message,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	Counts      BatchCounts `json:"counts"`
+	Requests    []Request   `json:"requests"`
+}
+
+type BatchCounts struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+// Enrollment lists the second factors of the authenticated user
+type Enrollment struct {
+	TOTP     bool   `json:"totp" doc:"An authenticator app is enrolled and validated"`
+	WebAuthn int    `json:"webauthn" doc:"Number of registered security keys"`
+	Phone    string `json:"phone,omitempty" doc:"Verified number for text message codes"`
+}
+
+// TOTPSetup is the secret of an authenticator app that still has to be validated
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	QRCode string `json:"qr_code" doc:"PNG data URL of the otpauth URL"`
+}
+
+// Code is a one-time code entered by the user
+type Code struct {
+	Code string `json:"code"`
+}
+
+// PhoneNumber starts a phone enrollment, a code is texted to the number
+type PhoneNumber struct {
+	Number string `json:"number" doc:"E.164 or national format"`
+}
+
+// Event is the body of webhook deliveries, see the service events
+type Event struct {
+	ID      string        `json:"id"`
+	Type    string        `json:"type"`
+	Time    time.Time     `json:"time"`
+	Request *EventRequest `json:"request,omitempty"`
+	User    *Party        `json:"user,omitempty"`
+	Factor  string        `json:"factor,omitempty"`
+}
+
+type EventRequest struct {
+	ID                string    `json:"id"`
+	BatchID           string    `json:"batch_id,omitempty"`
+	Status            string    `json:"status"`
+	CommunicationTool string    `json:"communication_tool"`
+	Start             time.Time `json:"start_time"`
+	End               time.Time `json:"end_time,omitempty"`
+	Requestor         Party     `json:"requestor"`
+	Recipient         Party     `json:"recipient"`
+	Message           string    `json:"message,omitempty"`
+	Error             string    `json:"error,omitempty"`
+}
+
+type Party struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Image string `json:"image,omitempty"`
+}
@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+// Audit keeps an append-only, hash-chained trail of everything done to
+// verification requests and user enrollments. The trail is stored separately
+// from the requests, which are overwritten on every save.
+
+const (
+	RequestCreated       = "request.created"
+	RequestSent          = "request.sent"
+	RequestAuthenticated = "request.authenticated"
+	RequestCompleted     = "request.completed"
+	RequestFailed        = "request.failed"
+	RequestReported      = "request.reported"
+	RequestCancelled     = "request.cancelled"
+	RequestResent        = "request.resent"
+
+	FactorPassed = "factor.passed"
+	FactorFailed = "factor.failed"
+
+	UserEnrollmentStarted = "user.enrollment_started"
+	UserEnrolled          = "user.enrolled"
+	UserMuted             = "user.muted"
+	UserUnmuted           = "user.unmuted"
+
+	AdminWebhookCreated = "admin.webhook_created"
+	AdminWebhookDeleted = "admin.webhook_deleted"
+	AdminAuditExported  = "admin.audit_exported"
+
+	AdminServiceAccountCreated  = "admin.service_account_created"
+	AdminServiceAccountUpdated  = "admin.service_account_updated"
+	AdminServiceAccountDisabled = "admin.service_account_disabled"
+	AdminAPIKeyCreated          = "admin.api_key_created"
+	AdminAPIKeyRevoked          = "admin.api_key_revoked"
+)
+
+// System is the actor for actions Veriflow takes on its own
+const System = "veriflow"
+
+// Exporter receives every entry once it is part of the trail. Export must not
+// block, exporters are expected to buffer entries themselves.
+type Exporter interface {
+	Export(entry models.AuditEntry)
+}
+
+var exporters []Exporter
+
+// RegisterExporter adds an exporter, it's meant to be called during startup
+func RegisterExporter(exporter Exporter) {
+	exporters = append(exporters, exporter)
+}
+
+// Actor is who performed an action and where from
+type Actor struct {
+	ID        string
+	IP        string
+	UserAgent string
+}
+
+type serviceAccountKey struct{}
+
+type serviceAccount struct {
+	id    string
+	keyID string
+}
+
+// WithServiceAccount marks the actions recorded with the context as taken by
+// a service account, through one of its API keys, on behalf of the actor
+func WithServiceAccount(ctx context.Context, id, keyID string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, serviceAccountKey{}, serviceAccount{id: id, keyID: keyID})
+}
+
+// Record appends an entry to the audit trail. Failures are logged and don't
+// stop the action that is being audited.
+func Record(ctx context.Context, action string, actor Actor, requestID, subject string, details map[string]string) {
+	if account, ok := ctx.Value(serviceAccountKey{}).(serviceAccount); ok {
+		withAccount := map[string]string{"service_account": account.id, "api_key": account.keyID}
+		for key, value := range details {
+			withAccount[key] = value
+		}
+		details = withAccount
+	}
+
+	entry := models.AuditEntry{
+		Action:    action,
+		Actor:     actor.ID,
+		ActorIP:   actor.IP,
+		UserAgent: actor.UserAgent,
+		RequestID: requestID,
+		Subject:   subject,
+		Details:   details,
+	}
+	if entry.Actor == "" {
+		entry.Actor = System
+	}
+
+	if err := models.AppendAuditEntry(ctx, &entry); err != nil {
+		log.Printf("failed to record audit entry %s for %s: %v\n", action, requestID, err)
+	}
+
+	// The SIEM still gets the entry when the table is unavailable
+	for _, exporter := range exporters {
+		exporter.Export(entry)
+	}
+}
+
+// WriteJSONLines writes one JSON encoded entry per line
+func WriteJSONLines(w io.Writer, entries []models.AuditEntry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -12,9 +13,9 @@ import (
 // Right now it only allows OIDC
 
 type Authenticator interface {
-	GenerateAuthLink(fn, uuid string) (string, error)
-	GetConfig() (*oidc.Provider, oauth2.Config, error)
-	GetAccessToken(code string) (*oidc.UserInfo, *oauth2.Token, error)
+	GenerateAuthLink(ctx context.Context, fn, uuid string) (string, error)
+	GetConfig(ctx context.Context) (*oidc.Provider, oauth2.Config, error)
+	GetAccessToken(ctx context.Context, code string) (*oidc.UserInfo, *oauth2.Token, error)
 }
 
 func NewAuthenticator(cfg *config.Config) Authenticator {
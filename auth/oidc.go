@@ -4,8 +4,12 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/vdparikh/veriflow/metrics"
+	"github.com/vdparikh/veriflow/tracing"
 	"golang.org/x/oauth2"
 )
 
@@ -16,9 +20,13 @@ type OIDCProvider struct {
 	CallbackURL  string
 }
 
-func (o *OIDCProvider) GetConfig() (*oidc.Provider, oauth2.Config, error) {
-	ctx := context.Background()
+// Calls to the identity provider get a client span
+var httpClient = &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(http.DefaultTransport, "oidc")}
+
+func (o *OIDCProvider) GetConfig(ctx context.Context) (*oidc.Provider, oauth2.Config, error) {
+	ctx, span := tracing.Start(oidc.ClientContext(ctx, httpClient), "oidc.discovery")
 	provider, err := oidc.NewProvider(ctx, o.Issuer)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, oauth2.Config{}, err
 	}
@@ -33,23 +41,33 @@ func (o *OIDCProvider) GetConfig() (*oidc.Provider, oauth2.Config, error) {
 	return provider, oauth2Config, nil
 }
 
-func (o *OIDCProvider) GenerateAuthLink(fn string, uuid string) (string, error) {
+func (o *OIDCProvider) GenerateAuthLink(ctx context.Context, fn string, uuid string) (string, error) {
 	stateString := fmt.Sprintf("%s=%s", fn, uuid)
 	state := base64.StdEncoding.EncodeToString([]byte(stateString))
 
-	_, oauth2Config, err := o.GetConfig()
+	_, oauth2Config, err := o.GetConfig(ctx)
 	return oauth2Config.AuthCodeURL(state), err
 }
 
-func (o *OIDCProvider) GetAccessToken(code string) (*oidc.UserInfo, *oauth2.Token, error) {
-	ctx := context.Background()
-	provider, config, _ := o.GetConfig()
+func (o *OIDCProvider) GetAccessToken(ctx context.Context, code string) (userInfo *oidc.UserInfo, oauth2Token *oauth2.Token, err error) {
+	provider, config, _ := o.GetConfig(ctx)
+
+	ctx, span := tracing.Start(oidc.ClientContext(ctx, httpClient), "oidc.exchange")
+	start := time.Now()
+	defer func() {
+		metrics.OIDCExchangeDuration.Observe(time.Since(start).Seconds())
+		tracing.End(span, err)
+	}()
 
-	oauth2Token, err := config.Exchange(ctx, code)
+	oauth2Token, err = config.Exchange(ctx, code)
 	if err != nil {
+		metrics.OIDCExchangeErrors.Inc()
 		return nil, nil, err
 	}
 
-	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(oauth2Token))
+	userInfo, err = provider.UserInfo(ctx, oauth2.StaticTokenSource(oauth2Token))
+	if err != nil {
+		metrics.OIDCExchangeErrors.Inc()
+	}
 	return userInfo, oauth2Token, err
 }
@@ -0,0 +1,215 @@
+// Package client calls the Veriflow /api/v1 endpoints from Go services and
+// verifies the webhooks Veriflow sends them
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vdparikh/veriflow/apiv1"
+)
+
+// DefaultPollInterval is how often WaitForCompletion checks a request
+const DefaultPollInterval = 2 * time.Second
+
+// Client authenticates with a service account API key (vf_...) or an OIDC access token
+type Client struct {
+	BaseURL      string
+	Token        string
+	HTTPClient   *http.Client
+	PollInterval time.Duration
+}
+
+// New returns a client of the Veriflow at baseURL, like https://veriflow.example.com
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		Token:        token,
+		HTTPClient:   &http.Client{Timeout: 30 * time.Second},
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Error is a failure reported by the API with its error envelope
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("veriflow: %s (%d): %s", e.Code, e.StatusCode, e.Message)
+}
+
+// ListOptions filter ListRequests, the zero value lists the newest requests
+// sent or received by the caller
+type ListOptions struct {
+	// sent, received, or empty for both
+	Role         string
+	Status       string
+	Counterparty string
+	Since        time.Time
+	Until        time.Time
+	Ascending    bool
+	Limit        int
+	// NextCursor of the previous page
+	Cursor string
+	// Required for service accounts, the user whose requests to list
+	OnBehalfOf string
+}
+
+// CreateRequest starts a verification, it is returned QUEUED
+func (c *Client) CreateRequest(ctx context.Context, request apiv1.CreateRequest) (apiv1.Request, error) {
+	var created apiv1.Request
+	err := c.do(ctx, http.MethodPost, "/requests", request, &created)
+	return created, err
+}
+
+func (c *Client) GetRequest(ctx context.Context, id string) (apiv1.Request, error) {
+	var request apiv1.Request
+	err := c.do(ctx, http.MethodGet, "/requests/"+url.PathEscape(id), nil, &request)
+	return request, err
+}
+
+func (c *Client) CancelRequest(ctx context.Context, id string) (apiv1.Request, error) {
+	var request apiv1.Request
+	err := c.do(ctx, http.MethodPost, "/requests/"+url.PathEscape(id)+"/cancel", nil, &request)
+	return request, err
+}
+
+func (c *Client) ResendRequest(ctx context.Context, id string) (apiv1.Request, error) {
+	var request apiv1.Request
+	err := c.do(ctx, http.MethodPost, "/requests/"+url.PathEscape(id)+"/resend", nil, &request)
+	return request, err
+}
+
+// ListRequests returns a page of requests, pass its NextCursor in the options
+// to get the next one
+func (c *Client) ListRequests(ctx context.Context, options ListOptions) (apiv1.RequestList, error) {
+	query := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	set("role", options.Role)
+	set("status", options.Status)
+	set("counterparty", options.Counterparty)
+	set("cursor", options.Cursor)
+	set("on_behalf_of", options.OnBehalfOf)
+	if !options.Since.IsZero() {
+		query.Set("since", options.Since.Format(time.RFC3339))
+	}
+	if !options.Until.IsZero() {
+		query.Set("until", options.Until.Format(time.RFC3339))
+	}
+	if options.Ascending {
+		query.Set("order", "asc")
+	}
+	if options.Limit > 0 {
+		query.Set("limit", strconv.Itoa(options.Limit))
+	}
+
+	path := "/requests"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var list apiv1.RequestList
+	err := c.do(ctx, http.MethodGet, path, nil, &list)
+	return list, err
+}
+
+// WaitForCompletion polls the request until it is COMPLETED, FAILED or
+// CANCELLED, or ctx is done. Bound the wait with a deadline on ctx.
+func (c *Client) WaitForCompletion(ctx context.Context, id string) (apiv1.Request, error) {
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		request, err := c.GetRequest(ctx, id)
+		if err != nil {
+			return request, err
+		}
+		if IsFinished(request) {
+			return request, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return request, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// IsFinished reports whether the request won't change anymore
+func IsFinished(request apiv1.Request) bool {
+	switch request.Status {
+	case "COMPLETED", "FAILED", "CANCELLED":
+		return true
+	}
+	return false
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, output interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+"/api/v1"+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		apiErr := &Error{StatusCode: resp.StatusCode, Code: "internal", Message: resp.Status}
+		var envelope apiv1.Error
+		if json.NewDecoder(resp.Body).Decode(&envelope) == nil && envelope.Error.Code != "" {
+			apiErr.Code, apiErr.Message = envelope.Error.Code, envelope.Error.Message
+		}
+		return apiErr
+	}
+
+	if output == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+		return fmt.Errorf("veriflow: decoding %s %s: %w", method, path, err)
+	}
+	return nil
+}
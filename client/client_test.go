@@ -0,0 +1,281 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vdparikh/veriflow/apiv1"
+	"github.com/vdparikh/veriflow/client"
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/i18n"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/queue"
+	"github.com/vdparikh/veriflow/service"
+	"github.com/vdparikh/veriflow/veriflow"
+)
+
+// The router loads the page templates from the working directory
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+const requestor = "alice@example.com"
+
+// newTestServer serves the real router on an in-memory database and returns a
+// client with the API key of a service account acting for alice
+func newTestServer(t *testing.T) (*client.Client, *models.ServiceAccount) {
+	t.Helper()
+	ctx := context.Background()
+
+	memory := db.NewMemoryDB()
+	memory.RangeKeys[models.RequestorIndex] = "start_time"
+	memory.RangeKeys[models.RecipientIndex] = "start_time"
+	models.UseDB(memory)
+
+	bundle, err := i18n.NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{BaseURL: "http://veriflow.test"}
+	logger := log.New()
+	logger.Out = testWriter{t}
+	app := &veriflow.Veriflow{
+		Cfg:    cfg,
+		Svc:    &service.VerificationService{Config: &cfg, Events: service.NewEventBus()},
+		Queue:  queue.NewMemoryQueue(100, time.Minute),
+		Logger: logger,
+		I18n:   bundle,
+	}
+	server := httptest.NewServer(app.SetupRouter())
+	t.Cleanup(server.Close)
+
+	if err := models.SaveUser(ctx, models.User{ID: requestor, Email: requestor, Name: "Alice"}); err != nil {
+		t.Fatal(err)
+	}
+	account := &models.ServiceAccount{ID: "ticketing", Name: "Ticketing", Scopes: models.Scopes, AllowedDelegators: []string{"@example.com"}, CreatedAt: time.Now()}
+	if err := account.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+	key, token, err := models.NewAPIKey(account.ID, "admin@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := key.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	c := client.New(server.URL, token)
+	c.PollInterval = 10 * time.Millisecond
+	return c, account
+}
+
+type testWriter struct{ t *testing.T }
+
+func (w testWriter) Write(p []byte) (int, error) {
+	w.t.Log(string(p))
+	return len(p), nil
+}
+
+func TestCreateAndGetRequest(t *testing.T) {
+	c, account := newTestServer(t)
+	ctx := context.Background()
+
+	created, err := c.CreateRequest(ctx, apiv1.CreateRequest{RecipientEmail: "bob@example.com", OnBehalfOf: requestor})
+	if err != nil {
+		t.Fatalf("CreateRequest() error = %v", err)
+	}
+	if created.ID == "" || created.Status != "QUEUED" || created.Requestor.Email != requestor || created.ServiceAccountID != account.ID {
+		t.Fatalf("CreateRequest() = %+v", created)
+	}
+
+	got, err := c.GetRequest(ctx, created.ID)
+	if err != nil {
+		t.Fatalf("GetRequest() error = %v", err)
+	}
+	if got.ID != created.ID || got.Recipient.ID != "bob@example.com" || !got.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("GetRequest() = %+v, want %+v", got, created)
+	}
+}
+
+func TestListRequestsPages(t *testing.T) {
+	c, _ := newTestServer(t)
+	ctx := context.Background()
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		created, err := c.CreateRequest(ctx, apiv1.CreateRequest{RecipientEmail: fmt.Sprintf("bob%d@example.com", i), OnBehalfOf: requestor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append([]string{created.ID}, want...)
+		time.Sleep(time.Millisecond)
+	}
+
+	var got []string
+	options := client.ListOptions{OnBehalfOf: requestor, Limit: 2}
+	for pages := 1; ; pages++ {
+		list, err := c.ListRequests(ctx, options)
+		if err != nil {
+			t.Fatalf("ListRequests() error = %v", err)
+		}
+		if len(list.Requests) > 2 {
+			t.Fatalf("page %d has %d requests, want at most 2", pages, len(list.Requests))
+		}
+		for _, request := range list.Requests {
+			got = append(got, request.ID)
+		}
+		if list.NextCursor == "" {
+			break
+		}
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		options.Cursor = list.NextCursor
+	}
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("listed %v, want newest first %v", got, want)
+	}
+
+	// The cursor is opaque, a forged one is rejected
+	_, err := c.ListRequests(ctx, client.ListOptions{OnBehalfOf: requestor, Cursor: "forged"})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("ListRequests() with a forged cursor error = %v, want 400", err)
+	}
+}
+
+func TestWaitForCompletion(t *testing.T) {
+	c, _ := newTestServer(t)
+	ctx := context.Background()
+
+	created, err := c.CreateRequest(ctx, apiv1.CreateRequest{RecipientEmail: "bob@example.com", OnBehalfOf: requestor})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing completes the request, the wait ends with the context
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	request, err := c.WaitForCompletion(waitCtx, created.ID)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitForCompletion() error = %v, want context.DeadlineExceeded", err)
+	}
+	if request.Status == "COMPLETED" {
+		t.Fatalf("WaitForCompletion() = %+v", request)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.WaitForCompletion(cancelled, created.ID); !errors.Is(err, context.Canceled) {
+		t.Fatalf("WaitForCompletion() with a cancelled context error = %v", err)
+	}
+
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		vr, err := models.GetByID(ctx, created.ID)
+		if err == nil {
+			vr.Status = "COMPLETED"
+			vr.End = time.Now()
+			vr.Save(ctx)
+		}
+	}()
+	waitCtx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	request, err = c.WaitForCompletion(waitCtx, created.ID)
+	if err != nil || request.Status != "COMPLETED" || request.CompletedAt == nil {
+		t.Fatalf("WaitForCompletion() = %+v, %v, want COMPLETED", request, err)
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	c, _ := newTestServer(t)
+	ctx := context.Background()
+
+	created, err := c.CreateRequest(ctx, apiv1.CreateRequest{RecipientEmail: "bob@example.com", OnBehalfOf: requestor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed, err := models.GetByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	completed.Finish("COMPLETED", "")
+	if err := completed.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		call   func(*client.Client) error
+		status int
+		code   string
+	}{
+		{"unknown request", func(c *client.Client) error {
+			_, err := c.GetRequest(ctx, "no-such-request")
+			return err
+		}, http.StatusNotFound, "not_found"},
+		{"missing on_behalf_of", func(c *client.Client) error {
+			_, err := c.CreateRequest(ctx, apiv1.CreateRequest{RecipientEmail: "bob@example.com"})
+			return err
+		}, http.StatusBadRequest, "bad_request"},
+		{"on_behalf_of outside the allowed delegators", func(c *client.Client) error {
+			_, err := c.CreateRequest(ctx, apiv1.CreateRequest{RecipientEmail: "bob@example.com", OnBehalfOf: "mallory@example.org"})
+			return err
+		}, http.StatusForbidden, "forbidden"},
+		{"listing outside the allowed delegators", func(c *client.Client) error {
+			_, err := c.ListRequests(ctx, client.ListOptions{OnBehalfOf: "mallory@example.org"})
+			return err
+		}, http.StatusForbidden, "forbidden"},
+		{"invalid API key", func(c *client.Client) error {
+			_, err := client.New(c.BaseURL, "vf_invalid").ListRequests(ctx, client.ListOptions{OnBehalfOf: requestor})
+			return err
+		}, http.StatusUnauthorized, "unauthorized"},
+		{"cancel completed request", func(c *client.Client) error {
+			_, err := c.CancelRequest(ctx, created.ID)
+			return err
+		}, http.StatusConflict, "conflict"},
+		{"resend completed request", func(c *client.Client) error {
+			_, err := c.ResendRequest(ctx, created.ID)
+			return err
+		}, http.StatusConflict, "conflict"},
+	}
+
+	for _, tt := range tests {
+		err := tt.call(c)
+		var apiErr *client.Error
+		if !errors.As(err, &apiErr) {
+			t.Errorf("%s: error = %v, want a *client.Error", tt.name, err)
+			continue
+		}
+		if apiErr.StatusCode != tt.status || apiErr.Code != tt.code || apiErr.Message == "" {
+			t.Errorf("%s: error = %+v, want %d %s", tt.name, apiErr, tt.status, tt.code)
+		}
+	}
+}
+
+// Responses without the envelope, like from a proxy, still become an *Error
+func TestErrorWithoutEnvelope(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<html>bad gateway</html>", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	_, err := client.New(server.URL, "token").GetRequest(context.Background(), "id")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.Code != "internal" {
+		t.Errorf("error = %v, want a 502 *client.Error", err)
+	}
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vdparikh/veriflow/apiv1"
+	"github.com/vdparikh/veriflow/utils"
+)
+
+// DefaultWebhookTolerance is how old a delivery can be before ParseWebhook
+// rejects it as a replay
+const DefaultWebhookTolerance = 5 * time.Minute
+
+var (
+	ErrMissingSignature = errors.New("veriflow: webhook is not signed")
+	ErrInvalidSignature = errors.New("veriflow: invalid webhook signature")
+	ErrStaleWebhook     = errors.New("veriflow: webhook timestamp is too old")
+)
+
+// VerifyWebhook checks the X-Veriflow-Signature of a delivery against the
+// secret of the subscription. Deliveries whose X-Veriflow-Timestamp is further
+// than tolerance from now are rejected, a tolerance of 0 skips that check.
+func VerifyWebhook(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	signature := header.Get("X-Veriflow-Signature")
+	timestamp := header.Get("X-Veriflow-Timestamp")
+	if signature == "" || timestamp == "" {
+		return ErrMissingSignature
+	}
+
+	expected := utils.SignPayload(secret, timestamp, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 {
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		age := time.Since(time.Unix(seconds, 0))
+		if age > tolerance || age < -tolerance {
+			return ErrStaleWebhook
+		}
+	}
+
+	return nil
+}
+
+// ParseWebhook reads and verifies a delivery and returns its event, use it in
+// the handler of the subscription URL
+func ParseWebhook(r *http.Request, secret string) (apiv1.Event, error) {
+	var event apiv1.Event
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return event, err
+	}
+	if err := VerifyWebhook(secret, r.Header, body, DefaultWebhookTolerance); err != nil {
+		return event, err
+	}
+
+	err = json.Unmarshal(body, &event)
+	return event, err
+}
@@ -0,0 +1,84 @@
+package client_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/vdparikh/veriflow/client"
+	"github.com/vdparikh/veriflow/utils"
+)
+
+const (
+	webhookSecret = "whsec_test"
+	webhookBody   = `{"id":"evt_1","type":"request.completed","time":"2026-10-19T10:00:00Z","request":{"id":"r1","status":"COMPLETED"}}`
+)
+
+func signedHeader(secret string, at time.Time, body string) http.Header {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	header := http.Header{}
+	header.Set("X-Veriflow-Timestamp", timestamp)
+	header.Set("X-Veriflow-Signature", utils.SignPayload(secret, timestamp, []byte(body)))
+	return header
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		header http.Header
+		body   string
+		want   error
+	}{
+		{"good signature", signedHeader(webhookSecret, now, webhookBody), webhookBody, nil},
+		{"other secret", signedHeader("whsec_other", now, webhookBody), webhookBody, client.ErrInvalidSignature},
+		{"tampered body", signedHeader(webhookSecret, now, webhookBody), webhookBody + " ", client.ErrInvalidSignature},
+		{"stale timestamp", signedHeader(webhookSecret, now.Add(-10*time.Minute), webhookBody), webhookBody, client.ErrStaleWebhook},
+		{"timestamp from the future", signedHeader(webhookSecret, now.Add(10*time.Minute), webhookBody), webhookBody, client.ErrStaleWebhook},
+		{"unsigned", http.Header{}, webhookBody, client.ErrMissingSignature},
+	}
+
+	for _, tt := range tests {
+		err := client.VerifyWebhook(webhookSecret, tt.header, []byte(tt.body), client.DefaultWebhookTolerance)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: VerifyWebhook() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// The signature covers the timestamp, moving it forward breaks the signature
+	header := signedHeader(webhookSecret, now.Add(-10*time.Minute), webhookBody)
+	header.Set("X-Veriflow-Timestamp", strconv.FormatInt(now.Unix(), 10))
+	if err := client.VerifyWebhook(webhookSecret, header, []byte(webhookBody), client.DefaultWebhookTolerance); !errors.Is(err, client.ErrInvalidSignature) {
+		t.Errorf("replayed with a new timestamp: VerifyWebhook() error = %v, want ErrInvalidSignature", err)
+	}
+
+	// A tolerance of 0 accepts old deliveries
+	old := signedHeader(webhookSecret, now.Add(-time.Hour), webhookBody)
+	if err := client.VerifyWebhook(webhookSecret, old, []byte(webhookBody), 0); err != nil {
+		t.Errorf("VerifyWebhook() without tolerance error = %v", err)
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/hooks/veriflow", bytes.NewBufferString(webhookBody))
+	for name, values := range signedHeader(webhookSecret, time.Now(), webhookBody) {
+		r.Header[name] = values
+	}
+
+	event, err := client.ParseWebhook(r, webhookSecret)
+	if err != nil {
+		t.Fatalf("ParseWebhook() error = %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != "request.completed" || event.Request == nil || event.Request.Status != "COMPLETED" {
+		t.Errorf("ParseWebhook() = %+v", event)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/hooks/veriflow", bytes.NewBufferString(webhookBody))
+	if _, err := client.ParseWebhook(r, webhookSecret); !errors.Is(err, client.ErrMissingSignature) {
+		t.Errorf("ParseWebhook() of an unsigned delivery error = %v", err)
+	}
+}
@@ -1,29 +1,96 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	ginadapter "github.com/awslabs/aws-lambda-go-api-proxy/gin"
+	"github.com/vdparikh/veriflow/models"
 	"github.com/vdparikh/veriflow/veriflow"
 )
 
 func main() {
 	app := veriflow.New()
 
+	// Saves the requests stored before RecipientIndex, the audit entries
+	// recorded before AuditDayIndex and the notifications queued before
+	// OutboxDueIndex so the indexes cover them
+	if len(os.Args) > 1 && os.Args[1] == "backfill-index-keys" {
+		updated, err := models.BackfillIndexKeys(context.Background())
+		if err != nil {
+			app.Logger.Fatalf("Backfill failed after %d requests: %s", updated, err.Error())
+		}
+		app.Logger.Infof("Backfilled %d requests", updated)
+
+		updated, err = models.BackfillAuditDays(context.Background())
+		if err != nil {
+			app.Logger.Fatalf("Backfill failed after %d audit entries: %s", updated, err.Error())
+		}
+		app.Logger.Infof("Backfilled %d audit entries", updated)
+
+		updated, err = models.BackfillOutboxDue(context.Background())
+		if err != nil {
+			app.Logger.Fatalf("Backfill failed after %d outbox messages: %s", updated, err.Error())
+		}
+		app.Logger.Infof("Backfilled %d outbox messages", updated)
+		return
+	}
+
 	app.Logger.Info("Starting...")
 
 	router := app.SetupRouter()
 
 	// If running in AWS Lambda
 	if lambdaRunningMode() {
+		// Lambda freezes between invocations, jobs have to come from an SQS event source
+		if app.Cfg.Queue.Provider != "sqs" {
+			app.Logger.Warn("Verification jobs may be lost, use the sqs queue provider in Lambda")
+			go app.StartVerificationWorker(context.Background())
+		}
+
 		ginLambda := ginadapter.New(router)
-		lambda.Start(func(req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-			return ginLambda.Proxy(req)
+		lambda.Start(func(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+			defer app.FlushTracing(ctx)
+			// Audit entries of the invocation are sent before Lambda freezes
+			defer func() {
+				if err := app.SIEM.Flush(ctx); err != nil {
+					app.Logger.Warn(err.Error())
+				}
+			}()
+
+			var sqsEvent events.SQSEvent
+			if err := json.Unmarshal(payload, &sqsEvent); err == nil && len(sqsEvent.Records) > 0 && sqsEvent.Records[0].EventSource == "aws:sqs" {
+				// Webhooks of the events of the jobs are sent before Lambda freezes
+				defer app.Webhooks.Wait()
+				return app.HandleSQSEvent(ctx, sqsEvent), nil
+			}
+
+			// The schedule retries the notifications, webhooks and audit entries
+			// that couldn't be delivered
+			var scheduledEvent events.CloudWatchEvent
+			if err := json.Unmarshal(payload, &scheduledEvent); err == nil && scheduledEvent.Source == "aws.events" {
+				defer app.Webhooks.Wait()
+				return nil, errors.Join(app.Svc.DispatchOutbox(ctx), app.Webhooks.DispatchPending(ctx), app.SIEM.CatchUp(ctx))
+			}
+
+			var req events.APIGatewayProxyRequest
+			if err := json.Unmarshal(payload, &req); err != nil {
+				return nil, err
+			}
+			return ginLambda.ProxyWithContext(ctx, req)
 		})
 	} else {
+		go app.StartVerificationWorker(context.Background())
+		go app.Svc.StartOutboxDispatcher(context.Background())
+		go app.Webhooks.StartDispatcher(context.Background())
+		go app.SIEM.StartCatchUp(context.Background(), time.Minute)
+
 		// Start Local
 		http.ListenAndServe(":8080", router)
 	}
@@ -1,23 +1,41 @@
 package communication
 
 import (
+	"context"
 	"log"
+	"net/http"
 	"os"
 
 	"github.com/slack-go/slack"
 	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/metrics"
 	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/tracing"
 )
 
 // This allows Veriflow messages to various communication tools
-// Right now it only allows Slack and Email
+// Right now it only allows Slack and Email, users without Slack are reached by email
 
 type Communicator interface {
-	GetUserInfo(userID string) (models.User, error)
-	SendInitConfirmation(request *models.VerifyRequest) error
-	SendVerificationMessage(request *models.VerifyRequest) error
-	SendCompletionMessage(request *models.VerifyRequest) error
-	SendFailedVerificationMessage(request *models.VerifyRequest) error
+	GetUserInfo(ctx context.Context, userID string) (models.User, error)
+	SendInitConfirmation(ctx context.Context, request *models.VerifyRequest) error
+	SendVerificationMessage(ctx context.Context, request *models.VerifyRequest) error
+	SendCompletionMessage(ctx context.Context, request *models.VerifyRequest) error
+	SendFailedVerificationMessage(ctx context.Context, request *models.VerifyRequest) error
+	SendCancellationMessage(ctx context.Context, request *models.VerifyRequest) error
+	DeleteVerificationMessage(ctx context.Context, request *models.VerifyRequest) error
+
+	// Security alerts for reported verifications
+	SendIncidentAlert(ctx context.Context, channelID string, incident *models.Incident) error
+
+	// Group verification
+	GetGroupMembers(ctx context.Context, groupID string) ([]string, error)
+	SendBatchInitConfirmation(ctx context.Context, batch *models.VerifyBatch) error
+	SendBatchSummary(ctx context.Context, batch *models.VerifyBatch) error
+
+	// Channel verification
+	GetChannelMembers(ctx context.Context, channelID string) ([]string, error)
+	SendBatchRoster(ctx context.Context, batch *models.VerifyBatch) error
 }
 
 func NewCommunicator(cfg *config.Config) Communicator {
@@ -28,13 +46,16 @@ func NewCommunicator(cfg *config.Config) Communicator {
 			slack.OptionDebug(false),
 			slack.OptionLog(log.New(os.Stdout, "api: ", log.Lshortfile|log.LstdFlags)),
 			slack.OptionAppLevelToken(cfg.Communication.Services.Slack.AppToken),
+			slack.OptionHTTPClient(&http.Client{Transport: tracing.Transport(&metrics.SlackTransport{}, "slack")}),
 		)
 
 		return &SlackService{
 			Client:   client,
-			Messages: cfg.Messages,
+			Messages: cfg.Templates,
 			BaseURL:  cfg.BaseURL,
 		}
+	case "email":
+		return &EmailCommunicator{}
 	case "ms_teams":
 		return nil
 	default:
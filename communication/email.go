@@ -0,0 +1,90 @@
+package communication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+var ErrNotSupported = errors.New("not supported over email")
+
+// EmailCommunicator reaches users who aren't on the communication tool, e.g.
+// external vendors or new hires, by their email address. The address is the
+// ID of the user. Messages to them are sent by the email notifications of a
+// request, so the Send methods have nothing left to do.
+type EmailCommunicator struct{}
+
+// IsEmailAddress tells users identified by their email address from users of the communication tool
+func IsEmailAddress(userID string) bool {
+	return strings.Contains(userID, "@")
+}
+
+func (e *EmailCommunicator) GetUserInfo(ctx context.Context, userID string) (models.User, error) {
+	address, err := mail.ParseAddress(userID)
+	if err != nil {
+		return models.User{}, fmt.Errorf("invalid email address %s", userID)
+	}
+
+	user, _ := models.GetUser(ctx, address.Address)
+	if user.ID != "" {
+		return user, nil
+	}
+
+	name := address.Name
+	if name == "" {
+		name = address.Address[:strings.LastIndex(address.Address, "@")]
+	}
+	return models.User{ID: address.Address, Name: name, Email: address.Address}, nil
+}
+
+func (e *EmailCommunicator) SendInitConfirmation(ctx context.Context, request *models.VerifyRequest) error {
+	return nil
+}
+
+func (e *EmailCommunicator) SendVerificationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	return nil
+}
+
+func (e *EmailCommunicator) SendCompletionMessage(ctx context.Context, request *models.VerifyRequest) error {
+	return nil
+}
+
+func (e *EmailCommunicator) SendFailedVerificationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	return nil
+}
+
+func (e *EmailCommunicator) SendCancellationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	return nil
+}
+
+func (e *EmailCommunicator) DeleteVerificationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	return nil
+}
+
+func (e *EmailCommunicator) SendIncidentAlert(ctx context.Context, channelID string, incident *models.Incident) error {
+	return ErrNotSupported
+}
+
+func (e *EmailCommunicator) GetGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	return nil, ErrNotSupported
+}
+
+func (e *EmailCommunicator) SendBatchInitConfirmation(ctx context.Context, batch *models.VerifyBatch) error {
+	return ErrNotSupported
+}
+
+func (e *EmailCommunicator) SendBatchSummary(ctx context.Context, batch *models.VerifyBatch) error {
+	return ErrNotSupported
+}
+
+func (e *EmailCommunicator) GetChannelMembers(ctx context.Context, channelID string) ([]string, error) {
+	return nil, ErrNotSupported
+}
+
+func (e *EmailCommunicator) SendBatchRoster(ctx context.Context, batch *models.VerifyBatch) error {
+	return ErrNotSupported
+}
@@ -1,6 +1,7 @@
 package communication
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -13,12 +14,12 @@ import (
 
 type SlackService struct {
 	Client   *slack.Client
-	Messages config.Messages
+	Messages *config.MessageTemplates
 	BaseURL  string
 }
 
-func (s *SlackService) getChannelID(userIDs ...string) string {
-	channel, _, _, err := s.Client.OpenConversation(&slack.OpenConversationParameters{
+func (s *SlackService) getChannelID(ctx context.Context, userIDs ...string) string {
+	channel, _, _, err := s.Client.OpenConversationContext(ctx, &slack.OpenConversationParameters{
 		Users: userIDs,
 	})
 
@@ -29,24 +30,32 @@ func (s *SlackService) getChannelID(userIDs ...string) string {
 	return channel.ID
 }
 
-func (s *SlackService) GetUserInfo(userID string) (models.User, error) {
-	user, err := s.Client.GetUserInfo(userID)
+func (s *SlackService) GetUserInfo(ctx context.Context, userID string) (models.User, error) {
+	user, err := s.Client.GetUserInfoContext(ctx, userID)
 	if err != nil {
 		return models.User{}, err
 	}
 
 	return models.User{
-		ID:    user.ID,
-		Name:  user.Profile.RealName,
-		Email: user.Profile.Email,
-		Image: user.Profile.Image192,
+		ID:     user.ID,
+		Name:   user.Profile.RealName,
+		Email:  user.Profile.Email,
+		Image:  user.Profile.Image192,
+		Locale: user.Locale,
 	}, nil
 }
 
-func (s *SlackService) SendVerificationMessage(request *models.VerifyRequest) error {
-	text := fmt.Sprintf(s.Messages.VerificationMessage, request.Recipient.Name, request.Requestor.Name)
+func (s *SlackService) SendVerificationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	if request.RecipientChannel == models.ChannelEmail {
+		return nil
+	}
+
+	text, err := s.Messages.Execute(request.Recipient.MessageLocale(), config.VerificationMessage, config.NewMessageData(request))
+	if err != nil {
+		return err
+	}
 
-	channelID := s.getChannelID(request.Recipient.ID)
+	channelID := s.getChannelID(ctx, request.Recipient.ID)
 	if channelID == "" {
 		return errors.New("failed to create channel")
 	}
@@ -57,16 +66,22 @@ func (s *SlackService) SendVerificationMessage(request *models.VerifyRequest) er
 	reportButtonTxt := slack.NewTextBlockObject("plain_text", "Report Issue", false, false)
 	reportButton := slack.NewButtonBlockElement("report_issue", request.ID, reportButtonTxt).WithStyle(slack.StyleDanger).WithURL(request.ReportLink) // URL button for reporting
 
-	var err error
-	request.Slack.Channel, request.Slack.MessageTS, err = s.sendMessage(channelID, request.Status, "Request for Verification", text, request.Requestor.Image, authButton, reportButton)
+	request.Slack.Channel, request.Slack.MessageTS, err = s.sendMessage(ctx, channelID, request.Status, "Request for Verification", text, request.Requestor.Image, authButton, reportButton)
 
 	return err
 }
 
-func (s *SlackService) SendInitConfirmation(request *models.VerifyRequest) error {
-	text := fmt.Sprintf(s.Messages.RequestConfirmationMessage, request.Requestor.Name, request.Recipient.Name, time.Now().Format("2006-01-02 03:04 PM"))
+func (s *SlackService) SendInitConfirmation(ctx context.Context, request *models.VerifyRequest) error {
+	if request.RequestorChannel == models.ChannelEmail {
+		return nil
+	}
 
-	channelID := s.getChannelID(request.Requestor.ID)
+	text, err := s.Messages.Execute(request.Requestor.MessageLocale(), config.RequestConfirmationMessage, config.NewMessageData(request))
+	if err != nil {
+		return err
+	}
+
+	channelID := s.getChannelID(ctx, request.Requestor.ID)
 	if channelID == "" {
 		return errors.New("failed to create channel")
 	}
@@ -74,24 +89,35 @@ func (s *SlackService) SendInitConfirmation(request *models.VerifyRequest) error
 	authButtonTxt := slack.NewTextBlockObject("plain_text", "Request Status", false, false)
 	statusButton := slack.NewButtonBlockElement("authenticate", request.ID, authButtonTxt).WithStyle(slack.StylePrimary).WithURL(request.StatusLink) // URL button for authentication
 
-	var err error
-	request.Slack.InitChannel, request.Slack.InitMessageTS, err = s.sendMessage(channelID, request.Status, "Verification Request Initiated", text, request.Recipient.Image, statusButton)
+	request.Slack.InitChannel, request.Slack.InitMessageTS, err = s.sendMessage(ctx, channelID, request.Status, "Verification Request Initiated", text, request.Recipient.Image, statusButton)
 	return err
 }
 
 // TODO: The message needs to go to the same CHANNEL where the message was initiated
-func (s *SlackService) SendCompletionMessage(request *models.VerifyRequest) error {
+func (s *SlackService) SendCompletionMessage(ctx context.Context, request *models.VerifyRequest) error {
 
 	authButtonTxt := slack.NewTextBlockObject("plain_text", "Request Status", false, false)
 	statusButton := slack.NewButtonBlockElement("authenticate", request.ID, authButtonTxt).WithStyle(slack.StylePrimary).WithURL(request.StatusLink) // URL button for authentication
 
-	text := fmt.Sprintf(s.Messages.RequestorCompletionMessage, request.Requestor.Name, request.Recipient.Name, time.Now().Format("2006-01-02 03:04 PM"))
-	channelID := s.getChannelID(request.Requestor.ID)
-	s.sendMessage(channelID, request.Status, "Verification Completed", text, request.Recipient.Image, statusButton)
+	var ch, ts, text string
+	var err error
 
-	text = fmt.Sprintf(s.Messages.RecipientCompletionMessage, request.Recipient.Name, request.Requestor.Name, time.Now().Format("2006-01-02 03:04 PM"))
-	channelID = s.getChannelID(request.Recipient.ID)
-	ch, ts, err := s.sendMessage(channelID, request.Status, "Thank you! Verification Completed", text, request.Requestor.Image, statusButton)
+	// Requestors of a batch get a single summary instead
+	if request.BatchID == "" && request.RequestorChannel != models.ChannelEmail {
+		if text, err = s.Messages.Execute(request.Requestor.MessageLocale(), config.RequestorCompletionMessage, config.NewMessageData(request)); err != nil {
+			return err
+		}
+		channelID := s.getChannelID(ctx, request.Requestor.ID)
+		ch, ts, err = s.sendMessage(ctx, channelID, request.Status, "Verification Completed", text, request.Recipient.Image, statusButton)
+	}
+
+	if request.RecipientChannel != models.ChannelEmail {
+		if text, err = s.Messages.Execute(request.Recipient.MessageLocale(), config.RecipientCompletionMessage, config.NewMessageData(request)); err != nil {
+			return err
+		}
+		channelID := s.getChannelID(ctx, request.Recipient.ID)
+		ch, ts, err = s.sendMessage(ctx, channelID, request.Status, "Thank you! Verification Completed", text, request.Requestor.Image, statusButton)
+	}
 
 	// Decide if we want to send message to both parties induvidually or seperate?
 	// text := fmt.Sprintf(s.Messages.RequestorCompletionMessage, request.Requestor.Name, request.Recipient.Name, time.Now().Format("2006-01-02 03:04 PM"))
@@ -102,10 +128,10 @@ func (s *SlackService) SendCompletionMessage(request *models.VerifyRequest) erro
 
 	// ch, ts, err := s.sendMessage(channelID, request.Status, "Thank you! Verification Completed", text, "")
 
-	s.Client.DeleteMessage(request.Slack.Channel, request.Slack.MessageTS)
-	s.Client.DeleteMessage(request.Slack.InitChannel, request.Slack.InitMessageTS)
+	s.Client.DeleteMessageContext(ctx, request.Slack.Channel, request.Slack.MessageTS)
+	s.Client.DeleteMessageContext(ctx, request.Slack.InitChannel, request.Slack.InitMessageTS)
 
-	request.Permalink, _ = s.Client.GetPermalink(&slack.PermalinkParameters{
+	request.Permalink, _ = s.Client.GetPermalinkContext(ctx, &slack.PermalinkParameters{
 		Channel: ch,
 		Ts:      ts,
 	})
@@ -113,25 +139,69 @@ func (s *SlackService) SendCompletionMessage(request *models.VerifyRequest) erro
 	return err
 }
 
-func (s *SlackService) SendFailedVerificationMessage(request *models.VerifyRequest) error {
-	text := fmt.Sprintf(s.Messages.RequestorVerificationFailureMessage, request.Requestor.Name, request.Recipient.Name, time.Now().Format("2006-01-02 03:04 PM"), request.Error)
+func (s *SlackService) SendFailedVerificationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	var ch, ts, text string
+	var err error
 
-	channelID := s.getChannelID(request.Requestor.ID)
-	if channelID == "" {
-		return errors.New("failed to create channel")
+	// Requestors of a batch get a single summary instead
+	if request.BatchID == "" && request.RequestorChannel != models.ChannelEmail {
+		if text, err = s.Messages.Execute(request.Requestor.MessageLocale(), config.RequestorVerificationFailureMessage, config.NewMessageData(request)); err != nil {
+			return err
+		}
+
+		channelID := s.getChannelID(ctx, request.Requestor.ID)
+		if channelID == "" {
+			return errors.New("failed to create channel")
+		}
+
+		ch, ts, err = s.sendMessage(ctx, channelID, request.Status, "Verification Failed", text, request.Recipient.Image)
 	}
 
-	ch, ts, err := s.sendMessage(channelID, request.Status, "Verification Failed", text, request.Recipient.Image)
+	if request.RecipientChannel != models.ChannelEmail {
+		if text, err = s.Messages.Execute(request.Recipient.MessageLocale(), config.RecipientVerificationFailureMessage, config.NewMessageData(request)); err != nil {
+			return err
+		}
+
+		channelID := s.getChannelID(ctx, request.Recipient.ID)
+		rch, rts, rerr := s.sendMessage(ctx, channelID, request.Status, "Verification Failed", text, request.Requestor.Image)
+		if request.BatchID != "" || request.RequestorChannel == models.ChannelEmail {
+			ch, ts, err = rch, rts, rerr
+		}
+	}
+
+	s.Client.DeleteMessageContext(ctx, request.Slack.Channel, request.Slack.MessageTS)
+	s.Client.DeleteMessageContext(ctx, request.Slack.InitChannel, request.Slack.InitMessageTS)
+
+	request.Permalink, _ = s.Client.GetPermalinkContext(ctx, &slack.PermalinkParameters{
+		Channel: ch,
+		Ts:      ts,
+	})
+
+	return err
+}
 
-	text = fmt.Sprintf(s.Messages.RecipientVerificationFailureMessage, request.Recipient.Name, request.Requestor.Name, time.Now().Format("2006-01-02 03:04 PM"), request.Error)
+// SendCancellationMessage removes the pending messages of a request and lets the recipient know it was withdrawn
+func (s *SlackService) SendCancellationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	s.Client.DeleteMessageContext(ctx, request.Slack.Channel, request.Slack.MessageTS)
+	s.Client.DeleteMessageContext(ctx, request.Slack.InitChannel, request.Slack.InitMessageTS)
 
-	channelID = s.getChannelID(request.Recipient.ID)
-	s.sendMessage(channelID, request.Status, "Verification Failed", text, request.Requestor.Image)
+	if request.RecipientChannel == models.ChannelEmail {
+		return nil
+	}
 
-	s.Client.DeleteMessage(request.Slack.Channel, request.Slack.MessageTS)
-	s.Client.DeleteMessage(request.Slack.InitChannel, request.Slack.InitMessageTS)
+	text, err := s.Messages.Execute(request.Recipient.MessageLocale(), config.CancellationMessage, config.NewMessageData(request))
+	if err != nil {
+		return err
+	}
 
-	request.Permalink, _ = s.Client.GetPermalink(&slack.PermalinkParameters{
+	channelID := s.getChannelID(ctx, request.Recipient.ID)
+	if channelID == "" {
+		return errors.New("failed to create channel")
+	}
+
+	ch, ts, err := s.sendMessage(ctx, channelID, request.Status, "Verification Cancelled", text, request.Requestor.Image)
+
+	request.Permalink, _ = s.Client.GetPermalinkContext(ctx, &slack.PermalinkParameters{
 		Channel: ch,
 		Ts:      ts,
 	})
@@ -139,7 +209,193 @@ func (s *SlackService) SendFailedVerificationMessage(request *models.VerifyReque
 	return err
 }
 
-func (s *SlackService) sendMessage(channelID, status, header, text, imageURL string, buttons ...*slack.ButtonBlockElement) (string, string, error) {
+// DeleteVerificationMessage removes the verification message sent to the recipient, used before resending it
+func (s *SlackService) DeleteVerificationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	if request.Slack.MessageTS == "" {
+		return nil
+	}
+
+	_, _, err := s.Client.DeleteMessageContext(ctx, request.Slack.Channel, request.Slack.MessageTS)
+	if err != nil {
+		return err
+	}
+
+	request.Slack.Channel, request.Slack.MessageTS = "", ""
+	return nil
+}
+
+func (s *SlackService) SendIncidentAlert(ctx context.Context, channelID string, incident *models.Incident) error {
+	text := fmt.Sprintf("*%s* reported the verification requested by *%s* (%s) for *%s* (%s).\nReason: `%s`",
+		incident.ReportedBy, incident.Requestor.Name, incident.Requestor.Email, incident.Recipient.Name, incident.Recipient.Email, incident.Reason)
+
+	for role, ip := range incident.IPs {
+		text += fmt.Sprintf("\n• %s IP: `%s`", role, ip)
+	}
+
+	statusButtonTxt := slack.NewTextBlockObject("plain_text", "Request Status", false, false)
+	statusButton := slack.NewButtonBlockElement("incident_status", incident.RequestID, statusButtonTxt).WithStyle(slack.StyleDanger).WithURL(incident.StatusLink)
+
+	_, _, err := s.sendMessage(ctx, channelID, "REPORTED", "Verification Reported", text, incident.Requestor.Image, statusButton)
+	return err
+}
+
+func (s *SlackService) GetGroupMembers(ctx context.Context, groupID string) ([]string, error) {
+	return s.Client.GetUserGroupMembersContext(ctx, groupID)
+}
+
+func (s *SlackService) SendBatchInitConfirmation(ctx context.Context, batch *models.VerifyBatch) error {
+	data := config.MessageData{Requestor: batch.Requestor, Time: time.Now().Format("2006-01-02 03:04 PM"), Recipients: len(batch.RequestIDs)}
+	text, err := s.Messages.Execute(batch.Requestor.MessageLocale(), config.BatchConfirmationMessage, data)
+	if err != nil {
+		return err
+	}
+
+	channelID := s.getChannelID(ctx, batch.Requestor.ID)
+	if channelID == "" {
+		return errors.New("failed to create channel")
+	}
+
+	statusButtonTxt := slack.NewTextBlockObject("plain_text", "Batch Status", false, false)
+	statusButton := slack.NewButtonBlockElement("batch_status", batch.ID, statusButtonTxt).WithStyle(slack.StylePrimary).WithURL(batch.StatusLink)
+
+	batch.Slack.InitChannel, batch.Slack.InitMessageTS, err = s.sendMessage(ctx, channelID, batch.Status, "Group Verification Initiated", text, batch.Requestor.Image, statusButton)
+	return err
+}
+
+func (s *SlackService) SendBatchSummary(ctx context.Context, batch *models.VerifyBatch) error {
+	counts := batch.Counts()
+	data := config.MessageData{Requestor: batch.Requestor, Time: time.Now().Format("2006-01-02 03:04 PM"), Completed: counts.Completed, Failed: counts.Failed, Pending: counts.Pending}
+	text, err := s.Messages.Execute(batch.Requestor.MessageLocale(), config.BatchSummaryMessage, data)
+	if err != nil {
+		return err
+	}
+
+	for _, vr := range batch.Requests {
+		line := fmt.Sprintf("\n• *%s* - `%s`", vr.Recipient.Name, vr.Status)
+		if vr.Error != "" {
+			line += fmt.Sprintf(" %s", vr.Error)
+		}
+		text += line
+	}
+
+	channelID := s.getChannelID(ctx, batch.Requestor.ID)
+	if channelID == "" {
+		return errors.New("failed to create channel")
+	}
+
+	statusButtonTxt := slack.NewTextBlockObject("plain_text", "Batch Status", false, false)
+	statusButton := slack.NewButtonBlockElement("batch_status", batch.ID, statusButtonTxt).WithStyle(slack.StylePrimary).WithURL(batch.StatusLink)
+
+	header := "Group Verification Completed"
+	if counts.Failed > 0 {
+		header = "Group Verification Failed"
+	}
+
+	_, _, err = s.sendMessage(ctx, channelID, batch.Status, header, text, "", statusButton)
+
+	s.Client.DeleteMessageContext(ctx, batch.Slack.InitChannel, batch.Slack.InitMessageTS)
+
+	return err
+}
+
+// GetChannelMembers returns the human members of a channel, bots and deactivated users are left out
+func (s *SlackService) GetChannelMembers(ctx context.Context, channelID string) ([]string, error) {
+	var memberIDs []string
+	params := &slack.GetUsersInConversationParameters{ChannelID: channelID, Limit: 200}
+	for {
+		ids, cursor, err := s.Client.GetUsersInConversationContext(ctx, params)
+		if err != nil {
+			return nil, err
+		}
+		memberIDs = append(memberIDs, ids...)
+		if cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+
+	var members []string
+	for start := 0; start < len(memberIDs); start += 30 {
+		end := start + 30
+		if end > len(memberIDs) {
+			end = len(memberIDs)
+		}
+
+		users, err := s.Client.GetUsersInfoContext(ctx, memberIDs[start:end]...)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range *users {
+			if user.IsBot || user.Deleted || user.ID == "USLACKBOT" {
+				continue
+			}
+			members = append(members, user.ID)
+		}
+	}
+
+	return members, nil
+}
+
+// rosterSectionLength keeps the sections of a roster under the 3000
+// characters Slack allows in the text of a section block
+const rosterSectionLength = 2900
+
+// SendBatchRoster posts the verification status of every member to the channel
+// of a channel verification, or updates the roster when it was already posted
+func (s *SlackService) SendBatchRoster(ctx context.Context, batch *models.VerifyBatch) error {
+	msgOptions := slack.MsgOptionBlocks(rosterBlocks(batch)...)
+
+	if batch.Slack.MessageTS != "" {
+		_, _, _, err := s.Client.UpdateMessageContext(ctx, batch.Slack.Channel, batch.Slack.MessageTS, msgOptions)
+		return err
+	}
+
+	var err error
+	batch.Slack.Channel, batch.Slack.MessageTS, err = s.Client.PostMessageContext(ctx, batch.Slack.Channel, msgOptions)
+	return err
+}
+
+// rosterBlocks lists the members in as many sections as their lines need
+func rosterBlocks(batch *models.VerifyBatch) []slack.Block {
+	counts := batch.Counts()
+	lines := []string{fmt.Sprintf("<@%s> asked everyone in this channel to verify. *%d* completed, *%d* failed and *%d* pending.\n", batch.Requestor.ID, counts.Completed, counts.Failed, counts.Pending)}
+
+	for _, vr := range batch.Requests {
+		icon := ":hourglass_flowing_sand:"
+		switch vr.Status {
+		case "COMPLETED":
+			icon = ":white_check_mark:"
+		case "FAILED":
+			icon = ":x:"
+		case "CANCELLED":
+			icon = ":no_entry_sign:"
+		}
+		lines = append(lines, fmt.Sprintf("%s <@%s> `%s`", icon, vr.Slack.RecipientID, vr.Status))
+	}
+
+	for _, id := range batch.SkippedIDs {
+		lines = append(lines, fmt.Sprintf(":ballot_box_with_check: <@%s> `VERIFIED RECENTLY`", id))
+	}
+
+	blocks := []slack.Block{slack.NewHeaderBlock(slack.NewTextBlockObject("plain_text", "Channel Verification", false, false))}
+	var text string
+	for _, line := range lines {
+		if text != "" && len(text)+len(line)+1 > rosterSectionLength {
+			blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil))
+			text = ""
+		}
+		if text != "" {
+			text += "\n"
+		}
+		text += line
+	}
+	blocks = append(blocks, slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil))
+
+	footerText := slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*Powered by Veriflow* | %s | Updated %s", batch.Status, time.Now().Format("2006-01-02 03:04 PM")), false, false)
+	return append(blocks, slack.NewContextBlock("", footerText))
+}
+
+func (s *SlackService) sendMessage(ctx context.Context, channelID, status, header, text, imageURL string, buttons ...*slack.ButtonBlockElement) (string, string, error) {
 	headerText := slack.NewTextBlockObject("plain_text", header, false, false)
 	headerSection := slack.NewHeaderBlock(headerText)
 
@@ -168,7 +424,7 @@ func (s *SlackService) sendMessage(channelID, status, header, text, imageURL str
 		msgOptions = slack.MsgOptionBlocks(headerSection, sectionBlock, footerBlock)
 	}
 
-	channel, ts, err := s.Client.PostMessage(channelID, msgOptions)
+	channel, ts, err := s.Client.PostMessageContext(ctx, channelID, msgOptions)
 
 	return channel, ts, err
 }
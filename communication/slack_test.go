@@ -0,0 +1,45 @@
+package communication
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/slack-go/slack"
+	"github.com/vdparikh/veriflow/models"
+)
+
+func TestRosterBlocks(t *testing.T) {
+	batch := &models.VerifyBatch{Status: "SENT", Requestor: models.User{ID: "U0"}}
+	for i := 0; i < 100; i++ {
+		batch.Requests = append(batch.Requests, models.VerifyRequest{Status: "CANCELLED", Slack: models.SlackRequest{RecipientID: fmt.Sprintf("U%010d", i)}})
+		batch.SkippedIDs = append(batch.SkippedIDs, fmt.Sprintf("W%010d", i))
+	}
+
+	blocks := rosterBlocks(batch)
+	if len(blocks) > 50 {
+		t.Fatalf("%d blocks, Slack allows 50", len(blocks))
+	}
+
+	var roster []string
+	for _, block := range blocks {
+		section, ok := block.(*slack.SectionBlock)
+		if !ok {
+			continue
+		}
+		if len(section.Text.Text) > 3000 {
+			t.Errorf("section of %d characters, Slack allows 3000", len(section.Text.Text))
+		}
+		roster = append(roster, strings.Split(section.Text.Text, "\n")...)
+	}
+
+	// The summary line, an empty line after it and every member once
+	if len(roster) != 202 {
+		t.Fatalf("roster has %d lines, want 202", len(roster))
+	}
+	for i, vr := range batch.Requests {
+		if !strings.Contains(roster[i+2], vr.Slack.RecipientID) {
+			t.Errorf("line %d = %q, want %s", i+2, roster[i+2], vr.Slack.RecipientID)
+		}
+	}
+}
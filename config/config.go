@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/vdparikh/veriflow/utils"
 	"gopkg.in/yaml.v2"
@@ -32,6 +33,24 @@ type Config struct {
 		Port       int    `yaml:"port"`
 		Username   string `yaml:"username"`
 		Password   string `yaml:"password"`
+
+		TLS                string `yaml:"tls"`  // starttls, tls or none
+		Auth               string `yaml:"auth"` // plain, login, cram-md5 or none
+		TimeoutSeconds     int    `yaml:"timeout_seconds"`
+		InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+
+		FromName       string `yaml:"from_name"`
+		TemplatesDir   string `yaml:"templates_dir"`   // overrides the built-in templates with the same name
+		UnsubscribeURL string `yaml:"unsubscribe_url"` // sent as List-Unsubscribe
+
+		// Signing is enabled when a selector is set
+		DKIM struct {
+			Domain         string   `yaml:"domain"` // defaults to the domain of From
+			Selector       string   `yaml:"selector"`
+			PrivateKey     string   `yaml:"private_key"` // PEM, RSA or Ed25519
+			PrivateKeyFile string   `yaml:"private_key_file"`
+			Headers        []string `yaml:"headers"`
+		} `yaml:"dkim"`
 	} `yaml:"email"`
 
 	Auth struct {
@@ -43,28 +62,177 @@ type Config struct {
 	} `yaml:"auth"`
 
 	Report struct {
-		URL string `yaml:"url"`
+		// Generic webhook receiving every incident, signed with Secret
+		URL    string `yaml:"url"`
+		Secret string `yaml:"secret"`
+
+		Jira struct {
+			URL       string `yaml:"url"`
+			Username  string `yaml:"username"`
+			APIToken  string `yaml:"api_token"`
+			Project   string `yaml:"project"`
+			IssueType string `yaml:"issue_type"`
+		} `yaml:"jira"`
+
+		PagerDuty struct {
+			URL        string `yaml:"url"`
+			RoutingKey string `yaml:"routing_key"`
+			Severity   string `yaml:"severity"`
+		} `yaml:"pagerduty"`
+
+		// Automated responses to a report
+		Actions struct {
+			SlackChannel  string `yaml:"slack_channel"`
+			MuteRequestor bool   `yaml:"mute_requestor"`
+		} `yaml:"actions"`
 	} `yaml:"report"`
 
 	Authenticator struct {
 		Enabled bool `yaml:"enabled"`
+
+		// One-time codes mailed to recipients without TOTP or WebAuthn
+		EmailOTP struct {
+			Enabled       bool `yaml:"enabled"`
+			TTLSeconds    int  `yaml:"ttl_seconds"`
+			MaxAttempts   int  `yaml:"max_attempts"`
+			ResendSeconds int  `yaml:"resend_seconds"`
+		} `yaml:"email_otp"`
+
+		// Codes sent by SMS or call to a phone number verified at enrollment
+		SMSOTP struct {
+			Enabled          bool `yaml:"enabled"`
+			TTLSeconds       int  `yaml:"ttl_seconds"`
+			MaxAttempts      int  `yaml:"max_attempts"`
+			ResendSeconds    int  `yaml:"resend_seconds"`
+			PerNumberPerHour int  `yaml:"per_number_per_hour"`
+		} `yaml:"sms_otp"`
 	} `yaml:"authenticator"`
 
+	Telephony struct {
+		Provider   string `yaml:"provider"` // twilio or log
+		AccountSID string `yaml:"account_sid"`
+		AuthToken  string `yaml:"auth_token"`
+		From       string `yaml:"from"`     // number messages and calls come from
+		BaseURL    string `yaml:"base_url"` // any Twilio compatible API, defaults to Twilio
+	} `yaml:"telephony"`
+
+	RateLimit struct {
+		RequestorPerHour int `yaml:"requestor_per_hour"`
+		RecipientPerHour int `yaml:"recipient_per_hour"`
+	} `yaml:"rate_limit"`
+
+	Verification struct {
+		MaxBatchRecipients    int `yaml:"max_batch_recipients"`
+		MaxResends            int `yaml:"max_resends"`
+		ResendCooldownSeconds int `yaml:"resend_cooldown_seconds"`
+
+		Channel struct {
+			MaxMembers          int     `yaml:"max_members"`
+			SkipVerifiedMinutes int     `yaml:"skip_verified_minutes"`
+			RequestsPerSecond   float64 `yaml:"requests_per_second"`
+		} `yaml:"channel"`
+	} `yaml:"verification"`
+
+	// Outbound webhooks for request lifecycle events. Subscriptions listed
+	// here are combined with the ones created through the admin API.
+	Webhooks struct {
+		MaxAttempts    int                   `yaml:"max_attempts"`
+		BackoffSeconds int                   `yaml:"backoff_seconds"`
+		Subscriptions  []WebhookSubscription `yaml:"subscriptions"`
+	} `yaml:"webhooks"`
+
+	// Streams the audit trail to a SIEM over syslog
+	SIEM struct {
+		Enabled            bool   `yaml:"enabled"`
+		Address            string `yaml:"address"`
+		Transport          string `yaml:"transport"` // tcp or tls
+		Format             string `yaml:"format"`    // cef or leef
+		CAFile             string `yaml:"ca_file"`
+		InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+		Hostname           string `yaml:"hostname"`
+		BufferSize         int    `yaml:"buffer_size"`
+		RetrySeconds       int    `yaml:"retry_seconds"`
+		FlushSeconds       int    `yaml:"flush_seconds"` // how long a Lambda invocation waits for its entries to be sent
+	} `yaml:"siem"`
+
+	// OpenTelemetry traces exported over OTLP/HTTP
+	Tracing struct {
+		Enabled     bool              `yaml:"enabled"`
+		Endpoint    string            `yaml:"endpoint"`
+		Insecure    bool              `yaml:"insecure"`
+		Headers     map[string]string `yaml:"headers"`
+		ServiceName string            `yaml:"service_name"`
+		SampleRatio float64           `yaml:"sample_ratio"`
+	} `yaml:"tracing"`
+
+	// /metrics is only served to scrapers sending the token as a bearer token
+	Metrics struct {
+		Token string `yaml:"token"`
+	} `yaml:"metrics"`
+
+	// Verification jobs are queued and processed by a worker so slash commands
+	// and API calls return right away
+	Queue struct {
+		Provider          string `yaml:"provider"` // memory or sqs
+		URL               string `yaml:"url"`      // SQS queue URL
+		MaxAttempts       int    `yaml:"max_attempts"`
+		VisibilitySeconds int    `yaml:"visibility_seconds"`
+		BufferSize        int    `yaml:"buffer_size"` // memory queue only
+	} `yaml:"queue"`
+
+	// Notifications are written to an outbox with the request and sent from there
+	Outbox struct {
+		MaxAttempts     int `yaml:"max_attempts"`
+		BackoffSeconds  int `yaml:"backoff_seconds"`
+		IntervalSeconds int `yaml:"interval_seconds"`
+	} `yaml:"outbox"`
+
+	// Emails of the users allowed to use the admin API
+	Admins []string `yaml:"admins"`
+
+	// Service accounts call /api/v1 with API keys, see docs/api.md
+	ServiceAccounts struct {
+		RateLimitPerHour   int `yaml:"rate_limit_per_hour"`  // API calls per key unless set on the account
+		RotationGraceHours int `yaml:"rotation_grace_hours"` // how long the previous keys keep working after a rotation
+	} `yaml:"service_accounts"`
+
 	Messages Messages `yaml:"messages"`
+
+	// Messages in other languages by locale, e.g. de or pt-BR. Users get the
+	// locale they chose or the one of their Slack profile, missing messages
+	// fall back to the ones above.
+	Locales map[string]Messages `yaml:"locales"`
+
+	// Messages and Locales parsed and validated by LoadConfig
+	Templates *MessageTemplates `yaml:"-"`
+}
+
+type WebhookSubscription struct {
+	ID     string   `yaml:"id"`
+	URL    string   `yaml:"url"`
+	Secret string   `yaml:"secret"`
+	Events []string `yaml:"events"` // empty subscribes to every event
 }
 
+// Messages are text/template strings executed with MessageData, e.g.
+// "*Hello {{.Recipient.Name}}*". The args tag lists the values of the older
+// positional format, strings with %s instead of fields are converted on load.
 type Messages struct {
-	VerificationMessage                 string `yaml:"verification_message"`
-	RequestConfirmationMessage          string `yaml:"request_confirmation_message"`
-	RequestorCompletionMessage          string `yaml:"requestor_completion_message"`
-	RecipientCompletionMessage          string `yaml:"recipient_completion_message"`
-	RequestorVerificationFailureMessage string `yaml:"requestor_verification_failure_message"`
-	RecipientVerificationFailureMessage string `yaml:"recipient_verification_failure_message"`
+	VerificationMessage                 string `yaml:"verification_message" args:"Recipient.Name,Requestor.Name"`
+	RequestConfirmationMessage          string `yaml:"request_confirmation_message" args:"Requestor.Name,Recipient.Name,Time"`
+	RequestorCompletionMessage          string `yaml:"requestor_completion_message" args:"Requestor.Name,Recipient.Name,Time"`
+	RecipientCompletionMessage          string `yaml:"recipient_completion_message" args:"Recipient.Name,Requestor.Name,Time"`
+	RequestorVerificationFailureMessage string `yaml:"requestor_verification_failure_message" args:"Requestor.Name,Recipient.Name,Time,Error"`
+	RecipientVerificationFailureMessage string `yaml:"recipient_verification_failure_message" args:"Recipient.Name,Requestor.Name,Time,Error"`
+	CancellationMessage                 string `yaml:"cancellation_message" args:"Recipient.Name,Requestor.Name,Time"`
+	BatchConfirmationMessage            string `yaml:"batch_confirmation_message" args:"Requestor.Name,Recipients,Time"`
+	BatchSummaryMessage                 string `yaml:"batch_summary_message" args:"Requestor.Name,Time,Completed,Failed,Pending"`
+	EmailCodeMessage                    string `yaml:"email_code_message" args:"Recipient.Name,Code,Minutes"`
+	SMSCodeMessage                      string `yaml:"sms_code_message" args:"Code,Minutes"`
+	VoiceCodeMessage                    string `yaml:"voice_code_message" args:"Code"`
 }
 
 func LoadConfig() (Config, error) {
-	var config Config
-
 	var data []byte
 	var err error
 
@@ -84,13 +252,157 @@ func LoadConfig() (Config, error) {
 	}
 
 	if err != nil {
-		return config, fmt.Errorf("failed to load config: %w", err)
+		return Config{}, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	err = yaml.Unmarshal(data, &config)
+	return parseConfig(data)
+}
+
+// parseConfig reads the config and fills in the defaults
+func parseConfig(data []byte) (Config, error) {
+	var config Config
+
+	// Defaults of the settings where 0 means something are set before
+	// reading, so they only apply when the setting is missing
+	config.Authenticator.SMSOTP.PerNumberPerHour = 5
+
+	err := yaml.Unmarshal(data, &config)
 	if err != nil {
 		return config, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if config.Verification.MaxBatchRecipients == 0 {
+		config.Verification.MaxBatchRecipients = 25
+	}
+	if config.Verification.MaxResends == 0 {
+		config.Verification.MaxResends = 3
+	}
+	if config.Verification.Channel.MaxMembers == 0 {
+		config.Verification.Channel.MaxMembers = 100
+	}
+	if config.Verification.Channel.RequestsPerSecond <= 0 {
+		config.Verification.Channel.RequestsPerSecond = 1
+	}
+	// The requests of a channel are queued up front, delayed to follow the rate
+	if spread := time.Duration(float64(config.Verification.Channel.MaxMembers-1) / config.Verification.Channel.RequestsPerSecond * float64(time.Second)); spread > 15*time.Minute {
+		return config, fmt.Errorf("verification.channel: %d members at %g requests per second take %s to queue, longer than the 15 minutes a job can be delayed", config.Verification.Channel.MaxMembers, config.Verification.Channel.RequestsPerSecond, spread.Round(time.Second))
+	}
+	for _, sub := range config.Webhooks.Subscriptions {
+		if sub.Secret == "" {
+			return config, fmt.Errorf("webhooks.subscriptions: %s has no secret, every delivery is signed", sub.ID)
+		}
+	}
+	if config.Webhooks.MaxAttempts == 0 {
+		config.Webhooks.MaxAttempts = 5
+	}
+	if config.Webhooks.BackoffSeconds == 0 {
+		config.Webhooks.BackoffSeconds = 30
+	}
+	if config.Tracing.ServiceName == "" {
+		config.Tracing.ServiceName = "veriflow"
+	}
+	if config.Tracing.SampleRatio == 0 {
+		config.Tracing.SampleRatio = 1
+	}
+	if config.Queue.URL == "" {
+		config.Queue.URL = os.Getenv("VERIFLOW_QUEUE_URL")
+	}
+	if config.Queue.Provider == "" {
+		config.Queue.Provider = "memory"
+		if config.Queue.URL != "" {
+			config.Queue.Provider = "sqs"
+		}
+	}
+	if config.Queue.MaxAttempts == 0 {
+		config.Queue.MaxAttempts = 3
+	}
+	if config.Queue.VisibilitySeconds == 0 {
+		config.Queue.VisibilitySeconds = 120
+	}
+	if config.Queue.BufferSize == 0 {
+		config.Queue.BufferSize = 1000
+	}
+	if config.ServiceAccounts.RateLimitPerHour == 0 {
+		config.ServiceAccounts.RateLimitPerHour = 600
+	}
+	if config.ServiceAccounts.RotationGraceHours == 0 {
+		config.ServiceAccounts.RotationGraceHours = 24
+	}
+	if config.Email.TLS == "" {
+		config.Email.TLS = "starttls"
+	}
+	if config.Email.Port == 0 {
+		switch config.Email.TLS {
+		case "tls":
+			config.Email.Port = 465
+		case "none":
+			config.Email.Port = 25
+		default:
+			config.Email.Port = 587
+		}
+	}
+	if config.Email.Auth == "" {
+		config.Email.Auth = "none"
+		if config.Email.Username != "" {
+			config.Email.Auth = "plain"
+		}
+	}
+	if config.Email.TimeoutSeconds == 0 {
+		config.Email.TimeoutSeconds = 10
+	}
+	if config.Email.FromName == "" {
+		config.Email.FromName = "Veriflow"
+	}
+	if config.Email.UnsubscribeURL == "" {
+		config.Email.UnsubscribeURL = config.BaseURL + "/user/configure"
+	}
+	if config.Authenticator.EmailOTP.TTLSeconds == 0 {
+		config.Authenticator.EmailOTP.TTLSeconds = 600
+	}
+	if config.Authenticator.EmailOTP.MaxAttempts == 0 {
+		config.Authenticator.EmailOTP.MaxAttempts = 5
+	}
+	if config.Authenticator.EmailOTP.ResendSeconds == 0 {
+		config.Authenticator.EmailOTP.ResendSeconds = 30
+	}
+	if config.Authenticator.SMSOTP.TTLSeconds == 0 {
+		config.Authenticator.SMSOTP.TTLSeconds = 300
+	}
+	if config.Authenticator.SMSOTP.MaxAttempts == 0 {
+		config.Authenticator.SMSOTP.MaxAttempts = 5
+	}
+	if config.Authenticator.SMSOTP.ResendSeconds == 0 {
+		config.Authenticator.SMSOTP.ResendSeconds = 30
+	}
+	if config.Outbox.MaxAttempts == 0 {
+		config.Outbox.MaxAttempts = 8
+	}
+	if config.Outbox.BackoffSeconds == 0 {
+		config.Outbox.BackoffSeconds = 30
+	}
+	if config.Outbox.IntervalSeconds == 0 {
+		config.Outbox.IntervalSeconds = 60
+	}
+	if config.SIEM.Transport == "" {
+		config.SIEM.Transport = "tls"
+	}
+	if config.SIEM.Format == "" {
+		config.SIEM.Format = "cef"
+	}
+	if config.SIEM.BufferSize == 0 {
+		config.SIEM.BufferSize = 1000
+	}
+	if config.SIEM.RetrySeconds == 0 {
+		config.SIEM.RetrySeconds = 5
+	}
+	if config.SIEM.FlushSeconds == 0 {
+		config.SIEM.FlushSeconds = 5
+	}
+
+	config.Templates, err = NewMessageTemplates(config.Messages, config.Locales)
+	if err != nil {
+		return config, fmt.Errorf("invalid messages: %w", err)
+	}
+
 	return config, nil
 }
@@ -0,0 +1,27 @@
+package config
+
+import "testing"
+
+func TestPerNumberPerHour(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want int
+	}{
+		{"missing", "authenticator:\n  sms_otp:\n    enabled: true\n", 5},
+		{"disabled", "authenticator:\n  sms_otp:\n    per_number_per_hour: 0\n", 0},
+		{"set", "authenticator:\n  sms_otp:\n    per_number_per_hour: 3\n", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseConfig([]byte(tt.yaml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := config.Authenticator.SMSOTP.PerNumberPerHour; got != tt.want {
+				t.Errorf("per_number_per_hour = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+// Message names, the yaml keys of Messages
+const (
+	VerificationMessage                 = "verification_message"
+	RequestConfirmationMessage          = "request_confirmation_message"
+	RequestorCompletionMessage          = "requestor_completion_message"
+	RecipientCompletionMessage          = "recipient_completion_message"
+	RequestorVerificationFailureMessage = "requestor_verification_failure_message"
+	RecipientVerificationFailureMessage = "recipient_verification_failure_message"
+	CancellationMessage                 = "cancellation_message"
+	BatchConfirmationMessage            = "batch_confirmation_message"
+	BatchSummaryMessage                 = "batch_summary_message"
+	EmailCodeMessage                    = "email_code_message"
+	SMSCodeMessage                      = "sms_code_message"
+	VoiceCodeMessage                    = "voice_code_message"
+)
+
+// Used for the messages missing from the config
+var defaultMessages = Messages{
+	VerificationMessage:                 "*Hello {{.Recipient.Name}}*, You initiated communication with *{{.Requestor.Name}}* and they have requested you to verify yourself. Please click the link below to verify and establish secure communication. If you have not initiated the call, please click the report button.",
+	RequestConfirmationMessage:          "*Hello {{.Requestor.Name}}*, Your verification request for *{{.Recipient.Name}}* was received at {{.Time}}. You will be notified when the verification is completed. Please avoid sharing any sensitive information until the request is completed",
+	RequestorCompletionMessage:          "*Hello {{.Requestor.Name}}*, Your verification request for *{{.Recipient.Name}}* completed at {{.Time}}.",
+	RecipientCompletionMessage:          "*Hello {{.Recipient.Name}}*, You successfully completed Verification initiated by *{{.Requestor.Name}}* at {{.Time}}.",
+	RequestorVerificationFailureMessage: "*Hello {{.Requestor.Name}}*, Verification for *{{.Recipient.Name}}* failed at {{.Time}}.\nError: `{{.Error}}`",
+	RecipientVerificationFailureMessage: "*Hello {{.Recipient.Name}}*, A verification request initiated by *{{.Requestor.Name}}* failed at {{.Time}}.\nError: `{{.Error}}`",
+	CancellationMessage:                 "*Hello {{.Recipient.Name}}*, The verification request from *{{.Requestor.Name}}* was cancelled at {{.Time}}. You can ignore the previous message.",
+	BatchConfirmationMessage:            "*Hello {{.Requestor.Name}}*, Your verification request for *{{.Recipients}} recipients* was received at {{.Time}}. You will get a summary once all of them complete or any of them fail.",
+	BatchSummaryMessage:                 "*Hello {{.Requestor.Name}}*, Your group verification was updated at {{.Time}}. *{{.Completed}}* completed, *{{.Failed}}* failed and *{{.Pending}}* pending.",
+	EmailCodeMessage:                    "*Hello {{.Recipient.Name}}*, Your Veriflow verification code is *{{.Code}}*. It expires in {{.Minutes}} minutes. Veriflow will never ask you to share it with anyone.",
+	SMSCodeMessage:                      "Your Veriflow code is {{.Code}}. It expires in {{.Minutes}} minutes. Veriflow will never ask you to share it.",
+	VoiceCodeMessage:                    "Your Veriflow code is {{.Code}}.",
+}
+
+// MessageData is what messages are executed with. Only the fields a message
+// is about are set, e.g. Code for the code messages.
+type MessageData struct {
+	Requestor models.User
+	Recipient models.User
+	Time      string // when the message is sent
+	Error     string // why the request failed
+
+	// One-time codes
+	Code    string
+	Minutes int // until the code expires
+
+	// Group verification
+	Recipients int
+	Completed  int
+	Failed     int
+	Pending    int
+}
+
+// NewMessageData fills in the parties and the error of the request
+func NewMessageData(request *models.VerifyRequest) MessageData {
+	return MessageData{
+		Requestor: request.Requestor,
+		Recipient: request.Recipient,
+		Time:      time.Now().Format("2006-01-02 03:04 PM"),
+		Error:     request.Error,
+	}
+}
+
+// MessageTemplates are the parsed messages of every locale
+type MessageTemplates struct {
+	messages map[string]*template.Template
+	locales  map[string]map[string]*template.Template // by lower case locale
+}
+
+// A printf verb of the older message format
+var positionalVerb = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+// NewMessageTemplates parses the messages and executes each of them once, so
+// unknown fields and syntax errors are found before any message is sent
+func NewMessageTemplates(messages Messages, locales map[string]Messages) (*MessageTemplates, error) {
+	t := &MessageTemplates{locales: map[string]map[string]*template.Template{}}
+
+	var err error
+	if t.messages, err = parseMessages("messages", messages, defaultMessages); err != nil {
+		return nil, err
+	}
+	for locale, localeMessages := range locales {
+		if t.locales[normalizeLocale(locale)], err = parseMessages("locales."+locale, localeMessages, Messages{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+func parseMessages(prefix string, messages, defaults Messages) (map[string]*template.Template, error) {
+	parsed := map[string]*template.Template{}
+
+	values, defaultValues := reflect.ValueOf(messages), reflect.ValueOf(defaults)
+	fields := values.Type()
+	for i := 0; i < fields.NumField(); i++ {
+		name := fields.Field(i).Tag.Get("yaml")
+		text := values.Field(i).String()
+		if text == "" {
+			text = defaultValues.Field(i).String()
+		}
+		if text == "" {
+			continue
+		}
+
+		if !strings.Contains(text, "{{") && positionalVerb.MatchString(text) {
+			text = convertPositional(text, strings.Split(fields.Field(i).Tag.Get("args"), ","))
+			log.Printf("%s.%s uses the positional format, change it to: %q", prefix, name, text)
+		}
+
+		tmpl, err := template.New(name).Parse(text)
+		if err == nil {
+			err = tmpl.Execute(io.Discard, MessageData{})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", prefix, name, err)
+		}
+		parsed[name] = tmpl
+	}
+
+	return parsed, nil
+}
+
+// convertPositional turns a message written for fmt.Sprintf into a template
+// by replacing the verbs with the fields they used to be filled with
+func convertPositional(text string, args []string) string {
+	next := 0
+	return positionalVerb.ReplaceAllStringFunc(text, func(verb string) string {
+		if verb == "%%" {
+			return "%"
+		}
+		if next >= len(args) {
+			return verb
+		}
+		next++
+		return "{{." + args[next-1] + "}}"
+	})
+}
+
+// Execute renders the message in the locale, falling back to the base
+// language (de for de-AT) and then to the default messages
+func (t *MessageTemplates) Execute(locale, name string, data MessageData) (string, error) {
+	tmpl := t.lookup(locale, name)
+	if tmpl == nil {
+		return "", fmt.Errorf("unknown message %s", name)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func (t *MessageTemplates) lookup(locale, name string) *template.Template {
+	locale = normalizeLocale(locale)
+	if tmpl := t.locales[locale][name]; tmpl != nil {
+		return tmpl
+	}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		if tmpl := t.locales[base][name]; tmpl != nil {
+			return tmpl
+		}
+	}
+	return t.messages[name]
+}
+
+// HasLocale tells whether messages were configured for the locale or its base language
+func (t *MessageTemplates) HasLocale(locale string) bool {
+	locale = normalizeLocale(locale)
+	base, _, _ := strings.Cut(locale, "-")
+	return t.locales[locale] != nil || t.locales[base] != nil
+}
+
+// Locales lists the configured locales
+func (t *MessageTemplates) Locales() []string {
+	locales := make([]string, 0, len(t.locales))
+	for locale := range t.locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Slack reports locales like en-US, configs may use en_US
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(locale, "_", "-"))
+}
@@ -2,31 +2,62 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 )
 
 // var db *gorm.DB
 
 type DB interface {
-	Save(table string, item map[string]types.AttributeValue) error
+	Save(ctx context.Context, table string, item map[string]types.AttributeValue) error
+	Create(ctx context.Context, table string, item map[string]types.AttributeValue) error
+	SaveIf(ctx context.Context, table string, item map[string]types.AttributeValue, condition expression.ConditionBuilder) error
+	Transact(ctx context.Context, writes []TransactWrite) error
 
 	// TODO: Combine all the GET into 1 function
-	Get(table string, key map[string]types.AttributeValue, output interface{}) error
-	GetItemById(table string, id string, output interface{}) error
-	GetItem(table string, key map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
-	QueryOne(queryInput *dynamodb.QueryInput, output interface{}) error
-	QueryAll(queryInput *dynamodb.QueryInput, output interface{}) error
-	Scan(queryParams *dynamodb.ScanInput, output interface{}) error
-	Delete(table string, id string) error
+	Get(ctx context.Context, table string, key map[string]types.AttributeValue, output interface{}) error
+	GetItemById(ctx context.Context, table string, id string, output interface{}) error
+	GetItem(ctx context.Context, table string, key map[string]types.AttributeValue) (map[string]types.AttributeValue, error)
+	QueryOne(ctx context.Context, queryInput *dynamodb.QueryInput, output interface{}) error
+	QueryAll(ctx context.Context, queryInput *dynamodb.QueryInput, output interface{}) error
+	QueryPage(ctx context.Context, queryInput *dynamodb.QueryInput, limit int, cursor string, output interface{}) (string, error)
+	Scan(ctx context.Context, queryParams *dynamodb.ScanInput, output interface{}) error
+	Delete(ctx context.Context, table string, id string) error
+	// Update sets only the given attributes of an existing item, nested ones
+	// named by their path like "slack.MessageTS". It fails with
+	// ErrConditionFailed when there is no item with the id.
+	Update(ctx context.Context, table string, id string, attributes map[string]interface{}) error
+	Increment(ctx context.Context, table string, key map[string]types.AttributeValue, attribute string, expiresAt time.Time) (int, error)
+}
+
+// ErrItemExists is returned by Create when an item with the same id is already stored
+var ErrItemExists = errors.New("item already exists")
+
+// ErrNotFound is returned by QueryOne and GetItemById when no item matches
+var ErrNotFound = errors.New("no record")
+
+// ErrConditionFailed is returned by SaveIf when the stored item doesn't match the condition
+var ErrConditionFailed = errors.New("condition failed")
+
+// TransactWrite is a put in a transaction. With Create it only succeeds when
+// no item with the same id exists, just like Create.
+type TransactWrite struct {
+	Table  string
+	Item   map[string]types.AttributeValue
+	Create bool
 }
 
 type DBClient struct {
@@ -70,13 +101,16 @@ func Init() DB {
 
 	}
 
+	// Every DynamoDB call becomes a span of the trace in its context
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+
 	dbClient.Svc = dynamodb.NewFromConfig(cfg)
 
 	return dbClient
 }
 
-func (dbClient *DBClient) Save(table string, item map[string]types.AttributeValue) error {
-	_, err := dbClient.Svc.PutItem(context.TODO(), &dynamodb.PutItemInput{
+func (dbClient *DBClient) Save(ctx context.Context, table string, item map[string]types.AttributeValue) error {
+	_, err := dbClient.Svc.PutItem(ctx, &dynamodb.PutItemInput{
 		TableName: aws.String(table),
 		Item:      item,
 	})
@@ -84,8 +118,72 @@ func (dbClient *DBClient) Save(table string, item map[string]types.AttributeValu
 	return err
 }
 
-func (dbClient *DBClient) Get(table string, key map[string]types.AttributeValue, output interface{}) error {
-	result, err := dbClient.Svc.GetItem(context.TODO(), &dynamodb.GetItemInput{
+// Create stores the item only if no item with the same id exists yet
+func (dbClient *DBClient) Create(ctx context.Context, table string, item map[string]types.AttributeValue) error {
+	_, err := dbClient.Svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return ErrItemExists
+	}
+	return err
+}
+
+// SaveIf stores the item only if the stored item matches the condition
+func (dbClient *DBClient) SaveIf(ctx context.Context, table string, item map[string]types.AttributeValue, condition expression.ConditionBuilder) error {
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return fmt.Errorf("error building expression: %v", err)
+	}
+
+	_, err = dbClient.Svc.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(table),
+		Item:                      item,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return ErrConditionFailed
+	}
+	return err
+}
+
+// Transact stores all the items or none of them
+func (dbClient *DBClient) Transact(ctx context.Context, writes []TransactWrite) error {
+	items := make([]types.TransactWriteItem, 0, len(writes))
+	for _, write := range writes {
+		put := &types.Put{
+			TableName: aws.String(write.Table),
+			Item:      write.Item,
+		}
+		if write.Create {
+			put.ConditionExpression = aws.String("attribute_not_exists(id)")
+		}
+		items = append(items, types.TransactWriteItem{Put: put})
+	}
+
+	_, err := dbClient.Svc.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+
+	var cancelledErr *types.TransactionCanceledException
+	if errors.As(err, &cancelledErr) {
+		for _, reason := range cancelledErr.CancellationReasons {
+			if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+				return ErrItemExists
+			}
+		}
+	}
+	return err
+}
+
+func (dbClient *DBClient) Get(ctx context.Context, table string, key map[string]types.AttributeValue, output interface{}) error {
+	result, err := dbClient.Svc.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(table),
 		Key:       key,
 	})
@@ -102,27 +200,58 @@ func (dbClient *DBClient) Get(table string, key map[string]types.AttributeValue,
 	return err
 }
 
-func (dbClient *DBClient) GetItem(table string, key map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
-	out, err := dbClient.Svc.GetItem(context.TODO(), &dynamodb.GetItemInput{
+func (dbClient *DBClient) GetItem(ctx context.Context, table string, key map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	out, err := dbClient.Svc.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(table),
 		Key:       key,
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Item, nil
+}
+
+func (dbClient *DBClient) Delete(ctx context.Context, table string, id string) error {
+	_, err := dbClient.Svc.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	})
 
-	return out.Item, err
+	return err
 }
 
-func (dbClient *DBClient) Delete(table string, id string) error {
-	_, err := dbClient.Svc.DeleteItem(context.TODO(), &dynamodb.DeleteItemInput{
+func (dbClient *DBClient) Update(ctx context.Context, table string, id string, attributes map[string]interface{}) error {
+	update := expression.UpdateBuilder{}
+	for name, value := range attributes {
+		update = update.Set(expression.Name(name), expression.Value(value))
+	}
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(expression.AttributeExists(expression.Name("id"))).Build()
+	if err != nil {
+		return fmt.Errorf("error building expression: %v", err)
+	}
+
+	_, err = dbClient.Svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(table),
 		Key: map[string]types.AttributeValue{
 			"id": &types.AttributeValueMemberS{Value: id},
 		},
+		UpdateExpression:          expr.Update(),
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
 	})
 
+	var conditionErr *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionErr) {
+		return ErrConditionFailed
+	}
 	return err
 }
 
-func (dbClient *DBClient) GetItemById(table string, id string, output interface{}) error {
+func (dbClient *DBClient) GetItemById(ctx context.Context, table string, id string, output interface{}) error {
 	queryInput := &dynamodb.QueryInput{
 		TableName:              aws.String(table),
 		KeyConditionExpression: aws.String("id = :id"),
@@ -132,17 +261,17 @@ func (dbClient *DBClient) GetItemById(table string, id string, output interface{
 		Limit: aws.Int32(1),
 	}
 
-	return dbClient.QueryOne(queryInput, output)
+	return dbClient.QueryOne(ctx, queryInput, output)
 }
 
-func (dbClient *DBClient) QueryOne(queryInput *dynamodb.QueryInput, output interface{}) error {
-	result, err := dbClient.Svc.Query(context.TODO(), queryInput)
+func (dbClient *DBClient) QueryOne(ctx context.Context, queryInput *dynamodb.QueryInput, output interface{}) error {
+	result, err := dbClient.Svc.Query(ctx, queryInput)
 	if err != nil {
 		return fmt.Errorf("error querying: %v", err)
 	}
 
 	if len(result.Items) == 0 {
-		return fmt.Errorf("no record")
+		return ErrNotFound
 	}
 
 	err = attributevalue.UnmarshalMap(result.Items[0], &output)
@@ -153,25 +282,60 @@ func (dbClient *DBClient) QueryOne(queryInput *dynamodb.QueryInput, output inter
 	return err
 }
 
-func (dbClient *DBClient) QueryAll(queryInput *dynamodb.QueryInput, output interface{}) error {
-	result, err := dbClient.Svc.Query(context.TODO(), queryInput)
-	if err != nil {
-		return fmt.Errorf("error querying: %v", err)
-	}
-
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &output)
+// QueryAll returns every item of the query, following the pages DynamoDB splits results in
+func (dbClient *DBClient) QueryAll(ctx context.Context, queryInput *dynamodb.QueryInput, output interface{}) error {
+	_, err := dbClient.QueryPage(ctx, queryInput, 0, "", output)
 	return err
 }
 
-func (dbClient *DBClient) Scan(queryParams *dynamodb.ScanInput, output interface{}) error {
-	result, err := dbClient.Svc.Scan(context.Background(), queryParams)
-	if err != nil {
-		return fmt.Errorf("error scanning table: %v", err)
+// Scan returns every item of the scan, following the pages DynamoDB splits results in
+func (dbClient *DBClient) Scan(ctx context.Context, queryParams *dynamodb.ScanInput, output interface{}) error {
+	input := *queryParams
+	var items []map[string]types.AttributeValue
+	for {
+		result, err := dbClient.Svc.Scan(ctx, &input)
+		if err != nil {
+			return fmt.Errorf("error scanning table: %v", err)
+		}
+		items = append(items, result.Items...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
 	}
 
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &output)
+	err := attributevalue.UnmarshalListOfMaps(items, output)
 	if err != nil {
 		return fmt.Errorf("error unmarshalling result items: %v", err)
 	}
 	return nil
 }
+
+// Increment atomically adds one to a numeric attribute and returns the new value.
+// expires_at is only set when the item is created so it can be used as the table TTL.
+func (dbClient *DBClient) Increment(ctx context.Context, table string, key map[string]types.AttributeValue, attribute string, expiresAt time.Time) (int, error) {
+	out, err := dbClient.Svc.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(table),
+		Key:              key,
+		UpdateExpression: aws.String("ADD #attr :one SET expires_at = if_not_exists(expires_at, :exp)"),
+		ExpressionAttributeNames: map[string]string{
+			"#attr": attribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+			":exp": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment %s: %w", attribute, err)
+	}
+
+	var count int
+	if err := attributevalue.Unmarshal(out.Attributes[attribute], &count); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal %s: %w", attribute, err)
+	}
+
+	return count, nil
+}
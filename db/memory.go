@@ -0,0 +1,381 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// MemoryDB keeps the tables in memory, it runs the tests without DynamoDB.
+// Every table is keyed by id, like in template.yaml.
+type MemoryDB struct {
+	mu     sync.Mutex
+	tables map[string]map[string]map[string]types.AttributeValue
+
+	// RangeKeys are the sort keys of the indexes, by index name. Queries of
+	// the other indexes return the items by id.
+	RangeKeys map[string]string
+}
+
+var _ DB = (*MemoryDB)(nil)
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{
+		tables:    map[string]map[string]map[string]types.AttributeValue{},
+		RangeKeys: map[string]string{},
+	}
+}
+
+func (m *MemoryDB) table(name string) map[string]map[string]types.AttributeValue {
+	table, ok := m.tables[name]
+	if !ok {
+		table = map[string]map[string]types.AttributeValue{}
+		m.tables[name] = table
+	}
+	return table
+}
+
+func itemID(item map[string]types.AttributeValue) (string, error) {
+	id, ok := item["id"].(*types.AttributeValueMemberS)
+	if !ok {
+		return "", fmt.Errorf("item without an id")
+	}
+	return id.Value, nil
+}
+
+func (m *MemoryDB) Save(ctx context.Context, table string, item map[string]types.AttributeValue) error {
+	id, err := itemID(item)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.table(table)[id] = item
+	return nil
+}
+
+func (m *MemoryDB) Create(ctx context.Context, table string, item map[string]types.AttributeValue) error {
+	id, err := itemID(item)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.table(table)[id]; exists {
+		return ErrItemExists
+	}
+	m.table(table)[id] = item
+	return nil
+}
+
+func (m *MemoryDB) SaveIf(ctx context.Context, table string, item map[string]types.AttributeValue, cond expression.ConditionBuilder) error {
+	id, err := itemID(item)
+	if err != nil {
+		return err
+	}
+	expr, err := expression.NewBuilder().WithCondition(cond).Build()
+	if err != nil {
+		return fmt.Errorf("error building expression: %v", err)
+	}
+	matches, err := parseCondition(aws.ToString(expr.Condition()), expr.Names(), expr.Values())
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Missing items are evaluated as empty ones, like DynamoDB does
+	stored := m.table(table)[id]
+	if stored == nil {
+		stored = map[string]types.AttributeValue{}
+	}
+	if !matches(stored) {
+		return ErrConditionFailed
+	}
+	m.table(table)[id] = item
+	return nil
+}
+
+func (m *MemoryDB) Transact(ctx context.Context, writes []TransactWrite) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ids := make([]string, len(writes))
+	for i, write := range writes {
+		id, err := itemID(write.Item)
+		if err != nil {
+			return err
+		}
+		if _, exists := m.table(write.Table)[id]; write.Create && exists {
+			return ErrItemExists
+		}
+		ids[i] = id
+	}
+	for i, write := range writes {
+		m.table(write.Table)[ids[i]] = write.Item
+	}
+	return nil
+}
+
+func (m *MemoryDB) Get(ctx context.Context, table string, key map[string]types.AttributeValue, output interface{}) error {
+	item, err := m.GetItem(ctx, table, key)
+	if err != nil {
+		return fmt.Errorf("failed to get item: %w", err)
+	}
+
+	if err := attributevalue.UnmarshalMap(item, &output); err != nil {
+		return fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+	return nil
+}
+
+func (m *MemoryDB) GetItem(ctx context.Context, table string, key map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	id, err := itemID(key)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.table(table)[id], nil
+}
+
+func (m *MemoryDB) GetItemById(ctx context.Context, table string, id string, output interface{}) error {
+	return m.QueryOne(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(table),
+		KeyConditionExpression: aws.String("id = :id"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":id": &types.AttributeValueMemberS{Value: id},
+		},
+	}, output)
+}
+
+func (m *MemoryDB) QueryOne(ctx context.Context, queryInput *dynamodb.QueryInput, output interface{}) error {
+	items, _, err := m.query(queryInput, 1, "")
+	if err != nil {
+		return fmt.Errorf("error querying: %v", err)
+	}
+	if len(items) == 0 {
+		return ErrNotFound
+	}
+
+	if err := attributevalue.UnmarshalMap(items[0], &output); err != nil {
+		return fmt.Errorf("failed to unmarshal item: %w", err)
+	}
+	return nil
+}
+
+func (m *MemoryDB) QueryAll(ctx context.Context, queryInput *dynamodb.QueryInput, output interface{}) error {
+	_, err := m.QueryPage(ctx, queryInput, 0, "", output)
+	return err
+}
+
+// QueryPage uses the id of the last item returned as the cursor
+func (m *MemoryDB) QueryPage(ctx context.Context, queryInput *dynamodb.QueryInput, limit int, cursor string, output interface{}) (string, error) {
+	items, next, err := m.query(queryInput, limit, cursor)
+	if err != nil {
+		return "", err
+	}
+
+	if err := attributevalue.UnmarshalListOfMaps(items, output); err != nil {
+		return "", fmt.Errorf("error unmarshalling result items: %v", err)
+	}
+	return next, nil
+}
+
+func (m *MemoryDB) query(input *dynamodb.QueryInput, limit int, cursor string) ([]map[string]types.AttributeValue, string, error) {
+	keyCond, err := parseCondition(aws.ToString(input.KeyConditionExpression), input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, "", err
+	}
+	filter, err := parseCondition(aws.ToString(input.FilterExpression), input.ExpressionAttributeNames, input.ExpressionAttributeValues)
+	if err != nil {
+		return nil, "", err
+	}
+
+	after := ""
+	if cursor != "" {
+		key, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		if after, err = itemID(key); err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	m.mu.Lock()
+	var items []map[string]types.AttributeValue
+	for _, item := range m.table(aws.ToString(input.TableName)) {
+		if keyCond(item) {
+			items = append(items, item)
+		}
+	}
+	m.mu.Unlock()
+
+	rangeKey := m.RangeKeys[aws.ToString(input.IndexName)]
+	sort.Slice(items, func(i, j int) bool {
+		if rangeKey != "" && !compares(items[i][rangeKey], "=", items[j][rangeKey]) {
+			return compares(items[i][rangeKey], "<", items[j][rangeKey])
+		}
+		a, _ := itemID(items[i])
+		b, _ := itemID(items[j])
+		return a < b
+	})
+	if input.ScanIndexForward != nil && !*input.ScanIndexForward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	if after != "" {
+		for i, item := range items {
+			if id, _ := itemID(item); id == after {
+				items = items[i+1:]
+				break
+			}
+		}
+	}
+
+	var page []map[string]types.AttributeValue
+	for i, item := range items {
+		if !filter(item) {
+			continue
+		}
+		page = append(page, item)
+		if limit > 0 && len(page) == limit {
+			if i == len(items)-1 {
+				break
+			}
+			next, err := encodeCursor(map[string]types.AttributeValue{"id": item["id"]})
+			return page, next, err
+		}
+	}
+	return page, "", nil
+}
+
+func (m *MemoryDB) Scan(ctx context.Context, queryParams *dynamodb.ScanInput, output interface{}) error {
+	filter, err := parseCondition(aws.ToString(queryParams.FilterExpression), queryParams.ExpressionAttributeNames, queryParams.ExpressionAttributeValues)
+	if err != nil {
+		return fmt.Errorf("error scanning table: %v", err)
+	}
+
+	m.mu.Lock()
+	var items []map[string]types.AttributeValue
+	for _, item := range m.table(aws.ToString(queryParams.TableName)) {
+		if filter(item) {
+			items = append(items, item)
+		}
+	}
+	m.mu.Unlock()
+
+	if err := attributevalue.UnmarshalListOfMaps(items, output); err != nil {
+		return fmt.Errorf("error unmarshalling result items: %v", err)
+	}
+	return nil
+}
+
+func (m *MemoryDB) Delete(ctx context.Context, table string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.table(table), id)
+	return nil
+}
+
+func (m *MemoryDB) Update(ctx context.Context, table string, id string, attributes map[string]interface{}) error {
+	values := make(map[string]types.AttributeValue, len(attributes))
+	for name, value := range attributes {
+		av, err := attributevalue.Marshal(value)
+		if err != nil {
+			return err
+		}
+		values[name] = av
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.table(table)[id]
+	if !ok {
+		return ErrConditionFailed
+	}
+	item := make(map[string]types.AttributeValue, len(stored)+len(values))
+	for name, value := range stored {
+		item[name] = value
+	}
+	for name, value := range values {
+		if err := setPath(item, strings.Split(name, "."), value); err != nil {
+			return err
+		}
+	}
+	m.table(table)[id] = item
+	return nil
+}
+
+// setPath sets a nested attribute, copying the maps on the way so the stored
+// item isn't changed
+func setPath(item map[string]types.AttributeValue, path []string, value types.AttributeValue) error {
+	if len(path) == 1 {
+		item[path[0]] = value
+		return nil
+	}
+
+	parent, ok := item[path[0]].(*types.AttributeValueMemberM)
+	if !ok {
+		return fmt.Errorf("the document path %s doesn't exist", path[0])
+	}
+	child := make(map[string]types.AttributeValue, len(parent.Value))
+	for name, value := range parent.Value {
+		child[name] = value
+	}
+	if err := setPath(child, path[1:], value); err != nil {
+		return err
+	}
+	item[path[0]] = &types.AttributeValueMemberM{Value: child}
+	return nil
+}
+
+// Increment stores expires_at like DBClient but nothing expires in memory
+func (m *MemoryDB) Increment(ctx context.Context, table string, key map[string]types.AttributeValue, attribute string, expiresAt time.Time) (int, error) {
+	id, err := itemID(key)
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item := map[string]types.AttributeValue{}
+	for name, value := range m.table(table)[id] {
+		item[name] = value
+	}
+	for name, value := range key {
+		item[name] = value
+	}
+
+	count := 0
+	if n, ok := item[attribute].(*types.AttributeValueMemberN); ok {
+		if count, err = strconv.Atoi(n.Value); err != nil {
+			return 0, fmt.Errorf("failed to increment %s: %w", attribute, err)
+		}
+	}
+	count++
+	item[attribute] = &types.AttributeValueMemberN{Value: strconv.Itoa(count)}
+	if _, ok := item["expires_at"]; !ok {
+		item["expires_at"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)}
+	}
+	m.table(table)[id] = item
+	return count, nil
+}
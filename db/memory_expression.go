@@ -0,0 +1,401 @@
+package db
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// condition is a parsed condition, key condition or filter expression
+type condition func(item map[string]types.AttributeValue) bool
+
+// operand is a path, a value or size() in a condition
+type operand func(item map[string]types.AttributeValue) types.AttributeValue
+
+// parseCondition parses the expressions built by the expression package and
+// the hand-written ones of the models, which are a subset of the DynamoDB syntax
+func parseCondition(expr string, names map[string]string, values map[string]types.AttributeValue) (condition, error) {
+	if strings.TrimSpace(expr) == "" {
+		return func(map[string]types.AttributeValue) bool { return true }, nil
+	}
+
+	p := &exprParser{tokens: tokenize(expr), names: names, values: values}
+	cond, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", expr, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%s: unexpected %q", expr, p.tokens[p.pos])
+	}
+	return cond, nil
+}
+
+func tokenize(expr string) []string {
+	var tokens []string
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case strings.ContainsRune("(),", c):
+			tokens = append(tokens, string(c))
+			i++
+		case strings.ContainsRune("<>=", c):
+			j := i + 1
+			if j < len(expr) && strings.ContainsRune("<>=", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			j := i
+			for j < len(expr) && !unicode.IsSpace(rune(expr[j])) && !strings.ContainsRune("(),<>=", rune(expr[j])) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		}
+	}
+	return tokens
+}
+
+type exprParser struct {
+	tokens []string
+	pos    int
+	names  map[string]string
+	values map[string]types.AttributeValue
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() string {
+	token := p.peek()
+	p.pos++
+	return token
+}
+
+func (p *exprParser) expect(token string) error {
+	if got := p.next(); !strings.EqualFold(got, token) {
+		return fmt.Errorf("expected %q, got %q", token, got)
+	}
+	return nil
+}
+
+func (p *exprParser) or() (condition, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "OR") {
+		p.next()
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(item map[string]types.AttributeValue) bool { return l(item) || right(item) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) and() (condition, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for strings.EqualFold(p.peek(), "AND") {
+		p.next()
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(item map[string]types.AttributeValue) bool { return l(item) && right(item) }
+	}
+	return left, nil
+}
+
+func (p *exprParser) not() (condition, error) {
+	if strings.EqualFold(p.peek(), "NOT") {
+		p.next()
+		cond, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(item map[string]types.AttributeValue) bool { return !cond(item) }, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (condition, error) {
+	token := p.peek()
+	if token == "(" {
+		p.next()
+		cond, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return cond, p.expect(")")
+	}
+
+	switch strings.ToLower(token) {
+	case "attribute_exists", "attribute_not_exists":
+		p.next()
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		exists := strings.ToLower(token) == "attribute_exists"
+		return func(item map[string]types.AttributeValue) bool { return (args[0](item) != nil) == exists }, nil
+	case "begins_with", "contains":
+		p.next()
+		args, err := p.arguments()
+		if err != nil || len(args) != 2 {
+			return nil, fmt.Errorf("%s takes 2 arguments", token)
+		}
+		match := hasPrefix
+		if strings.ToLower(token) == "contains" {
+			match = contains
+		}
+		return func(item map[string]types.AttributeValue) bool { return match(args[0](item), args[1](item)) }, nil
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+
+	switch comparator := p.next(); strings.ToUpper(comparator) {
+	case "=", "<>", "<", "<=", ">", ">=":
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return func(item map[string]types.AttributeValue) bool {
+			return compares(left(item), comparator, right(item))
+		}, nil
+	case "BETWEEN":
+		low, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+		high, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		return func(item map[string]types.AttributeValue) bool {
+			value := left(item)
+			return compares(value, ">=", low(item)) && compares(value, "<=", high(item))
+		}, nil
+	case "IN":
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		p.pos--
+		candidates, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		return func(item map[string]types.AttributeValue) bool {
+			value := left(item)
+			for _, candidate := range candidates {
+				if compares(value, "=", candidate(item)) {
+					return true
+				}
+			}
+			return false
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q", comparator)
+	}
+}
+
+func (p *exprParser) arguments() ([]operand, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	var args []operand
+	for {
+		arg, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek() != "," {
+			break
+		}
+		p.next()
+	}
+	return args, p.expect(")")
+}
+
+func (p *exprParser) operand() (operand, error) {
+	token := p.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end")
+	case strings.EqualFold(token, "size"):
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		return func(item map[string]types.AttributeValue) types.AttributeValue {
+			var size int
+			switch v := args[0](item).(type) {
+			case *types.AttributeValueMemberS:
+				size = len(v.Value)
+			case *types.AttributeValueMemberB:
+				size = len(v.Value)
+			case *types.AttributeValueMemberL:
+				size = len(v.Value)
+			case *types.AttributeValueMemberM:
+				size = len(v.Value)
+			case *types.AttributeValueMemberSS:
+				size = len(v.Value)
+			default:
+				return nil
+			}
+			return &types.AttributeValueMemberN{Value: fmt.Sprint(size)}
+		}, nil
+	case strings.HasPrefix(token, ":"):
+		value, ok := p.values[token]
+		if !ok {
+			return nil, fmt.Errorf("missing value %s", token)
+		}
+		return func(map[string]types.AttributeValue) types.AttributeValue { return value }, nil
+	default:
+		var path []string
+		for _, part := range strings.Split(token, ".") {
+			if strings.HasPrefix(part, "#") {
+				name, ok := p.names[part]
+				if !ok {
+					return nil, fmt.Errorf("missing name %s", part)
+				}
+				part = name
+			}
+			path = append(path, part)
+		}
+		return func(item map[string]types.AttributeValue) types.AttributeValue { return lookup(item, path) }, nil
+	}
+}
+
+func lookup(item map[string]types.AttributeValue, path []string) types.AttributeValue {
+	value, ok := item[path[0]]
+	if !ok {
+		return nil
+	}
+	if len(path) == 1 {
+		return value
+	}
+	m, ok := value.(*types.AttributeValueMemberM)
+	if !ok {
+		return nil
+	}
+	return lookup(m.Value, path[1:])
+}
+
+// compares is false when an operand is missing or their types differ, like in DynamoDB
+func compares(a types.AttributeValue, comparator string, b types.AttributeValue) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	var order int
+	switch x := a.(type) {
+	case *types.AttributeValueMemberS:
+		y, ok := b.(*types.AttributeValueMemberS)
+		if !ok {
+			return comparator == "<>"
+		}
+		order = strings.Compare(x.Value, y.Value)
+	case *types.AttributeValueMemberN:
+		y, ok := b.(*types.AttributeValueMemberN)
+		if !ok {
+			return comparator == "<>"
+		}
+		order = compareNumbers(x.Value, y.Value)
+	case *types.AttributeValueMemberB:
+		y, ok := b.(*types.AttributeValueMemberB)
+		if !ok {
+			return comparator == "<>"
+		}
+		order = bytes.Compare(x.Value, y.Value)
+	default:
+		equal := fmt.Sprintf("%#v", a) == fmt.Sprintf("%#v", b)
+		switch comparator {
+		case "=":
+			return equal
+		case "<>":
+			return !equal
+		}
+		return false
+	}
+
+	switch comparator {
+	case "=":
+		return order == 0
+	case "<>":
+		return order != 0
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	case ">=":
+		return order >= 0
+	}
+	return false
+}
+
+func compareNumbers(a, b string) int {
+	x, _, errX := big.ParseFloat(a, 10, 128, big.ToNearestEven)
+	y, _, errY := big.ParseFloat(b, 10, 128, big.ToNearestEven)
+	if errX != nil || errY != nil {
+		return strings.Compare(a, b)
+	}
+	return x.Cmp(y)
+}
+
+func hasPrefix(value, prefix types.AttributeValue) bool {
+	s, ok := value.(*types.AttributeValueMemberS)
+	p, ok2 := prefix.(*types.AttributeValueMemberS)
+	return ok && ok2 && strings.HasPrefix(s.Value, p.Value)
+}
+
+func contains(value, operand types.AttributeValue) bool {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		o, ok := operand.(*types.AttributeValueMemberS)
+		return ok && strings.Contains(v.Value, o.Value)
+	case *types.AttributeValueMemberSS:
+		o, ok := operand.(*types.AttributeValueMemberS)
+		if !ok {
+			return false
+		}
+		for _, member := range v.Value {
+			if member == o.Value {
+				return true
+			}
+		}
+	case *types.AttributeValueMemberL:
+		for _, member := range v.Value {
+			if compares(member, "=", operand) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestParseCondition(t *testing.T) {
+	item := map[string]types.AttributeValue{
+		"id":     &types.AttributeValueMemberS{Value: "r1"},
+		"status": &types.AttributeValueMemberS{Value: "SENT"},
+		"count":  &types.AttributeValueMemberN{Value: "10"},
+		"score":  &types.AttributeValueMemberN{Value: "2.5"},
+		"tags":   &types.AttributeValueMemberSS{Value: []string{"urgent", "batch"}},
+		"steps":  &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: "email"}}},
+		"party": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"name": &types.AttributeValueMemberS{Value: "Alice Smith"},
+		}},
+	}
+	names := map[string]string{"#s": "status", "#p": "party", "#n": "name"}
+	values := map[string]types.AttributeValue{
+		":sent":   &types.AttributeValueMemberS{Value: "SENT"},
+		":failed": &types.AttributeValueMemberS{Value: "FAILED"},
+		":nine":   &types.AttributeValueMemberN{Value: "9"},
+		":ten":    &types.AttributeValueMemberN{Value: "10.0"},
+		":three":  &types.AttributeValueMemberN{Value: "3"},
+		":alice":  &types.AttributeValueMemberS{Value: "Alice"},
+		":smith":  &types.AttributeValueMemberS{Value: "Smith"},
+		":urgent": &types.AttributeValueMemberS{Value: "urgent"},
+		":email":  &types.AttributeValueMemberS{Value: "email"},
+	}
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"", true},
+		{"#s = :sent", true},
+		{"#s <> :sent", false},
+		{"#s<>:failed", true},
+		{"count = :ten", true},
+		{"count > :nine", true},
+		{"count >= :ten AND count <= :ten", true},
+		{"score < :three", true},
+		{"count < :three", false},
+		{"#s = :nine", false},
+		{"#s <> :nine", true},
+		{"missing = :sent", false},
+		{"count BETWEEN :nine AND :ten", true},
+		{"score BETWEEN :nine AND :ten", false},
+		{"#s IN (:failed, :sent)", true},
+		{"#s IN (:failed)", false},
+		{"attribute_exists(#p.#n)", true},
+		{"attribute_not_exists(#p.missing)", true},
+		{"attribute_exists(#s.#n)", false},
+		{"begins_with(#p.#n, :alice)", true},
+		{"begins_with(#p.#n, :smith)", false},
+		{"contains(#p.#n, :smith)", true},
+		{"contains(tags, :urgent)", true},
+		{"contains(steps, :email)", true},
+		{"contains(count, :nine)", false},
+		{"size(tags) = :three", false},
+		{"size(#p.#n) > :ten", true},
+		{"NOT #s = :sent", false},
+		{"NOT (#s = :failed OR count < :nine)", true},
+		{"#s = :failed OR #s = :sent AND count = :nine", false},
+		{"(#s = :failed OR #s = :sent) AND count = :ten", true},
+		{"#s = :sent and not count = :nine or #s = :failed", true},
+	}
+
+	for _, tt := range tests {
+		cond, err := parseCondition(tt.expr, names, values)
+		if err != nil {
+			t.Errorf("parseCondition(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got := cond(item); got != tt.want {
+			t.Errorf("%q = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseConditionErrors(t *testing.T) {
+	names := map[string]string{"#s": "status"}
+	values := map[string]types.AttributeValue{":sent": &types.AttributeValueMemberS{Value: "SENT"}}
+
+	for _, expr := range []string{
+		"#s = :missing",
+		"#missing = :sent",
+		"#s = ",
+		"#s == :sent",
+		"#s = :sent AND",
+		"(#s = :sent",
+		"#s = :sent)",
+		"#s BETWEEN :sent :sent",
+		"#s IN :sent",
+		"begins_with(#s)",
+		"attribute_exists #s",
+	} {
+		if _, err := parseCondition(expr, names, values); err == nil {
+			t.Errorf("parseCondition(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{"#s = :v", []string{"#s", "=", ":v"}},
+		{"#a.#b<>:v", []string{"#a.#b", "<>", ":v"}},
+		{"size(#l)>=:n", []string{"size", "(", "#l", ")", ">=", ":n"}},
+		{"#s IN (:a,:b)", []string{"#s", "IN", "(", ":a", ",", ":b", ")"}},
+	}
+
+	for _, tt := range tests {
+		got := tokenize(tt.expr)
+		if len(got) != len(tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.expr, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("tokenize(%q) = %q, want %q", tt.expr, got, tt.want)
+				break
+			}
+		}
+	}
+}
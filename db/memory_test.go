@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+type memoryItem struct {
+	ID     string            `dynamodbav:"id"`
+	Email  string            `dynamodbav:"email,omitempty"`
+	Start  string            `dynamodbav:"start_time,omitempty"`
+	Status string            `dynamodbav:"status,omitempty"`
+	Count  int               `dynamodbav:"count"`
+	Party  map[string]string `dynamodbav:"party,omitempty"`
+}
+
+func saveItems(t *testing.T, m *MemoryDB, items ...memoryItem) {
+	t.Helper()
+	for _, item := range items {
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Save(context.Background(), "items", av); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryConditions(t *testing.T) {
+	m := NewMemoryDB()
+	saveItems(t, m, memoryItem{ID: "a", Status: "SENT", Count: 2, Party: map[string]string{"name": "Alice Smith"}})
+
+	tests := []struct {
+		cond expression.ConditionBuilder
+		want bool
+	}{
+		{expression.Name("status").Equal(expression.Value("SENT")), true},
+		{expression.Name("status").In(expression.Value("QUEUED"), expression.Value("SENT")), true},
+		{expression.Name("count").LessThan(expression.Value(10)), true},
+		{expression.Name("count").Between(expression.Value(3), expression.Value(10)), false},
+		{expression.Name("party.name").Contains("Smith"), true},
+		{expression.Name("party.name").BeginsWith("Bob"), false},
+		{expression.Name("missing").AttributeNotExists(), true},
+		{expression.Not(expression.Name("id").AttributeExists()), false},
+		{expression.Or(expression.Name("status").Equal(expression.Value("FAILED")), expression.Name("count").Equal(expression.Value(2))), true},
+		{expression.And(expression.Name("status").Equal(expression.Value("SENT")), expression.Name("missing").Equal(expression.Value(2))), false},
+	}
+
+	for i, tt := range tests {
+		av, _ := attributevalue.MarshalMap(memoryItem{ID: "a", Status: "DONE"})
+		err := m.SaveIf(context.Background(), "items", av, tt.cond)
+		if got := err == nil; got != tt.want {
+			t.Errorf("condition %d: SaveIf() error = %v, want match %v", i, err, tt.want)
+		}
+		if err != nil && !errors.Is(err, ErrConditionFailed) {
+			t.Errorf("condition %d: error = %v, want ErrConditionFailed", i, err)
+		}
+		saveItems(t, m, memoryItem{ID: "a", Status: "SENT", Count: 2, Party: map[string]string{"name": "Alice Smith"}})
+	}
+}
+
+func TestMemoryQueryPages(t *testing.T) {
+	m := NewMemoryDB()
+	m.RangeKeys["ByEmail"] = "start_time"
+	for i := 0; i < 7; i++ {
+		status := "SENT"
+		if i%3 == 0 {
+			status = "FAILED"
+		}
+		saveItems(t, m, memoryItem{ID: fmt.Sprintf("r%d", i), Email: "a@example.com", Start: fmt.Sprintf("2026-10-0%dT00:00:00Z", i+1), Status: status})
+	}
+	saveItems(t, m, memoryItem{ID: "other", Email: "b@example.com", Start: "2026-10-01T00:00:00Z", Status: "SENT"})
+
+	expr, _ := expression.NewBuilder().
+		WithKeyCondition(expression.Key("email").Equal(expression.Value("a@example.com"))).
+		WithFilter(expression.Name("status").Equal(expression.Value("SENT"))).
+		Build()
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String("items"),
+		IndexName:                 aws.String("ByEmail"),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ScanIndexForward:          aws.Bool(false),
+	}
+
+	var ids []string
+	cursor := ""
+	for pages := 0; pages == 0 || cursor != ""; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination does not end")
+		}
+		var page []memoryItem
+		var err error
+		if cursor, err = m.QueryPage(context.Background(), input, 2, cursor, &page); err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range page {
+			ids = append(ids, item.ID)
+		}
+	}
+
+	if got, want := fmt.Sprint(ids), "[r5 r4 r2 r1]"; got != want {
+		t.Errorf("pages = %s, want %s", got, want)
+	}
+}
+
+func TestMemoryIncrement(t *testing.T) {
+	m := NewMemoryDB()
+	key, _ := attributevalue.MarshalMap(map[string]string{"id": "limit#a"})
+	for want := 1; want <= 3; want++ {
+		count, err := m.Increment(context.Background(), "limits", key, "count", time.Now())
+		if err != nil || count != want {
+			t.Fatalf("Increment() = %d, %v, want %d", count, err, want)
+		}
+	}
+}
+
+func TestMemoryUpdate(t *testing.T) {
+	m := NewMemoryDB()
+	saveItems(t, m, memoryItem{ID: "a", Status: "SENT", Count: 2, Party: map[string]string{"name": "Alice Smith"}})
+
+	err := m.Update(context.Background(), "items", "a", map[string]interface{}{"party.email": "alice@example.com", "count": 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var item memoryItem
+	if err := m.GetItemById(context.Background(), "items", "a", &item); err != nil {
+		t.Fatal(err)
+	}
+	if item.Status != "SENT" || item.Count != 3 || item.Party["name"] != "Alice Smith" || item.Party["email"] != "alice@example.com" {
+		t.Errorf("item = %+v, want the status and name kept and the count and email set", item)
+	}
+
+	if err := m.Update(context.Background(), "items", "b", map[string]interface{}{"count": 1}); !errors.Is(err, ErrConditionFailed) {
+		t.Errorf("Update() of a missing item = %v, want ErrConditionFailed", err)
+	}
+	if err := m.Update(context.Background(), "items", "a", map[string]interface{}{"missing.name": "x"}); err == nil {
+		t.Error("Update() of a missing document path succeeded")
+	}
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInvalidCursor is returned by QueryPage for cursors it didn't hand out
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// QueryPage returns up to limit items of the query starting at cursor, all of
+// them when limit is 0, and the cursor of the next page, empty after the last
+// one. DynamoDB applies its Limit before the filter expression, so pages are
+// read until enough items passed the filter. Asking for exactly the missing
+// number of items keeps the last evaluated key right behind the last item
+// returned, so no item is skipped between pages.
+func (dbClient *DBClient) QueryPage(ctx context.Context, queryInput *dynamodb.QueryInput, limit int, cursor string, output interface{}) (string, error) {
+	input := *queryInput
+	if cursor != "" {
+		key, err := decodeCursor(cursor)
+		if err != nil {
+			return "", err
+		}
+		input.ExclusiveStartKey = key
+	}
+
+	var items []map[string]types.AttributeValue
+	var next string
+	for {
+		if limit > 0 {
+			input.Limit = aws.Int32(int32(limit - len(items)))
+		}
+
+		result, err := dbClient.Svc.Query(ctx, &input)
+		if err != nil {
+			return "", fmt.Errorf("error querying: %v", err)
+		}
+		items = append(items, result.Items...)
+
+		if result.LastEvaluatedKey == nil {
+			break
+		}
+		if limit > 0 && len(items) >= limit {
+			if next, err = encodeCursor(result.LastEvaluatedKey); err != nil {
+				return "", err
+			}
+			break
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	if err := attributevalue.UnmarshalListOfMaps(items, output); err != nil {
+		return "", fmt.Errorf("error unmarshalling result items: %v", err)
+	}
+	return next, nil
+}
+
+// cursorValue is a key attribute, keys are strings or numbers
+type cursorValue struct {
+	S *string `json:"s,omitempty"`
+	N *string `json:"n,omitempty"`
+}
+
+func encodeCursor(key map[string]types.AttributeValue) (string, error) {
+	values := map[string]cursorValue{}
+	for name, value := range key {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			values[name] = cursorValue{S: aws.String(v.Value)}
+		case *types.AttributeValueMemberN:
+			values[name] = cursorValue{N: aws.String(v.Value)}
+		default:
+			return "", fmt.Errorf("unsupported key attribute %s", name)
+		}
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var values map[string]cursorValue
+	if err := json.Unmarshal(data, &values); err != nil || len(values) == 0 {
+		return nil, ErrInvalidCursor
+	}
+
+	key := map[string]types.AttributeValue{}
+	for name, value := range values {
+		switch {
+		case value.S != nil:
+			key[name] = &types.AttributeValueMemberS{Value: *value.S}
+		case value.N != nil:
+			key[name] = &types.AttributeValueMemberN{Value: *value.N}
+		default:
+			return nil, ErrInvalidCursor
+		}
+	}
+	return key, nil
+}
@@ -0,0 +1,244 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vdparikh/veriflow/config"
+)
+
+// Headers signed when the config doesn't list any
+var defaultDKIMHeaders = []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "List-Unsubscribe"}
+
+// DKIMSigner adds a DKIM-Signature (RFC 6376) to outgoing messages. Headers
+// and body use the relaxed canonicalization, which survives the whitespace
+// changes relays commonly make. Keys are RSA (rsa-sha256) or Ed25519 (ed25519-sha256, RFC 8463).
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	Headers  []string
+	Key      crypto.Signer
+}
+
+// NewDKIMSigner returns nil when DKIM isn't configured
+func NewDKIMSigner(cfg *config.Config) (*DKIMSigner, error) {
+	dkimCfg := cfg.Email.DKIM
+	if dkimCfg.Selector == "" {
+		return nil, nil
+	}
+
+	keyPEM := []byte(dkimCfg.PrivateKey)
+	if dkimCfg.PrivateKeyFile != "" {
+		var err error
+		if keyPEM, err = os.ReadFile(dkimCfg.PrivateKeyFile); err != nil {
+			return nil, err
+		}
+	}
+	key, err := parseDKIMKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	signer := &DKIMSigner{
+		Domain:   dkimCfg.Domain,
+		Selector: dkimCfg.Selector,
+		Headers:  dkimCfg.Headers,
+		Key:      key,
+	}
+	if signer.Domain == "" {
+		if at := strings.LastIndex(cfg.Email.From, "@"); at >= 0 {
+			signer.Domain = cfg.Email.From[at+1:]
+		}
+	}
+	if signer.Domain == "" {
+		return nil, errors.New("dkim domain is not set")
+	}
+	if len(signer.Headers) == 0 {
+		signer.Headers = defaultDKIMHeaders
+	}
+
+	return signer, nil
+}
+
+func parseDKIMKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("dkim private key is not PEM encoded")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			return key, nil
+		case ed25519.PrivateKey:
+			return key, nil
+		}
+		return nil, fmt.Errorf("unsupported dkim key type %T", key)
+	default:
+		return nil, fmt.Errorf("unsupported dkim key %q", block.Type)
+	}
+}
+
+// Sign returns msg with a DKIM-Signature header prepended. msg must use CRLF line endings.
+func (s *DKIMSigner) Sign(msg []byte) ([]byte, error) {
+	headerEnd := bytes.Index(msg, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, errors.New("message has no body")
+	}
+	headers := parseHeaders(string(msg[:headerEnd+2]))
+	bodyHash := sha256.Sum256(relaxedBody(msg[headerEnd+4:]))
+
+	algorithm := "rsa-sha256"
+	if _, ok := s.Key.(ed25519.PrivateKey); ok {
+		algorithm = "ed25519-sha256"
+	}
+
+	// A header listed twice signs the next instance up from the bottom (RFC 6376 5.4.2)
+	var signed []string
+	var names []string
+	used := map[string]int{}
+	for _, name := range s.Headers {
+		key := strings.ToLower(name)
+		for i := len(headers) - 1 - used[key]; i >= 0; i-- {
+			if strings.ToLower(headers[i].name) != key {
+				continue
+			}
+			used[key] = len(headers) - i
+			signed = append(signed, relaxedHeader(headers[i].name, headers[i].value))
+			names = append(names, name)
+			break
+		}
+	}
+	if !containsFold(names, "from") {
+		return nil, errors.New("dkim signature must cover the From header")
+	}
+
+	value := fmt.Sprintf("v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s; t=%d; h=%s; bh=%s; b=",
+		algorithm, s.Domain, s.Selector, time.Now().Unix(), strings.Join(names, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+
+	// The signature header itself is hashed last, with an empty b= and no CRLF
+	hash := sha256.New()
+	for _, header := range signed {
+		hash.Write([]byte(header))
+	}
+	hash.Write([]byte(strings.TrimSuffix(relaxedHeader("DKIM-Signature", value), "\r\n")))
+	digest := hash.Sum(nil)
+
+	var signature []byte
+	var err error
+	switch key := s.Key.(type) {
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, digest)
+	default:
+		signature, err = key.Sign(rand.Reader, digest, crypto.SHA256)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	header := "DKIM-Signature: " + value + foldBase64(base64.StdEncoding.EncodeToString(signature)) + "\r\n"
+	return append([]byte(header), msg...), nil
+}
+
+type headerField struct {
+	name, value string
+}
+
+// parseHeaders splits the header block into fields, keeping folded values as they are
+func parseHeaders(block string) []headerField {
+	var fields []headerField
+	for _, line := range strings.SplitAfter(block, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].value += line
+			continue
+		}
+		if colon := strings.Index(line, ":"); colon > 0 {
+			fields = append(fields, headerField{name: line[:colon], value: line[colon+1:]})
+		}
+	}
+	return fields
+}
+
+// relaxedHeader canonicalizes a header field (RFC 6376 3.4.2)
+func relaxedHeader(name, value string) string {
+	value = strings.NewReplacer("\r\n", "").Replace(value)
+	return strings.ToLower(strings.TrimSpace(name)) + ":" + strings.TrimSpace(collapseWhitespace(value)) + "\r\n"
+}
+
+// relaxedBody canonicalizes the body (RFC 6376 3.4.4)
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWhitespace(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+func collapseWhitespace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// foldBase64 wraps the signature, whitespace in b= is ignored by verifiers
+func foldBase64(s string) string {
+	var b strings.Builder
+	for len(s) > 72 {
+		b.WriteString(s[:72] + "\r\n\t")
+		s = s[72:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
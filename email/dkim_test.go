@@ -0,0 +1,211 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testMessage = "From: Veriflow <veriflow@example.com>\r\n" +
+	"To: someone@example.org\r\n" +
+	"Subject: Please verify\r\n" +
+	" your identity\r\n" +
+	"Date: Mon, 19 Oct 2026 10:00:00 +0000\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Hello,  please verify.\r\n" +
+	"\r\n" +
+	"\r\n"
+
+// verifyDKIM checks the first DKIM-Signature of msg the way a receiver does,
+// with the public key published in DNS
+func verifyDKIM(msg []byte, publicKey crypto.PublicKey) error {
+	headerEnd := bytes.Index(msg, []byte("\r\n\r\n"))
+	headers := parseHeaders(string(msg[:headerEnd+2]))
+	if len(headers) == 0 || !strings.EqualFold(headers[0].name, "DKIM-Signature") {
+		return fmt.Errorf("no DKIM-Signature")
+	}
+	signature := headers[0]
+
+	tags := map[string]string{}
+	for _, tag := range strings.Split(signature.value, ";") {
+		name, value, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(name)] = strings.Join(strings.Fields(value), "")
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(msg[headerEnd+4:]))
+	if tags["bh"] != base64.StdEncoding.EncodeToString(bodyHash[:]) {
+		return fmt.Errorf("body hash mismatch")
+	}
+
+	hash := sha256.New()
+	used := map[string]int{}
+	for _, name := range strings.Split(tags["h"], ":") {
+		key := strings.ToLower(name)
+		for i := len(headers) - 1 - used[key]; i > 0; i-- {
+			if strings.ToLower(headers[i].name) == key {
+				used[key] = len(headers) - i
+				hash.Write([]byte(relaxedHeader(headers[i].name, headers[i].value)))
+				break
+			}
+		}
+	}
+	// The signature is hashed with an empty b=, which Sign puts last
+	unsigned := signature.value[:strings.LastIndex(signature.value, "; b=")+4]
+	hash.Write([]byte(strings.TrimSuffix(relaxedHeader(signature.name, unsigned), "\r\n")))
+	digest := hash.Sum(nil)
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return err
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if tags["a"] != "rsa-sha256" {
+			return fmt.Errorf("algorithm %s for an RSA key", tags["a"])
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig)
+	case ed25519.PublicKey:
+		if tags["a"] != "ed25519-sha256" {
+			return fmt.Errorf("algorithm %s for an Ed25519 key", tags["a"])
+		}
+		if !ed25519.Verify(key, digest, sig) {
+			return fmt.Errorf("ed25519 signature mismatch")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported key %T", publicKey)
+	}
+}
+
+func testDKIMKeys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]crypto.Signer{"rsa": rsaKey, "ed25519": edKey}
+}
+
+func TestDKIMSignVerifies(t *testing.T) {
+	for name, key := range testDKIMKeys(t) {
+		t.Run(name, func(t *testing.T) {
+			signer := &DKIMSigner{Domain: "example.com", Selector: "veriflow", Headers: defaultDKIMHeaders, Key: key}
+			signed, err := signer.Sign([]byte(testMessage))
+			if err != nil {
+				t.Fatalf("Sign() error = %v", err)
+			}
+
+			if !bytes.HasSuffix(signed, []byte(testMessage)) {
+				t.Fatal("Sign() changed the message")
+			}
+			if err := verifyDKIM(signed, key.Public()); err != nil {
+				t.Fatalf("signature does not verify: %v", err)
+			}
+
+			tampered := bytes.Replace(signed, []byte("please verify."), []byte("please pay."), 1)
+			if err := verifyDKIM(tampered, key.Public()); err == nil {
+				t.Fatal("tampered body verified")
+			}
+			tampered = bytes.Replace(signed, []byte("To: someone@example.org"), []byte("To: attacker@example.org"), 1)
+			if err := verifyDKIM(tampered, key.Public()); err == nil {
+				t.Fatal("tampered header verified")
+			}
+		})
+	}
+}
+
+// Relays refold headers and change whitespace, relaxed canonicalization keeps the signature valid
+func TestDKIMSurvivesRefolding(t *testing.T) {
+	for name, key := range testDKIMKeys(t) {
+		t.Run(name, func(t *testing.T) {
+			signer := &DKIMSigner{Domain: "example.com", Selector: "veriflow", Headers: defaultDKIMHeaders, Key: key}
+			signed, err := signer.Sign([]byte(testMessage))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			relayed := bytes.Replace(signed, []byte("Subject: Please verify\r\n your identity"), []byte("subject:   Please\r\n\t verify your\t identity  "), 1)
+			relayed = bytes.Replace(relayed, []byte("Hello,  please verify.\r\n\r\n\r\n"), []byte("Hello, please verify.   \r\n"), 1)
+			if err := verifyDKIM(relayed, key.Public()); err != nil {
+				t.Fatalf("refolded message does not verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestRelaxedHeaderFolding(t *testing.T) {
+	tests := []struct {
+		name, value string
+	}{
+		{"Subject", " Please verify your identity\r\n"},
+		{"subject", "Please verify your identity\r\n"},
+		{"SUBJECT ", "  Please verify\r\n your identity\r\n"},
+		{"Subject", " Please\r\n\tverify \t your\r\n  identity  \r\n"},
+	}
+
+	want := "subject:Please verify your identity\r\n"
+	for _, tt := range tests {
+		if got := relaxedHeader(tt.name, tt.value); got != want {
+			t.Errorf("relaxedHeader(%q, %q) = %q, want %q", tt.name, tt.value, got, want)
+		}
+	}
+
+	headers := parseHeaders("Subject: Please verify\r\n your identity\r\nTo: a@example.org\r\n")
+	if len(headers) != 2 || relaxedHeader(headers[0].name, headers[0].value) != want {
+		t.Errorf("parseHeaders() = %q", headers)
+	}
+}
+
+func TestRelaxedBody(t *testing.T) {
+	got := string(relaxedBody([]byte("Hello \t world  \r\nbye\r\n\r\n\r\n")))
+	if want := "Hello world\r\nbye\r\n"; got != want {
+		t.Errorf("relaxedBody() = %q, want %q", got, want)
+	}
+	if got := relaxedBody([]byte("\r\n\r\n")); got != nil {
+		t.Errorf("relaxedBody() of an empty body = %q, want nil", got)
+	}
+}
+
+func TestDKIMSignRequiresFrom(t *testing.T) {
+	signer := &DKIMSigner{Domain: "example.com", Selector: "veriflow", Headers: []string{"To", "Subject"}, Key: testDKIMKeys(t)["ed25519"]}
+	if _, err := signer.Sign([]byte(testMessage)); err == nil {
+		t.Fatal("Sign() without From succeeded")
+	}
+}
+
+func TestParseDKIMKey(t *testing.T) {
+	for name, key := range testDKIMKeys(t) {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := parseDKIMKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+		if err != nil {
+			t.Fatalf("%s: parseDKIMKey() error = %v", name, err)
+		}
+		if !parsed.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(key.Public()) {
+			t.Errorf("%s: parsed key differs", name)
+		}
+	}
+
+	if _, err := parseDKIMKey([]byte("not a key")); err == nil {
+		t.Error("parseDKIMKey() accepted garbage")
+	}
+}
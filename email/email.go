@@ -1,48 +1,65 @@
 package email
 
 import (
-	"fmt"
-	"net/smtp"
-	"strings"
+	"context"
+	"net/mail"
 	"time"
 
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/html"
 	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/metrics"
 	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/tracing"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/gomarkdown/markdown/parser"
 )
 
 type Email interface {
-	SendInitConfirmation(request *models.VerifyRequest) error
-	SendVerificationMessage(request *models.VerifyRequest) error
-	SendCompletionMessage(request *models.VerifyRequest) error
-	SendFailedVerificationMessage(request *models.VerifyRequest) error
+	SendInitConfirmation(ctx context.Context, request *models.VerifyRequest) error
+	SendVerificationMessage(ctx context.Context, request *models.VerifyRequest) error
+	SendCompletionMessage(ctx context.Context, request *models.VerifyRequest) error
+	SendFailedVerificationMessage(ctx context.Context, request *models.VerifyRequest) error
+	SendCancellationMessage(ctx context.Context, request *models.VerifyRequest) error
+	SendCode(ctx context.Context, request *models.VerifyRequest, address, code string, ttl time.Duration) error
 }
 
-func NewEmail(cfg *config.Config) Email {
+func NewEmail(cfg *config.Config) (Email, error) {
+	transport, err := NewSMTPTransport(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	return &EmailService{
-		SMTPServer: cfg.Email.SMTPServer,
-		Port:       cfg.Email.Port,
-		Username:   cfg.Email.Username,
-		Password:   cfg.Email.Password,
-		From:       cfg.Email.From,
-		Messages:   cfg.Messages,
-		Enabled:    cfg.Email.Enabled,
+	renderer, err := NewRenderer(cfg.Email.TemplatesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dkim, err := NewDKIMSigner(cfg)
+	if err != nil {
+		return nil, err
 	}
 
+	return &EmailService{
+		Transport:      transport,
+		DKIM:           dkim,
+		Renderer:       renderer,
+		From:           &mail.Address{Name: cfg.Email.FromName, Address: cfg.Email.From},
+		UnsubscribeURL: cfg.Email.UnsubscribeURL,
+		Messages:       cfg.Templates,
+		Enabled:        cfg.Email.Enabled,
+	}, nil
 }
 
 type EmailService struct {
-	SMTPServer string
-	Port       int
-	Username   string
-	Password   string
-	From       string
-	Messages   config.Messages
-	Enabled    bool
+	Transport      *SMTPTransport
+	DKIM           *DKIMSigner
+	Renderer       *Renderer
+	From           *mail.Address
+	UnsubscribeURL string
+	Messages       *config.MessageTemplates
+	Enabled        bool
 }
 
 func mdToHTML(md string) string {
@@ -55,108 +72,150 @@ func mdToHTML(md string) string {
 	return string(markdown.Render(doc, renderer))
 }
 
-func (s *EmailService) sendEmail(from string, to []string, subject string, body string) error {
-	auth := smtp.PlainAuth("", s.Username, s.Password, s.SMTPServer)
-
-	html := mdToHTML(body)
-
-	htmlBody := fmt.Sprintf(`
-		<html>
-		<head>
-			<style>
-				body { font-family: Avenir, 'Segoe UI', Arial, sans-serif; background: #f2f2f2; }
-				.box { border: 2px solid #f2f2f2;  }
-				.header { background: #f2f2f2; padding: 10px; text-align: center; }
-				.header img { width: 200px; }
-				.content { padding: 20px; background: #fff;}
-				.footer { background: #f2f2f2; padding: 10px; text-align: center; }
-				.buttons { margin: 20px 0px; }
-				a.btn { border: 1px solid #fff; border-radius: 0.5rem; padding: 5px 50px; background: #eee; text-decoration: none; color: #fff; font-size: 16px; font-weight: bold; margin-right: 10px; }
-				a.btn.auth { background: green; }
-				a.btn.report { background: crimson; }
-			</style>
-		</head>
-		<body>
-		<div class="box">
-			<div class="header">
-				<p><strong>Veriflow Verification</strong></p>
-			</div>
-			<div class="content">
-				%s
-			</div>
-			<div class="footer">
-				<!-- Footer content here -->
-			</div>
-		</div>
-		</body>
-		</html>
-	`, html)
-
-	msg := []byte("MIME-Version: 1.0\r\n" +
-		"Content-Type: text/html; charset=\"UTF-8\"\r\n" +
-		"From: " + from + "\r\n" +
-		"To: " + strings.Join(to, ", ") + "\r\n" +
-		"Subject: " + subject + "\r\n\r\n" +
-		htmlBody)
-
-	err := smtp.SendMail("smtp.gmail.com:587", auth, s.From, to, msg)
+// sendEmail renders the template with the configured message in the locale
+func (s *EmailService) sendEmail(ctx context.Context, to []*mail.Address, subject, template string, request *models.VerifyRequest, locale, message string, data config.MessageData) error {
+	textMessage, err := s.Messages.Execute(locale, message, data)
+	if err != nil {
+		return err
+	}
+	htmlMessage, err := messageHTML(s.Messages, locale, message, data)
+	if err != nil {
+		return err
+	}
+
+	html, text, err := s.Renderer.Render(template, TemplateData{
+		Subject:        subject,
+		Request:        request,
+		Text:           textMessage,
+		HTML:           htmlMessage,
+		UnsubscribeURL: s.UnsubscribeURL,
+	})
+	if err != nil {
+		return err
+	}
+
+	msg, err := (&Message{
+		From:           s.From,
+		To:             to,
+		Subject:        subject,
+		Text:           text,
+		HTML:           html,
+		UnsubscribeURL: s.UnsubscribeURL,
+	}).Bytes()
+	if err != nil {
+		return err
+	}
+	if s.DKIM != nil {
+		if msg, err = s.DKIM.Sign(msg); err != nil {
+			return err
+		}
+	}
+
+	rcpts := make([]string, len(to))
+	for i, addr := range to {
+		rcpts[i] = addr.Address
+	}
+
+	_, span := tracing.Start(ctx, "smtp.SendMail", attribute.String("email.subject", subject), attribute.Int("email.recipients", len(to)))
+	err = s.Transport.Send(ctx, s.From.Address, rcpts, msg)
+	tracing.End(span, err)
+	if err != nil {
+		metrics.EmailFailures.WithLabelValues(subject).Inc()
+	}
 	return err
 }
 
-func (s *EmailService) SendVerificationMessage(request *models.VerifyRequest) error {
-	if !s.Enabled {
+// reaches tells whether a party on channel gets a copy of the verification
+// emails. Parties without the communication tool always do, the others when
+// email is enabled. Messages only the communication tool sends otherwise, like
+// confirmations and cancellations, are only emailed to parties on email.
+func (s *EmailService) reaches(channel string) bool {
+	return s.Enabled || channel == models.ChannelEmail
+}
+
+func (s *EmailService) SendVerificationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	if !s.reaches(request.RecipientChannel) {
 		return nil
 	}
 
-	to := []string{
-		request.Recipient.Email,
+	to := []*mail.Address{
+		{Name: request.Recipient.Name, Address: request.Recipient.Email},
 	}
-
-	subject := "Verification Request"
-	body := fmt.Sprintf(s.Messages.VerificationMessage, request.Recipient.Name, request.Requestor.Name)
-	body = body + fmt.Sprintf("<div class='buttons'><a class='btn auth' href='%s'>Verify</a> <a class='btn report' href='%s'>Report</a></div>", request.AuthLink, request.ReportLink)
-	return s.sendEmail(s.From, to, subject, body)
+	return s.sendEmail(ctx, to, "Verification Request", "verification", request,
+		request.Recipient.MessageLocale(), config.VerificationMessage, config.NewMessageData(request))
 }
 
-func (s *EmailService) SendInitConfirmation(request *models.VerifyRequest) error {
-	if !s.Enabled {
+func (s *EmailService) SendInitConfirmation(ctx context.Context, request *models.VerifyRequest) error {
+	if request.RequestorChannel != models.ChannelEmail {
 		return nil
 	}
 
-	to := []string{
-		request.Requestor.Email,
+	to := []*mail.Address{
+		{Name: request.Requestor.Name, Address: request.Requestor.Email},
 	}
-	subject := "Verification Request Initiated"
-	body := fmt.Sprintf(s.Messages.RequestConfirmationMessage, request.Requestor.Name, request.Recipient.Name, time.Now().Format("2006-01-02 03:04 PM"))
-
-	return s.sendEmail(s.From, to, subject, body)
+	return s.sendEmail(ctx, to, "Verification Request Initiated", "init_confirmation", request,
+		request.Requestor.MessageLocale(), config.RequestConfirmationMessage, config.NewMessageData(request))
 }
 
-func (s *EmailService) SendCompletionMessage(request *models.VerifyRequest) error {
-	if !s.Enabled {
+func (s *EmailService) SendCompletionMessage(ctx context.Context, request *models.VerifyRequest) error {
+	var to []*mail.Address
+	if s.reaches(request.RecipientChannel) {
+		to = append(to, &mail.Address{Name: request.Recipient.Name, Address: request.Recipient.Email})
+	}
+	if s.reaches(request.RequestorChannel) {
+		to = append(to, &mail.Address{Name: request.Requestor.Name, Address: request.Requestor.Email})
+	}
+	if len(to) == 0 {
 		return nil
 	}
 
-	to := []string{
-		request.Recipient.Email,
-		request.Requestor.Email,
+	return s.sendEmail(ctx, to, "Verification Completed", "completion", request,
+		request.Requestor.MessageLocale(), config.RequestorCompletionMessage, config.NewMessageData(request))
+}
+
+func (s *EmailService) SendFailedVerificationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	if s.reaches(request.RequestorChannel) {
+		to := []*mail.Address{
+			{Name: request.Requestor.Name, Address: request.Requestor.Email},
+		}
+		err := s.sendEmail(ctx, to, "Verification Failed", "failure", request,
+			request.Requestor.MessageLocale(), config.RequestorVerificationFailureMessage, config.NewMessageData(request))
+		if err != nil {
+			return err
+		}
 	}
-	subject := "Verification Completed"
-	body := fmt.Sprintf(s.Messages.RequestorCompletionMessage, request.Requestor.Name, request.Recipient.Name, time.Now().Format("2006-01-02 03:04 PM"))
 
-	return s.sendEmail(s.From, to, subject, body)
+	// The recipient would otherwise never learn the request they got is void
+	if request.RecipientChannel == models.ChannelEmail {
+		to := []*mail.Address{
+			{Name: request.Recipient.Name, Address: request.Recipient.Email},
+		}
+		return s.sendEmail(ctx, to, "Verification Failed", "failure", request,
+			request.Recipient.MessageLocale(), config.RecipientVerificationFailureMessage, config.NewMessageData(request))
+	}
+	return nil
 }
 
-func (s *EmailService) SendFailedVerificationMessage(request *models.VerifyRequest) error {
-	if !s.Enabled {
+func (s *EmailService) SendCancellationMessage(ctx context.Context, request *models.VerifyRequest) error {
+	if request.RecipientChannel != models.ChannelEmail {
 		return nil
 	}
 
-	to := []string{
-		request.Requestor.Email,
+	to := []*mail.Address{
+		{Name: request.Recipient.Name, Address: request.Recipient.Email},
 	}
-	subject := "Verification Failed"
-	body := fmt.Sprintf(s.Messages.RequestorVerificationFailureMessage, request.Requestor.Name, request.Recipient.Name, time.Now().Format("2006-01-02 03:04 PM"))
+	return s.sendEmail(ctx, to, "Verification Cancelled", "cancellation", request,
+		request.Recipient.MessageLocale(), config.CancellationMessage, config.NewMessageData(request))
+}
 
-	return s.sendEmail(s.From, to, subject, body)
+// SendCode mails a one-time code for the second factor. It is sent even when
+// email is disabled, the recipient asked for it.
+func (s *EmailService) SendCode(ctx context.Context, request *models.VerifyRequest, address, code string, ttl time.Duration) error {
+	to := []*mail.Address{
+		{Name: request.Recipient.Name, Address: address},
+	}
+	data := config.NewMessageData(request)
+	data.Code, data.Minutes = code, int(ttl.Minutes())
+	return s.sendEmail(ctx, to, "Your Verification Code", "code", request,
+		request.Recipient.MessageLocale(), config.EmailCodeMessage, data)
 }
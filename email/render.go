@@ -0,0 +1,114 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/models"
+)
+
+//go:embed templates/*
+var defaultTemplates embed.FS
+
+// TemplateData is what the email templates are executed with
+type TemplateData struct {
+	Subject string
+	Request *models.VerifyRequest
+
+	// The configured message as plain text and rendered from markdown
+	Text string
+	HTML htmltemplate.HTML
+
+	UnsubscribeURL string
+
+	// The rendered message template, only set for the layout
+	Body interface{}
+}
+
+// Renderer executes the email templates. Every message has a NAME.html and a
+// NAME.txt template whose output is wrapped in layout.html and layout.txt.
+type Renderer struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// NewRenderer parses the built-in templates, files in dir with the same name replace them
+func NewRenderer(dir string) (*Renderer, error) {
+	html, err := htmltemplate.ParseFS(defaultTemplates, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	text, err := texttemplate.ParseFS(defaultTemplates, "templates/*.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	if dir != "" {
+		if files, _ := filepath.Glob(filepath.Join(dir, "*.html")); len(files) > 0 {
+			if html, err = html.ParseFiles(files...); err != nil {
+				return nil, err
+			}
+		}
+		if files, _ := filepath.Glob(filepath.Join(dir, "*.txt")); len(files) > 0 {
+			if text, err = text.ParseFiles(files...); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &Renderer{html: html, text: text}, nil
+}
+
+// Render returns the HTML and the plain text body of the message
+func (r *Renderer) Render(name string, data TemplateData) (string, string, error) {
+	var body, html bytes.Buffer
+	if err := r.html.ExecuteTemplate(&body, name+".html", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s.html: %w", name, err)
+	}
+	data.Body = htmltemplate.HTML(body.String())
+	if err := r.html.ExecuteTemplate(&html, "layout.html", data); err != nil {
+		return "", "", fmt.Errorf("failed to render layout.html: %w", err)
+	}
+
+	var textBody, text bytes.Buffer
+	if err := r.text.ExecuteTemplate(&textBody, name+".txt", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s.txt: %w", name, err)
+	}
+	data.Body = textBody.String()
+	if err := r.text.ExecuteTemplate(&text, "layout.txt", data); err != nil {
+		return "", "", fmt.Errorf("failed to render layout.txt: %w", err)
+	}
+
+	return html.String(), text.String(), nil
+}
+
+// messageHTML renders the markdown of a configured message before filling in
+// the values, so names and errors are escaped instead of parsed as markup
+func messageHTML(messages *config.MessageTemplates, locale, name string, data config.MessageData) (htmltemplate.HTML, error) {
+	values := map[string]string{}
+	placeholder := func(value string) string {
+		key := fmt.Sprintf("veriflowvalue%dx", len(values))
+		values[key] = htmltemplate.HTMLEscapeString(value)
+		return key
+	}
+	data.Requestor.Name, data.Requestor.Email = placeholder(data.Requestor.Name), placeholder(data.Requestor.Email)
+	data.Recipient.Name, data.Recipient.Email = placeholder(data.Recipient.Name), placeholder(data.Recipient.Email)
+	data.Error, data.Code = placeholder(data.Error), placeholder(data.Code)
+
+	md, err := messages.Execute(locale, name, data)
+	if err != nil {
+		return "", err
+	}
+
+	html := mdToHTML(md)
+	for key, value := range values {
+		html = strings.ReplaceAll(html, key, value)
+	}
+	return htmltemplate.HTML(html), nil
+}
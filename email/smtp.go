@@ -0,0 +1,189 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vdparikh/veriflow/config"
+)
+
+// TLS modes of the SMTP connection
+const (
+	TLSStartTLS = "starttls"
+	TLSImplicit = "tls"
+	TLSNone     = "none"
+)
+
+// SMTPTransport delivers messages to an SMTP server. The connection is
+// secured with STARTTLS, implicit TLS (SMTPS) or not at all for local relays.
+type SMTPTransport struct {
+	Host               string
+	Port               int
+	Username           string
+	Password           string
+	TLSMode            string
+	AuthMechanism      string // plain, login, cram-md5 or none
+	Timeout            time.Duration
+	InsecureSkipVerify bool
+}
+
+func NewSMTPTransport(cfg *config.Config) (*SMTPTransport, error) {
+	emailCfg := cfg.Email
+	transport := &SMTPTransport{
+		Host:               emailCfg.SMTPServer,
+		Port:               emailCfg.Port,
+		Username:           emailCfg.Username,
+		Password:           emailCfg.Password,
+		TLSMode:            emailCfg.TLS,
+		AuthMechanism:      emailCfg.Auth,
+		Timeout:            time.Duration(emailCfg.TimeoutSeconds) * time.Second,
+		InsecureSkipVerify: emailCfg.InsecureSkipVerify,
+	}
+
+	switch transport.TLSMode {
+	case TLSStartTLS, TLSImplicit, TLSNone:
+	default:
+		return nil, fmt.Errorf("unsupported email tls mode %q", transport.TLSMode)
+	}
+
+	switch transport.AuthMechanism {
+	case "plain", "login", "cram-md5", "none":
+	default:
+		return nil, fmt.Errorf("unsupported email auth mechanism %q", transport.AuthMechanism)
+	}
+
+	return transport, nil
+}
+
+// Send delivers msg to the recipients. The timeout covers the whole
+// conversation with the server, the context can only shorten it.
+func (t *SMTPTransport) Send(ctx context.Context, from string, to []string, msg []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, t.Timeout)
+	defer cancel()
+
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", t.address(), err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if t.TLSMode == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("smtp server does not support STARTTLS")
+		}
+		if err := client.StartTLS(t.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if auth := t.auth(); auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return errors.New("smtp server does not support AUTH")
+		}
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(msg); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (t *SMTPTransport) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{}
+	if t.TLSMode == TLSImplicit {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: t.tlsConfig()}
+		return tlsDialer.DialContext(ctx, "tcp", t.address())
+	}
+	return dialer.DialContext(ctx, "tcp", t.address())
+}
+
+func (t *SMTPTransport) address() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+func (t *SMTPTransport) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: t.Host, InsecureSkipVerify: t.InsecureSkipVerify}
+}
+
+func (t *SMTPTransport) auth() smtp.Auth {
+	switch t.AuthMechanism {
+	case "plain":
+		return smtp.PlainAuth("", t.Username, t.Password, t.Host)
+	case "login":
+		return &loginAuth{username: t.Username, password: t.Password, host: t.Host}
+	case "cram-md5":
+		return smtp.CRAMMD5Auth(t.Username, t.Password)
+	default:
+		return nil
+	}
+}
+
+// loginAuth implements the LOGIN mechanism still required by some servers
+// (e.g. Office 365). Like PLAIN it only sends the password over TLS or to localhost.
+type loginAuth struct {
+	username, password, host string
+}
+
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalhost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
+
+func isLocalhost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
@@ -0,0 +1,322 @@
+package email
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer is an in-process SMTP server speaking just enough of the
+// protocol for the transport: STARTTLS, implicit TLS and the PLAIN, LOGIN
+// and CRAM-MD5 mechanisms
+type fakeSMTPServer struct {
+	listener net.Listener
+	tlsMode  string
+	username string
+	password string
+	config   *tls.Config
+
+	mu       sync.Mutex
+	received []receivedMail
+}
+
+type receivedMail struct {
+	from string
+	to   []string
+	data string
+	tls  bool
+	auth string
+}
+
+func newFakeSMTPServer(t *testing.T, tlsMode string) *fakeSMTPServer {
+	t.Helper()
+
+	server := &fakeSMTPServer{tlsMode: tlsMode, username: "veriflow", password: "secret", config: testTLSConfig(t)}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsMode == TLSImplicit {
+		listener = tls.NewListener(listener, server.config)
+	}
+	server.listener = listener
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeSMTPServer) transport(auth string) *SMTPTransport {
+	return &SMTPTransport{
+		Host:               "127.0.0.1",
+		Port:               s.listener.Addr().(*net.TCPAddr).Port,
+		Username:           s.username,
+		Password:           s.password,
+		TLSMode:            s.tlsMode,
+		AuthMechanism:      auth,
+		Timeout:            5 * time.Second,
+		InsecureSkipVerify: true,
+	}
+}
+
+func (s *fakeSMTPServer) messages() []receivedMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]receivedMail(nil), s.received...)
+}
+
+func (s *fakeSMTPServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	_, secure := conn.(*tls.Conn)
+	reader := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	readLine := func() (string, bool) {
+		line, err := reader.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err == nil
+	}
+
+	var mail receivedMail
+	reply("220 127.0.0.1 fake ESMTP")
+	for {
+		line, ok := readLine()
+		if !ok {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply("250-127.0.0.1")
+			if s.tlsMode == TLSStartTLS && !secure {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN LOGIN CRAM-MD5")
+		case "STARTTLS":
+			reply("220 ready to start TLS")
+			tlsConn := tls.Server(conn, s.config)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, reader, secure = tlsConn, bufio.NewReader(tlsConn), true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			if !s.authenticate(strings.ToUpper(mechanism), initial, reply, readLine) {
+				reply("535 authentication failed")
+				continue
+			}
+			mail.auth = strings.ToUpper(mechanism)
+			reply("235 authenticated")
+		case "MAIL":
+			mail.from = strings.TrimSuffix(strings.TrimPrefix(arg, "FROM:<"), ">")
+			reply("250 OK")
+		case "RCPT":
+			mail.to = append(mail.to, strings.TrimSuffix(strings.TrimPrefix(arg, "TO:<"), ">"))
+			reply("250 OK")
+		case "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				line, ok := readLine()
+				if !ok {
+					return
+				}
+				if line == "." {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, ".") + "\n")
+			}
+			mail.data, mail.tls = data.String(), secure
+			s.mu.Lock()
+			s.received = append(s.received, mail)
+			s.mu.Unlock()
+			mail = receivedMail{auth: mail.auth}
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) authenticate(mechanism, initial string, reply func(string, ...interface{}), readLine func() (string, bool)) bool {
+	challenge := func(prompt string) string {
+		reply("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, _ := readLine()
+		decoded, _ := base64.StdEncoding.DecodeString(line)
+		return string(decoded)
+	}
+
+	switch mechanism {
+	case "PLAIN":
+		decoded, _ := base64.StdEncoding.DecodeString(initial)
+		return string(decoded) == "\x00"+s.username+"\x00"+s.password
+	case "LOGIN":
+		return challenge("Username:") == s.username && challenge("Password:") == s.password
+	case "CRAM-MD5":
+		nonce := "<1896.697170952@127.0.0.1>"
+		mac := hmac.New(md5.New, []byte(s.password))
+		mac.Write([]byte(nonce))
+		return challenge(nonce) == s.username+" "+hex.EncodeToString(mac.Sum(nil))
+	default:
+		return false
+	}
+}
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestSMTPTransportSend(t *testing.T) {
+	tests := []struct {
+		tlsMode string
+		auth    string
+		secure  bool
+	}{
+		{TLSNone, "none", false},
+		{TLSNone, "plain", false},
+		{TLSNone, "cram-md5", false},
+		{TLSStartTLS, "plain", true},
+		{TLSStartTLS, "login", true},
+		{TLSStartTLS, "cram-md5", true},
+		{TLSImplicit, "plain", true},
+		{TLSImplicit, "login", true},
+		{TLSImplicit, "cram-md5", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.tlsMode+"/"+tt.auth, func(t *testing.T) {
+			server := newFakeSMTPServer(t, tt.tlsMode)
+			msg := []byte("Subject: Verify\r\n\r\nHello\r\n.hidden dot\r\n")
+
+			err := server.transport(tt.auth).Send(context.Background(), "veriflow@example.com", []string{"a@example.com", "b@example.com"}, msg)
+			if err != nil {
+				t.Fatalf("Send() error = %v", err)
+			}
+
+			received := server.messages()
+			if len(received) != 1 {
+				t.Fatalf("received %d messages, want 1", len(received))
+			}
+			mail := received[0]
+			if mail.from != "veriflow@example.com" || strings.Join(mail.to, ",") != "a@example.com,b@example.com" {
+				t.Errorf("envelope = %s -> %v", mail.from, mail.to)
+			}
+			if !strings.Contains(mail.data, "Subject: Verify") || !strings.Contains(mail.data, "\n.hidden dot\n") {
+				t.Errorf("data = %q", mail.data)
+			}
+			if mail.tls != tt.secure {
+				t.Errorf("tls = %v, want %v", mail.tls, tt.secure)
+			}
+			if want := strings.ToUpper(tt.auth); tt.auth != "none" && mail.auth != want {
+				t.Errorf("auth = %q, want %q", mail.auth, want)
+			}
+		})
+	}
+}
+
+func TestSMTPTransportWrongPassword(t *testing.T) {
+	server := newFakeSMTPServer(t, TLSStartTLS)
+	transport := server.transport("login")
+	transport.Password = "wrong"
+
+	if err := transport.Send(context.Background(), "veriflow@example.com", []string{"a@example.com"}, []byte("Hello\r\n")); err == nil {
+		t.Fatal("Send() succeeded with a wrong password")
+	}
+	if len(server.messages()) != 0 {
+		t.Fatal("message delivered without authentication")
+	}
+}
+
+// LOGIN sends the password in the clear, it is refused without TLS to other hosts
+func TestSMTPTransportLoginNeedsTLS(t *testing.T) {
+	auth := &loginAuth{username: "veriflow", password: "secret", host: "mail.example.com"}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com"}); err == nil {
+		t.Fatal("LOGIN started over an unencrypted connection")
+	}
+}
+
+func TestSMTPTransportTimeout(t *testing.T) {
+	// Accepts connections but never greets, like an unresponsive server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	for _, mode := range []string{TLSNone, TLSImplicit} {
+		transport := &SMTPTransport{
+			Host:          "127.0.0.1",
+			Port:          listener.Addr().(*net.TCPAddr).Port,
+			TLSMode:       mode,
+			AuthMechanism: "none",
+			Timeout:       200 * time.Millisecond,
+		}
+
+		start := time.Now()
+		err := transport.Send(context.Background(), "veriflow@example.com", []string{"a@example.com"}, []byte("Hello\r\n"))
+		if err == nil {
+			t.Fatalf("%s: Send() succeeded against a silent server", mode)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("%s: Send() took %s, want about the 200ms timeout", mode, elapsed)
+		}
+	}
+}
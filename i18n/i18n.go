@@ -0,0 +1,147 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/*.json
+var catalogFiles embed.FS
+
+// DefaultLanguage is used when none of the preferred languages is available
+const DefaultLanguage = "en"
+
+// Bundle holds the message catalogs of the web pages, one JSON file of
+// key/text pairs per language in locales/. Texts are HTML and can use
+// fmt verbs for their arguments, e.g. "Reference ID: %s".
+type Bundle struct {
+	catalogs map[string]map[string]string
+	tags     []language.Tag
+	matcher  language.Matcher
+}
+
+// NewBundle loads the catalogs and checks every catalog has exactly the keys
+// of the default language, so a page never shows a key instead of a text
+func NewBundle() (*Bundle, error) {
+	files, err := catalogFiles.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{catalogs: map[string]map[string]string{}}
+	for _, file := range files {
+		data, err := catalogFiles.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file.Name(), err)
+		}
+		b.catalogs[strings.TrimSuffix(file.Name(), ".json")] = catalog
+	}
+
+	if b.catalogs[DefaultLanguage] == nil {
+		return nil, fmt.Errorf("missing %s catalog", DefaultLanguage)
+	}
+	for _, lang := range b.Languages() {
+		if err := b.check(lang); err != nil {
+			return nil, err
+		}
+	}
+
+	// The matcher falls back to the first tag
+	b.tags = []language.Tag{language.Make(DefaultLanguage)}
+	for _, lang := range b.Languages() {
+		if lang != DefaultLanguage {
+			b.tags = append(b.tags, language.Make(lang))
+		}
+	}
+	b.matcher = language.NewMatcher(b.tags)
+
+	return b, nil
+}
+
+// check compares the keys of a catalog with the ones of the default language
+func (b *Bundle) check(lang string) error {
+	var missing, unknown []string
+	for key := range b.catalogs[DefaultLanguage] {
+		if _, ok := b.catalogs[lang][key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	for key := range b.catalogs[lang] {
+		if _, ok := b.catalogs[DefaultLanguage][key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+
+	if len(missing) > 0 || len(unknown) > 0 {
+		sort.Strings(missing)
+		sort.Strings(unknown)
+		return fmt.Errorf("%s catalog: missing keys %v, unknown keys %v", lang, missing, unknown)
+	}
+	return nil
+}
+
+// Languages lists the available languages
+func (b *Bundle) Languages() []string {
+	languages := make([]string, 0, len(b.catalogs))
+	for lang := range b.catalogs {
+		languages = append(languages, lang)
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// Translator picks the best available language for the preferences, given
+// in priority order as language tags or Accept-Language header values
+func (b *Bundle) Translator(preferences ...string) Translator {
+	var desired []language.Tag
+	for _, preference := range preferences {
+		tags, _, err := language.ParseAcceptLanguage(strings.ReplaceAll(preference, "_", "-"))
+		if err == nil {
+			desired = append(desired, tags...)
+		}
+	}
+
+	lang := DefaultLanguage
+	if _, index, confidence := b.matcher.Match(desired...); confidence != language.No {
+		lang = b.tags[index].String()
+	}
+
+	return Translator{Lang: lang, catalog: b.catalogs[lang]}
+}
+
+// Translator returns the texts of one language, templates use it as {{ .T.Get "key" }}
+type Translator struct {
+	Lang    string
+	catalog map[string]string
+}
+
+// Get returns the text of the key with the arguments escaped and filled in.
+// Unknown keys are returned as they are.
+func (t Translator) Get(key string, args ...interface{}) template.HTML {
+	text, ok := t.catalog[key]
+	if !ok {
+		return template.HTML(html.EscapeString(key))
+	}
+	if len(args) == 0 {
+		return template.HTML(text)
+	}
+
+	escaped := make([]interface{}, len(args))
+	for i, arg := range args {
+		escaped[i] = html.EscapeString(fmt.Sprint(arg))
+	}
+	return template.HTML(fmt.Sprintf(text, escaped...))
+}
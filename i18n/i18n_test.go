@@ -0,0 +1,111 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCatalogsHaveTheSameKeys(t *testing.T) {
+	b, err := NewBundle()
+	if err != nil {
+		t.Fatalf("NewBundle() error = %v", err)
+	}
+	if len(b.Languages()) < 2 {
+		t.Fatalf("languages = %v, want the translations too", b.Languages())
+	}
+
+	for _, lang := range b.Languages() {
+		if err := b.check(lang); err != nil {
+			t.Error(err)
+		}
+		for key, text := range b.catalogs[lang] {
+			if strings.TrimSpace(text) == "" {
+				t.Errorf("%s catalog: %s is empty", lang, key)
+			}
+		}
+	}
+}
+
+var verb = regexp.MustCompile(`%[-+# 0]*[0-9]*(\.[0-9]+)?[a-zA-Z%]`)
+
+// A translation with other arguments than the default text prints %!s(MISSING) or %!(EXTRA ...)
+func TestCatalogsHaveTheSameArguments(t *testing.T) {
+	b, err := NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, text := range b.catalogs[DefaultLanguage] {
+		want := strings.Join(verb.FindAllString(text, -1), " ")
+		for _, lang := range b.Languages() {
+			if got := strings.Join(verb.FindAllString(b.catalogs[lang][key], -1), " "); got != want {
+				t.Errorf("%s catalog: %s has arguments %q, want %q", lang, key, got, want)
+			}
+		}
+	}
+}
+
+// Keys used in the templates and in the handlers exist in every catalog
+func TestUsedKeysExist(t *testing.T) {
+	b, err := NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	used := map[string]string{}
+	find := func(pattern string, re *regexp.Regexp) {
+		files, _ := filepath.Glob(filepath.Join("..", pattern))
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, match := range re.FindAllStringSubmatch(string(data), -1) {
+				used[match[1]] = file
+			}
+		}
+	}
+	find("templates/*.html", regexp.MustCompile(`\.T\.Get "([^"]+)"`))
+	find("veriflow/*.go", regexp.MustCompile(`"(error\.[a-z_]+)"`))
+	if len(used) == 0 {
+		t.Fatal("no keys found in the templates")
+	}
+
+	for key, file := range used {
+		for _, lang := range b.Languages() {
+			if _, ok := b.catalogs[lang][key]; !ok {
+				t.Errorf("%s catalog: missing %s used in %s", lang, key, file)
+			}
+		}
+	}
+}
+
+func TestTranslator(t *testing.T) {
+	b, err := NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		preferences []string
+		want        string
+	}{
+		{nil, DefaultLanguage},
+		{[]string{"de-AT"}, "de"},
+		{[]string{"", "fr-FR,es;q=0.8"}, "es"},
+		{[]string{"pt_BR"}, DefaultLanguage},
+	}
+	for _, tt := range tests {
+		if got := b.Translator(tt.preferences...).Lang; got != tt.want {
+			t.Errorf("Translator(%q).Lang = %s, want %s", tt.preferences, got, tt.want)
+		}
+	}
+
+	tr := b.Translator("en")
+	if got := tr.Get("no.such.key"); got != "no.such.key" {
+		t.Errorf("Get() of an unknown key = %q", got)
+	}
+}
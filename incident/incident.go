@@ -0,0 +1,82 @@
+package incident
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/tracing"
+)
+
+// This allows reported verifications to be forwarded to security tooling
+// Right now it supports a generic signed webhook, Jira and PagerDuty
+
+type Sink interface {
+	Name() string
+	Report(ctx context.Context, incident *models.Incident) error
+}
+
+var httpClient = &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(http.DefaultTransport, "incident")}
+
+// NewSinks returns a sink for every integration configured under report
+func NewSinks(cfg *config.Config) []Sink {
+	var sinks []Sink
+
+	if cfg.Report.URL != "" {
+		sinks = append(sinks, &WebhookSink{URL: cfg.Report.URL, Secret: cfg.Report.Secret})
+	}
+
+	if jira := cfg.Report.Jira; jira.URL != "" {
+		sinks = append(sinks, &JiraSink{
+			URL:       jira.URL,
+			Username:  jira.Username,
+			APIToken:  jira.APIToken,
+			Project:   jira.Project,
+			IssueType: jira.IssueType,
+		})
+	}
+
+	if pd := cfg.Report.PagerDuty; pd.RoutingKey != "" {
+		sinks = append(sinks, &PagerDutySink{
+			URL:        pd.URL,
+			RoutingKey: pd.RoutingKey,
+			Severity:   pd.Severity,
+			BaseURL:    cfg.BaseURL,
+		})
+	}
+
+	return sinks
+}
+
+func postJSON(req *http.Request, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// summary is the one line description used as issue title and alert summary
+func summary(incident *models.Incident) string {
+	return fmt.Sprintf("Veriflow: verification of %s requested by %s was reported by %s", incident.Recipient.Email, incident.Requestor.Email, incident.ReportedBy)
+}
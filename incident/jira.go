@@ -0,0 +1,87 @@
+package incident
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+// JiraSink creates an issue through the Jira REST API
+type JiraSink struct {
+	URL       string
+	Username  string
+	APIToken  string
+	Project   string
+	IssueType string
+}
+
+func (j *JiraSink) Name() string {
+	return "jira"
+}
+
+func (j *JiraSink) Report(ctx context.Context, incident *models.Incident) error {
+	issueType := j.IssueType
+	if issueType == "" {
+		issueType = "Task"
+	}
+
+	payload := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": j.Project},
+			"issuetype":   map[string]string{"name": issueType},
+			"summary":     summary(incident),
+			"description": jiraDescription(incident),
+			"labels":      []string{"veriflow", "reported-verification"},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(j.URL, "/")+"/rest/api/2/issue", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(j.Username, j.APIToken)
+
+	return postJSON(req, payload)
+}
+
+func jiraDescription(incident *models.Incident) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "*Reason:* %s\n", incident.Reason)
+	fmt.Fprintf(&b, "*Request:* [%s|%s]\n\n", incident.RequestID, incident.StatusLink)
+	fmt.Fprintf(&b, "||Role||Name||Email||ID||\n")
+	fmt.Fprintf(&b, "|Requestor|%s|%s|%s|\n", incident.Requestor.Name, incident.Requestor.Email, incident.Requestor.ID)
+	fmt.Fprintf(&b, "|Recipient|%s|%s|%s|\n\n", incident.Recipient.Name, incident.Recipient.Email, incident.Recipient.ID)
+
+	b.WriteString("h3. IP Addresses\n")
+	for _, role := range sortedKeys(incident.IPs) {
+		fmt.Fprintf(&b, "* %s: %s (%s)\n", role, incident.IPs[role], incident.UserAgents[role])
+	}
+
+	b.WriteString("\nh3. Timeline\n")
+	for _, event := range incident.Timeline {
+		fmt.Fprintf(&b, "* %s - %s\n", event.Time.Format("2006-01-02 15:04:05 MST"), event.Event)
+	}
+
+	if len(incident.OIDCClaims) > 0 {
+		b.WriteString("\nh3. OIDC Claims\n")
+		for _, claim := range sortedKeys(incident.OIDCClaims) {
+			fmt.Fprintf(&b, "* %s: %v\n", claim, incident.OIDCClaims[claim])
+		}
+	}
+
+	return b.String()
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,59 @@
+package incident
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutySink triggers an alert through the PagerDuty Events API v2
+type PagerDutySink struct {
+	URL        string
+	RoutingKey string
+	Severity   string
+	BaseURL    string
+}
+
+func (p *PagerDutySink) Name() string {
+	return "pagerduty"
+}
+
+func (p *PagerDutySink) Report(ctx context.Context, incident *models.Incident) error {
+	url := p.URL
+	if url == "" {
+		url = pagerDutyEventsURL
+	}
+
+	severity := p.Severity
+	if severity == "" {
+		severity = "critical"
+	}
+
+	payload := map[string]interface{}{
+		"routing_key":  p.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    incident.RequestID,
+		"payload": map[string]interface{}{
+			"summary":        summary(incident),
+			"source":         p.BaseURL,
+			"severity":       severity,
+			"timestamp":      incident.ReportedAt,
+			"component":      "veriflow",
+			"class":          "reported-verification",
+			"custom_details": incident,
+		},
+		"links": []map[string]string{
+			{"href": incident.StatusLink, "text": "Verification Request"},
+		},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+
+	return postJSON(req, payload)
+}
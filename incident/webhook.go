@@ -0,0 +1,57 @@
+package incident
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/utils"
+)
+
+// WebhookSink posts the incident as JSON. When a secret is set the body is
+// signed with HMAC-SHA256 over "<timestamp>.<body>" so receivers can verify it
+// came from Veriflow and reject replays.
+type WebhookSink struct {
+	URL    string
+	Secret string
+}
+
+func (w *WebhookSink) Name() string {
+	return "webhook"
+}
+
+func (w *WebhookSink) Report(ctx context.Context, incident *models.Incident) error {
+	body, err := json.Marshal(incident)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Veriflow-Event", "request.reported")
+	req.Header.Set("X-Veriflow-Timestamp", timestamp)
+	if w.Secret != "" {
+		req.Header.Set("X-Veriflow-Signature", utils.SignPayload(w.Secret, timestamp, body))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics exposed on /metrics
+
+var (
+	Verifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "veriflow_verifications_total",
+		Help: "Verification requests by lifecycle event (created, completed, failed, reported) and communication channel.",
+	}, []string{"event", "channel"})
+
+	TimeToVerify = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "veriflow_time_to_verify_seconds",
+		Help:    "Time from the creation of a request until it completed or failed.",
+		Buckets: []float64{5, 15, 30, 60, 120, 300, 600, 1800, 3600, 14400},
+	}, []string{"channel", "status"})
+
+	OIDCExchangeDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "veriflow_oidc_exchange_duration_seconds",
+		Help:    "Latency of the OIDC code exchange and user info lookup.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	OIDCExchangeErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "veriflow_oidc_exchange_errors_total",
+		Help: "Failed OIDC code exchanges and user info lookups.",
+	})
+
+	SlackAPIDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "veriflow_slack_api_duration_seconds",
+		Help:    "Latency of Slack Web API calls by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	SlackAPIErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "veriflow_slack_api_errors_total",
+		Help: "Slack Web API calls that failed or returned ok=false, by method.",
+	}, []string{"method"})
+
+	EmailFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "veriflow_email_failures_total",
+		Help: "Emails that could not be sent, by subject.",
+	}, []string{"subject"})
+
+	FactorFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "veriflow_factor_failures_total",
+		Help: "Failed second factor checks by factor (totp, webauthn, email_otp, sms) and stage (verify, enroll).",
+	}, []string{"factor", "stage"})
+
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "veriflow_http_requests_total",
+		Help: "HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "veriflow_http_request_duration_seconds",
+		Help:    "HTTP request latency by method and route.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() gin.HandlerFunc {
+	return gin.WrapH(promhttp.Handler())
+}
+
+// Middleware records HTTP metrics by route template so path parameters don't create new series
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// SlackTransport measures every Slack Web API call. Slack reports most errors
+// with a 200 and "ok": false, so the response body is checked as well.
+type SlackTransport struct {
+	Base http.RoundTripper
+}
+
+func (t *SlackTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	method := strings.TrimPrefix(req.URL.Path, "/api/")
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	SlackAPIDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		SlackAPIErrors.WithLabelValues(method).Inc()
+		return resp, err
+	}
+
+	body, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if readErr != nil || resp.StatusCode >= 300 || bytes.Contains(body, []byte(`"ok":false`)) {
+		SlackAPIErrors.WithLabelValues(method).Inc()
+	}
+
+	return resp, readErr
+}
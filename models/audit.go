@@ -0,0 +1,438 @@
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/vdparikh/veriflow/db"
+)
+
+// The head item points at the latest entry so appends don't need a scan
+const auditHeadID = "head"
+
+// The export gap item points at the first entry that may not have reached the
+// SIEM, entries from there on are exported again
+const auditExportGapID = "export-gap"
+
+// AuditDayIndex partitions the entries by the day they were recorded, sorted
+// by sequence, so time ranges and the chain are read without a scan
+const AuditDayIndex = "AuditDayIndex"
+
+// auditAppendAttempts is how often an append moves to the new end of the
+// chain when other writers took its sequence number
+const auditAppendAttempts = 10
+
+// AuditEntry is an append-only record of an action. Entries are numbered and
+// every entry carries the hash of the previous one, so removing or changing an
+// entry breaks the chain from that point on.
+type AuditEntry struct {
+	ID        string    `json:"id" dynamodbav:"id"`
+	Sequence  int64     `json:"sequence" dynamodbav:"sequence"`
+	Time      time.Time `json:"time" dynamodbav:"time"`
+	Action    string    `json:"action" dynamodbav:"action"`
+	Actor     string    `json:"actor" dynamodbav:"actor"`
+	ActorIP   string    `json:"actor_ip,omitempty" dynamodbav:"actor_ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty" dynamodbav:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty" dynamodbav:"request_id,omitempty"`
+	Subject   string    `json:"subject,omitempty" dynamodbav:"subject,omitempty"`
+
+	Details map[string]string `json:"details,omitempty" dynamodbav:"details,omitempty"`
+
+	PrevHash string `json:"prev_hash" dynamodbav:"prev_hash"`
+	Hash     string `json:"hash" dynamodbav:"hash"`
+
+	// Day keys AuditDayIndex, it is derived from Time and not hashed
+	Day string `json:"-" dynamodbav:"day,omitempty"`
+}
+
+type auditHead struct {
+	ID       string `dynamodbav:"id"`
+	Sequence int64  `dynamodbav:"sequence"`
+	Hash     string `dynamodbav:"hash"`
+}
+
+// Sequence is zero when every entry was exported
+type auditExportGap struct {
+	ID       string `dynamodbav:"id"`
+	Sequence int64  `dynamodbav:"sequence"`
+}
+
+// AuditFilter narrows down GetAuditEntries, empty fields match everything
+type AuditFilter struct {
+	RequestID string
+	Actor     string
+	Action    string
+	Since     time.Time
+	Until     time.Time
+
+	// Window bounds the days read when Since is zero, counting back from
+	// Until, the Before entry or now. Zero reads from the first entry.
+	Window time.Duration
+	// Before is the sequence cursor of the next page, only older entries match
+	Before int64
+	// Limit keeps the newest entries, the days are read newest first until
+	// there are enough
+	Limit int
+}
+
+func auditID(sequence int64) string {
+	return fmt.Sprintf("%012d", sequence)
+}
+
+// Missing items leave the output empty with Get, unlike GetItemById
+func auditKey(id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{"id": &types.AttributeValueMemberS{Value: id}}
+}
+
+// ComputeHash hashes the entry without its own hash
+func (e AuditEntry) ComputeHash() string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// AppendAuditEntry adds the entry at the end of the chain. Entries are created
+// with a condition on their sequence number, so concurrent writers can't fork
+// the chain and simply retry against the new end.
+func AppendAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	entry.Day = auditDay(entry.Time)
+
+	for attempt := 1; ; attempt++ {
+		head, err := auditChainHead(ctx)
+		if err != nil {
+			return err
+		}
+
+		entry.Sequence = head.Sequence + 1
+		entry.ID = auditID(entry.Sequence)
+		entry.PrevHash = head.Hash
+		entry.Hash = entry.ComputeHash()
+
+		av, err := attributevalue.MarshalMap(entry)
+		if err != nil {
+			return err
+		}
+
+		err = dbClient.Create(ctx, VeriflowAuditTable, av)
+		if errors.Is(err, db.ErrItemExists) {
+			if attempt == auditAppendAttempts {
+				return fmt.Errorf("audit entry %d was taken by another writer %d times: %w", entry.Sequence, attempt, err)
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// The head is only a shortcut, auditChainHead walks past a stale one
+		av, _ = attributevalue.MarshalMap(auditHead{ID: auditHeadID, Sequence: entry.Sequence, Hash: entry.Hash})
+		dbClient.Save(ctx, VeriflowAuditTable, av)
+		return nil
+	}
+}
+
+// GetAuditEntry returns the entry with the sequence number, it is empty when
+// there is no such entry
+func GetAuditEntry(ctx context.Context, sequence int64) (AuditEntry, error) {
+	var entry AuditEntry
+	if err := dbClient.Get(ctx, VeriflowAuditTable, auditKey(auditID(sequence)), &entry); err != nil {
+		return entry, fmt.Errorf("failed to get audit entry: %w", err)
+	}
+	return entry, nil
+}
+
+// GetAuditExportGap returns the first entry that may not have been exported,
+// zero when all of them were
+func GetAuditExportGap(ctx context.Context) (int64, error) {
+	var gap auditExportGap
+	if err := dbClient.Get(ctx, VeriflowAuditTable, auditKey(auditExportGapID), &gap); err != nil {
+		return 0, fmt.Errorf("failed to get audit export gap: %w", err)
+	}
+	return gap.Sequence, nil
+}
+
+// MarkAuditExportGap records that the entry may not have been exported. A gap
+// marked earlier in the chain is kept.
+func MarkAuditExportGap(ctx context.Context, sequence int64) error {
+	av, err := attributevalue.MarshalMap(auditExportGap{ID: auditExportGapID, Sequence: sequence})
+	if err != nil {
+		return err
+	}
+
+	cond := expression.AttributeNotExists(expression.Name("sequence")).
+		Or(expression.Name("sequence").Equal(expression.Value(0))).
+		Or(expression.Name("sequence").GreaterThan(expression.Value(sequence)))
+	err = dbClient.SaveIf(ctx, VeriflowAuditTable, av, cond)
+	if errors.Is(err, db.ErrConditionFailed) {
+		return nil
+	}
+	return err
+}
+
+// MoveAuditExportGap moves the gap once the entries before to were exported
+// again, zero clears it. The gap is kept when it was marked again meanwhile.
+func MoveAuditExportGap(ctx context.Context, from, to int64) error {
+	av, err := attributevalue.MarshalMap(auditExportGap{ID: auditExportGapID, Sequence: to})
+	if err != nil {
+		return err
+	}
+
+	err = dbClient.SaveIf(ctx, VeriflowAuditTable, av, expression.Name("sequence").Equal(expression.Value(from)))
+	if errors.Is(err, db.ErrConditionFailed) {
+		return nil
+	}
+	return err
+}
+
+func auditChainHead(ctx context.Context) (auditHead, error) {
+	var head auditHead
+	if err := dbClient.Get(ctx, VeriflowAuditTable, auditKey(auditHeadID), &head); err != nil {
+		return head, fmt.Errorf("failed to get audit head: %w", err)
+	}
+
+	for {
+		var next AuditEntry
+		if err := dbClient.Get(ctx, VeriflowAuditTable, auditKey(auditID(head.Sequence+1)), &next); err != nil {
+			return head, fmt.Errorf("failed to get audit entry: %w", err)
+		}
+		if next.ID == "" {
+			return head, nil
+		}
+		head.Sequence, head.Hash = next.Sequence, next.Hash
+	}
+}
+
+func auditDay(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// auditDays lists the days from since to until, they default to the day of
+// the first entry and today
+func auditDays(ctx context.Context, since, until time.Time) ([]string, error) {
+	if since.IsZero() {
+		var first AuditEntry
+		if err := dbClient.Get(ctx, VeriflowAuditTable, auditKey(auditID(1)), &first); err != nil {
+			return nil, fmt.Errorf("failed to get audit entry: %w", err)
+		}
+		if first.ID == "" {
+			return nil, nil
+		}
+		since = first.Time
+	}
+	if until.IsZero() {
+		until = time.Now()
+	}
+
+	var days []string
+	last := auditDay(until)
+	for day := since.UTC().Truncate(24 * time.Hour); auditDay(day) <= last; day = day.Add(24 * time.Hour) {
+		days = append(days, auditDay(day))
+	}
+	return days, nil
+}
+
+// getAuditDay returns the matching entries of a day before the sequence, all
+// of them when it is zero, in sequence order
+func getAuditDay(ctx context.Context, day string, before int64, filter expression.ConditionBuilder, hasFilter bool) ([]AuditEntry, error) {
+	keyCond := expression.Key("day").Equal(expression.Value(day))
+	if before > 0 {
+		keyCond = keyCond.And(expression.Key("sequence").LessThan(expression.Value(before)))
+	}
+	builder := expression.NewBuilder().WithKeyCondition(keyCond)
+	if hasFilter {
+		builder = builder.WithFilter(filter)
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building expression: %v", err)
+	}
+
+	var entries []AuditEntry
+	err = dbClient.QueryAll(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(VeriflowAuditTable),
+		IndexName:                 aws.String(AuditDayIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("error querying audit entries of %s: %v", day, err)
+	}
+	return entries, nil
+}
+
+// GetAuditEntries returns the matching entries in chain order. Only the days
+// between since and until are read, newest first when there is a limit.
+func GetAuditEntries(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	var conds []expression.ConditionBuilder
+	if filter.RequestID != "" {
+		conds = append(conds, expression.Name("request_id").Equal(expression.Value(filter.RequestID)))
+	}
+	if filter.Actor != "" {
+		conds = append(conds, expression.Name("actor").Equal(expression.Value(filter.Actor)))
+	}
+	if filter.Action != "" {
+		conds = append(conds, expression.Name("action").Equal(expression.Value(filter.Action)))
+	}
+	var cond expression.ConditionBuilder
+	if len(conds) > 0 {
+		cond = conds[0]
+		for _, c := range conds[1:] {
+			cond = cond.And(c)
+		}
+	}
+
+	// Older entries than the cursor are recorded on its day or before
+	until := filter.Until
+	if filter.Before > 0 {
+		var cursor AuditEntry
+		if err := dbClient.Get(ctx, VeriflowAuditTable, auditKey(auditID(filter.Before)), &cursor); err != nil {
+			return nil, fmt.Errorf("failed to get audit entry: %w", err)
+		}
+		if cursor.ID == "" {
+			return nil, fmt.Errorf("audit entry %d does not exist", filter.Before)
+		}
+		if until.IsZero() || cursor.Time.Before(until) {
+			until = cursor.Time
+		}
+	}
+	since := filter.Since
+	if since.IsZero() && filter.Window > 0 {
+		if until.IsZero() {
+			since = time.Now().Add(-filter.Window)
+		} else {
+			since = until.Add(-filter.Window)
+		}
+	}
+
+	days, err := auditDays(ctx, since, until)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []AuditEntry
+	for i := len(days) - 1; i >= 0; i-- {
+		if filter.Limit > 0 && len(entries) >= filter.Limit {
+			break
+		}
+		found, err := getAuditDay(ctx, days[i], filter.Before, cond, len(conds) > 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range found {
+			if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+				continue
+			}
+			if !filter.Until.IsZero() && entry.Time.After(filter.Until) {
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	// Entries recorded around midnight can land on the day before their predecessor
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Sequence < entries[j].Sequence
+	})
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+
+	return entries, nil
+}
+
+// VerifyAuditChain checks every entry against its hash and its predecessor,
+// reading the chain a day at a time. It returns the number of entries checked
+// and an error naming the first broken entry.
+func VerifyAuditChain(ctx context.Context) (int, error) {
+	days, err := auditDays(ctx, time.Time{}, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+
+	checked := 0
+	prevHash := ""
+	// Entries of a later day waiting for one recorded around midnight on the day before
+	waiting := map[int64]AuditEntry{}
+	for _, day := range days {
+		entries, err := getAuditDay(ctx, day, 0, expression.ConditionBuilder{}, false)
+		if err != nil {
+			return checked, err
+		}
+		for _, entry := range entries {
+			waiting[entry.Sequence] = entry
+		}
+
+		for {
+			entry, ok := waiting[int64(checked+1)]
+			if !ok {
+				break
+			}
+			delete(waiting, entry.Sequence)
+
+			if entry.PrevHash != prevHash {
+				return checked, fmt.Errorf("audit entry %d does not follow entry %d", entry.Sequence, entry.Sequence-1)
+			}
+			if entry.ComputeHash() != entry.Hash {
+				return checked, fmt.Errorf("audit entry %d was modified", entry.Sequence)
+			}
+			prevHash = entry.Hash
+			checked++
+		}
+	}
+
+	// The head also catches entries removed from the start or the end
+	head, err := auditChainHead(ctx)
+	if err != nil {
+		return checked, err
+	}
+	if len(waiting) > 0 || int64(checked) < head.Sequence {
+		return checked, fmt.Errorf("audit entry %d is missing", checked+1)
+	}
+	return checked, nil
+}
+
+// BackfillAuditDays saves the entries recorded before AuditDayIndex existed
+// so the index covers them, and returns how many were updated. Day is not
+// hashed, the chain stays valid.
+func BackfillAuditDays(ctx context.Context) (int, error) {
+	var entries []AuditEntry
+	err := dbClient.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(VeriflowAuditTable)}, &entries)
+	if err != nil {
+		return 0, fmt.Errorf("error scanning table: %v", err)
+	}
+
+	updated := 0
+	for _, entry := range entries {
+		if entry.ID == auditHeadID || entry.ID == auditExportGapID || entry.Day != "" {
+			continue
+		}
+		entry.Day = auditDay(entry.Time)
+		av, err := attributevalue.MarshalMap(entry)
+		if err != nil {
+			return updated, err
+		}
+		if err := dbClient.Save(ctx, VeriflowAuditTable, av); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
@@ -0,0 +1,260 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/vdparikh/veriflow/db"
+)
+
+var auditStart = time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC)
+
+// newAuditTestChain records an entry every 30 minutes from 23:00, over three days
+func newAuditTestChain(t *testing.T, n int) *db.MemoryDB {
+	t.Helper()
+	memory := db.NewMemoryDB()
+	memory.RangeKeys[AuditDayIndex] = "sequence"
+	UseDB(memory)
+
+	for i := 0; i < n; i++ {
+		entry := &AuditEntry{
+			Time:      auditStart.Add(time.Duration(i) * 30 * time.Minute),
+			Action:    "request.created",
+			Actor:     "alice@example.com",
+			RequestID: []string{"r1", "r2"}[i%2],
+		}
+		if err := AppendAuditEntry(context.Background(), entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return memory
+}
+
+func saveAuditEntry(t *testing.T, memory *db.MemoryDB, entry AuditEntry) {
+	t.Helper()
+	av, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := memory.Save(context.Background(), VeriflowAuditTable, av); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getAuditEntry(t *testing.T, sequence int64) AuditEntry {
+	t.Helper()
+	var entry AuditEntry
+	if err := dbClient.Get(context.Background(), VeriflowAuditTable, auditKey(auditID(sequence)), &entry); err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+func TestGetAuditEntries(t *testing.T) {
+	newAuditTestChain(t, 6)
+	ctx := context.Background()
+
+	entries, err := GetAuditEntries(ctx, AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 6 || entries[0].Sequence != 1 || entries[5].Sequence != 6 {
+		t.Fatalf("GetAuditEntries() = %d entries", len(entries))
+	}
+	if entries[0].Day != "2026-10-17" || entries[5].Day != "2026-10-18" {
+		t.Errorf("days = %s .. %s", entries[0].Day, entries[5].Day)
+	}
+
+	entries, err = GetAuditEntries(ctx, AuditFilter{RequestID: "r2", Since: auditStart.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Sequence != 4 || entries[1].Sequence != 6 {
+		t.Fatalf("GetAuditEntries(r2 since 00:00) = %+v", entries)
+	}
+
+	entries, err = GetAuditEntries(ctx, AuditFilter{Until: auditStart.Add(45 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("GetAuditEntries(until 23:45) = %d entries, want 2", len(entries))
+	}
+}
+
+func TestGetAuditEntriesPages(t *testing.T) {
+	newAuditTestChain(t, 100)
+	ctx := context.Background()
+	last := auditStart.Add(99 * 30 * time.Minute)
+
+	entries, err := GetAuditEntries(ctx, AuditFilter{Until: last, Limit: 4})
+	if err != nil || len(entries) != 4 || entries[0].Sequence != 97 || entries[3].Sequence != 100 {
+		t.Fatalf("GetAuditEntries(limit 4) = %d entries, %v, want 97 to 100", len(entries), err)
+	}
+
+	entries, err = GetAuditEntries(ctx, AuditFilter{Before: 97, Limit: 4})
+	if err != nil || len(entries) != 4 || entries[0].Sequence != 93 || entries[3].Sequence != 96 {
+		t.Fatalf("GetAuditEntries(before 97) = %d entries, %v, want 93 to 96", len(entries), err)
+	}
+
+	// The window counts back from the cursor and covers whole days
+	entries, err = GetAuditEntries(ctx, AuditFilter{Before: 97, Window: time.Hour})
+	if err != nil || len(entries) != 46 || entries[0].Sequence != 51 || entries[45].Sequence != 96 {
+		t.Fatalf("GetAuditEntries(window 1h) = %d entries, %v, want 51 to 96", len(entries), err)
+	}
+
+	if _, err := GetAuditEntries(ctx, AuditFilter{Before: 101}); err == nil {
+		t.Error("GetAuditEntries() with a cursor past the end succeeded")
+	}
+}
+
+// takenDB acts as if another writer always took the next sequence number
+type takenDB struct {
+	*db.MemoryDB
+	creates int
+}
+
+func (t *takenDB) Create(ctx context.Context, table string, item map[string]types.AttributeValue) error {
+	t.creates++
+	return db.ErrItemExists
+}
+
+func TestAppendAuditEntryGivesUp(t *testing.T) {
+	taken := &takenDB{MemoryDB: db.NewMemoryDB()}
+	UseDB(taken)
+
+	err := AppendAuditEntry(context.Background(), &AuditEntry{Action: "request.created"})
+	if !errors.Is(err, db.ErrItemExists) {
+		t.Fatalf("AppendAuditEntry() error = %v, want ErrItemExists", err)
+	}
+	if taken.creates != auditAppendAttempts {
+		t.Errorf("creates = %d, want %d", taken.creates, auditAppendAttempts)
+	}
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	newAuditTestChain(t, 6)
+
+	checked, err := VerifyAuditChain(context.Background())
+	if err != nil || checked != 6 {
+		t.Fatalf("VerifyAuditChain() = %d, %v", checked, err)
+	}
+}
+
+// Of two entries recorded around midnight the later one can be dated before
+func TestVerifyAuditChainAcrossMidnight(t *testing.T) {
+	memory := newAuditTestChain(t, 4)
+
+	second := getAuditEntry(t, 2)
+	second.Time = time.Date(2026, 10, 18, 0, 0, 0, 1, time.UTC)
+	second.Day = auditDay(second.Time)
+	second.Hash = second.ComputeHash()
+	saveAuditEntry(t, memory, second)
+	third := getAuditEntry(t, 3)
+	third.Time = time.Date(2026, 10, 17, 23, 59, 59, 0, time.UTC)
+	third.Day = auditDay(third.Time)
+	third.PrevHash = second.Hash
+	third.Hash = third.ComputeHash()
+	saveAuditEntry(t, memory, third)
+	fourth := getAuditEntry(t, 4)
+	fourth.PrevHash = third.Hash
+	fourth.Hash = fourth.ComputeHash()
+	saveAuditEntry(t, memory, fourth)
+
+	checked, err := VerifyAuditChain(context.Background())
+	if err != nil || checked != 4 {
+		t.Fatalf("VerifyAuditChain() = %d, %v", checked, err)
+	}
+}
+
+func TestVerifyAuditChainDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, memory *db.MemoryDB)
+		want   string
+	}{
+		{"modified", func(t *testing.T, memory *db.MemoryDB) {
+			entry := getAuditEntry(t, 3)
+			entry.Actor = "mallory@example.com"
+			saveAuditEntry(t, memory, entry)
+		}, "audit entry 3 was modified"},
+		{"removed", func(t *testing.T, memory *db.MemoryDB) {
+			memory.Delete(context.Background(), VeriflowAuditTable, auditID(3))
+		}, "audit entry 3 is missing"},
+		{"first removed", func(t *testing.T, memory *db.MemoryDB) {
+			memory.Delete(context.Background(), VeriflowAuditTable, auditID(1))
+		}, "audit entry 1 is missing"},
+		{"last removed", func(t *testing.T, memory *db.MemoryDB) {
+			memory.Delete(context.Background(), VeriflowAuditTable, auditID(6))
+			head := auditHead{ID: auditHeadID, Sequence: 6}
+			av, _ := attributevalue.MarshalMap(head)
+			memory.Save(context.Background(), VeriflowAuditTable, av)
+		}, "audit entry 6 is missing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory := newAuditTestChain(t, 6)
+			tt.tamper(t, memory)
+
+			_, err := VerifyAuditChain(context.Background())
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("VerifyAuditChain() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackfillAuditDays(t *testing.T) {
+	memory := newAuditTestChain(t, 3)
+	for sequence := int64(1); sequence <= 3; sequence++ {
+		entry := getAuditEntry(t, sequence)
+		entry.Day = ""
+		saveAuditEntry(t, memory, entry)
+	}
+
+	updated, err := BackfillAuditDays(context.Background())
+	if err != nil || updated != 3 {
+		t.Fatalf("BackfillAuditDays() = %d, %v", updated, err)
+	}
+	if checked, err := VerifyAuditChain(context.Background()); err != nil || checked != 3 {
+		t.Fatalf("VerifyAuditChain() after the backfill = %d, %v", checked, err)
+	}
+}
+
+func TestAuditExportGap(t *testing.T) {
+	newAuditTestChain(t, 6)
+	ctx := context.Background()
+
+	steps := []struct {
+		name string
+		do   func() error
+		want int64
+	}{
+		{"marked", func() error { return MarkAuditExportGap(ctx, 4) }, 4},
+		{"a later entry keeps the gap", func() error { return MarkAuditExportGap(ctx, 5) }, 4},
+		{"an earlier entry moves it", func() error { return MarkAuditExportGap(ctx, 2) }, 2},
+		{"a stale move keeps it", func() error { return MoveAuditExportGap(ctx, 4, 0) }, 2},
+		{"moved", func() error { return MoveAuditExportGap(ctx, 2, 5) }, 5},
+		{"cleared", func() error { return MoveAuditExportGap(ctx, 5, 0) }, 0},
+		{"marked again", func() error { return MarkAuditExportGap(ctx, 6) }, 6},
+	}
+	for _, step := range steps {
+		if err := step.do(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if gap, err := GetAuditExportGap(ctx); err != nil || gap != step.want {
+			t.Fatalf("%s: gap = %d, %v, want %d", step.name, gap, err, step.want)
+		}
+	}
+
+	// The gap isn't an entry
+	if updated, err := BackfillAuditDays(ctx); err != nil || updated != 0 {
+		t.Errorf("BackfillAuditDays() = %d, %v, want 0", updated, err)
+	}
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+// VerifyBatch groups the requests created by a single multi-recipient command
+// (`/veriflow verify @a @b @c` or a Slack user group) so the requestor can
+// follow them together and gets one summary instead of a message per recipient.
+type VerifyBatch struct {
+	ID             string `dynamodbav:"id"`
+	RequestorEmail string `dynamodbav:"requestor_email"`
+
+	Start  time.Time `dynamodbav:"start_time"`
+	End    time.Time `dynamodbav:"end_time,omitempty"`
+	Status string    `dynamodbav:"status"`
+
+	Requestor  User     `dynamodbav:"requestor"`
+	RequestIDs []string `dynamodbav:"request_ids"`
+
+	Message    string `dynamodbav:"message"`
+	StatusLink string `dynamodbav:"status_link"`
+
+	SummarySent bool `dynamodbav:"summary_sent"`
+
+	// Version counts the updates, concurrent refreshes of the batch don't
+	// overwrite each other
+	Version int `dynamodbav:"version"`
+
+	// Channel members left out of a channel verification because they were verified recently
+	SkippedIDs []string `json:"skipped_ids,omitempty" dynamodbav:"skipped_ids,omitempty"`
+
+	Slack SlackRequest `json:"slack"  dynamodbav:"slack"`
+
+	Requests []VerifyRequest `json:"requests" dynamodbav:"-"`
+}
+
+// BatchCounts is the aggregated status of the requests in a batch
+type BatchCounts struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+}
+
+func GetBatchByID(ctx context.Context, id string) (VerifyBatch, error) {
+	var batch VerifyBatch
+
+	err := dbClient.GetItemById(ctx, VeriflowBatchesTable, id, &batch)
+	if err != nil {
+		return batch, fmt.Errorf("failed to get batch %s: %w", id, err)
+	}
+
+	return batch, nil
+}
+
+func (b *VerifyBatch) Save(ctx context.Context) error {
+	if b.Requestor.Email != "" {
+		b.RequestorEmail = b.Requestor.Email
+	}
+
+	av, err := attributevalue.MarshalMap(b)
+	if err != nil {
+		return err
+	}
+	return dbClient.Save(ctx, VeriflowBatchesTable, av)
+}
+
+// Update saves the batch when nobody else saved it since it was read. It fails
+// with db.ErrConditionFailed otherwise, the batch has to be read again.
+func (b *VerifyBatch) Update(ctx context.Context) error {
+	version := b.Version
+	b.Version++
+	if b.Requestor.Email != "" {
+		b.RequestorEmail = b.Requestor.Email
+	}
+
+	av, err := attributevalue.MarshalMap(b)
+	if err != nil {
+		return err
+	}
+
+	cond := expression.Name("version").Equal(expression.Value(version))
+	if version == 0 {
+		// Batches stored before they had a version
+		cond = cond.Or(expression.AttributeNotExists(expression.Name("version")))
+	}
+	return dbClient.SaveIf(ctx, VeriflowBatchesTable, av, cond)
+}
+
+// LoadRequests fetches the latest state of every request in the batch
+func (b *VerifyBatch) LoadRequests(ctx context.Context) error {
+	b.Requests = make([]VerifyRequest, 0, len(b.RequestIDs))
+	for _, id := range b.RequestIDs {
+		vr, err := GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		b.Requests = append(b.Requests, vr)
+	}
+	return nil
+}
+
+// Counts requires LoadRequests to be called first
+func (b *VerifyBatch) Counts() BatchCounts {
+	counts := BatchCounts{Total: len(b.Requests)}
+	for _, vr := range b.Requests {
+		switch vr.Status {
+		case "COMPLETED":
+			counts.Completed++
+		case "FAILED":
+			counts.Failed++
+		case "CANCELLED":
+			counts.Cancelled++
+		default:
+			counts.Pending++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Digits of the codes sent to users
+const oneTimeCodeDigits = 6
+
+// OneTimeCode is a code sent by email, SMS or a call to prove the user
+// controls the destination. There is one code per ID, sending a new one
+// replaces it. Only a bcrypt hash of the code is stored, so the codes can't be
+// read from the table and are slow to guess from a copy of it.
+type OneTimeCode struct {
+	ID          string    `dynamodbav:"id"`          // what the code is for, e.g. email#REQUEST_ID
+	Destination string    `dynamodbav:"destination"` // email address or phone number
+	CodeHash    string    `dynamodbav:"code_hash"`
+	Attempts    int       `dynamodbav:"attempts"`
+	CreatedAt   time.Time `dynamodbav:"created_at"`
+
+	// Expired codes are rejected right away and removed through the table TTL
+	ExpiresAt time.Time `dynamodbav:"expires_at,unixtime"`
+}
+
+// NewOneTimeCode returns the code to send and its record to store
+func NewOneTimeCode(id, destination string, ttl time.Duration) (*OneTimeCode, string, error) {
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(oneTimeCodeDigits), nil)
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return nil, "", err
+	}
+	code := fmt.Sprintf("%0*d", oneTimeCodeDigits, n)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	return &OneTimeCode{
+		ID:          id,
+		Destination: destination,
+		CodeHash:    string(hash),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}, code, nil
+}
+
+// GetOneTimeCode returns the code with the ID, the ID is empty when there is none
+func GetOneTimeCode(ctx context.Context, id string) (OneTimeCode, error) {
+	var code OneTimeCode
+	dbClient.GetItemById(ctx, VeriflowOneTimeCodesTable, id, &code)
+	return code, nil
+}
+
+func (c *OneTimeCode) Save(ctx context.Context) error {
+	av, err := attributevalue.MarshalMap(c)
+	if err != nil {
+		return err
+	}
+	return dbClient.Save(ctx, VeriflowOneTimeCodesTable, av)
+}
+
+// Check uses up an attempt and tells whether code matches. The attempt is
+// stored before the code is compared, concurrent guesses fail with
+// db.ErrConditionFailed instead of sharing an attempt.
+func (c *OneTimeCode) Check(ctx context.Context, code string) (bool, error) {
+	attempts := c.Attempts
+	c.Attempts++
+
+	av, err := attributevalue.MarshalMap(c)
+	if err != nil {
+		return false, err
+	}
+	cond := expression.Name("attempts").Equal(expression.Value(attempts))
+	if err := dbClient.SaveIf(ctx, VeriflowOneTimeCodesTable, av, cond); err != nil {
+		return false, err
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(c.CodeHash), []byte(code)) == nil, nil
+}
+
+// Delete removes the code once it was used
+func (c *OneTimeCode) Delete(ctx context.Context) error {
+	return dbClient.Delete(ctx, VeriflowOneTimeCodesTable, c.ID)
+}
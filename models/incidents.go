@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Incident is what gets handed to the security tooling when a verification is
+// reported. Participants only carry their profile, never their 2FA details.
+type Incident struct {
+	ID         string                 `json:"id"`
+	RequestID  string                 `json:"request_id"`
+	ReportedAt time.Time              `json:"reported_at"`
+	ReportedBy string                 `json:"reported_by"`
+	Reason     string                 `json:"reason"`
+	StatusLink string                 `json:"status_link"`
+	Requestor  Party                  `json:"requestor"`
+	Recipient  Party                  `json:"recipient"`
+	OIDCClaims map[string]interface{} `json:"oidc_claims,omitempty"`
+	IPs        map[string]string      `json:"ips"`
+	UserAgents map[string]string      `json:"user_agents"`
+	Timeline   []TimelineEvent        `json:"timeline"`
+}
+
+type TimelineEvent struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+}
+
+// NewIncident builds an incident for a reported request. claims are the OIDC
+// claims of the reporter when they just authenticated, otherwise the claims
+// stored when the recipient authenticated are used.
+func NewIncident(vr *VerifyRequest, reportedBy, ip, userAgent string, claims map[string]interface{}) *Incident {
+	incident := &Incident{
+		ID:         uuid.New().String(),
+		RequestID:  vr.ID,
+		ReportedAt: time.Now(),
+		ReportedBy: reportedBy,
+		Reason:     vr.Error,
+		StatusLink: vr.StatusLink,
+		Requestor:  PartyOf(vr.Requestor),
+		Recipient:  PartyOf(vr.Recipient),
+		OIDCClaims: claims,
+		IPs:        map[string]string{},
+		UserAgents: map[string]string{},
+	}
+
+	if incident.OIDCClaims == nil && vr.OIDCInfo != "" {
+		json.Unmarshal([]byte(vr.OIDCInfo), &incident.OIDCClaims)
+	}
+
+	for role, value := range map[string]string{"reporter": ip, "requestor": vr.RequestorIP, "recipient": vr.RecipientIP} {
+		if value != "" {
+			incident.IPs[role] = value
+		}
+	}
+	for role, value := range map[string]string{"reporter": userAgent, "recipient": vr.RecipientUserAgent} {
+		if value != "" {
+			incident.UserAgents[role] = value
+		}
+	}
+
+	incident.Timeline = append(incident.Timeline, TimelineEvent{Time: vr.Start, Event: "Verification requested by " + vr.Requestor.Email})
+	if !vr.LastSent.IsZero() {
+		incident.Timeline = append(incident.Timeline, TimelineEvent{Time: vr.LastSent, Event: "Verification message resent"})
+	}
+	if !vr.AuthenticatedAt.IsZero() {
+		incident.Timeline = append(incident.Timeline, TimelineEvent{Time: vr.AuthenticatedAt, Event: "Recipient authenticated as " + vr.Recipient.Email})
+	}
+	incident.Timeline = append(incident.Timeline, TimelineEvent{Time: incident.ReportedAt, Event: "Reported by " + reportedBy})
+	sort.Slice(incident.Timeline, func(i, j int) bool {
+		return incident.Timeline[i].Time.Before(incident.Timeline[j].Time)
+	})
+
+	return incident
+}
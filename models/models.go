@@ -4,12 +4,30 @@ import "github.com/vdparikh/veriflow/db"
 
 var dbClient db.DB
 
+// ErrNotFound is returned when the item doesn't exist, other errors may be worth a retry
+var ErrNotFound = db.ErrNotFound
+
 const (
-	VeriflowUsersTable           = "VeriflowUsers"
-	VeriflowWebAuthnSessionTable = "VeriflowWebAuthnSessions"
-	VeriflowRequestsTable        = "VeriflowRequests"
+	VeriflowUsersTable             = "VeriflowUsers"
+	VeriflowWebAuthnSessionTable   = "VeriflowWebAuthnSessions"
+	VeriflowRequestsTable          = "VeriflowRequests"
+	VeriflowBatchesTable           = "VeriflowBatches"
+	VeriflowRateLimitsTable        = "VeriflowRateLimits"
+	VeriflowWebhooksTable          = "VeriflowWebhooks"
+	VeriflowWebhookDeliveriesTable = "VeriflowWebhookDeliveries"
+	VeriflowWebhookQueueTable      = "VeriflowWebhookQueue"
+	VeriflowAuditTable             = "VeriflowAudit"
+	VeriflowOutboxTable            = "VeriflowOutbox"
+	VeriflowOneTimeCodesTable      = "VeriflowOneTimeCodes"
+	VeriflowServiceAccountsTable   = "VeriflowServiceAccounts"
+	VeriflowAPIKeysTable           = "VeriflowAPIKeys"
 )
 
 func init() {
 	dbClient = db.Init()
 }
+
+// UseDB replaces the DynamoDB client, tests run on a db.MemoryDB
+func UseDB(client db.DB) {
+	dbClient = client
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/vdparikh/veriflow/db"
+)
+
+// Delivered notifications are kept for this long
+const outboxRetention = 30 * 24 * time.Hour
+
+// OutboxDueIndex sorts the pending messages by their next attempt. Only
+// pending messages carry its key, so sent and failed ones aren't in it.
+const OutboxDueIndex = "OutboxDueIndex"
+
+// outboxDue is the key of every message in OutboxDueIndex
+const outboxDue = "PENDING"
+
+// OutboxMessage is a notification that has to be sent because a request
+// changed. It is written in the same transaction as the request, so a
+// notification is never sent for a change that wasn't stored and never lost
+// for one that was. The ID is the idempotency key of the notification.
+type OutboxMessage struct {
+	ID          string    `json:"id" dynamodbav:"id"`
+	RequestID   string    `json:"request_id" dynamodbav:"request_id"`
+	Kind        string    `json:"kind" dynamodbav:"kind"`
+	Status      string    `json:"status" dynamodbav:"status"` // PENDING, SENT or FAILED
+	Attempts    int       `json:"attempts" dynamodbav:"attempts"`
+	Error       string    `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	CreatedAt   time.Time `json:"created_at" dynamodbav:"created_at"`
+	NextAttempt time.Time `json:"next_attempt" dynamodbav:"next_attempt,unixtime"`
+	SentAt      time.Time `json:"sent_at,omitempty" dynamodbav:"sent_at,omitempty"`
+
+	// Set while the message is pending so it is in OutboxDueIndex
+	Due string `json:"-" dynamodbav:"due,omitempty"`
+
+	// Sent and failed messages are removed through the table TTL
+	ExpiresAt int64 `json:"-" dynamodbav:"expires_at,omitempty"`
+}
+
+// NewOutboxMessage keys the notification on the request, its kind and the
+// number of resends so the same notification is only ever queued once
+func NewOutboxMessage(request *VerifyRequest, kind string) OutboxMessage {
+	now := time.Now()
+	return OutboxMessage{
+		ID:          fmt.Sprintf("%s#%s#%d", request.ID, kind, request.ResendCount),
+		RequestID:   request.ID,
+		Kind:        kind,
+		Status:      "PENDING",
+		CreatedAt:   now,
+		NextAttempt: now,
+		Due:         outboxDue,
+	}
+}
+
+// SaveWithOutbox stores the request together with its notifications. It
+// returns db.ErrItemExists when one of the notifications was already queued.
+func (vr *VerifyRequest) SaveWithOutbox(ctx context.Context, messages []OutboxMessage) error {
+	vr.PrepareForSave()
+
+	av, err := attributevalue.MarshalMap(vr)
+	if err != nil {
+		return err
+	}
+	writes := []db.TransactWrite{{Table: VeriflowRequestsTable, Item: av}}
+
+	for _, msg := range messages {
+		av, err := attributevalue.MarshalMap(msg)
+		if err != nil {
+			return err
+		}
+		writes = append(writes, db.TransactWrite{Table: VeriflowOutboxTable, Item: av, Create: true})
+	}
+
+	return dbClient.Transact(ctx, writes)
+}
+
+// Claim takes the message for lease so no other dispatcher sends it at the
+// same time. It fails with db.ErrConditionFailed when someone else claimed it.
+func (m *OutboxMessage) Claim(ctx context.Context, lease time.Duration) error {
+	attempts := m.Attempts
+	m.Attempts++
+	m.NextAttempt = time.Now().Add(lease)
+
+	av, err := attributevalue.MarshalMap(m)
+	if err != nil {
+		return err
+	}
+
+	cond := expression.Name("status").Equal(expression.Value("PENDING")).And(expression.Name("attempts").Equal(expression.Value(attempts)))
+	return dbClient.SaveIf(ctx, VeriflowOutboxTable, av, cond)
+}
+
+func (m *OutboxMessage) Sent(ctx context.Context) error {
+	m.Status = "SENT"
+	m.Due = ""
+	m.Error = ""
+	m.SentAt = time.Now()
+	m.ExpiresAt = m.SentAt.Add(outboxRetention).Unix()
+	return m.Save(ctx)
+}
+
+// Failed schedules the next attempt, or gives up on the message when next is zero
+func (m *OutboxMessage) Failed(ctx context.Context, err error, next time.Time) error {
+	m.Error = err.Error()
+	m.NextAttempt = next
+	if next.IsZero() {
+		m.Status = "FAILED"
+		m.Due = ""
+		m.ExpiresAt = time.Now().Add(outboxRetention).Unix()
+	}
+	return m.Save(ctx)
+}
+
+func (m *OutboxMessage) Save(ctx context.Context) error {
+	av, err := attributevalue.MarshalMap(m)
+	if err != nil {
+		return err
+	}
+	return dbClient.Save(ctx, VeriflowOutboxTable, av)
+}
+
+// GetDueOutboxMessages returns the pending messages whose next attempt is due, oldest first
+func GetDueOutboxMessages(ctx context.Context) ([]OutboxMessage, error) {
+	keyCond := expression.Key("due").Equal(expression.Value(outboxDue)).
+		And(expression.Key("next_attempt").LessThanEqual(expression.Value(time.Now().Unix())))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building expression: %v", err)
+	}
+
+	var messages []OutboxMessage
+	err = dbClient.QueryAll(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(VeriflowOutboxTable),
+		IndexName:                 aws.String(OutboxDueIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}, &messages)
+	if err != nil {
+		return nil, fmt.Errorf("error querying due outbox messages: %v", err)
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].CreatedAt.Before(messages[j].CreatedAt)
+	})
+
+	return messages, nil
+}
+
+// BackfillOutboxDue saves the pending messages queued before OutboxDueIndex
+// existed so the dispatcher sees them, and returns how many were updated
+func BackfillOutboxDue(ctx context.Context) (int, error) {
+	filt := expression.Name("status").Equal(expression.Value("PENDING")).
+		And(expression.AttributeNotExists(expression.Name("due")))
+	expr, err := expression.NewBuilder().WithFilter(filt).Build()
+	if err != nil {
+		return 0, fmt.Errorf("error building expression: %v", err)
+	}
+
+	var messages []OutboxMessage
+	err = dbClient.Scan(ctx, &dynamodb.ScanInput{
+		TableName:                 aws.String(VeriflowOutboxTable),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+	}, &messages)
+	if err != nil {
+		return 0, fmt.Errorf("error scanning table: %v", err)
+	}
+
+	updated := 0
+	for _, msg := range messages {
+		msg.Due = outboxDue
+		if err := msg.Save(ctx); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
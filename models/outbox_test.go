@@ -0,0 +1,65 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/vdparikh/veriflow/db"
+)
+
+func TestGetDueOutboxMessages(t *testing.T) {
+	memory := db.NewMemoryDB()
+	memory.RangeKeys[OutboxDueIndex] = "next_attempt"
+	UseDB(memory)
+	ctx := context.Background()
+
+	request := &VerifyRequest{ID: "r1"}
+	due := NewOutboxMessage(request, "due")
+	later := NewOutboxMessage(request, "later")
+	later.NextAttempt = time.Now().Add(time.Hour)
+	sent := NewOutboxMessage(request, "sent")
+	failed := NewOutboxMessage(request, "failed")
+	for _, msg := range []*OutboxMessage{&due, &later, &sent, &failed} {
+		if err := msg.Save(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sent.Sent(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := failed.Failed(ctx, errors.New("channel_not_found"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, err := GetDueOutboxMessages(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(messages) != 1 || messages[0].ID != due.ID {
+		t.Errorf("GetDueOutboxMessages() = %+v, want only %s", messages, due.ID)
+	}
+}
+
+func TestBackfillOutboxDue(t *testing.T) {
+	memory := db.NewMemoryDB()
+	memory.RangeKeys[OutboxDueIndex] = "next_attempt"
+	UseDB(memory)
+	ctx := context.Background()
+
+	old := NewOutboxMessage(&VerifyRequest{ID: "r1"}, "old")
+	old.Due = ""
+	if err := old.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := BackfillOutboxDue(ctx)
+	if err != nil || updated != 1 {
+		t.Fatalf("BackfillOutboxDue() = %d, %v, want 1", updated, err)
+	}
+	messages, err := GetDueOutboxMessages(ctx)
+	if err != nil || len(messages) != 1 {
+		t.Errorf("GetDueOutboxMessages() = %d messages, %v, want the backfilled one", len(messages), err)
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// IncrementRateLimit counts one more event for key in the current fixed window
+// and returns the number of events seen in that window so far. Counters live
+// in DynamoDB so the limits hold across Lambda instances and expire through the
+// table TTL once the window is over.
+func IncrementRateLimit(ctx context.Context, key string, window time.Duration) (int, error) {
+	windowStart := time.Now().Truncate(window)
+
+	return dbClient.Increment(ctx, VeriflowRateLimitsTable, map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: fmt.Sprintf("%s#%d", key, windowStart.Unix())},
+	}, "count", windowStart.Add(window))
+}
+
+// openRequest names the pending request of a requestor to a recipient
+type openRequest struct {
+	ID        string `dynamodbav:"id"`
+	RequestID string `dynamodbav:"request_id"`
+}
+
+// GetOpenRequest returns the ID of the request that last claimed key, or an
+// empty string when none did
+func GetOpenRequest(ctx context.Context, key string) (string, error) {
+	item, err := dbClient.GetItem(ctx, VeriflowRateLimitsTable, map[string]types.AttributeValue{
+		"id": &types.AttributeValueMemberS{Value: "open#" + key},
+	})
+	if err != nil || item == nil {
+		return "", err
+	}
+
+	var open openRequest
+	err = attributevalue.UnmarshalMap(item, &open)
+	return open.RequestID, err
+}
+
+// ClaimOpenRequest makes requestID the pending request of key. The claim only
+// succeeds while key is still held by holder, the request GetOpenRequest
+// returned, so of two requests racing for key only one gets it. It fails with
+// db.ErrConditionFailed when the other one was first.
+func ClaimOpenRequest(ctx context.Context, key, requestID, holder string) error {
+	av, err := attributevalue.MarshalMap(openRequest{ID: "open#" + key, RequestID: requestID})
+	if err != nil {
+		return err
+	}
+
+	cond := expression.AttributeNotExists(expression.Name("id"))
+	if holder != "" {
+		cond = expression.Name("request_id").Equal(expression.Value(holder))
+	}
+	return dbClient.SaveIf(ctx, VeriflowRateLimitsTable, av, cond)
+}
@@ -0,0 +1,281 @@
+package models
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+
+	"github.com/vdparikh/veriflow/db"
+)
+
+// Indexes of the requests table by party, sorted by start time
+const (
+	RequestorIndex = "RequestorIndex"
+	RecipientIndex = "RecipientIndex"
+)
+
+// Roles of the user in the requests of a RequestQuery
+const (
+	RoleSent     = "sent"
+	RoleReceived = "received"
+)
+
+// ErrInvalidCursor is returned for cursors that weren't handed out by QueryRequests
+var ErrInvalidCursor = db.ErrInvalidCursor
+
+// RequestQuery selects the requests of a user, newest first unless Ascending
+type RequestQuery struct {
+	Email string
+	// RoleSent, RoleReceived, or empty for both
+	Role string
+
+	Status string
+	Since  time.Time
+	Until  time.Time
+	// Email, ID or part of the name of the other party
+	Counterparty string
+	// Only the requests a service account sent on behalf of the user
+	ServiceAccountID string
+
+	Ascending bool
+	// Page size, 0 returns all the requests
+	Limit  int
+	Cursor string
+}
+
+// QueryRequests returns a page of requests and the cursor of the next one,
+// empty after the last page
+func QueryRequests(ctx context.Context, q RequestQuery) ([]VerifyRequest, string, error) {
+	if q.Role == RoleSent || q.Role == RoleReceived {
+		requests, next, err := queryRequestsAs(ctx, q, q.Role, q.Limit, q.Cursor)
+		setDurations(requests)
+		return requests, next, err
+	}
+
+	cursor, err := decodeRequestCursor(q.Cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Both roles are read page by page and merged. Each side of the cursor
+	// keeps where its page started and how many of its items were returned.
+	sent, err := cursor.Sent.read(ctx, q, RoleSent)
+	if err != nil {
+		return nil, "", err
+	}
+	received, err := cursor.Received.read(ctx, q, RoleReceived)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var requests []VerifyRequest
+	i, j := 0, 0
+	for (i < len(sent) || j < len(received)) && (q.Limit == 0 || len(requests) < q.Limit) {
+		if j >= len(received) || (i < len(sent) && q.before(sent[i], received[j])) {
+			requests = append(requests, sent[i])
+			i++
+			continue
+		}
+		// Requests users send themselves are in both lists
+		if i < len(sent) && sent[i].ID == received[j].ID {
+			i++
+		}
+		requests = append(requests, received[j])
+		j++
+	}
+	setDurations(requests)
+
+	if q.Limit == 0 {
+		return requests, "", nil
+	}
+	cursor.Sent.advance(i, len(sent))
+	cursor.Received.advance(j, len(received))
+	if cursor.Sent.Done && cursor.Received.Done {
+		return requests, "", nil
+	}
+
+	next, err := encodeRequestCursor(cursor)
+	return requests, next, err
+}
+
+// GetAllByUser returns every request sent by the user
+func GetAllByUser(ctx context.Context, email string) ([]VerifyRequest, error) {
+	requests, _, err := QueryRequests(ctx, RequestQuery{Email: email, Role: RoleSent})
+	return requests, err
+}
+
+// GetAllByRecipientEmail returns every request received by the user
+func GetAllByRecipientEmail(ctx context.Context, email string) ([]VerifyRequest, error) {
+	requests, _, err := QueryRequests(ctx, RequestQuery{Email: email, Role: RoleReceived})
+	return requests, err
+}
+
+// GetRequestHistory returns the requests sent and received by a user, newest first
+func GetRequestHistory(ctx context.Context, email string) (sent []VerifyRequest, received []VerifyRequest, err error) {
+	sent, err = GetAllByUser(ctx, email)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	received, err = GetAllByRecipientEmail(ctx, email)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sent, received, nil
+}
+
+func (q RequestQuery) before(a, b VerifyRequest) bool {
+	if q.Ascending {
+		return a.Start.Before(b.Start)
+	}
+	return a.Start.After(b.Start)
+}
+
+func queryRequestsAs(ctx context.Context, q RequestQuery, role string, limit int, cursor string) ([]VerifyRequest, string, error) {
+	index, partition, counterparty := RequestorIndex, "requestor_email", "recipient"
+	if role == RoleReceived {
+		index, partition, counterparty = RecipientIndex, "recipient_email", "requestor"
+	}
+
+	keyCond := expression.Key(partition).Equal(expression.Value(q.Email))
+	switch start := expression.Key("start_time"); {
+	case !q.Since.IsZero() && !q.Until.IsZero():
+		keyCond = keyCond.And(start.Between(expression.Value(timeKey(q.Since)), expression.Value(timeKey(q.Until))))
+	case !q.Since.IsZero():
+		keyCond = keyCond.And(start.GreaterThanEqual(expression.Value(timeKey(q.Since))))
+	case !q.Until.IsZero():
+		keyCond = keyCond.And(start.LessThanEqual(expression.Value(timeKey(q.Until))))
+	}
+
+	var filters []expression.ConditionBuilder
+	if q.Status != "" {
+		filters = append(filters, expression.Name("status").Equal(expression.Value(q.Status)))
+	}
+	if q.Counterparty != "" {
+		value := expression.Value(q.Counterparty)
+		filters = append(filters, expression.Or(
+			expression.Name(counterparty+".email").Equal(value),
+			expression.Name(counterparty+".id").Equal(value),
+			expression.Name(counterparty+".name").Contains(q.Counterparty),
+		))
+	}
+	if q.ServiceAccountID != "" {
+		filters = append(filters, expression.Name("service_account_id").Equal(expression.Value(q.ServiceAccountID)))
+	}
+
+	builder := expression.NewBuilder().WithKeyCondition(keyCond)
+	switch len(filters) {
+	case 0:
+	case 1:
+		builder = builder.WithFilter(filters[0])
+	default:
+		builder = builder.WithFilter(expression.And(filters[0], filters[1], filters[2:]...))
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, "", fmt.Errorf("error building expression: %v", err)
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(VeriflowRequestsTable),
+		IndexName:                 aws.String(index),
+		KeyConditionExpression:    expr.KeyCondition(),
+		FilterExpression:          expr.Filter(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ScanIndexForward:          aws.Bool(q.Ascending),
+	}
+
+	var requests []VerifyRequest
+	next, err := dbClient.QueryPage(ctx, input, limit, cursor, &requests)
+	return requests, next, err
+}
+
+// timeKey formats a time the way start_time is stored, see PrepareForSave
+func timeKey(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func setDurations(requests []VerifyRequest) {
+	for i := range requests {
+		requests[i].setDuration()
+	}
+}
+
+// requestCursor is the position in both roles of a merged query
+type requestCursor struct {
+	Sent     roleCursor `json:"s"`
+	Received roleCursor `json:"r"`
+}
+
+type roleCursor struct {
+	// Cursor of the page being read and number of its items already returned
+	Page string `json:"c,omitempty"`
+	Skip int    `json:"k,omitempty"`
+	Done bool   `json:"d,omitempty"`
+
+	next string
+}
+
+// read returns the items of the role that weren't returned yet, enough of
+// them to fill a page on their own
+func (rc *roleCursor) read(ctx context.Context, q RequestQuery, role string) ([]VerifyRequest, error) {
+	if rc.Done {
+		return nil, nil
+	}
+
+	limit := 0
+	if q.Limit > 0 {
+		limit = rc.Skip + q.Limit
+	}
+	requests, next, err := queryRequestsAs(ctx, q, role, limit, rc.Page)
+	if err != nil {
+		return nil, err
+	}
+	rc.next = next
+
+	if rc.Skip >= len(requests) {
+		return nil, nil
+	}
+	return requests[rc.Skip:], nil
+}
+
+// advance moves past the used items out of the read ones
+func (rc *roleCursor) advance(used, read int) {
+	if rc.Done {
+		return
+	}
+	if used < read {
+		rc.Skip += used
+		return
+	}
+	rc.Page, rc.Skip, rc.Done = rc.next, 0, rc.next == ""
+}
+
+func encodeRequestCursor(cursor requestCursor) (string, error) {
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeRequestCursor(cursor string) (requestCursor, error) {
+	var decoded requestCursor
+	if cursor == "" {
+		return decoded, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || json.Unmarshal(data, &decoded) != nil || decoded.Sent.Skip < 0 || decoded.Received.Skip < 0 {
+		return decoded, ErrInvalidCursor
+	}
+	return decoded, nil
+}
@@ -1,22 +1,26 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 
 	"github.com/coreos/go-oidc/v3/oidc"
 )
 
+// ChannelEmail reaches a party of a request by email instead of the communication tool
+const ChannelEmail = "email"
+
 type VerifyRequest struct {
 	ID             string `dynamodbav:"id"`
-	RequestorEmail string `dynamodbav:"requestor_email"`
+	RequestorEmail string `dynamodbav:"requestor_email,omitempty"` // unknown until a queued slash command is processed
+	RecipientEmail string `dynamodbav:"recipient_email,omitempty"` // keys RecipientIndex, the recipient may have no email
 
 	Start             time.Time `dynamodbav:"start_time"`
 	End               time.Time `dynamodbav:"end_time,omitempty"`
@@ -26,19 +30,42 @@ type VerifyRequest struct {
 	Requestor User `dynamodbav:"requestor"`
 	Recipient User `dynamodbav:"recipient"`
 
+	// Where the parties get their messages, the communication tool or email
+	RequestorChannel string `json:"requestor_channel,omitempty" dynamodbav:"requestor_channel,omitempty"`
+	RecipientChannel string `json:"recipient_channel,omitempty" dynamodbav:"recipient_channel,omitempty"`
+
 	Message string `dynamodbav:"message"`
 	Error   string `dynamodbav:"error,omitempty"`
 
 	OIDCInfo string `dynamodbav:"user_info,omitempty"`
 
+	RequestorIP        string    `json:"requestor_ip,omitempty" dynamodbav:"requestor_ip,omitempty"`
+	RecipientIP        string    `json:"recipient_ip,omitempty" dynamodbav:"recipient_ip,omitempty"`
+	RecipientUserAgent string    `json:"recipient_user_agent,omitempty" dynamodbav:"recipient_user_agent,omitempty"`
+	AuthenticatedAt    time.Time `json:"authenticated_at" dynamodbav:"authenticated_at,omitempty"`
+
 	StatusLink string `dynamodbav:"status_link"`
 	AuthLink   string `dynamodbav:"auth_link"`
 	ReportLink string `dynamodbav:"report_link"`
 
 	Slack SlackRequest `json:"slack"  dynamodbav:"slack"`
 
+	// Set when the request was created as part of a multi-recipient command
+	BatchID string `json:"batch_id,omitempty" dynamodbav:"batch_id,omitempty"`
+
+	// Set when a service account created the request on behalf of the requestor
+	ServiceAccountID string `json:"service_account_id,omitempty" dynamodbav:"service_account_id,omitempty"`
+	APIKeyID         string `json:"api_key_id,omitempty" dynamodbav:"api_key_id,omitempty"`
+
 	Permalink string `json:"permalink"  dynamodbav:"permalink"`
 
+	ResendCount int       `json:"resend_count" dynamodbav:"resend_count"`
+	LastSent    time.Time `json:"last_sent" dynamodbav:"last_sent,omitempty"`
+
+	// Set once the request counted towards the rate limits, so retries of
+	// the worker don't count it again
+	RateCounted bool `json:"-" dynamodbav:"rate_counted,omitempty"`
+
 	DurationSinceStart string `json:"duration_since_start" dynamodbav:"-"`
 	Duration           string `json:"duration" dynamodbav:"-"`
 }
@@ -56,7 +83,7 @@ type SlackRequest struct {
 	InitChannel   string `json:"init_channel"`
 }
 
-func GetByID(id string) (VerifyRequest, error) {
+func GetByID(ctx context.Context, id string) (VerifyRequest, error) {
 	var vr VerifyRequest
 
 	input := &dynamodb.QueryInput{
@@ -67,28 +94,26 @@ func GetByID(id string) (VerifyRequest, error) {
 		}, Limit: aws.Int32(1), // Add a limit to minimize read consumption
 	}
 
-	dbClient.QueryOne(input, &vr)
+	err := dbClient.QueryOne(ctx, input, &vr)
+	vr.setDuration()
 
-	if !vr.End.IsZero() {
-		duration := vr.End.Sub(vr.Start)
-		vr.Duration = formatDuration(duration)
-	} else {
-		duration := time.Since(vr.Start)
-		vr.DurationSinceStart = formatDuration(duration)
-	}
-
-	return vr, nil
+	return vr, err
 }
 
-func (vr *VerifyRequest) Get() error {
+func (vr *VerifyRequest) Get(ctx context.Context) error {
 
 	key := map[string]types.AttributeValue{
 		"id":              &types.AttributeValueMemberS{Value: vr.ID},
 		"requestor_email": &types.AttributeValueMemberS{Value: vr.RequestorEmail}, // Ensure this is correctly populated
 	}
 
-	err := dbClient.Get(VeriflowRequestsTable, key, vr)
+	err := dbClient.Get(ctx, VeriflowRequestsTable, key, vr)
+	vr.setDuration()
+
+	return err
+}
 
+func (vr *VerifyRequest) setDuration() {
 	if !vr.End.IsZero() {
 		duration := vr.End.Sub(vr.Start)
 		vr.Duration = formatDuration(duration)
@@ -96,24 +121,28 @@ func (vr *VerifyRequest) Get() error {
 		duration := time.Since(vr.Start)
 		vr.DurationSinceStart = formatDuration(duration)
 	}
-
-	return err
 }
 
+// PrepareForSave fills the attributes the indexes are keyed on. start_time
+// is kept in UTC so it sorts as a string.
 func (vr *VerifyRequest) PrepareForSave() {
 	if vr.Requestor.Email != "" {
 		vr.RequestorEmail = vr.Requestor.Email
 	}
+	if vr.Recipient.Email != "" {
+		vr.RecipientEmail = vr.Recipient.Email
+	}
+	vr.Start = vr.Start.UTC()
 }
 
-func (vr *VerifyRequest) Save() error {
+func (vr *VerifyRequest) Save(ctx context.Context) error {
 	vr.PrepareForSave()
 
 	av, err := attributevalue.MarshalMap(vr)
 	if err != nil {
 		return err
 	}
-	return dbClient.Save(VeriflowRequestsTable, av)
+	return dbClient.Save(ctx, VeriflowRequestsTable, av)
 }
 
 func (vr *VerifyRequest) SetOIDCInfo(info *oidc.UserInfo) error {
@@ -133,58 +162,114 @@ func (vr *VerifyRequest) GetOIDCInfo() (*oidc.UserInfo, error) {
 	return &info, nil
 }
 
-func (vr *VerifyRequest) Done() error {
-	vr.End = time.Now()
-	vr.Status = "COMPLETED"
-	return vr.Save()
+// SaveSlackReferences only updates the channels and timestamps of the Slack
+// messages sent and the permalink, so it never overwrites a status changed
+// since the request was read
+func (vr *VerifyRequest) SaveSlackReferences(ctx context.Context) error {
+	attributes := map[string]interface{}{}
+	if vr.Slack.MessageTS != "" {
+		attributes["slack.Channel"], attributes["slack.MessageTS"] = vr.Slack.Channel, vr.Slack.MessageTS
+	}
+	if vr.Slack.InitMessageTS != "" {
+		attributes["slack.InitChannel"], attributes["slack.InitMessageTS"] = vr.Slack.InitChannel, vr.Slack.InitMessageTS
+	}
+	if vr.Permalink != "" {
+		attributes["permalink"] = vr.Permalink
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+	return dbClient.Update(ctx, VeriflowRequestsTable, vr.ID, attributes)
 }
 
-func (vr *VerifyRequest) DoneWithError(errorString string) error {
-	vr.End = time.Now()
-	vr.Status = "FAILED"
-	vr.Error = errorString
-	return vr.Save()
+// SaveRateCounted marks the stored request as counted towards the rate limits
+func (vr *VerifyRequest) SaveRateCounted(ctx context.Context) error {
+	vr.RateCounted = true
+	return dbClient.Update(ctx, VeriflowRequestsTable, vr.ID, map[string]interface{}{"rate_counted": true})
 }
 
-func GetAllByUser(email string) ([]VerifyRequest, error) {
-	var requests []VerifyRequest
+func (vr *VerifyRequest) Done(ctx context.Context) error {
+	vr.Finish("COMPLETED", "")
+	return vr.Save(ctx)
+}
 
-	input := &dynamodb.QueryInput{
-		TableName:              aws.String("VeriflowRequests"),
-		IndexName:              aws.String("EmailIndex"), // Specify the name of your GSI
-		KeyConditionExpression: aws.String("requestor_email = :email"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":email": &types.AttributeValueMemberS{Value: email},
-		},
-	}
+func (vr *VerifyRequest) DoneWithError(ctx context.Context, errorString string) error {
+	vr.Finish("FAILED", errorString)
+	return vr.Save(ctx)
+}
+
+func (vr *VerifyRequest) Cancel(ctx context.Context) error {
+	vr.Finish("CANCELLED", "")
+	return vr.Save(ctx)
+}
 
-	dbClient.QueryAll(input, &requests)
+// Finish closes the request without saving it
+func (vr *VerifyRequest) Finish(status, errorString string) {
+	vr.End = time.Now()
+	vr.Status = status
+	if errorString != "" {
+		vr.Error = errorString
+	}
+}
 
-	return requests, nil
+// IsOpen reports whether the recipient can still act on the request
+func (vr *VerifyRequest) IsOpen() bool {
+	return vr.Status == "SENT"
 }
 
-func GetAllByRecipientEmail(email string) ([]VerifyRequest, error) {
-	filt := expression.Name("recipient.email").Equal(expression.Value(email))
-	expr, err := expression.NewBuilder().WithFilter(filt).Build()
+// IsPending reports whether the request isn't finished, it is waiting in the
+// queue, being started or open
+func (vr *VerifyRequest) IsPending() bool {
+	return vr.Status == "QUEUED" || vr.Status == "RECEIVED" || vr.IsOpen()
+}
 
+// BackfillIndexKeys saves the requests stored before RecipientIndex existed
+// so they get the attributes the indexes are keyed on, and returns how many
+// were updated
+func BackfillIndexKeys(ctx context.Context) (int, error) {
+	var requests []VerifyRequest
+	err := dbClient.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(VeriflowRequestsTable)}, &requests)
 	if err != nil {
-		return nil, fmt.Errorf("error building expression: %v", err)
+		return 0, fmt.Errorf("error scanning table: %v", err)
 	}
 
-	params := &dynamodb.ScanInput{
-		TableName:                 aws.String("VeriflowRequests"),
-		ExpressionAttributeNames:  expr.Names(),
-		ExpressionAttributeValues: expr.Values(),
-		FilterExpression:          expr.Filter(),
+	updated := 0
+	for _, vr := range requests {
+		if vr.RecipientEmail == vr.Recipient.Email && vr.Start.Location() == time.UTC {
+			continue
+		}
+		if err := vr.Save(ctx); err != nil {
+			return updated, err
+		}
+		updated++
 	}
+	return updated, nil
+}
 
-	var verifyRequests []VerifyRequest
-	err = dbClient.Scan(params, &verifyRequests)
-	if err != nil {
-		return nil, fmt.Errorf("error scanning table: %v", err)
+// GetRecentlyVerifiedRecipients returns which of the users completed a
+// verification requested since the given time. Their received requests are
+// read from RecipientIndex, users Veriflow never stored were never verified.
+func GetRecentlyVerifiedRecipients(ctx context.Context, userIDs []string, since time.Time) (map[string]bool, error) {
+	verified := map[string]bool{}
+	for _, id := range userIDs {
+		user, err := GetUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if user.Email == "" {
+			continue
+		}
+
+		completed, _, err := QueryRequests(ctx, RequestQuery{Email: user.Email, Role: RoleReceived, Status: "COMPLETED", Since: since, Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(completed) > 0 {
+			verified[id] = true
+		}
 	}
 
-	return verifyRequests, nil
+	return verified, nil
 }
 
 func formatDuration(d time.Duration) string {
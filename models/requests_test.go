@@ -0,0 +1,89 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/vdparikh/veriflow/db"
+)
+
+func TestGetRecentlyVerifiedRecipients(t *testing.T) {
+	memory := db.NewMemoryDB()
+	memory.RangeKeys[RecipientIndex] = "start_time"
+	UseDB(memory)
+	ctx := context.Background()
+	now := time.Now()
+
+	requests := []struct {
+		recipient string
+		status    string
+		start     time.Time
+	}{
+		{"bob", "COMPLETED", now.Add(-10 * time.Minute)},
+		{"carol", "COMPLETED", now.Add(-2 * time.Hour)},
+		{"dave", "SENT", now.Add(-5 * time.Minute)},
+		{"dave", "FAILED", now.Add(-5 * time.Minute)},
+	}
+	for i, r := range requests {
+		recipient := User{ID: "U-" + r.recipient, Email: r.recipient + "@example.com"}
+		if err := SaveUser(ctx, recipient); err != nil {
+			t.Fatal(err)
+		}
+		vr := VerifyRequest{
+			ID:        string(rune('a' + i)),
+			Status:    r.status,
+			Start:     r.start,
+			Requestor: User{ID: "U-alice", Email: "alice@example.com"},
+			Recipient: recipient,
+		}
+		if err := vr.Save(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	verified, err := GetRecentlyVerifiedRecipients(ctx, []string{"U-bob", "U-carol", "U-dave", "U-erin"}, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(verified) != 1 || !verified["U-bob"] {
+		t.Fatalf("GetRecentlyVerifiedRecipients() = %v, want only U-bob", verified)
+	}
+}
+
+func TestSaveSlackReferencesKeepsStatus(t *testing.T) {
+	UseDB(db.NewMemoryDB())
+	ctx := context.Background()
+
+	vr := VerifyRequest{ID: "r1", Status: "SENT", Slack: SlackRequest{Text: "hello"}}
+	if err := vr.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The recipient completes the request while the message is being sent
+	stored, err := GetByID(ctx, "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored.Status = "COMPLETED"
+	if err := stored.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	vr.Slack.Channel, vr.Slack.MessageTS = "D123", "1700000000.000100"
+	vr.Permalink = "https://slack.example.com/archives/D123/p1700000000000100"
+	if err := vr.SaveSlackReferences(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetByID(ctx, "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "COMPLETED" {
+		t.Errorf("status = %s, want COMPLETED", got.Status)
+	}
+	if got.Slack.Channel != "D123" || got.Slack.MessageTS != "1700000000.000100" || got.Slack.Text != "hello" || got.Permalink != vr.Permalink {
+		t.Errorf("slack = %+v, permalink = %s, want the references saved and the text kept", got.Slack, got.Permalink)
+	}
+}
@@ -0,0 +1,217 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Scopes of service account API keys
+const (
+	ScopeRequestsRead  = "requests:read"
+	ScopeRequestsWrite = "requests:write"
+)
+
+// Scopes lists the scopes a service account can be given
+var Scopes = []string{ScopeRequestsRead, ScopeRequestsWrite}
+
+// apiKeyPrefix starts every API key so they are recognizable in logs and by secret scanners
+const apiKeyPrefix = "vf_"
+
+// ServiceAccount lets another system, like a ticketing tool, call the API on
+// behalf of the humans using it
+type ServiceAccount struct {
+	ID          string   `json:"id" dynamodbav:"id"`
+	Name        string   `json:"name" dynamodbav:"name"`
+	Description string   `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Scopes      []string `json:"scopes" dynamodbav:"scopes"`
+
+	// Users the account can act on behalf of, emails or whole domains written
+	// as "@example.com". An account without any can't act for anyone.
+	AllowedDelegators []string `json:"allowed_delegators" dynamodbav:"allowed_delegators,omitempty"`
+
+	// API calls per hour and key, 0 uses the service_accounts default
+	RateLimitPerHour int `json:"rate_limit_per_hour" dynamodbav:"rate_limit_per_hour"`
+
+	Disabled  bool      `json:"disabled" dynamodbav:"disabled"`
+	CreatedBy string    `json:"created_by" dynamodbav:"created_by"`
+	CreatedAt time.Time `json:"created_at" dynamodbav:"created_at"`
+
+	Keys []APIKey `json:"keys" dynamodbav:"-"`
+}
+
+// APIKey is a credential of a service account. Only a SHA-256 hash of the
+// secret is stored, the secret is random so a slow hash isn't needed.
+type APIKey struct {
+	ID               string    `json:"id" dynamodbav:"id"`
+	ServiceAccountID string    `json:"service_account_id" dynamodbav:"service_account_id"`
+	SecretHash       string    `json:"-" dynamodbav:"secret_hash"`
+	CreatedBy        string    `json:"created_by" dynamodbav:"created_by"`
+	CreatedAt        time.Time `json:"created_at" dynamodbav:"created_at"`
+
+	// Set on the previous keys when a key is rotated, so callers have time to switch
+	ExpiresAt time.Time `json:"expires_at,omitempty" dynamodbav:"expires_at,omitempty"`
+	RevokedAt time.Time `json:"revoked_at,omitempty" dynamodbav:"revoked_at,omitempty"`
+}
+
+func (a *ServiceAccount) HasScope(scope string) bool {
+	for _, s := range a.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CanActFor reports whether the account may act on behalf of the user with
+// the email, emails are compared case-insensitively
+func (a *ServiceAccount) CanActFor(email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return false
+	}
+	for _, delegator := range a.AllowedDelegators {
+		delegator = strings.ToLower(delegator)
+		if delegator == email || delegator == email[at:] {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *ServiceAccount) Save(ctx context.Context) error {
+	av, err := attributevalue.MarshalMap(a)
+	if err != nil {
+		return err
+	}
+	return dbClient.Save(ctx, VeriflowServiceAccountsTable, av)
+}
+
+// GetServiceAccount returns the service account with its keys
+func GetServiceAccount(ctx context.Context, id string) (ServiceAccount, error) {
+	var account ServiceAccount
+
+	err := dbClient.GetItemById(ctx, VeriflowServiceAccountsTable, id, &account)
+	if err != nil || account.ID == "" {
+		return account, fmt.Errorf("service account %s not found", id)
+	}
+
+	account.Keys, err = GetAPIKeys(ctx, id)
+	return account, err
+}
+
+func GetServiceAccounts(ctx context.Context) ([]ServiceAccount, error) {
+	var accounts []ServiceAccount
+
+	err := dbClient.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(VeriflowServiceAccountsTable)}, &accounts)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning table: %v", err)
+	}
+
+	return accounts, nil
+}
+
+// NewAPIKey returns the key to hand out once and its record to store
+func NewAPIKey(accountID, createdBy string) (*APIKey, string, error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	key := &APIKey{
+		ID:               hex.EncodeToString(id),
+		ServiceAccountID: accountID,
+		SecretHash:       hashAPIKeySecret(secret),
+		CreatedBy:        createdBy,
+		CreatedAt:        time.Now(),
+	}
+	return key, apiKeyPrefix + key.ID + "_" + base64.RawURLEncoding.EncodeToString(secret), nil
+}
+
+// ParseAPIKey splits a key into the ID of its record and its secret
+func ParseAPIKey(key string) (id string, secret []byte, ok bool) {
+	id, encoded, found := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), "_")
+	if !found || !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", nil, false
+	}
+
+	secret, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, false
+	}
+	return id, secret, true
+}
+
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// Matches compares the secret in constant time
+func (k *APIKey) Matches(secret []byte) bool {
+	return subtle.ConstantTimeCompare([]byte(k.SecretHash), []byte(hashAPIKeySecret(secret))) == 1
+}
+
+// Active keys are neither revoked nor past the end of a rotation
+func (k *APIKey) Active() bool {
+	return k.RevokedAt.IsZero() && (k.ExpiresAt.IsZero() || time.Now().Before(k.ExpiresAt))
+}
+
+func hashAPIKeySecret(secret []byte) string {
+	sum := sha256.Sum256(secret)
+	return hex.EncodeToString(sum[:])
+}
+
+func (k *APIKey) Save(ctx context.Context) error {
+	av, err := attributevalue.MarshalMap(k)
+	if err != nil {
+		return err
+	}
+	return dbClient.Save(ctx, VeriflowAPIKeysTable, av)
+}
+
+// GetAPIKey returns the key with the ID, the ID is empty when there is none
+func GetAPIKey(ctx context.Context, id string) (APIKey, error) {
+	var key APIKey
+	err := dbClient.GetItemById(ctx, VeriflowAPIKeysTable, id, &key)
+	return key, err
+}
+
+// GetAPIKeys returns the keys of a service account, including revoked ones
+func GetAPIKeys(ctx context.Context, accountID string) ([]APIKey, error) {
+	filt := expression.Name("service_account_id").Equal(expression.Value(accountID))
+	expr, err := expression.NewBuilder().WithFilter(filt).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building expression: %v", err)
+	}
+
+	params := &dynamodb.ScanInput{
+		TableName:                 aws.String(VeriflowAPIKeysTable),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		FilterExpression:          expr.Filter(),
+	}
+
+	var keys []APIKey
+	err = dbClient.Scan(ctx, params, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning table: %v", err)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,30 @@
+package models
+
+import "testing"
+
+func TestServiceAccountCanActFor(t *testing.T) {
+	account := ServiceAccount{AllowedDelegators: []string{"alice@example.com", "@support.example.com"}}
+
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"alice@example.com", true},
+		{"Alice@Example.com", true},
+		{"bob@example.com", false},
+		{"carol@support.example.com", true},
+		{"carol@evil-support.example.com", false},
+		{"@support.example.com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := account.CanActFor(tt.email); got != tt.want {
+			t.Errorf("CanActFor(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+
+	if (&ServiceAccount{}).CanActFor("alice@example.com") {
+		t.Error("an account without allowed delegators can act for alice")
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
@@ -8,22 +9,22 @@ import (
 	"github.com/go-webauthn/webauthn/webauthn"
 )
 
-func (u *User) SaveSessionData(userID string, sessionData *webauthn.SessionData) error {
+func (u *User) SaveSessionData(ctx context.Context, userID string, sessionData *webauthn.SessionData) error {
 	sessionDataJSON, err := json.Marshal(sessionData)
 	if err != nil {
 		return err
 	}
 
-	err = dbClient.Save(VeriflowWebAuthnSessionTable, map[string]types.AttributeValue{
+	err = dbClient.Save(ctx, VeriflowWebAuthnSessionTable, map[string]types.AttributeValue{
 		"id":   &types.AttributeValueMemberS{Value: userID},
 		"data": &types.AttributeValueMemberS{Value: string(sessionDataJSON)},
 	})
 	return err
 }
 
-func (u *User) GetSessionData(userID string) (*webauthn.SessionData, error) {
+func (u *User) GetSessionData(ctx context.Context, userID string) (*webauthn.SessionData, error) {
 
-	out, err := dbClient.GetItem(VeriflowWebAuthnSessionTable, map[string]types.AttributeValue{
+	out, err := dbClient.GetItem(ctx, VeriflowWebAuthnSessionTable, map[string]types.AttributeValue{
 		"id": &types.AttributeValueMemberS{Value: userID},
 	})
 	if err != nil {
@@ -48,6 +49,6 @@ func (u *User) GetSessionData(userID string) (*webauthn.SessionData, error) {
 	return &sessionData, nil
 }
 
-func (u *User) DeleteSessionData(userID string) error {
-	return dbClient.Delete(VeriflowWebAuthnSessionTable, userID)
+func (u *User) DeleteSessionData(ctx context.Context, userID string) error {
+	return dbClient.Delete(ctx, VeriflowWebAuthnSessionTable, userID)
 }
@@ -1,8 +1,10 @@
 package models
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -12,12 +14,12 @@ import (
 )
 
 type UserStore interface {
-	GetUserByID(userID string) (webauthn.User, error)
-	SaveSessionData(userID string, sessionData *webauthn.SessionData) error
-	GetSessionData(userID string) (*webauthn.SessionData, error)
-	DeleteSessionData(userID string) error
-	SaveCredentials(userID string, credential *webauthn.Credential) error
-	GetCredentials(userID string) []webauthn.Credential
+	GetUserByID(ctx context.Context, userID string) (webauthn.User, error)
+	SaveSessionData(ctx context.Context, userID string, sessionData *webauthn.SessionData) error
+	GetSessionData(ctx context.Context, userID string) (*webauthn.SessionData, error)
+	DeleteSessionData(ctx context.Context, userID string) error
+	SaveCredentials(ctx context.Context, userID string, credential *webauthn.Credential) error
+	GetCredentials(ctx context.Context, userID string) []webauthn.Credential
 }
 
 type User struct {
@@ -28,6 +30,25 @@ type User struct {
 	Authenticator   Authenticator         `dynamodbav:"authenticator"`
 	CredentialsJSON string                `dynamodbav:"credentialsJSON"`
 	Credentials     []webauthn.Credential `dynamodbav:"-"`
+	MutedRequestors []string              `dynamodbav:"muted_requestors,omitempty"`
+	Phone           Phone                 `dynamodbav:"phone"`
+	Locale          string                `dynamodbav:"locale,omitempty"`   // from the communication tool, e.g. en-US
+	Language        string                `dynamodbav:"language,omitempty"` // chosen with `/veriflow language`, overrides Locale
+}
+
+// MessageLocale is the locale messages to the user are written in
+func (u User) MessageLocale() string {
+	if u.Language != "" {
+		return u.Language
+	}
+	return u.Locale
+}
+
+// Phone is the number one-time codes are sent to, it is only used once verified
+type Phone struct {
+	Number     string    `dynamodbav:"number"` // E.164
+	Verified   bool      `dynamodbav:"verified"`
+	VerifiedAt time.Time `dynamodbav:"verified_at,omitempty"`
 }
 
 type Authenticator struct {
@@ -41,7 +62,7 @@ func NewUserStore() UserStore {
 	return &User{}
 }
 
-func SaveUser(user User) error {
+func SaveUser(ctx context.Context, user User) error {
 	// Encode Credentials to JSON
 	if len(user.Credentials) > 0 {
 		credsJSON, err := json.Marshal(user.Credentials)
@@ -56,13 +77,13 @@ func SaveUser(user User) error {
 		return err
 	}
 
-	return dbClient.Save(VeriflowUsersTable, av)
+	return dbClient.Save(ctx, VeriflowUsersTable, av)
 }
 
-func GetUser(userID string) (User, error) {
+func GetUser(ctx context.Context, userID string) (User, error) {
 	var user User
 
-	dbClient.GetItemById(VeriflowUsersTable, userID, &user)
+	dbClient.GetItemById(ctx, VeriflowUsersTable, userID, &user)
 	// Decode CredentialsJSON
 	if user.CredentialsJSON != "" {
 		err := json.Unmarshal([]byte(user.CredentialsJSON), &user.Credentials)
@@ -74,14 +95,14 @@ func GetUser(userID string) (User, error) {
 	return user, nil
 }
 
-func GetOrCreateUser(userEmail string) (User, error) {
-	user, err := GetUser(userEmail)
+func GetOrCreateUser(ctx context.Context, userEmail string) (User, error) {
+	user, err := GetUser(ctx, userEmail)
 	if user.ID == "" {
 		user.ID = userEmail
 		user.Email = userEmail
 		user.Name = userEmail
 
-		SaveUser(user)
+		SaveUser(ctx, user)
 		return user, err
 	}
 
@@ -95,7 +116,7 @@ func GetOrCreateUser(userEmail string) (User, error) {
 	return user, nil
 }
 
-func GetUserByEmail(userEmail string) (User, error) {
+func GetUserByEmail(ctx context.Context, userEmail string) (User, error) {
 	var user User
 
 	queryInput := &dynamodb.QueryInput{
@@ -108,7 +129,7 @@ func GetUserByEmail(userEmail string) (User, error) {
 		Limit: aws.Int32(1),
 	}
 
-	err := dbClient.QueryOne(queryInput, &user)
+	err := dbClient.QueryOne(ctx, queryInput, &user)
 
 	if user.CredentialsJSON != "" {
 		err := json.Unmarshal([]byte(user.CredentialsJSON), &user.Credentials)
@@ -120,22 +141,49 @@ func GetUserByEmail(userEmail string) (User, error) {
 	return user, err
 }
 
-func (u *User) GetUserByID(userID string) (webauthn.User, error) {
-	user, err := GetUser(userID)
+// HasMuted reports whether the user muted verification requests from the
+// requestor with that email
+func (u *User) HasMuted(requestorEmail string) bool {
+	for _, muted := range u.MutedRequestors {
+		if muted == requestorEmail {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) Mute(requestorEmail string) {
+	if !u.HasMuted(requestorEmail) {
+		u.MutedRequestors = append(u.MutedRequestors, requestorEmail)
+	}
+}
+
+func (u *User) Unmute(requestorEmail string) {
+	muted := u.MutedRequestors[:0]
+	for _, m := range u.MutedRequestors {
+		if m != requestorEmail {
+			muted = append(muted, m)
+		}
+	}
+	u.MutedRequestors = muted
+}
+
+func (u *User) GetUserByID(ctx context.Context, userID string) (webauthn.User, error) {
+	user, err := GetUser(ctx, userID)
 	if err != nil {
 		return &user, err
 	}
 	return &user, nil
 }
 
-func (u *User) SaveCredentials(userID string, credentials *webauthn.Credential) error {
-	user, _ := GetUser(userID)
+func (u *User) SaveCredentials(ctx context.Context, userID string, credentials *webauthn.Credential) error {
+	user, _ := GetUser(ctx, userID)
 	user.Credentials = append(user.Credentials, *credentials)
-	return SaveUser(user)
+	return SaveUser(ctx, user)
 }
 
-func (u *User) GetCredentials(userID string) []webauthn.Credential {
-	user, _ := GetUser(userID)
+func (u *User) GetCredentials(ctx context.Context, userID string) []webauthn.Credential {
+	user, _ := GetUser(ctx, userID)
 	return user.Credentials
 }
 
@@ -158,3 +206,16 @@ func (u *User) WebAuthnIcon() string {
 func (u *User) WebAuthnCredentials() []webauthn.Credential {
 	return u.Credentials
 }
+
+// Party is the public profile of a requestor or recipient
+type Party struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Image string `json:"image,omitempty"`
+}
+
+// PartyOf strips the 2FA details from a user
+func PartyOf(user User) Party {
+	return Party{ID: user.ID, Name: user.Name, Email: user.Email, Image: user.Image}
+}
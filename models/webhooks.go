@@ -0,0 +1,244 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// WebhookDueIndex sorts the queued deliveries of a status by their next
+// attempt, so the dispatcher only reads the pending ones that are due
+const WebhookDueIndex = "WebhookDueIndex"
+
+// WebhookSubscriptionIndex sorts the delivery log of a subscription by time
+const WebhookSubscriptionIndex = "WebhookSubscriptionIndex"
+
+// WebhookSubscription is an endpoint that receives lifecycle events. Events
+// filters which event types are delivered, an empty list receives all of them.
+type WebhookSubscription struct {
+	ID        string    `json:"id" dynamodbav:"id"`
+	URL       string    `json:"url" dynamodbav:"url"`
+	Secret    string    `json:"-" dynamodbav:"secret"`
+	Events    []string  `json:"events" dynamodbav:"events"`
+	CreatedBy string    `json:"created_by,omitempty" dynamodbav:"created_by"`
+	CreatedAt time.Time `json:"created_at,omitempty" dynamodbav:"created_at"`
+
+	// Subscriptions from config.yaml can't be changed through the API
+	FromConfig bool `json:"from_config" dynamodbav:"-"`
+}
+
+// WebhookDelivery records a single attempt to deliver an event
+type WebhookDelivery struct {
+	ID             string    `json:"id" dynamodbav:"id"`
+	SubscriptionID string    `json:"subscription_id" dynamodbav:"subscription_id"`
+	EventID        string    `json:"event_id" dynamodbav:"event_id"`
+	EventType      string    `json:"event_type" dynamodbav:"event_type"`
+	Attempt        int       `json:"attempt" dynamodbav:"attempt"`
+	StatusCode     int       `json:"status_code,omitempty" dynamodbav:"status_code"`
+	Error          string    `json:"error,omitempty" dynamodbav:"error"`
+	Success        bool      `json:"success" dynamodbav:"success"`
+	DeliveredAt    time.Time `json:"delivered_at" dynamodbav:"delivered_at"`
+	Duration       string    `json:"duration" dynamodbav:"duration"`
+
+	// Deliveries are removed through the table TTL
+	ExpiresAt int64 `json:"-" dynamodbav:"expires_at"`
+}
+
+// PendingWebhook is an event that still has to be delivered to a
+// subscription. It is stored before the first attempt so a delivery
+// interrupted by a restart or a frozen Lambda is retried by the dispatcher.
+type PendingWebhook struct {
+	ID             string    `json:"id" dynamodbav:"id"`
+	SubscriptionID string    `json:"subscription_id" dynamodbav:"subscription_id"`
+	EventID        string    `json:"event_id" dynamodbav:"event_id"`
+	EventType      string    `json:"event_type" dynamodbav:"event_type"`
+	Body           string    `json:"body" dynamodbav:"body"`
+	Status         string    `json:"status" dynamodbav:"status"` // PENDING, SENT or FAILED
+	Attempts       int       `json:"attempts" dynamodbav:"attempts"`
+	CreatedAt      time.Time `json:"created_at" dynamodbav:"created_at"`
+	NextAttempt    time.Time `json:"next_attempt" dynamodbav:"next_attempt,unixtime"`
+
+	// Delivered and abandoned events are removed through the table TTL
+	ExpiresAt int64 `json:"-" dynamodbav:"expires_at,omitempty"`
+}
+
+// NewPendingWebhook keys the delivery on the event and the subscription so an
+// event is only ever queued once for a subscription
+func NewPendingWebhook(subscriptionID, eventID, eventType string, body []byte) PendingWebhook {
+	now := time.Now()
+	return PendingWebhook{
+		ID:             eventID + "#" + subscriptionID,
+		SubscriptionID: subscriptionID,
+		EventID:        eventID,
+		EventType:      eventType,
+		Body:           string(body),
+		Status:         "PENDING",
+		CreatedAt:      now,
+		NextAttempt:    now,
+	}
+}
+
+func (s *WebhookSubscription) Matches(eventType string) bool {
+	if len(s.Events) == 0 {
+		return true
+	}
+	for _, event := range s.Events {
+		if event == "*" || event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *WebhookSubscription) Save(ctx context.Context) error {
+	av, err := attributevalue.MarshalMap(s)
+	if err != nil {
+		return err
+	}
+	return dbClient.Save(ctx, VeriflowWebhooksTable, av)
+}
+
+func GetWebhookSubscription(ctx context.Context, id string) (WebhookSubscription, error) {
+	var subscription WebhookSubscription
+
+	err := dbClient.GetItemById(ctx, VeriflowWebhooksTable, id, &subscription)
+	if err != nil || subscription.ID == "" {
+		return subscription, fmt.Errorf("webhook subscription %s not found", id)
+	}
+
+	return subscription, nil
+}
+
+func GetWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	var subscriptions []WebhookSubscription
+
+	err := dbClient.Scan(ctx, &dynamodb.ScanInput{TableName: aws.String(VeriflowWebhooksTable)}, &subscriptions)
+	if err != nil {
+		return nil, fmt.Errorf("error scanning table: %v", err)
+	}
+
+	return subscriptions, nil
+}
+
+func DeleteWebhookSubscription(ctx context.Context, id string) error {
+	return dbClient.Delete(ctx, VeriflowWebhooksTable, id)
+}
+
+func (d *WebhookDelivery) Save(ctx context.Context) error {
+	av, err := attributevalue.MarshalMap(d)
+	if err != nil {
+		return err
+	}
+	return dbClient.Save(ctx, VeriflowWebhookDeliveriesTable, av)
+}
+
+// GetWebhookDeliveries returns the delivery log of a subscription, newest first
+func GetWebhookDeliveries(ctx context.Context, subscriptionID string) ([]WebhookDelivery, error) {
+	keyCond := expression.Key("subscription_id").Equal(expression.Value(subscriptionID))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building expression: %v", err)
+	}
+
+	var deliveries []WebhookDelivery
+	err = dbClient.QueryAll(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(VeriflowWebhookDeliveriesTable),
+		IndexName:                 aws.String(WebhookSubscriptionIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		ScanIndexForward:          aws.Bool(false),
+	}, &deliveries)
+	if err != nil {
+		return nil, fmt.Errorf("error querying deliveries of %s: %v", subscriptionID, err)
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].DeliveredAt.After(deliveries[j].DeliveredAt)
+	})
+
+	return deliveries, nil
+}
+
+// Create queues the delivery, it returns db.ErrItemExists when it already is
+func (p *PendingWebhook) Create(ctx context.Context) error {
+	av, err := attributevalue.MarshalMap(p)
+	if err != nil {
+		return err
+	}
+	return dbClient.Create(ctx, VeriflowWebhookQueueTable, av)
+}
+
+// Claim takes the delivery for lease so no other dispatcher sends it at the
+// same time. It fails with db.ErrConditionFailed when someone else claimed it.
+func (p *PendingWebhook) Claim(ctx context.Context, lease time.Duration) error {
+	attempts := p.Attempts
+	p.Attempts++
+	p.NextAttempt = time.Now().Add(lease)
+
+	av, err := attributevalue.MarshalMap(p)
+	if err != nil {
+		return err
+	}
+
+	cond := expression.Name("status").Equal(expression.Value("PENDING")).And(expression.Name("attempts").Equal(expression.Value(attempts)))
+	return dbClient.SaveIf(ctx, VeriflowWebhookQueueTable, av, cond)
+}
+
+func (p *PendingWebhook) Sent(ctx context.Context, retention time.Duration) error {
+	p.Status = "SENT"
+	p.ExpiresAt = time.Now().Add(retention).Unix()
+	return p.Save(ctx)
+}
+
+// Failed schedules the next attempt, or gives up on the delivery when next is zero
+func (p *PendingWebhook) Failed(ctx context.Context, next time.Time, retention time.Duration) error {
+	p.NextAttempt = next
+	if next.IsZero() {
+		p.Status = "FAILED"
+		p.ExpiresAt = time.Now().Add(retention).Unix()
+	}
+	return p.Save(ctx)
+}
+
+func (p *PendingWebhook) Save(ctx context.Context) error {
+	av, err := attributevalue.MarshalMap(p)
+	if err != nil {
+		return err
+	}
+	return dbClient.Save(ctx, VeriflowWebhookQueueTable, av)
+}
+
+// GetDuePendingWebhooks returns the deliveries whose next attempt is due, oldest first
+func GetDuePendingWebhooks(ctx context.Context) ([]PendingWebhook, error) {
+	keyCond := expression.Key("status").Equal(expression.Value("PENDING")).
+		And(expression.Key("next_attempt").LessThanEqual(expression.Value(time.Now().Unix())))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCond).Build()
+	if err != nil {
+		return nil, fmt.Errorf("error building expression: %v", err)
+	}
+
+	var pending []PendingWebhook
+	err = dbClient.QueryAll(ctx, &dynamodb.QueryInput{
+		TableName:                 aws.String(VeriflowWebhookQueueTable),
+		IndexName:                 aws.String(WebhookDueIndex),
+		KeyConditionExpression:    expr.KeyCondition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	}, &pending)
+	if err != nil {
+		return nil, fmt.Errorf("error querying due webhooks: %v", err)
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+	})
+
+	return pending, nil
+}
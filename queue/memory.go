@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Receive waits this long for a message before returning empty handed
+const memoryWaitTime = 20 * time.Second
+
+// MemoryQueue keeps the jobs in process for local mode. Jobs don't survive a
+// restart, but received jobs that aren't deleted come back after the
+// visibility timeout just like with SQS.
+type MemoryQueue struct {
+	Visibility time.Duration
+
+	messages chan Message
+	mu       sync.Mutex
+	inflight map[string]*time.Timer
+}
+
+func NewMemoryQueue(size int, visibility time.Duration) *MemoryQueue {
+	return &MemoryQueue{
+		Visibility: visibility,
+		messages:   make(chan Message, size),
+		inflight:   make(map[string]*time.Timer),
+	}
+}
+
+func (q *MemoryQueue) Send(ctx context.Context, body []byte) error {
+	select {
+	case q.messages <- Message{ID: uuid.New().String(), Body: body}:
+		return nil
+	default:
+		return errors.New("queue is full")
+	}
+}
+
+func (q *MemoryQueue) SendAfter(ctx context.Context, body []byte, delay time.Duration) error {
+	if delay <= 0 {
+		return q.Send(ctx, body)
+	}
+	if delay > MaxDelay {
+		return fmt.Errorf("delay %s is longer than %s", delay, MaxDelay)
+	}
+	q.hide(Message{ID: uuid.New().String(), Body: body, receipt: uuid.New().String()}, delay)
+	return nil
+}
+
+func (q *MemoryQueue) Receive(ctx context.Context) ([]Message, error) {
+	var msg Message
+	select {
+	case msg = <-q.messages:
+	case <-time.After(memoryWaitTime):
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	msg.ReceiveCount++
+	msg.receipt = uuid.New().String()
+	q.hide(msg, q.Visibility)
+	return []Message{msg}, nil
+}
+
+func (q *MemoryQueue) Delete(ctx context.Context, msg Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	timer, ok := q.inflight[msg.receipt]
+	if !ok {
+		return fmt.Errorf("message %s is not in flight", msg.ID)
+	}
+	timer.Stop()
+	delete(q.inflight, msg.receipt)
+	return nil
+}
+
+func (q *MemoryQueue) Retry(ctx context.Context, msg Message, delay time.Duration) error {
+	if err := q.Delete(ctx, msg); err != nil {
+		return err
+	}
+	q.hide(msg, delay)
+	return nil
+}
+
+// hide puts the message back on the queue once delay passed, unless it is deleted first
+func (q *MemoryQueue) hide(msg Message, delay time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.inflight[msg.receipt] = time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		_, ok := q.inflight[msg.receipt]
+		delete(q.inflight, msg.receipt)
+		q.mu.Unlock()
+
+		if ok {
+			q.messages <- msg
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vdparikh/veriflow/config"
+)
+
+// Message is a job received from the queue. It stays invisible to other
+// receivers until it is deleted, retried or its visibility timeout expires.
+type Message struct {
+	ID   string
+	Body []byte
+
+	// Number of times the message was received, including this one
+	ReceiveCount int
+
+	receipt string
+}
+
+// Queue is a durable job queue with the semantics of SQS: messages are
+// delivered at least once and come back when they aren't deleted in time.
+type Queue interface {
+	Send(ctx context.Context, body []byte) error
+	// SendAfter sends a message that only becomes visible once delay passed,
+	// up to MaxDelay
+	SendAfter(ctx context.Context, body []byte, delay time.Duration) error
+
+	// Receive waits a while for messages and returns an empty slice when there are none
+	Receive(ctx context.Context) ([]Message, error)
+	Delete(ctx context.Context, msg Message) error
+
+	// Retry makes the message visible again after delay
+	Retry(ctx context.Context, msg Message, delay time.Duration) error
+}
+
+// MaxDelay is the longest SQS can delay a message
+const MaxDelay = 15 * time.Minute
+
+func NewQueue(cfg *config.Config) (Queue, error) {
+	queueCfg := cfg.Queue
+	visibility := time.Duration(queueCfg.VisibilitySeconds) * time.Second
+
+	switch queueCfg.Provider {
+	case "memory":
+		return NewMemoryQueue(queueCfg.BufferSize, visibility), nil
+	case "sqs":
+		return NewSQSQueue(queueCfg.URL, visibility)
+	default:
+		return nil, fmt.Errorf("unsupported queue provider %q", queueCfg.Provider)
+	}
+}
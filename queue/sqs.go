@@ -0,0 +1,118 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+)
+
+// SQSQueue is a queue backed by Amazon SQS, or anything speaking its API
+type SQSQueue struct {
+	URL        string
+	Visibility time.Duration
+	Client     *sqs.Client
+}
+
+func NewSQSQueue(url string, visibility time.Duration) (*SQSQueue, error) {
+	if url == "" {
+		return nil, errors.New("queue url is required for sqs")
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+
+	return &SQSQueue{
+		URL:        url,
+		Visibility: visibility,
+		Client:     sqs.NewFromConfig(cfg),
+	}, nil
+}
+
+func (q *SQSQueue) Send(ctx context.Context, body []byte) error {
+	_, err := q.Client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(q.URL),
+		MessageBody: aws.String(string(body)),
+	})
+	return err
+}
+
+func (q *SQSQueue) SendAfter(ctx context.Context, body []byte, delay time.Duration) error {
+	if delay > MaxDelay {
+		return fmt.Errorf("delay %s is longer than %s", delay, MaxDelay)
+	}
+	_, err := q.Client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:     aws.String(q.URL),
+		MessageBody:  aws.String(string(body)),
+		DelaySeconds: int32(delay.Seconds()),
+	})
+	return err
+}
+
+func (q *SQSQueue) Receive(ctx context.Context) ([]Message, error) {
+	result, err := q.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.URL),
+		MaxNumberOfMessages: 10,
+		WaitTimeSeconds:     20,
+		VisibilityTimeout:   int32(q.Visibility.Seconds()),
+		AttributeNames:      []types.QueueAttributeName{types.QueueAttributeName(types.MessageSystemAttributeNameApproximateReceiveCount)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]Message, 0, len(result.Messages))
+	for _, msg := range result.Messages {
+		receiveCount, _ := strconv.Atoi(msg.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		messages = append(messages, Message{
+			ID:           aws.ToString(msg.MessageId),
+			Body:         []byte(aws.ToString(msg.Body)),
+			ReceiveCount: receiveCount,
+			receipt:      aws.ToString(msg.ReceiptHandle),
+		})
+	}
+	return messages, nil
+}
+
+func (q *SQSQueue) Delete(ctx context.Context, msg Message) error {
+	_, err := q.Client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.URL),
+		ReceiptHandle: aws.String(msg.receipt),
+	})
+	return err
+}
+
+// Retry only changes the visibility timeout of the message, it is never sent again
+func (q *SQSQueue) Retry(ctx context.Context, msg Message, delay time.Duration) error {
+	_, err := q.Client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.URL),
+		ReceiptHandle:     aws.String(msg.receipt),
+		VisibilityTimeout: int32(delay.Seconds()),
+	})
+	return err
+}
+
+// FromSQSEvent converts a message delivered by a Lambda SQS event source
+func FromSQSEvent(record events.SQSMessage) Message {
+	receiveCount, _ := strconv.Atoi(record.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	return Message{
+		ID:           record.MessageId,
+		Body:         []byte(record.Body),
+		ReceiveCount: receiveCount,
+		receipt:      record.ReceiptHandle,
+	}
+}
@@ -40,6 +40,20 @@ aws dynamodb update-table \
         "[{\"Create\":{\"IndexName\":\"EmailIndex\",\"KeySchema\":[{\"AttributeName\":\"requestor_email\",\"KeyType\":\"HASH\"}],\"Projection\":{\"ProjectionType\":\"ALL\"},\"ProvisionedThroughput\":{\"ReadCapacityUnits\":5,\"WriteCapacityUnits\":5}}}]" \
     --endpoint-url http://localhost:8000        
 
+aws dynamodb update-table \
+    --table-name VeriflowRequests \
+    --attribute-definitions AttributeName=requestor_email,AttributeType=S AttributeName=start_time,AttributeType=S \
+    --global-secondary-index-updates \
+        "[{\"Create\":{\"IndexName\":\"RequestorIndex\",\"KeySchema\":[{\"AttributeName\":\"requestor_email\",\"KeyType\":\"HASH\"},{\"AttributeName\":\"start_time\",\"KeyType\":\"RANGE\"}],\"Projection\":{\"ProjectionType\":\"ALL\"},\"ProvisionedThroughput\":{\"ReadCapacityUnits\":5,\"WriteCapacityUnits\":5}}}]" \
+    --endpoint-url http://localhost:8000
+
+aws dynamodb update-table \
+    --table-name VeriflowRequests \
+    --attribute-definitions AttributeName=recipient_email,AttributeType=S AttributeName=start_time,AttributeType=S \
+    --global-secondary-index-updates \
+        "[{\"Create\":{\"IndexName\":\"RecipientIndex\",\"KeySchema\":[{\"AttributeName\":\"recipient_email\",\"KeyType\":\"HASH\"},{\"AttributeName\":\"start_time\",\"KeyType\":\"RANGE\"}],\"Projection\":{\"ProjectionType\":\"ALL\"},\"ProvisionedThroughput\":{\"ReadCapacityUnits\":5,\"WriteCapacityUnits\":5}}}]" \
+    --endpoint-url http://localhost:8000
+
 #aws dynamodb delete-table --table-name VeriflowWebAuthnSessions --endpoint-url http://localhost:8000
 aws dynamodb create-table \
     --table-name VeriflowWebAuthnSessions \
@@ -52,5 +66,168 @@ aws dynamodb create-table \
     --table-class STANDARD --endpoint-url http://localhost:8000    
 
 
+#aws dynamodb delete-table --table-name VeriflowBatches --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowBatches \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
+#aws dynamodb delete-table --table-name VeriflowRateLimits --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowRateLimits \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
+aws dynamodb update-time-to-live \
+    --table-name VeriflowRateLimits \
+    --time-to-live-specification "Enabled=true, AttributeName=expires_at" \
+    --endpoint-url http://localhost:8000
+
+#aws dynamodb delete-table --table-name VeriflowWebhooks --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowWebhooks \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
+#aws dynamodb delete-table --table-name VeriflowWebhookDeliveries --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowWebhookDeliveries \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
+aws dynamodb update-time-to-live \
+    --table-name VeriflowWebhookDeliveries \
+    --time-to-live-specification "Enabled=true, AttributeName=expires_at" \
+    --endpoint-url http://localhost:8000
+
+aws dynamodb update-table \
+    --table-name VeriflowWebhookDeliveries \
+    --attribute-definitions AttributeName=subscription_id,AttributeType=S AttributeName=delivered_at,AttributeType=S \
+    --global-secondary-index-updates \
+        "[{\"Create\":{\"IndexName\":\"WebhookSubscriptionIndex\",\"KeySchema\":[{\"AttributeName\":\"subscription_id\",\"KeyType\":\"HASH\"},{\"AttributeName\":\"delivered_at\",\"KeyType\":\"RANGE\"}],\"Projection\":{\"ProjectionType\":\"ALL\"},\"ProvisionedThroughput\":{\"ReadCapacityUnits\":5,\"WriteCapacityUnits\":5}}}]" \
+    --endpoint-url http://localhost:8000
+
+#aws dynamodb delete-table --table-name VeriflowWebhookQueue --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowWebhookQueue \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
+aws dynamodb update-time-to-live \
+    --table-name VeriflowWebhookQueue \
+    --time-to-live-specification "Enabled=true, AttributeName=expires_at" \
+    --endpoint-url http://localhost:8000
+
+aws dynamodb update-table \
+    --table-name VeriflowWebhookQueue \
+    --attribute-definitions AttributeName=status,AttributeType=S AttributeName=next_attempt,AttributeType=N \
+    --global-secondary-index-updates \
+        "[{\"Create\":{\"IndexName\":\"WebhookDueIndex\",\"KeySchema\":[{\"AttributeName\":\"status\",\"KeyType\":\"HASH\"},{\"AttributeName\":\"next_attempt\",\"KeyType\":\"RANGE\"}],\"Projection\":{\"ProjectionType\":\"ALL\"},\"ProvisionedThroughput\":{\"ReadCapacityUnits\":5,\"WriteCapacityUnits\":5}}}]" \
+    --endpoint-url http://localhost:8000
+
+#aws dynamodb delete-table --table-name VeriflowAudit --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowAudit \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
+aws dynamodb update-table \
+    --table-name VeriflowAudit \
+    --attribute-definitions AttributeName=day,AttributeType=S AttributeName=sequence,AttributeType=N \
+    --global-secondary-index-updates \
+        "[{\"Create\":{\"IndexName\":\"AuditDayIndex\",\"KeySchema\":[{\"AttributeName\":\"day\",\"KeyType\":\"HASH\"},{\"AttributeName\":\"sequence\",\"KeyType\":\"RANGE\"}],\"Projection\":{\"ProjectionType\":\"ALL\"},\"ProvisionedThroughput\":{\"ReadCapacityUnits\":5,\"WriteCapacityUnits\":5}}}]" \
+    --endpoint-url http://localhost:8000
+
+#aws dynamodb delete-table --table-name VeriflowOutbox --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowOutbox \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
+aws dynamodb update-time-to-live \
+    --table-name VeriflowOutbox \
+    --time-to-live-specification "Enabled=true, AttributeName=expires_at" \
+    --endpoint-url http://localhost:8000
+
+aws dynamodb update-table \
+    --table-name VeriflowOutbox \
+    --attribute-definitions AttributeName=due,AttributeType=S AttributeName=next_attempt,AttributeType=N \
+    --global-secondary-index-updates \
+        "[{\"Create\":{\"IndexName\":\"OutboxDueIndex\",\"KeySchema\":[{\"AttributeName\":\"due\",\"KeyType\":\"HASH\"},{\"AttributeName\":\"next_attempt\",\"KeyType\":\"RANGE\"}],\"Projection\":{\"ProjectionType\":\"ALL\"},\"ProvisionedThroughput\":{\"ReadCapacityUnits\":5,\"WriteCapacityUnits\":5}}}]" \
+    --endpoint-url http://localhost:8000
+
+#aws dynamodb delete-table --table-name VeriflowOneTimeCodes --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowOneTimeCodes \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
+aws dynamodb update-time-to-live \
+    --table-name VeriflowOneTimeCodes \
+    --time-to-live-specification "Enabled=true, AttributeName=expires_at" \
+    --endpoint-url http://localhost:8000
+
+#aws dynamodb delete-table --table-name VeriflowServiceAccounts --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowServiceAccounts \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
+#aws dynamodb delete-table --table-name VeriflowAPIKeys --endpoint-url http://localhost:8000
+aws dynamodb create-table \
+    --table-name VeriflowAPIKeys \
+    --attribute-definitions \
+        AttributeName=id,AttributeType=S \
+    --key-schema \
+        AttributeName=id,KeyType=HASH \
+    --provisioned-throughput \
+        ReadCapacityUnits=5,WriteCapacityUnits=5 \
+    --table-class STANDARD --endpoint-url http://localhost:8000
+
 # Verify if tables are created
 aws dynamodb list-tables --endpoint-url http://localhost:8000    
\ No newline at end of file
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+)
+
+// batchRefreshAttempts is how often a refresh reads the batch again when
+// another refresh updated it in the meantime
+const batchRefreshAttempts = 5
+
+// InitBatchVerification saves a QUEUED verification request per recipient,
+// the caller queues them to be started. User groups are expanded to their
+// members and the requestor is never verified against themselves.
+func (svc *VerificationService) InitBatchVerification(ctx context.Context, batch *models.VerifyBatch, recipientIDs, groupIDs []string) error {
+	for _, groupID := range groupIDs {
+		members, err := svc.Communicator.GetGroupMembers(ctx, groupID)
+		if err != nil {
+			log.Printf("failed to get members of group %s: %v\n", groupID, err)
+			return fmt.Errorf("failed to get members of user group: %w", err)
+		}
+		recipientIDs = append(recipientIDs, members...)
+	}
+
+	recipients := uniqueRecipients(batch.Slack.UserID, recipientIDs)
+	if len(recipients) == 0 {
+		return errors.New("no recipients to verify")
+	}
+
+	if limit := svc.Config.Verification.MaxBatchRecipients; len(recipients) > limit {
+		return fmt.Errorf("too many recipients (%d), the limit is %d", len(recipients), limit)
+	}
+
+	if err := svc.prepareBatch(ctx, batch, recipients); err != nil {
+		return err
+	}
+
+	if err := svc.Communicator.SendBatchInitConfirmation(ctx, batch); err != nil {
+		log.Printf("failed to send batch confirmation for %s: %v\n", batch.ID, err)
+	}
+
+	return batch.Save(ctx)
+}
+
+// InitChannelVerification verifies every member of the channel the command was
+// issued in. Bots and users who completed a verification within the configured
+// window are skipped. The requests are saved as QUEUED for the caller to queue
+// at a limited rate, and a roster of the verification status is posted in the
+// channel and kept up to date by RefreshBatch.
+func (svc *VerificationService) InitChannelVerification(ctx context.Context, batch *models.VerifyBatch) error {
+	channelCfg := svc.Config.Verification.Channel
+
+	members, err := svc.Communicator.GetChannelMembers(ctx, batch.Slack.Channel)
+	if err != nil {
+		log.Printf("failed to get members of channel %s: %v\n", batch.Slack.Channel, err)
+		return fmt.Errorf("failed to get channel members: %w", err)
+	}
+
+	members = uniqueRecipients(batch.Slack.UserID, members)
+	verified := map[string]bool{}
+	if channelCfg.SkipVerifiedMinutes > 0 {
+		since := time.Now().Add(-time.Duration(channelCfg.SkipVerifiedMinutes) * time.Minute)
+		if verified, err = models.GetRecentlyVerifiedRecipients(ctx, members, since); err != nil {
+			return err
+		}
+	}
+
+	var recipients []string
+	for _, id := range members {
+		if verified[id] {
+			batch.SkippedIDs = append(batch.SkippedIDs, id)
+			continue
+		}
+		recipients = append(recipients, id)
+	}
+
+	if len(recipients) == 0 {
+		return errors.New("everyone in this channel was verified recently")
+	}
+
+	if len(recipients) > channelCfg.MaxMembers {
+		return fmt.Errorf("too many channel members (%d), the limit is %d", len(recipients), channelCfg.MaxMembers)
+	}
+
+	if err := svc.prepareBatch(ctx, batch, recipients); err != nil {
+		return err
+	}
+
+	if err := svc.Communicator.SendBatchRoster(ctx, batch); err != nil {
+		log.Printf("failed to post roster for %s: %v\n", batch.ID, err)
+	}
+
+	return batch.Save(ctx)
+}
+
+// prepareBatch saves a QUEUED request for every recipient up front so the
+// batch knows all of its requests before any of them can complete.
+func (svc *VerificationService) prepareBatch(ctx context.Context, batch *models.VerifyBatch, recipients []string) error {
+	var err error
+	batch.Requestor, err = svc.Communicator.GetUserInfo(ctx, batch.Slack.UserID)
+	if err != nil {
+		log.Printf("failed to get user details: %v\n", err)
+		return err
+	}
+
+	batch.Status = "SENT"
+	batch.StatusLink = fmt.Sprintf("%s/batches/%s", svc.Config.BaseURL, batch.ID)
+
+	for _, recipientID := range recipients {
+		request := models.VerifyRequest{
+			Start:             time.Now(),
+			ID:                uuid.New().String(),
+			Status:            "QUEUED",
+			CommunicationTool: "slack",
+			Message:           batch.Message,
+			BatchID:           batch.ID,
+			Requestor:         batch.Requestor,
+			Recipient:         models.User{ID: recipientID},
+			Slack:             models.SlackRequest{UserID: batch.Slack.UserID, RecipientID: recipientID, Text: batch.Slack.Text, ResponseURL: batch.Slack.ResponseURL},
+		}
+
+		if err := request.Save(ctx); err != nil {
+			return err
+		}
+
+		batch.RequestIDs = append(batch.RequestIDs, request.ID)
+		batch.Requests = append(batch.Requests, request)
+	}
+
+	return nil
+}
+
+// RefreshBatch re-evaluates the aggregated status of a batch after one of its
+// requests changed and sends the requestor a single summary once every request
+// completed or as soon as any of them failed. Requests completing together
+// refresh the batch together, the update is conditional on the version read
+// and the summary is claimed by the update before it is sent.
+func (svc *VerificationService) RefreshBatch(ctx context.Context, batchID string) error {
+	for attempt := 1; ; attempt++ {
+		err := svc.refreshBatch(ctx, batchID)
+		if !errors.Is(err, db.ErrConditionFailed) || attempt == batchRefreshAttempts {
+			return err
+		}
+	}
+}
+
+func (svc *VerificationService) refreshBatch(ctx context.Context, batchID string) error {
+	batch, err := models.GetBatchByID(ctx, batchID)
+	if err != nil {
+		return err
+	}
+
+	if err := batch.LoadRequests(ctx); err != nil {
+		return err
+	}
+
+	counts := batch.Counts()
+	if counts.Pending == 0 {
+		batch.End = time.Now()
+		batch.Status = "COMPLETED"
+		if counts.Failed > 0 {
+			batch.Status = "FAILED"
+		}
+	}
+
+	sendSummary := !batch.SummarySent && (counts.Pending == 0 || counts.Failed > 0)
+	batch.SummarySent = batch.SummarySent || sendSummary
+	if err := batch.Update(ctx); err != nil {
+		return err
+	}
+
+	if batch.Slack.MessageTS != "" {
+		if err := svc.Communicator.SendBatchRoster(ctx, &batch); err != nil {
+			log.Printf("failed to update roster for %s: %v\n", batch.ID, err)
+		}
+	}
+
+	if sendSummary {
+		if err := svc.Communicator.SendBatchSummary(ctx, &batch); err != nil {
+			log.Printf("failed to send batch summary for %s: %v\n", batch.ID, err)
+			// The next refresh sends it
+			batch.SummarySent = false
+			return batch.Update(ctx)
+		}
+	}
+
+	return nil
+}
+
+// uniqueRecipients drops duplicates, empty IDs and the requestor
+func uniqueRecipients(requestorID string, ids []string) []string {
+	seen := map[string]bool{requestorID: true}
+	var recipients []string
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		recipients = append(recipients, id)
+	}
+	return recipients
+}
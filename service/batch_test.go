@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/vdparikh/veriflow/communication"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+)
+
+// summaryCounter is a communicator that only counts the batch summaries
+type summaryCounter struct {
+	communication.Communicator
+	summaries atomic.Int32
+	fail      atomic.Bool
+}
+
+func (s *summaryCounter) SendBatchSummary(ctx context.Context, batch *models.VerifyBatch) error {
+	if s.fail.Load() {
+		return errors.New("slack is down")
+	}
+	s.summaries.Add(1)
+	return nil
+}
+
+func newBatchTestService(t *testing.T, statuses ...string) (*VerificationService, *summaryCounter, string) {
+	t.Helper()
+	ctx := context.Background()
+	models.UseDB(db.NewMemoryDB())
+
+	batch := models.VerifyBatch{ID: "batch", Status: "SENT", Requestor: models.User{ID: "U1", Email: "alice@example.com"}}
+	for i, status := range statuses {
+		request := models.VerifyRequest{ID: fmt.Sprint("request-", i), BatchID: batch.ID, Status: status, Requestor: batch.Requestor}
+		if err := request.Save(ctx); err != nil {
+			t.Fatal(err)
+		}
+		batch.RequestIDs = append(batch.RequestIDs, request.ID)
+	}
+	if err := batch.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	communicator := &summaryCounter{}
+	return &VerificationService{Communicator: communicator}, communicator, batch.ID
+}
+
+// The last requests of a batch completing together send a single summary
+func TestRefreshBatchSendsOneSummary(t *testing.T) {
+	svc, communicator, batchID := newBatchTestService(t, "COMPLETED", "COMPLETED", "FAILED")
+
+	var wg sync.WaitGroup
+	for i := 0; i < batchRefreshAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := svc.RefreshBatch(context.Background(), batchID); err != nil {
+				t.Errorf("RefreshBatch() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := communicator.summaries.Load(); got != 1 {
+		t.Fatalf("sent %d summaries, want 1", got)
+	}
+	batch, err := models.GetBatchByID(context.Background(), batchID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.Status != "FAILED" || !batch.SummarySent || batch.Version != batchRefreshAttempts {
+		t.Fatalf("batch = %s, summary sent %v, version %d", batch.Status, batch.SummarySent, batch.Version)
+	}
+}
+
+func TestRefreshBatchRetriesFailedSummary(t *testing.T) {
+	svc, communicator, batchID := newBatchTestService(t, "COMPLETED", "SENT")
+	ctx := context.Background()
+
+	if err := svc.RefreshBatch(ctx, batchID); err != nil {
+		t.Fatal(err)
+	}
+	if got := communicator.summaries.Load(); got != 0 {
+		t.Fatalf("sent %d summaries while a request is pending", got)
+	}
+
+	request, err := models.GetByID(ctx, "request-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Finish("COMPLETED", "")
+	if err := request.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	communicator.fail.Store(true)
+	if err := svc.RefreshBatch(ctx, batchID); err != nil {
+		t.Fatal(err)
+	}
+	if batch, _ := models.GetBatchByID(ctx, batchID); batch.SummarySent {
+		t.Fatal("summary marked sent after it failed")
+	}
+
+	communicator.fail.Store(false)
+	if err := svc.RefreshBatch(ctx, batchID); err != nil {
+		t.Fatal(err)
+	}
+	if got := communicator.summaries.Load(); got != 1 {
+		t.Fatalf("sent %d summaries, want 1", got)
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+)
+
+var (
+	ErrCodeInvalid  = errors.New("invalid code")
+	ErrCodeExpired  = errors.New("the code expired, please request a new one")
+	ErrCodeAttempts = errors.New("too many invalid codes, please request a new one")
+	ErrCodeTooSoon  = errors.New("a code was sent moments ago")
+)
+
+// SendEmailCode mails a new one-time code to the recipient, replacing the
+// previous one. email is the address the recipient authenticated with.
+func (svc *VerificationService) SendEmailCode(ctx context.Context, request models.VerifyRequest, email string) error {
+	cfg := svc.Config.Authenticator.EmailOTP
+	ttl := time.Duration(cfg.TTLSeconds) * time.Second
+
+	code, err := issueCode(ctx, "email#"+request.ID, email, ttl, time.Duration(cfg.ResendSeconds)*time.Second)
+	if err != nil {
+		return err
+	}
+	return svc.EmailSvc.SendCode(ctx, &request, email, code, ttl)
+}
+
+// VerifyEmailCode checks a code sent with SendEmailCode
+func (svc *VerificationService) VerifyEmailCode(ctx context.Context, request models.VerifyRequest, email, code string) error {
+	_, err := checkCode(ctx, "email#"+request.ID, email, code, svc.Config.Authenticator.EmailOTP.MaxAttempts)
+	return err
+}
+
+// issueCode replaces the code with the ID by a new one for destination, unless
+// the previous one was sent less than resend ago
+func issueCode(ctx context.Context, id, destination string, ttl, resend time.Duration) (string, error) {
+	previous, _ := models.GetOneTimeCode(ctx, id)
+	if wait := time.Until(previous.CreatedAt.Add(resend)); previous.ID != "" && wait > 0 {
+		return "", fmt.Errorf("%w, please wait %d seconds before requesting another one", ErrCodeTooSoon, int(wait.Seconds())+1)
+	}
+
+	record, code, err := models.NewOneTimeCode(id, destination, ttl)
+	if err != nil {
+		return "", err
+	}
+	return code, record.Save(ctx)
+}
+
+// checkCode verifies a code sent to destination, any destination when it is
+// empty. A code can only be used once.
+func checkCode(ctx context.Context, id, destination, code string, maxAttempts int) (models.OneTimeCode, error) {
+	record, _ := models.GetOneTimeCode(ctx, id)
+	if record.ID == "" || destination != "" && record.Destination != destination {
+		return record, ErrCodeInvalid
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return record, ErrCodeExpired
+	}
+	if record.Attempts >= maxAttempts {
+		return record, ErrCodeAttempts
+	}
+
+	// A guess racing this one took the attempt
+	valid, err := record.Check(ctx, code)
+	if errors.Is(err, db.ErrConditionFailed) {
+		return record, ErrCodeInvalid
+	}
+	if err != nil {
+		return record, err
+	}
+	if !valid {
+		return record, ErrCodeInvalid
+	}
+
+	return record, record.Delete(ctx)
+}
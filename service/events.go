@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vdparikh/veriflow/audit"
+	"github.com/vdparikh/veriflow/models"
+)
+
+// Lifecycle events emitted by the verification service
+const (
+	EventRequestCreated   = "request.created"
+	EventRequestSent      = "request.sent"
+	EventRequestCompleted = "request.completed"
+	EventRequestFailed    = "request.failed"
+	EventRequestReported  = "request.reported"
+	EventUserEnrolled     = "user.enrolled"
+)
+
+var EventTypes = []string{
+	EventRequestCreated,
+	EventRequestSent,
+	EventRequestCompleted,
+	EventRequestFailed,
+	EventRequestReported,
+	EventUserEnrolled,
+}
+
+type Event struct {
+	ID      string        `json:"id"`
+	Type    string        `json:"type"`
+	Time    time.Time     `json:"time"`
+	Request *EventRequest `json:"request,omitempty"`
+	User    *models.Party `json:"user,omitempty"`
+	Factor  string        `json:"factor,omitempty"`
+}
+
+// EventRequest is the part of a request shared with subscribers
+type EventRequest struct {
+	ID                string       `json:"id"`
+	BatchID           string       `json:"batch_id,omitempty"`
+	Status            string       `json:"status"`
+	CommunicationTool string       `json:"communication_tool"`
+	Start             time.Time    `json:"start_time"`
+	End               time.Time    `json:"end_time,omitempty"`
+	Requestor         models.Party `json:"requestor"`
+	Recipient         models.Party `json:"recipient"`
+	Message           string       `json:"message,omitempty"`
+	Error             string       `json:"error,omitempty"`
+}
+
+type EventHandler func(ctx context.Context, event Event)
+
+// EventBus fans events out to its subscribers. Handlers are called
+// synchronously and must hand off any slow work themselves.
+type EventBus struct {
+	mu       sync.RWMutex
+	handlers []EventHandler
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+func (b *EventBus) Subscribe(handler EventHandler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, handler)
+}
+
+func (b *EventBus) Publish(ctx context.Context, event Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, handler := range b.handlers {
+		handler(ctx, event)
+	}
+}
+
+func newEvent(eventType string) Event {
+	return Event{
+		ID:   uuid.New().String(),
+		Type: eventType,
+		Time: time.Now(),
+	}
+}
+
+func (svc *VerificationService) publishRequest(ctx context.Context, eventType string, request *models.VerifyRequest) {
+	event := newEvent(eventType)
+	event.Request = &EventRequest{
+		ID:                request.ID,
+		BatchID:           request.BatchID,
+		Status:            request.Status,
+		CommunicationTool: request.CommunicationTool,
+		Start:             request.Start,
+		End:               request.End,
+		Requestor:         models.PartyOf(request.Requestor),
+		Recipient:         models.PartyOf(request.Recipient),
+		Message:           request.Message,
+		Error:             request.Error,
+	}
+	svc.Events.Publish(ctx, event)
+}
+
+// UserEnrolled is called once a user finished setting up a second factor
+func (svc *VerificationService) UserEnrolled(ctx context.Context, user models.User, factor string) {
+	event := newEvent(EventUserEnrolled)
+	party := models.PartyOf(user)
+	event.User = &party
+	event.Factor = factor
+	audit.Record(ctx, audit.UserEnrolled, audit.Actor{ID: user.Email}, "", user.ID, map[string]string{"factor": factor})
+	svc.Events.Publish(ctx, event)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vdparikh/veriflow/audit"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+)
+
+var (
+	ErrMuted            = errors.New("the recipient is not accepting verification requests from you")
+	ErrDuplicateRequest = errors.New("a verification request to this recipient is already open")
+	ErrRateLimited      = errors.New("too many verification requests")
+)
+
+// checkLimits protects recipients from being flooded with requests. Muted
+// requestors and duplicate pending requests are rejected before the rate limit
+// counters are touched so they don't use up the allowance.
+func (svc *VerificationService) checkLimits(ctx context.Context, request *models.VerifyRequest) error {
+	// Mutes used to be keyed on the Slack ID of the requestor, those still apply
+	if request.Recipient.HasMuted(request.Requestor.Email) || request.Recipient.HasMuted(request.Requestor.ID) {
+		return ErrMuted
+	}
+
+	if err := claimOpenRequest(ctx, request); err != nil {
+		return err
+	}
+
+	// A retry of the worker was counted by the attempt before
+	if request.RateCounted {
+		return nil
+	}
+
+	limits := svc.Config.RateLimit
+	if err := rateLimit(ctx, "requestor#"+request.Requestor.Email, limits.RequestorPerHour); err != nil {
+		return fmt.Errorf("%w sent, please try again later", err)
+	}
+	if err := rateLimit(ctx, "recipient#"+request.Recipient.ID, limits.RecipientPerHour); err != nil {
+		return fmt.Errorf("%w for %s, please try again later", err, request.Recipient.Name)
+	}
+
+	return request.SaveRateCounted(ctx)
+}
+
+// claimOpenRequest makes the request the pending one from its requestor to its
+// recipient. The claim is a conditional write on the request that held it
+// before, two requests started at the same time can't both pass.
+func claimOpenRequest(ctx context.Context, request *models.VerifyRequest) error {
+	key := request.Requestor.Email + "#" + request.Recipient.Email
+	holder, err := models.GetOpenRequest(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if holder != "" && holder != request.ID {
+		vr, err := models.GetByID(ctx, holder)
+		if err != nil && !errors.Is(err, models.ErrNotFound) {
+			return err
+		}
+		if err == nil && vr.IsPending() {
+			return fmt.Errorf("%w (%s)", ErrDuplicateRequest, vr.ID)
+		}
+	}
+
+	err = models.ClaimOpenRequest(ctx, key, request.ID, holder)
+	if errors.Is(err, db.ErrConditionFailed) {
+		holder, _ = models.GetOpenRequest(ctx, key)
+		return fmt.Errorf("%w (%s)", ErrDuplicateRequest, holder)
+	}
+	return err
+}
+
+func rateLimit(ctx context.Context, key string, perHour int) error {
+	if perHour <= 0 {
+		return nil
+	}
+
+	count, err := models.IncrementRateLimit(ctx, key, time.Hour)
+	if err != nil {
+		// Don't block verifications when the counter can't be updated
+		log.Printf("failed to update rate limit for %s: %v\n", key, err)
+		return nil
+	}
+
+	if count > perHour {
+		return ErrRateLimited
+	}
+	return nil
+}
+
+// MuteRequestor stops verification requests from the requestor reaching the
+// recipient. Mutes are keyed on the email so they hold whichever tool the
+// requests come from.
+func (svc *VerificationService) MuteRequestor(ctx context.Context, recipient *models.User, requestor models.User) error {
+	recipient.Mute(requestor.Email)
+	audit.Record(ctx, audit.UserMuted, audit.Actor{ID: recipient.Email}, "", requestor.Email, nil)
+	return models.SaveUser(ctx, *recipient)
+}
+
+func (svc *VerificationService) UnmuteRequestor(ctx context.Context, recipient *models.User, requestor models.User) error {
+	recipient.Unmute(requestor.Email)
+	recipient.Unmute(requestor.ID)
+	audit.Record(ctx, audit.UserUnmuted, audit.Actor{ID: recipient.Email}, "", requestor.Email, nil)
+	return models.SaveUser(ctx, *recipient)
+}
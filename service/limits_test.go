@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+)
+
+func newLimitsTestService() *VerificationService {
+	models.UseDB(db.NewMemoryDB())
+	return &VerificationService{Config: &config.Config{}}
+}
+
+func newLimitsTestRequest(t *testing.T, id, status string) *models.VerifyRequest {
+	t.Helper()
+	request := &models.VerifyRequest{
+		ID:        id,
+		Status:    status,
+		Requestor: models.User{ID: "U1", Email: "alice@example.com"},
+		Recipient: models.User{ID: "U2", Email: "bob@example.com"},
+	}
+	if err := request.Save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return request
+}
+
+func TestMutesAreKeyedOnEmail(t *testing.T) {
+	svc := newLimitsTestService()
+	ctx := context.Background()
+	recipient := &models.User{ID: "U2", Email: "bob@example.com"}
+
+	// Muted from Slack, the requestor sends through the API next
+	if err := svc.MuteRequestor(ctx, recipient, models.User{ID: "U1", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	request := &models.VerifyRequest{
+		ID:        "api",
+		Requestor: models.User{ID: "alice@example.com", Email: "alice@example.com"},
+		Recipient: *recipient,
+	}
+	if err := svc.checkLimits(ctx, request); !errors.Is(err, ErrMuted) {
+		t.Fatalf("checkLimits() error = %v, want ErrMuted", err)
+	}
+
+	// Mutes stored before were keyed on the Slack ID
+	request.Recipient.MutedRequestors = []string{"U1"}
+	request.Requestor.ID = "U1"
+	if err := svc.checkLimits(ctx, request); !errors.Is(err, ErrMuted) {
+		t.Fatalf("checkLimits() with a Slack ID mute error = %v, want ErrMuted", err)
+	}
+
+	recipient.MutedRequestors = []string{"U1", "alice@example.com"}
+	if err := svc.UnmuteRequestor(ctx, recipient, models.User{ID: "U1", Email: "alice@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(recipient.MutedRequestors) != 0 {
+		t.Fatalf("muted requestors after unmute = %v", recipient.MutedRequestors)
+	}
+}
+
+func TestDuplicateRequests(t *testing.T) {
+	svc := newLimitsTestService()
+	ctx := context.Background()
+
+	first := newLimitsTestRequest(t, "first", "QUEUED")
+	if err := svc.checkLimits(ctx, first); err != nil {
+		t.Fatalf("checkLimits() error = %v", err)
+	}
+	// Retries of the worker start the same request again
+	if err := svc.checkLimits(ctx, first); err != nil {
+		t.Fatalf("checkLimits() of a retry error = %v", err)
+	}
+
+	for _, status := range []string{"QUEUED", "RECEIVED", "SENT"} {
+		first.Status = status
+		if err := first.Save(ctx); err != nil {
+			t.Fatal(err)
+		}
+		second := newLimitsTestRequest(t, "second-"+status, "RECEIVED")
+		if err := svc.checkLimits(ctx, second); !errors.Is(err, ErrDuplicateRequest) {
+			t.Fatalf("checkLimits() while the first is %s error = %v, want ErrDuplicateRequest", status, err)
+		}
+	}
+
+	first.Finish("COMPLETED", "")
+	if err := first.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.checkLimits(ctx, newLimitsTestRequest(t, "third", "RECEIVED")); err != nil {
+		t.Fatalf("checkLimits() after the first completed error = %v", err)
+	}
+}
+
+func TestDuplicateRequestsStartedTogether(t *testing.T) {
+	svc := newLimitsTestService()
+	ctx := context.Background()
+
+	var requests []*models.VerifyRequest
+	for i := 0; i < 10; i++ {
+		requests = append(requests, newLimitsTestRequest(t, fmt.Sprint("request-", i), "RECEIVED"))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(requests))
+	for i, request := range requests {
+		wg.Add(1)
+		go func(i int, request *models.VerifyRequest) {
+			defer wg.Done()
+			errs[i] = svc.checkLimits(ctx, request)
+		}(i, request)
+	}
+	wg.Wait()
+
+	passed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			passed++
+		case !errors.Is(err, ErrDuplicateRequest):
+			t.Fatalf("checkLimits() error = %v", err)
+		}
+	}
+	if passed != 1 {
+		t.Fatalf("%d requests passed, want 1", passed)
+	}
+}
+
+func TestRetriesCountOnce(t *testing.T) {
+	svc := newLimitsTestService()
+	svc.Config.RateLimit.RequestorPerHour = 1
+	ctx := context.Background()
+
+	first := newLimitsTestRequest(t, "first", "QUEUED")
+	for attempt := 1; attempt <= 3; attempt++ {
+		// The worker reads the request again for every attempt
+		stored, err := models.GetByID(ctx, first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.checkLimits(ctx, &stored); err != nil {
+			t.Fatalf("checkLimits() of attempt %d error = %v", attempt, err)
+		}
+	}
+
+	first.Finish("COMPLETED", "")
+	if err := first.Save(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.checkLimits(ctx, newLimitsTestRequest(t, "second", "RECEIVED")); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("checkLimits() of the second request error = %v, want ErrRateLimited", err)
+	}
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+)
+
+// Kinds of notifications sent through the outbox
+const (
+	NotifySlackVerification     = "slack.verification"
+	NotifySlackInitConfirmation = "slack.init_confirmation"
+	NotifySlackCompletion       = "slack.completion"
+	NotifySlackFailure          = "slack.failure"
+	NotifySlackCancellation     = "slack.cancellation"
+	NotifyEmailVerification     = "email.verification"
+	NotifyEmailInitConfirmation = "email.init_confirmation"
+	NotifyEmailCompletion       = "email.completion"
+	NotifyEmailFailure          = "email.failure"
+	NotifyEmailCancellation     = "email.cancellation"
+)
+
+// A claimed notification is handed to another dispatcher when it isn't done by then
+const outboxLease = 2 * time.Minute
+
+// saveWithNotifications stores the request and queues the notifications of
+// the change in one transaction, then tries to deliver them right away.
+// Notifications that can't be delivered now are retried by DispatchOutbox.
+func (svc *VerificationService) saveWithNotifications(ctx context.Context, request *models.VerifyRequest, kinds ...string) error {
+	messages := make([]models.OutboxMessage, 0, len(kinds))
+	for _, kind := range kinds {
+		messages = append(messages, models.NewOutboxMessage(request, kind))
+	}
+
+	if err := request.SaveWithOutbox(ctx, messages); err != nil {
+		return err
+	}
+
+	for i := range messages {
+		svc.deliverNotification(ctx, &messages[i])
+	}
+
+	// The notifications store the Slack messages they sent on the request
+	if stored, _ := models.GetByID(ctx, request.ID); stored.ID != "" {
+		*request = stored
+	}
+	return nil
+}
+
+// DispatchOutbox delivers the notifications whose next attempt is due
+func (svc *VerificationService) DispatchOutbox(ctx context.Context) error {
+	messages, err := models.GetDueOutboxMessages(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		svc.deliverNotification(ctx, &messages[i])
+	}
+	return nil
+}
+
+// StartOutboxDispatcher retries undelivered notifications until ctx is done
+func (svc *VerificationService) StartOutboxDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(svc.Config.Outbox.IntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := svc.DispatchOutbox(ctx); err != nil {
+				log.Printf("failed to dispatch outbox: %v\n", err)
+			}
+		}
+	}
+}
+
+func (svc *VerificationService) deliverNotification(ctx context.Context, msg *models.OutboxMessage) {
+	if err := msg.Claim(ctx, outboxLease); err != nil {
+		if !errors.Is(err, db.ErrConditionFailed) {
+			log.Printf("failed to claim notification %s: %v\n", msg.ID, err)
+		}
+		return
+	}
+
+	err := svc.sendNotification(ctx, msg)
+	if err == nil {
+		if err := msg.Sent(ctx); err != nil {
+			log.Printf("failed to mark notification %s as sent: %v\n", msg.ID, err)
+		}
+		return
+	}
+
+	log.Printf("failed to send notification %s attempt %d: %v\n", msg.ID, msg.Attempts, err)
+
+	var next time.Time
+	if msg.Attempts < svc.Config.Outbox.MaxAttempts {
+		backoff := time.Duration(svc.Config.Outbox.BackoffSeconds) * time.Second
+		next = time.Now().Add(backoff << (msg.Attempts - 1))
+	}
+	if err := msg.Failed(ctx, err, next); err != nil {
+		log.Printf("failed to reschedule notification %s: %v\n", msg.ID, err)
+	}
+
+	// A recipient who never got the verification message can't complete it
+	if next.IsZero() && msg.Kind == NotifySlackVerification {
+		request, err := models.GetByID(ctx, msg.RequestID)
+		if err == nil && request.IsOpen() {
+			request.Error = "Failed to deliver the verification message"
+			svc.SendFailure(ctx, request)
+		}
+	}
+}
+
+func (svc *VerificationService) sendNotification(ctx context.Context, msg *models.OutboxMessage) error {
+	request, err := models.GetByID(ctx, msg.RequestID)
+	if err != nil {
+		return err
+	}
+	if request.ID == "" {
+		return fmt.Errorf("request %s not found", msg.RequestID)
+	}
+
+	switch msg.Kind {
+	case NotifySlackVerification:
+		err = svc.Communicator.SendVerificationMessage(ctx, &request)
+	case NotifySlackInitConfirmation:
+		err = svc.Communicator.SendInitConfirmation(ctx, &request)
+	case NotifySlackCompletion:
+		err = svc.Communicator.SendCompletionMessage(ctx, &request)
+	case NotifySlackFailure:
+		err = svc.Communicator.SendFailedVerificationMessage(ctx, &request)
+	case NotifySlackCancellation:
+		err = svc.Communicator.SendCancellationMessage(ctx, &request)
+	case NotifyEmailVerification:
+		return svc.EmailSvc.SendVerificationMessage(ctx, &request)
+	case NotifyEmailInitConfirmation:
+		return svc.EmailSvc.SendInitConfirmation(ctx, &request)
+	case NotifyEmailCompletion:
+		return svc.EmailSvc.SendCompletionMessage(ctx, &request)
+	case NotifyEmailFailure:
+		return svc.EmailSvc.SendFailedVerificationMessage(ctx, &request)
+	case NotifyEmailCancellation:
+		return svc.EmailSvc.SendCancellationMessage(ctx, &request)
+	default:
+		return fmt.Errorf("unknown notification %s", msg.Kind)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// The message went out, failing now would only send it twice
+	if err := svc.saveSlackReferences(ctx, request); err != nil {
+		log.Printf("failed to save slack messages of request %s: %v\n", request.ID, err)
+	}
+	return nil
+}
+
+// saveSlackReferences keeps the channels and timestamps of the messages sent
+// for the request, they are needed to update or delete the messages later
+func (svc *VerificationService) saveSlackReferences(ctx context.Context, sent models.VerifyRequest) error {
+	return sent.SaveSlackReferences(ctx)
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/vdparikh/veriflow/audit"
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/telephony"
+)
+
+var ErrNoPhone = errors.New("no verified phone number")
+
+// StartPhoneEnrollment texts a code to the number, the number is only saved
+// once the code comes back through FinishPhoneEnrollment
+func (svc *VerificationService) StartPhoneEnrollment(ctx context.Context, user *models.User, number string) error {
+	number, err := telephony.NormalizeNumber(number)
+	if err != nil {
+		return err
+	}
+
+	code, ttl, err := svc.issuePhoneCode(ctx, "phone#"+user.ID, number)
+	if err != nil {
+		return err
+	}
+
+	audit.Record(ctx, audit.UserEnrollmentStarted, audit.Actor{ID: user.Email}, "", user.ID, map[string]string{"factor": "sms"})
+	return svc.sendPhoneCode(ctx, *user, number, code, ttl, false)
+}
+
+// FinishPhoneEnrollment saves the number the code was sent to as verified
+func (svc *VerificationService) FinishPhoneEnrollment(ctx context.Context, user *models.User, code string) error {
+	record, err := checkCode(ctx, "phone#"+user.ID, "", code, svc.Config.Authenticator.SMSOTP.MaxAttempts)
+	if err != nil {
+		return err
+	}
+
+	user.Phone = models.Phone{Number: record.Destination, Verified: true, VerifiedAt: time.Now()}
+	audit.Record(ctx, audit.UserEnrolled, audit.Actor{ID: user.Email}, "", user.ID, map[string]string{"factor": "sms"})
+	return models.SaveUser(ctx, *user)
+}
+
+// SendPhoneCode sends a code for the request to the verified number of the
+// recipient, read out in a call when voice is set
+func (svc *VerificationService) SendPhoneCode(ctx context.Context, request models.VerifyRequest, user models.User, voice bool) error {
+	if !user.Phone.Verified {
+		return ErrNoPhone
+	}
+
+	code, ttl, err := svc.issuePhoneCode(ctx, "sms#"+request.ID, user.Phone.Number)
+	if err != nil {
+		return err
+	}
+
+	return svc.sendPhoneCode(ctx, user, user.Phone.Number, code, ttl, voice)
+}
+
+// sendPhoneCode texts the code in the language of the user, or reads it out in a call when voice is set
+func (svc *VerificationService) sendPhoneCode(ctx context.Context, user models.User, number, code string, ttl time.Duration, voice bool) error {
+	data := config.MessageData{Recipient: user, Code: code, Minutes: int(ttl.Minutes())}
+	message := config.SMSCodeMessage
+	if voice {
+		// Digits one by one, a number would be read as "one hundred twenty-three thousand..."
+		data.Code = strings.Join(strings.Split(code, ""), ", ")
+		message = config.VoiceCodeMessage
+	}
+
+	text, err := svc.Config.Templates.Execute(user.MessageLocale(), message, data)
+	if err != nil {
+		return err
+	}
+	if voice {
+		return svc.Telephony.Call(ctx, number, text)
+	}
+	return svc.Telephony.SendSMS(ctx, number, text)
+}
+
+// VerifyPhoneCode checks a code sent with SendPhoneCode
+func (svc *VerificationService) VerifyPhoneCode(ctx context.Context, request models.VerifyRequest, user models.User, code string) error {
+	if !user.Phone.Verified {
+		return ErrNoPhone
+	}
+
+	_, err := checkCode(ctx, "sms#"+request.ID, user.Phone.Number, code, svc.Config.Authenticator.SMSOTP.MaxAttempts)
+	return err
+}
+
+// issuePhoneCode limits the codes a number receives, so Veriflow can't be used to flood it
+func (svc *VerificationService) issuePhoneCode(ctx context.Context, id, number string) (string, time.Duration, error) {
+	cfg := svc.Config.Authenticator.SMSOTP
+	if svc.Telephony == nil {
+		return "", 0, errors.New("no telephony provider configured")
+	}
+
+	if err := rateLimit(ctx, "phone#"+number, cfg.PerNumberPerHour); err != nil {
+		return "", 0, fmt.Errorf("%w for this number, please try again later", err)
+	}
+
+	ttl := time.Duration(cfg.TTLSeconds) * time.Second
+	code, err := issueCode(ctx, id, number, ttl, time.Duration(cfg.ResendSeconds)*time.Second)
+	return code, ttl, err
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/telephony/twiliotest"
+)
+
+var codePattern = regexp.MustCompile(`\d{6}`)
+
+func newPhoneTestService(t *testing.T) (*VerificationService, *twiliotest.Server) {
+	t.Helper()
+	models.UseDB(db.NewMemoryDB())
+
+	templates, err := config.NewMessageTemplates(config.Messages{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{Templates: templates}
+	cfg.Authenticator.SMSOTP.TTLSeconds = 300
+	cfg.Authenticator.SMSOTP.MaxAttempts = 3
+	cfg.Authenticator.SMSOTP.ResendSeconds = 30
+	cfg.Authenticator.SMSOTP.PerNumberPerHour = 3
+
+	server := twiliotest.NewServer()
+	t.Cleanup(server.Close)
+	return &VerificationService{Config: cfg, Telephony: server.Client()}, server
+}
+
+func TestPhoneEnrollment(t *testing.T) {
+	svc, server := newPhoneTestService(t)
+	ctx := context.Background()
+	user := &models.User{ID: "U123", Email: "alice@example.com", Name: "Alice"}
+
+	if err := svc.StartPhoneEnrollment(ctx, user, "+1 (415) 555-0100"); err != nil {
+		t.Fatalf("StartPhoneEnrollment() error = %v", err)
+	}
+	messages := server.Messages()
+	if len(messages) != 1 || messages[0].Kind != "Messages" || messages[0].To != "+14155550100" {
+		t.Fatalf("received %+v, want a text to +14155550100", messages)
+	}
+	if user.Phone.Verified {
+		t.Fatal("phone verified before the code came back")
+	}
+
+	if err := svc.FinishPhoneEnrollment(ctx, user, "000000"); !errors.Is(err, ErrCodeInvalid) {
+		t.Fatalf("FinishPhoneEnrollment() with a wrong code error = %v, want ErrCodeInvalid", err)
+	}
+
+	code := codePattern.FindString(messages[0].Body)
+	if err := svc.FinishPhoneEnrollment(ctx, user, code); err != nil {
+		t.Fatalf("FinishPhoneEnrollment() error = %v", err)
+	}
+	if !user.Phone.Verified || user.Phone.Number != "+14155550100" {
+		t.Errorf("phone = %+v, want +14155550100 verified", user.Phone)
+	}
+	stored, err := models.GetUser(ctx, user.ID)
+	if err != nil || !stored.Phone.Verified {
+		t.Errorf("stored phone = %+v, %v", stored.Phone, err)
+	}
+
+	// Codes are used once
+	if err := svc.FinishPhoneEnrollment(ctx, user, code); !errors.Is(err, ErrCodeInvalid) {
+		t.Errorf("reused code error = %v, want ErrCodeInvalid", err)
+	}
+}
+
+func TestPhoneEnrollmentRejectsInvalidNumbers(t *testing.T) {
+	svc, server := newPhoneTestService(t)
+
+	err := svc.StartPhoneEnrollment(context.Background(), &models.User{ID: "U123"}, "call me")
+	if err == nil {
+		t.Fatal("StartPhoneEnrollment() accepted an invalid number")
+	}
+	if len(server.Messages()) != 0 {
+		t.Error("a text was sent to an invalid number")
+	}
+}
+
+func TestSendPhoneCode(t *testing.T) {
+	svc, server := newPhoneTestService(t)
+	ctx := context.Background()
+	user := models.User{ID: "U123", Phone: models.Phone{Number: "+14155550100", Verified: true}}
+
+	if err := svc.SendPhoneCode(ctx, models.VerifyRequest{ID: "r1"}, user, false); err != nil {
+		t.Fatalf("SendPhoneCode() error = %v", err)
+	}
+	if err := svc.SendPhoneCode(ctx, models.VerifyRequest{ID: "r2"}, user, true); err != nil {
+		t.Fatalf("SendPhoneCode() by voice error = %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 2 || messages[0].Kind != "Messages" || messages[1].Kind != "Calls" {
+		t.Fatalf("received %+v, want a text and a call", messages)
+	}
+	if err := svc.VerifyPhoneCode(ctx, models.VerifyRequest{ID: "r1"}, user, codePattern.FindString(messages[0].Body)); err != nil {
+		t.Errorf("VerifyPhoneCode() of the text error = %v", err)
+	}
+
+	// The call reads the digits one by one
+	spoken := regexp.MustCompile(`\d(, \d){5}`).FindString(messages[1].Body)
+	if spoken == "" {
+		t.Fatalf("call Twiml = %s, want the digits separated", messages[1].Body)
+	}
+	if err := svc.VerifyPhoneCode(ctx, models.VerifyRequest{ID: "r2"}, user, strings.ReplaceAll(spoken, ", ", "")); err != nil {
+		t.Errorf("VerifyPhoneCode() of the call error = %v", err)
+	}
+
+	if err := svc.SendPhoneCode(ctx, models.VerifyRequest{ID: "r3"}, models.User{ID: "U456"}, false); !errors.Is(err, ErrNoPhone) {
+		t.Errorf("SendPhoneCode() without a verified phone error = %v, want ErrNoPhone", err)
+	}
+}
+
+func TestPhoneCodesPerNumberLimit(t *testing.T) {
+	svc, server := newPhoneTestService(t)
+	ctx := context.Background()
+	number := "+14155550100"
+
+	// Enrollments of other users count for the same number
+	for _, id := range []string{"U1", "U2"} {
+		if err := svc.StartPhoneEnrollment(ctx, &models.User{ID: id}, number); err != nil {
+			t.Fatalf("StartPhoneEnrollment(%s) error = %v", id, err)
+		}
+	}
+	user := models.User{ID: "U3", Phone: models.Phone{Number: number, Verified: true}}
+	if err := svc.SendPhoneCode(ctx, models.VerifyRequest{ID: "r1"}, user, false); err != nil {
+		t.Fatalf("SendPhoneCode() error = %v", err)
+	}
+
+	err := svc.SendPhoneCode(ctx, models.VerifyRequest{ID: "r2"}, user, true)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("SendPhoneCode() over the limit error = %v, want ErrRateLimited", err)
+	}
+	if got := len(server.Messages()); got != 3 {
+		t.Errorf("received %d messages, want 3", got)
+	}
+
+	// Other numbers have their own limit
+	other := models.User{ID: "U4", Phone: models.Phone{Number: "+14155550199", Verified: true}}
+	if err := svc.SendPhoneCode(ctx, models.VerifyRequest{ID: "r3"}, other, false); err != nil {
+		t.Errorf("SendPhoneCode() to another number error = %v", err)
+	}
+}
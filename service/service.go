@@ -1,33 +1,58 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"time"
 
-	"github.com/go-webauthn/webauthn/webauthn"
 	"github.com/pquerna/otp/totp"
 	"github.com/skip2/go-qrcode"
+	"github.com/vdparikh/veriflow/audit"
 	"github.com/vdparikh/veriflow/auth"
 	"github.com/vdparikh/veriflow/communication"
 	"github.com/vdparikh/veriflow/config"
 	"github.com/vdparikh/veriflow/email"
+	"github.com/vdparikh/veriflow/incident"
 	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/telephony"
+	"github.com/vdparikh/veriflow/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type VerificationService struct {
-	Config       *config.Config
-	Auth         auth.Authenticator
-	Communicator communication.Communicator
-	EmailSvc     email.Email
+	Config        *config.Config
+	Auth          auth.Authenticator
+	Communicator  communication.Communicator
+	EmailUsers    communication.Communicator // users without an account on the communication tool
+	EmailSvc      email.Email
+	IncidentSinks []incident.Sink
+	Events        *EventBus
+	Telephony     telephony.Provider // nil when SMS and voice codes aren't set up
 }
 
 func NewVerificationService(cfg *config.Config) (*VerificationService, error) {
+	emailSvc, err := email.NewEmail(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	telephonyProvider, err := telephony.NewProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
 	svc := &VerificationService{
-		Config:       cfg,
-		Auth:         auth.NewAuthenticator(cfg),
-		Communicator: communication.NewCommunicator(cfg),
-		EmailSvc:     email.NewEmail(cfg),
+		Config:        cfg,
+		Auth:          auth.NewAuthenticator(cfg),
+		Communicator:  communication.NewCommunicator(cfg),
+		EmailUsers:    &communication.EmailCommunicator{},
+		EmailSvc:      emailSvc,
+		IncidentSinks: incident.NewSinks(cfg),
+		Events:        NewEventBus(),
+		Telephony:     telephonyProvider,
 	}
 
 	if svc.Communicator == nil {
@@ -37,80 +62,250 @@ func NewVerificationService(cfg *config.Config) (*VerificationService, error) {
 	return svc, nil
 }
 
-func (svc *VerificationService) FetchUserDetails(request *models.VerifyRequest) error {
-	//TODO: update the user details on every fetch to make sure things are latest and greatest
+func (svc *VerificationService) FetchUserDetails(ctx context.Context, request *models.VerifyRequest) error {
 	var err error
-	request.Requestor, err = svc.Communicator.GetUserInfo(request.Slack.UserID)
+	request.Requestor, err = svc.FetchUser(ctx, request.Slack.UserID)
 	if err != nil {
 		log.Printf("failed to get user details: %v\n", err)
 		return err
 	}
 
-	request.Requestor, err = models.GetUser(request.Slack.UserID)
-	if err != nil {
-		models.SaveUser(request.Requestor)
-	}
-
-	request.Recipient, err = svc.Communicator.GetUserInfo(request.Slack.RecipientID)
+	request.Recipient, err = svc.FetchUser(ctx, request.Slack.RecipientID)
 	if err != nil {
 		log.Printf("failed to get recipient: %v\n", err)
 		return errors.New("failed to get recipient")
 	}
 
-	request.Recipient, err = models.GetUser(request.Slack.RecipientID)
-	if err != nil {
-		request.Recipient.CredentialsJSON = ""
-		request.Recipient.Credentials = []webauthn.Credential{}
-		request.Recipient.Authenticator.Validated = false
-		models.SaveUser(request.Recipient)
+	if request.RequestorChannel == "" {
+		request.RequestorChannel = svc.channelOf(request.Slack.UserID)
+	}
+	if request.RecipientChannel == "" {
+		request.RecipientChannel = svc.channelOf(request.Slack.RecipientID)
 	}
 
 	return nil
 }
 
-func (svc *VerificationService) InitVerification(request *models.VerifyRequest) error {
-	err := svc.FetchUserDetails(request)
+// communicatorFor returns the communicator that knows the user
+func (svc *VerificationService) communicatorFor(userID string) communication.Communicator {
+	if communication.IsEmailAddress(userID) {
+		return svc.EmailUsers
+	}
+	return svc.Communicator
+}
+
+// channelOf is where a user gets their messages when they didn't choose
+func (svc *VerificationService) channelOf(userID string) string {
+	if communication.IsEmailAddress(userID) {
+		return models.ChannelEmail
+	}
+	return svc.Config.Communication.ActiveService
+}
+
+// FetchUser refreshes the profile of a user from the communication tool on
+// every fetch while keeping what Veriflow stores for them (2FA, muted users)
+func (svc *VerificationService) FetchUser(ctx context.Context, userID string) (models.User, error) {
+	profile, err := svc.communicatorFor(userID).GetUserInfo(ctx, userID)
 	if err != nil {
-		return err
+		return profile, err
 	}
 
-	fmt.Printf("starting verification for %s initiated by %s\n", request.Requestor.Email, request.Recipient.Email)
-	return svc.NewVerification(request)
+	user, _ := models.GetUser(ctx, userID)
+	if user.ID == "" {
+		user = profile
+	} else {
+		user.Name, user.Email, user.Image, user.Locale = profile.Name, profile.Email, profile.Image, profile.Locale
+	}
+
+	return user, models.SaveUser(ctx, user)
+}
+
+// EmailOf returns the email of a user. Users Veriflow already stored are not
+// looked up on the communication tool, slash commands only get 3 seconds.
+func (svc *VerificationService) EmailOf(ctx context.Context, userID string) (string, error) {
+	if communication.IsEmailAddress(userID) {
+		return userID, nil
+	}
+	if user, _ := models.GetUser(ctx, userID); user.Email != "" {
+		return user.Email, nil
+	}
+
+	profile, err := svc.Communicator.GetUserInfo(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if profile.Email == "" {
+		return "", fmt.Errorf("user %s has no email address", userID)
+	}
+	return profile.Email, nil
 }
 
-func (svc *VerificationService) NewVerification(request *models.VerifyRequest) error {
-	request.AuthLink, _ = svc.Auth.GenerateAuthLink("auth", request.ID)
-	request.ReportLink, _ = svc.Auth.GenerateAuthLink("report", request.ID)
-	request.StatusLink, _ = svc.Auth.GenerateAuthLink("status", request.ID)
+func (svc *VerificationService) InitVerification(ctx context.Context, request *models.VerifyRequest) (err error) {
+	ctx, span := tracing.Start(ctx, "verification.init", attribute.String("veriflow.request_id", request.ID), attribute.String("veriflow.channel", request.CommunicationTool))
+	defer func() { tracing.End(span, err) }()
 
-	err := svc.Communicator.SendVerificationMessage(request)
+	err = svc.FetchUserDetails(ctx, request)
 	if err != nil {
 		return err
 	}
 
-	request.Status = "SENT"
-	err = svc.Communicator.SendInitConfirmation(request)
+	err = svc.checkLimits(ctx, request)
 	if err != nil {
 		return err
 	}
-	go svc.EmailSvc.SendVerificationMessage(request)
-	return request.Save()
+
+	fmt.Printf("starting verification for %s initiated by %s\n", request.Requestor.Email, request.Recipient.Email)
+	ctx = audit.WithServiceAccount(ctx, request.ServiceAccountID, request.APIKeyID)
+	audit.Record(ctx, audit.RequestCreated, audit.Actor{ID: request.Requestor.Email, IP: request.RequestorIP}, request.ID, request.Recipient.Email, map[string]string{
+		"communication_tool": request.CommunicationTool,
+		"batch_id":           request.BatchID,
+	})
+	svc.publishRequest(ctx, EventRequestCreated, request)
+	return svc.NewVerification(ctx, request)
+}
+
+func (svc *VerificationService) NewVerification(ctx context.Context, request *models.VerifyRequest) error {
+	request.AuthLink, _ = svc.Auth.GenerateAuthLink(ctx, "auth", request.ID)
+	request.ReportLink, _ = svc.Auth.GenerateAuthLink(ctx, "report", request.ID)
+	request.StatusLink, _ = svc.Auth.GenerateAuthLink(ctx, "status", request.ID)
+
+	request.Status = "SENT"
+
+	notifications := []string{NotifySlackVerification, NotifyEmailVerification}
+	// Requestors of a batch get a single confirmation for the whole batch
+	if request.BatchID == "" {
+		notifications = append(notifications, NotifySlackInitConfirmation, NotifyEmailInitConfirmation)
+	}
+	if err := svc.saveWithNotifications(ctx, request, notifications...); err != nil {
+		return err
+	}
+
+	audit.Record(ctx, audit.RequestSent, audit.Actor{}, request.ID, request.Recipient.Email, nil)
+	svc.publishRequest(ctx, EventRequestSent, request)
+	return nil
+}
+
+func (svc *VerificationService) SendFailure(ctx context.Context, request models.VerifyRequest) (*models.VerifyRequest, error) {
+	request.Finish("FAILED", request.Error)
+	if err := svc.saveWithNotifications(ctx, &request, NotifySlackFailure, NotifyEmailFailure); err != nil {
+		return &request, err
+	}
+	audit.Record(ctx, audit.RequestFailed, audit.Actor{}, request.ID, request.Recipient.Email, map[string]string{"error": request.Error})
+	svc.publishRequest(ctx, EventRequestFailed, &request)
+	svc.refreshBatchOf(ctx, &request)
+	return &request, nil
+}
+
+func (svc *VerificationService) SendConfirmation(ctx context.Context, request models.VerifyRequest) (*models.VerifyRequest, error) {
+	request.Finish("COMPLETED", "")
+	if err := svc.saveWithNotifications(ctx, &request, NotifySlackCompletion, NotifyEmailCompletion); err != nil {
+		return &request, err
+	}
+	audit.Record(ctx, audit.RequestCompleted, audit.Actor{ID: request.Recipient.Email}, request.ID, request.Recipient.Email, nil)
+	svc.publishRequest(ctx, EventRequestCompleted, &request)
+	svc.refreshBatchOf(ctx, &request)
+	return &request, nil
+}
+
+// ReportIncident fails a reported request, forwards the incident to every
+// configured sink and runs the automated responses from the report config
+func (svc *VerificationService) ReportIncident(ctx context.Context, request models.VerifyRequest, inc *models.Incident) (*models.VerifyRequest, error) {
+	updated, err := svc.SendFailure(ctx, request)
+	inc.Reason = updated.Error
+	audit.Record(ctx, audit.RequestReported, audit.Actor{ID: inc.ReportedBy, IP: inc.IPs["reporter"], UserAgent: inc.UserAgents["reporter"]}, updated.ID, updated.Requestor.Email, map[string]string{"incident_id": inc.ID})
+	svc.publishRequest(ctx, EventRequestReported, updated)
+
+	for _, sink := range svc.IncidentSinks {
+		if sinkErr := sink.Report(ctx, inc); sinkErr != nil {
+			log.Printf("failed to report incident %s to %s: %v\n", inc.ID, sink.Name(), sinkErr)
+		}
+	}
+
+	actions := svc.Config.Report.Actions
+	if actions.SlackChannel != "" {
+		if alertErr := svc.Communicator.SendIncidentAlert(ctx, actions.SlackChannel, inc); alertErr != nil {
+			log.Printf("failed to alert security channel for incident %s: %v\n", inc.ID, alertErr)
+		}
+	}
+
+	if actions.MuteRequestor && inc.ReportedBy == updated.Recipient.Email {
+		recipient, _ := models.GetUser(ctx, updated.Recipient.ID)
+		if muteErr := svc.MuteRequestor(ctx, &recipient, updated.Requestor); muteErr != nil {
+			log.Printf("failed to mute requestor for incident %s: %v\n", inc.ID, muteErr)
+		}
+	}
+
+	return updated, err
 }
 
-func (svc *VerificationService) SendFailure(request models.VerifyRequest) (*models.VerifyRequest, error) {
-	request.DoneWithError(request.Error)
-	svc.Communicator.SendFailedVerificationMessage(&request)
-	go svc.EmailSvc.SendFailedVerificationMessage(&request)
+// Errors of CancelVerification and ResendVerification, the request is left as it was
+var (
+	ErrRequestClosed = errors.New("the request is closed")
+	ErrResendLimit   = errors.New("the request can't be resent again")
+	ErrResendTooSoon = errors.New("the request was resent moments ago")
+)
+
+// CancelVerification withdraws a pending request and cleans up the messages that were sent for it
+func (svc *VerificationService) CancelVerification(ctx context.Context, request models.VerifyRequest) (*models.VerifyRequest, error) {
+	if !request.IsPending() {
+		return &request, fmt.Errorf("%w, it is already %s", ErrRequestClosed, request.Status)
+	}
+
+	request.Finish("CANCELLED", "")
+	if err := svc.saveWithNotifications(ctx, &request, NotifySlackCancellation, NotifyEmailCancellation); err != nil {
+		return &request, err
+	}
+
+	audit.Record(ctx, audit.RequestCancelled, audit.Actor{ID: request.Requestor.Email}, request.ID, request.Recipient.Email, nil)
+
+	svc.refreshBatchOf(ctx, &request)
 	return &request, nil
 }
 
-func (svc *VerificationService) SendConfirmation(request models.VerifyRequest) (*models.VerifyRequest, error) {
-	request.Done()
-	svc.Communicator.SendCompletionMessage(&request)
-	go svc.EmailSvc.SendCompletionMessage(&request)
+// ResendVerification sends the verification message to the recipient again and
+// removes the previous one. Resends are limited in number and spaced by a cooldown.
+func (svc *VerificationService) ResendVerification(ctx context.Context, request models.VerifyRequest) (*models.VerifyRequest, error) {
+	if !request.IsOpen() {
+		return &request, fmt.Errorf("%w, it is %s", ErrRequestClosed, request.Status)
+	}
+
+	if request.ResendCount >= svc.Config.Verification.MaxResends {
+		return &request, fmt.Errorf("%w, it was already resent %d times", ErrResendLimit, request.ResendCount)
+	}
+
+	lastSent := request.LastSent
+	if lastSent.IsZero() {
+		lastSent = request.Start
+	}
+	cooldown := time.Duration(svc.Config.Verification.ResendCooldownSeconds) * time.Second
+	if wait := time.Until(lastSent.Add(cooldown)); wait > 0 {
+		return &request, fmt.Errorf("%w, please wait %d seconds before resending", ErrResendTooSoon, int(wait.Seconds())+1)
+	}
+
+	if err := svc.Communicator.DeleteVerificationMessage(ctx, &request); err != nil {
+		log.Printf("failed to delete verification message for %s: %v\n", request.ID, err)
+	}
+
+	request.ResendCount++
+	request.LastSent = time.Now()
+	if err := svc.saveWithNotifications(ctx, &request, NotifySlackVerification, NotifyEmailVerification); err != nil {
+		return &request, err
+	}
+
+	audit.Record(ctx, audit.RequestResent, audit.Actor{ID: request.Requestor.Email}, request.ID, request.Recipient.Email, map[string]string{"resend_count": strconv.Itoa(request.ResendCount)})
 	return &request, nil
 }
 
+func (svc *VerificationService) refreshBatchOf(ctx context.Context, request *models.VerifyRequest) {
+	if request.BatchID == "" {
+		return
+	}
+
+	if err := svc.RefreshBatch(ctx, request.BatchID); err != nil {
+		log.Printf("failed to refresh batch %s: %v\n", request.BatchID, err)
+	}
+}
+
 func (svc *VerificationService) VerifyOTP(secret, code string) bool {
 	return totp.Validate(code, secret)
 }
@@ -122,32 +317,47 @@ func (svc *VerificationService) GenerateQRCode(secret, issuer, accountName strin
 	return png, err
 }
 
-func (svc *VerificationService) EnableAuthenticator(user *models.User) error {
+func (svc *VerificationService) EnableAuthenticator(ctx context.Context, user *models.User) error {
 	key, err := totp.Generate(totp.GenerateOpts{Issuer: "Veriflow", AccountName: user.ID})
 	if err != nil {
 		log.Fatalf("Error generating TOTP key: %v", err)
 	}
 	user.Authenticator = models.Authenticator{Secret: key.Secret(), FilePath: "", Permalink: "", Validated: false}
-	return models.SaveUser(*user)
+	audit.Record(ctx, audit.UserEnrollmentStarted, audit.Actor{ID: user.Email}, "", user.ID, map[string]string{"factor": "authenticator"})
+	return models.SaveUser(ctx, *user)
 }
 
-func (svc *VerificationService) ConfigureUser(userID string) (string, error) {
-	existingUser, err := models.GetUser(userID)
+func (svc *VerificationService) ConfigureUser(ctx context.Context, userID string) (string, error) {
+	existingUser, err := models.GetUser(ctx, userID)
 	if err == nil {
 		// User exists
-		return svc.Auth.GenerateAuthLink("configure", existingUser.ID)
+		return svc.Auth.GenerateAuthLink(ctx, "configure", existingUser.ID)
 	}
 
-	user, err := svc.Communicator.GetUserInfo(userID)
+	user, err := svc.Communicator.GetUserInfo(ctx, userID)
 	if err != nil {
 		return "", err
 	}
 
-	err = models.SaveUser(user)
+	err = models.SaveUser(ctx, user)
 	if err != nil {
 		return "", err
 	}
 
-	return svc.Auth.GenerateAuthLink("configure", user.ID)
+	return svc.Auth.GenerateAuthLink(ctx, "configure", user.ID)
+
+}
+
+// ErrUnknownLanguage is returned for languages without configured messages
+var ErrUnknownLanguage = errors.New("no messages are configured for this language")
+
+// SetLanguage changes the language the user gets messages in, an empty
+// language goes back to the locale of their profile
+func (svc *VerificationService) SetLanguage(ctx context.Context, user *models.User, language string) error {
+	if language != "" && !svc.Config.Templates.HasLocale(language) {
+		return ErrUnknownLanguage
+	}
 
+	user.Language = language
+	return models.SaveUser(ctx, *user)
 }
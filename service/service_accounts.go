@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+var (
+	ErrInvalidAPIKey          = errors.New("invalid API key")
+	ErrServiceAccountDisabled = errors.New("the service account is disabled")
+	ErrUnknownAPIKey          = errors.New("the service account has no such API key")
+)
+
+// AuthenticateAPIKey returns the service account of an API key and counts the
+// call against the hourly limit of the key
+func (svc *VerificationService) AuthenticateAPIKey(ctx context.Context, token string) (models.ServiceAccount, models.APIKey, error) {
+	id, secret, ok := models.ParseAPIKey(token)
+	if !ok {
+		return models.ServiceAccount{}, models.APIKey{}, ErrInvalidAPIKey
+	}
+
+	key, _ := models.GetAPIKey(ctx, id)
+	if key.ID == "" || !key.Matches(secret) || !key.Active() {
+		return models.ServiceAccount{}, key, ErrInvalidAPIKey
+	}
+
+	account, err := models.GetServiceAccount(ctx, key.ServiceAccountID)
+	if err != nil {
+		return account, key, ErrInvalidAPIKey
+	}
+	if account.Disabled {
+		return account, key, ErrServiceAccountDisabled
+	}
+
+	limit := account.RateLimitPerHour
+	if limit == 0 {
+		limit = svc.Config.ServiceAccounts.RateLimitPerHour
+	}
+	if err := rateLimit(ctx, "apikey#"+key.ID, limit); err != nil {
+		return account, key, fmt.Errorf("%w with this API key, please try again later", err)
+	}
+
+	return account, key, nil
+}
+
+// RotateAPIKey creates a new key for the service account. The keys it had keep
+// working for grace so callers can switch over, a grace of 0 ends them now.
+func (svc *VerificationService) RotateAPIKey(ctx context.Context, account *models.ServiceAccount, createdBy string, grace time.Duration) (models.APIKey, string, error) {
+	key, secret, err := models.NewAPIKey(account.ID, createdBy)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	if err := key.Save(ctx); err != nil {
+		return *key, "", err
+	}
+
+	expiresAt := time.Now().Add(grace)
+	for i := range account.Keys {
+		previous := &account.Keys[i]
+		if !previous.Active() || !previous.ExpiresAt.IsZero() && previous.ExpiresAt.Before(expiresAt) {
+			continue
+		}
+		previous.ExpiresAt = expiresAt
+		if err := previous.Save(ctx); err != nil {
+			return *key, "", err
+		}
+	}
+
+	account.Keys = append(account.Keys, *key)
+	return *key, secret, nil
+}
+
+// RevokeAPIKey stops a key from working right away
+func (svc *VerificationService) RevokeAPIKey(ctx context.Context, account *models.ServiceAccount, keyID string) error {
+	for i := range account.Keys {
+		if key := &account.Keys[i]; key.ID == keyID {
+			if key.RevokedAt.IsZero() {
+				key.RevokedAt = time.Now()
+			}
+			return key.Save(ctx)
+		}
+	}
+	return ErrUnknownAPIKey
+}
@@ -0,0 +1,177 @@
+package siem
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+const (
+	vendor  = "Veriflow"
+	product = "Veriflow"
+	version = "1.0"
+
+	// authpriv, the facility for security and authorization messages
+	facility = 10
+
+	severityWarning = 4
+	severityInfo    = 6
+)
+
+type Formatter func(entry models.AuditEntry) string
+
+func formatterFor(format string) (Formatter, error) {
+	switch format {
+	case "cef":
+		return FormatCEF, nil
+	case "leef":
+		return FormatLEEF, nil
+	default:
+		return nil, fmt.Errorf("unsupported siem format %q", format)
+	}
+}
+
+// isAlert is true for the actions a SOC would want to look at
+func isAlert(action string) bool {
+	return action == "request.failed" || action == "request.reported" || action == "factor.failed"
+}
+
+// FormatCEF formats the entry as an ArcSight Common Event Format message
+func FormatCEF(entry models.AuditEntry) string {
+	severity := 3
+	if isAlert(entry.Action) {
+		severity = 7
+	}
+
+	ext := []string{
+		"rt=" + strconv.FormatInt(entry.Time.UnixMilli(), 10),
+		"suser=" + cefValue(entry.Actor),
+	}
+	if entry.ActorIP != "" {
+		ext = append(ext, "src="+cefValue(entry.ActorIP))
+	}
+	if entry.UserAgent != "" {
+		ext = append(ext, "requestClientApplication="+cefValue(entry.UserAgent))
+	}
+	if entry.Subject != "" {
+		ext = append(ext, "duser="+cefValue(entry.Subject))
+	}
+	if entry.RequestID != "" {
+		ext = append(ext, "cs1Label=requestId", "cs1="+cefValue(entry.RequestID))
+	}
+	ext = append(ext,
+		"cs2Label=auditHash", "cs2="+cefValue(entry.Hash),
+		"cn1Label=auditSequence", "cn1="+strconv.FormatInt(entry.Sequence, 10),
+	)
+	if len(entry.Details) > 0 {
+		ext = append(ext, "msg="+cefValue(detailString(entry.Details)))
+	}
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		cefHeader(vendor), cefHeader(product), cefHeader(version),
+		cefHeader(entry.Action), cefHeader(entry.Action), severity, strings.Join(ext, " "))
+}
+
+// FormatLEEF formats the entry as an IBM QRadar LEEF 1.0 message with tab separated attributes
+func FormatLEEF(entry models.AuditEntry) string {
+	attrs := []string{
+		"devTime=" + entry.Time.UTC().Format("Jan 02 2006 15:04:05"),
+		"devTimeFormat=MMM dd yyyy HH:mm:ss",
+		"usrName=" + leefValue(entry.Actor),
+	}
+	if entry.ActorIP != "" {
+		attrs = append(attrs, "src="+leefValue(entry.ActorIP))
+	}
+	if entry.UserAgent != "" {
+		attrs = append(attrs, "userAgent="+leefValue(entry.UserAgent))
+	}
+	if entry.Subject != "" {
+		attrs = append(attrs, "dstUsrName="+leefValue(entry.Subject))
+	}
+	if entry.RequestID != "" {
+		attrs = append(attrs, "requestId="+leefValue(entry.RequestID))
+	}
+	sev := "3"
+	if isAlert(entry.Action) {
+		sev = "7"
+	}
+	attrs = append(attrs,
+		"sev="+sev,
+		"auditSequence="+strconv.FormatInt(entry.Sequence, 10),
+		"auditHash="+leefValue(entry.Hash),
+	)
+	for _, key := range sortedKeys(entry.Details) {
+		attrs = append(attrs, leefValue(key)+"="+leefValue(entry.Details[key]))
+	}
+
+	return fmt.Sprintf("LEEF:1.0|%s|%s|%s|%s|%s", leefHeader(vendor), leefHeader(product), leefHeader(version), leefHeader(entry.Action), strings.Join(attrs, "\t"))
+}
+
+// syslogMessage wraps the message in an RFC 5424 header
+func syslogMessage(entry models.AuditEntry, hostname, message string) string {
+	severity := severityInfo
+	if isAlert(entry.Action) {
+		severity = severityWarning
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s veriflow - %s - %s",
+		facility*8+severity,
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		syslogField(hostname),
+		syslogField(entry.Action),
+		message)
+}
+
+// syslogFrame uses octet counting (RFC 6587) so messages may contain newlines
+func syslogFrame(message string) []byte {
+	return []byte(strconv.Itoa(len(message)) + " " + message)
+}
+
+func syslogField(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.Map(func(r rune) rune {
+		if r <= 32 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+func cefHeader(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(value)
+}
+
+func cefValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(value)
+}
+
+func leefHeader(value string) string {
+	return strings.NewReplacer(`|`, `_`, "\t", " ", "\n", " ", "\r", " ").Replace(value)
+}
+
+func leefValue(value string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(value)
+}
+
+func detailString(details map[string]string) string {
+	parts := make([]string, 0, len(details))
+	for _, key := range sortedKeys(details) {
+		parts = append(parts, key+"="+details[key])
+	}
+	return strings.Join(parts, " ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
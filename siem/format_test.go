@@ -0,0 +1,113 @@
+package siem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+var testEntry = models.AuditEntry{
+	Sequence:  7,
+	Time:      time.Date(2026, 10, 19, 8, 0, 0, 500000000, time.UTC),
+	Action:    "request.reported",
+	Actor:     "alice@example.com",
+	ActorIP:   "10.0.0.1",
+	RequestID: "r1",
+	Details:   map[string]string{"reason": "a=b"},
+	Hash:      "abc",
+}
+
+func TestSyslogMessage(t *testing.T) {
+	info := testEntry
+	info.Action = "request.created"
+
+	tests := []struct {
+		name     string
+		entry    models.AuditEntry
+		hostname string
+		want     string
+	}{
+		{"alert", testEntry, "siem-host", "<84>1 2026-10-19T08:00:00.5Z siem-host veriflow - request.reported - message"},
+		{"info", info, "siem-host", "<86>1 2026-10-19T08:00:00.5Z siem-host veriflow - request.created - message"},
+		{"no hostname", info, "", "<86>1 2026-10-19T08:00:00.5Z - veriflow - request.created - message"},
+		{"hostname with spaces", info, "my hôst", "<86>1 2026-10-19T08:00:00.5Z my_h_st veriflow - request.created - message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := syslogMessage(tt.entry, tt.hostname, "message"); got != tt.want {
+				t.Errorf("syslogMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSyslogFrame(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+	}{
+		{"abc", "3 abc"},
+		{"line\nbreak", "10 line\nbreak"},
+		{"é", "2 é"},
+	}
+
+	for _, tt := range tests {
+		if got := string(syslogFrame(tt.message)); got != tt.want {
+			t.Errorf("syslogFrame(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	tests := []struct {
+		name   string
+		escape func(string) string
+		value  string
+		want   string
+	}{
+		{"cef header", cefHeader, "a|b\\c\r\nd", `a\|b\\c  d`},
+		{"cef header keeps =", cefHeader, "a=b", "a=b"},
+		{"cef value", cefValue, "k=v\\x\r\ny", `k\=v\\x\r\ny`},
+		{"cef value keeps |", cefValue, "a|b", "a|b"},
+		{"leef header", leefHeader, "a|b\tc\r\nd", "a_b c  d"},
+		{"leef value", leefValue, "a\tb\r\nc|d", "a b  c|d"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.escape(tt.value); got != tt.want {
+				t.Errorf("escape(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormats(t *testing.T) {
+	injected := testEntry
+	injected.Action = "request.created"
+	injected.Actor = "mallory cs1=forged\nCEF:0|fake"
+	injected.RequestID = ""
+	injected.Details = nil
+
+	tests := []struct {
+		name   string
+		format Formatter
+		entry  models.AuditEntry
+		want   string
+	}{
+		{"cef", FormatCEF, testEntry, `CEF:0|Veriflow|Veriflow|1.0|request.reported|request.reported|7|rt=1792396800500 suser=alice@example.com src=10.0.0.1 cs1Label=requestId cs1=r1 cs2Label=auditHash cs2=abc cn1Label=auditSequence cn1=7 msg=reason\=a\=b`},
+		{"cef injection", FormatCEF, injected, `CEF:0|Veriflow|Veriflow|1.0|request.created|request.created|3|rt=1792396800500 suser=mallory cs1\=forged\nCEF:0|fake src=10.0.0.1 cs2Label=auditHash cs2=abc cn1Label=auditSequence cn1=7`},
+		{"leef", FormatLEEF, testEntry, "LEEF:1.0|Veriflow|Veriflow|1.0|request.reported|devTime=Oct 19 2026 08:00:00\tdevTimeFormat=MMM dd yyyy HH:mm:ss\tusrName=alice@example.com\tsrc=10.0.0.1\trequestId=r1\tsev=7\tauditSequence=7\tauditHash=abc\treason=a=b"},
+		{"leef injection", FormatLEEF, injected, "LEEF:1.0|Veriflow|Veriflow|1.0|request.created|devTime=Oct 19 2026 08:00:00\tdevTimeFormat=MMM dd yyyy HH:mm:ss\tusrName=mallory cs1=forged CEF:0|fake\tsrc=10.0.0.1\tsev=3\tauditSequence=7\tauditHash=abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.format(tt.entry); got != tt.want {
+				t.Errorf("format() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
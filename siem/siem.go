@@ -0,0 +1,320 @@
+package siem
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/models"
+)
+
+// Retries back off up to this delay while the SIEM is unreachable
+const maxRetryDelay = 5 * time.Minute
+
+// markTimeout bounds recording an entry that may not have been exported
+const markTimeout = 5 * time.Second
+
+// SyslogExporter streams audit entries to a SIEM as RFC 5424 syslog messages
+// over TCP or TLS. Entries are buffered in memory and sent by a single
+// goroutine, so an unreachable SIEM never blocks the verification flow. While
+// the SIEM is down the current entry is retried with backoff and new entries
+// queue up in the buffer. When the buffer is full new entries are dropped, the
+// first dropped entry is marked in the audit trail and CatchUp exports the
+// entries from there on again.
+type SyslogExporter struct {
+	Address      string
+	Transport    string
+	Hostname     string
+	TLSConfig    *tls.Config
+	Format       Formatter
+	RetryDelay   time.Duration
+	BufferSize   int
+	FlushTimeout time.Duration
+
+	mu    sync.Mutex
+	queue []models.AuditEntry // the first entry is the one being sent
+	idle  chan struct{}       // closed once the queue is empty
+	wake  chan struct{}
+	conn  net.Conn
+}
+
+// NewExporter returns nil when the SIEM export is disabled
+func NewExporter(cfg *config.Config) (*SyslogExporter, error) {
+	siemCfg := cfg.SIEM
+	if !siemCfg.Enabled {
+		return nil, nil
+	}
+
+	if siemCfg.Address == "" {
+		return nil, errors.New("siem address is required")
+	}
+
+	format, err := formatterFor(siemCfg.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter := &SyslogExporter{
+		Address:      siemCfg.Address,
+		Transport:    siemCfg.Transport,
+		Hostname:     siemCfg.Hostname,
+		Format:       format,
+		RetryDelay:   time.Duration(siemCfg.RetrySeconds) * time.Second,
+		BufferSize:   siemCfg.BufferSize,
+		FlushTimeout: time.Duration(siemCfg.FlushSeconds) * time.Second,
+	}
+
+	if exporter.Hostname == "" {
+		exporter.Hostname, _ = os.Hostname()
+	}
+
+	switch siemCfg.Transport {
+	case "tcp":
+	case "tls":
+		exporter.TLSConfig, err = tlsConfig(siemCfg.CAFile, siemCfg.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported siem transport %q", siemCfg.Transport)
+	}
+
+	exporter.start()
+	return exporter, nil
+}
+
+func (e *SyslogExporter) start() {
+	e.wake = make(chan struct{}, 1)
+	go e.run()
+}
+
+func tlsConfig(caFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	tlsCfg := &tls.Config{InsecureSkipVerify: insecureSkipVerify, MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return tlsCfg, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read siem ca file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.New("no certificates found in siem ca file")
+	}
+	tlsCfg.RootCAs = pool
+	return tlsCfg, nil
+}
+
+func (e *SyslogExporter) Export(entry models.AuditEntry) {
+	if e.enqueue(entry) {
+		return
+	}
+
+	log.Printf("siem buffer is full, dropping audit entry %d (%s)\n", entry.Sequence, entry.Action)
+	ctx, cancel := context.WithTimeout(context.Background(), markTimeout)
+	defer cancel()
+	e.markGap(ctx, entry.Sequence)
+}
+
+// enqueue is false when the buffer is full
+func (e *SyslogExporter) enqueue(entry models.AuditEntry) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.queue) >= e.BufferSize {
+		return false
+	}
+	if len(e.queue) == 0 {
+		e.idle = make(chan struct{})
+	}
+	e.queue = append(e.queue, entry)
+
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// markGap records the entry so CatchUp exports it again. Entries that aren't
+// part of the trail because the table was unavailable can't be exported again.
+func (e *SyslogExporter) markGap(ctx context.Context, sequence int64) {
+	if sequence == 0 {
+		return
+	}
+	if err := models.MarkAuditExportGap(ctx, sequence); err != nil {
+		log.Printf("failed to mark audit entry %d as not exported: %v\n", sequence, err)
+	}
+}
+
+// Flush waits up to FlushTimeout for the queued entries to be sent. Lambda
+// freezes the process between invocations, the entries still queued then are
+// marked so CatchUp exports them again if the process doesn't come back.
+func (e *SyslogExporter) Flush(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.Lock()
+	idle := e.idle
+	queued := len(e.queue)
+	e.mu.Unlock()
+	if queued == 0 {
+		return nil
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, e.FlushTimeout)
+	defer cancel()
+	select {
+	case <-idle:
+		return nil
+	case <-timeout.Done():
+	}
+
+	e.mu.Lock()
+	var first int64
+	for _, entry := range e.queue {
+		if entry.Sequence > 0 && (first == 0 || entry.Sequence < first) {
+			first = entry.Sequence
+		}
+	}
+	queued = len(e.queue)
+	e.mu.Unlock()
+
+	mark, cancel := context.WithTimeout(context.WithoutCancel(ctx), markTimeout)
+	defer cancel()
+	e.markGap(mark, first)
+	return fmt.Errorf("%d audit entries were not sent to the siem in %s", queued, e.FlushTimeout)
+}
+
+// CatchUp queues the entries from the first one that may not have reached the
+// SIEM again, entries are exported at least once. The ones that don't fit in
+// the buffer are queued by the next call.
+func (e *SyslogExporter) CatchUp(ctx context.Context) error {
+	if e == nil {
+		return nil
+	}
+
+	from, err := models.GetAuditExportGap(ctx)
+	if err != nil || from == 0 {
+		return err
+	}
+
+	next := from
+	for {
+		entry, err := models.GetAuditEntry(ctx, next)
+		if err != nil {
+			return err
+		}
+		if entry.ID == "" {
+			// Every entry up to the end of the trail is queued
+			next = 0
+			break
+		}
+		if !e.enqueue(entry) {
+			break
+		}
+		next++
+	}
+
+	return models.MoveAuditExportGap(ctx, from, next)
+}
+
+// StartCatchUp runs CatchUp every interval until the context is done
+func (e *SyslogExporter) StartCatchUp(ctx context.Context, interval time.Duration) {
+	if e == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.CatchUp(ctx); err != nil {
+				log.Printf("failed to export the missed audit entries: %v\n", err)
+			}
+		}
+	}
+}
+
+func (e *SyslogExporter) run() {
+	for range e.wake {
+		for {
+			e.mu.Lock()
+			if len(e.queue) == 0 {
+				e.mu.Unlock()
+				break
+			}
+			entry := e.queue[0]
+			e.mu.Unlock()
+
+			e.send(entry)
+
+			e.mu.Lock()
+			e.queue = e.queue[1:]
+			if len(e.queue) == 0 {
+				close(e.idle)
+			}
+			e.mu.Unlock()
+		}
+	}
+}
+
+// send retries until the entry is sent
+func (e *SyslogExporter) send(entry models.AuditEntry) {
+	frame := syslogFrame(syslogMessage(entry, e.Hostname, e.Format(entry)))
+
+	delay := e.RetryDelay
+	for {
+		err := e.write(frame)
+		if err == nil {
+			return
+		}
+
+		log.Printf("failed to send audit entry %d to siem, retrying in %s: %v\n", entry.Sequence, delay, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+func (e *SyslogExporter) write(frame []byte) error {
+	if e.conn == nil {
+		conn, err := e.dial()
+		if err != nil {
+			return err
+		}
+		e.conn = conn
+	}
+
+	e.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := e.conn.Write(frame); err != nil {
+		e.conn.Close()
+		e.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (e *SyslogExporter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if e.TLSConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", e.Address, e.TLSConfig)
+	}
+	return dialer.Dial("tcp", e.Address)
+}
@@ -0,0 +1,205 @@
+package siem
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+)
+
+// newSIEMServer returns the address of a syslog receiver and a function
+// waiting for the next n messages it got
+func newSIEMServer(t *testing.T) (string, func(n int) []string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	messages := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					length, err := r.ReadString(' ')
+					if err != nil {
+						return
+					}
+					n, err := strconv.Atoi(strings.TrimSpace(length))
+					if err != nil {
+						return
+					}
+					message := make([]byte, n)
+					if _, err := io.ReadFull(r, message); err != nil {
+						return
+					}
+					messages <- string(message)
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String(), func(n int) []string {
+		t.Helper()
+		var got []string
+		for len(got) < n {
+			select {
+			case message := <-messages:
+				got = append(got, message)
+			case <-time.After(2 * time.Second):
+				t.Fatalf("got %d messages, want %d", len(got), n)
+			}
+		}
+		return got
+	}
+}
+
+// unreachableAddress is an address nothing listens on
+func unreachableAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func newTestExporter(address string, bufferSize int) *SyslogExporter {
+	exporter := &SyslogExporter{
+		Address:      address,
+		Transport:    "tcp",
+		Hostname:     "veriflow-test",
+		Format:       FormatCEF,
+		RetryDelay:   10 * time.Millisecond,
+		BufferSize:   bufferSize,
+		FlushTimeout: 200 * time.Millisecond,
+	}
+	exporter.start()
+	return exporter
+}
+
+// appendEntries records n entries in a new audit trail
+func appendEntries(t *testing.T, n int) []models.AuditEntry {
+	t.Helper()
+	memory := db.NewMemoryDB()
+	memory.RangeKeys[models.AuditDayIndex] = "sequence"
+	models.UseDB(memory)
+
+	var entries []models.AuditEntry
+	for i := 0; i < n; i++ {
+		entry := models.AuditEntry{Action: "request.created", Actor: "alice@example.com"}
+		if err := models.AppendAuditEntry(context.Background(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestExporterFlush(t *testing.T) {
+	address, receive := newSIEMServer(t)
+	exporter := newTestExporter(address, 10)
+
+	for _, entry := range appendEntries(t, 3) {
+		exporter.Export(entry)
+	}
+	if err := exporter.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+
+	for i, message := range receive(3) {
+		if !strings.HasPrefix(message, "<86>1 ") || !strings.HasSuffix(message, " cn1="+strconv.Itoa(i+1)) {
+			t.Errorf("message %d = %q", i, message)
+		}
+	}
+}
+
+func TestExporterMarksWhatWasNotSent(t *testing.T) {
+	exporter := newTestExporter(unreachableAddress(t), 2)
+	ctx := context.Background()
+
+	entries := appendEntries(t, 3)
+	for _, entry := range entries {
+		exporter.Export(entry)
+	}
+	// The third entry didn't fit in the buffer
+	if gap, err := models.GetAuditExportGap(ctx); err != nil || gap != 3 {
+		t.Fatalf("gap after the drop = %d, %v, want 3", gap, err)
+	}
+
+	if err := exporter.Flush(ctx); err == nil {
+		t.Fatal("Flush() to an unreachable SIEM succeeded")
+	}
+	if gap, err := models.GetAuditExportGap(ctx); err != nil || gap != 1 {
+		t.Fatalf("gap after the flush = %d, %v, want 1", gap, err)
+	}
+}
+
+func TestExporterCatchUp(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("sends the missed entries again", func(t *testing.T) {
+		address, receive := newSIEMServer(t)
+		exporter := newTestExporter(address, 10)
+		appendEntries(t, 3)
+		if err := models.MarkAuditExportGap(ctx, 2); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := exporter.CatchUp(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := exporter.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		messages := receive(2)
+		if !strings.HasSuffix(messages[0], " cn1=2") || !strings.HasSuffix(messages[1], " cn1=3") {
+			t.Errorf("messages = %q, want entries 2 and 3", messages)
+		}
+		if gap, err := models.GetAuditExportGap(ctx); err != nil || gap != 0 {
+			t.Errorf("gap = %d, %v, want none", gap, err)
+		}
+	})
+
+	t.Run("continues where the buffer was full", func(t *testing.T) {
+		exporter := newTestExporter(unreachableAddress(t), 1)
+		appendEntries(t, 3)
+		if err := models.MarkAuditExportGap(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := exporter.CatchUp(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if gap, err := models.GetAuditExportGap(ctx); err != nil || gap != 2 {
+			t.Errorf("gap = %d, %v, want 2", gap, err)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		var exporter *SyslogExporter
+		if err := exporter.CatchUp(ctx); err != nil {
+			t.Error(err)
+		}
+		if err := exporter.Flush(ctx); err != nil {
+			t.Error(err)
+		}
+	})
+}
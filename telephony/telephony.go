@@ -0,0 +1,78 @@
+package telephony
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/tracing"
+)
+
+// Provider sends text messages and places calls reading out a message
+type Provider interface {
+	SendSMS(ctx context.Context, to, body string) error
+	Call(ctx context.Context, to, message string) error
+}
+
+var ErrInvalidNumber = errors.New("phone numbers must be in international format, e.g. +14155550100")
+
+// NewProvider returns nil when no provider is configured
+func NewProvider(cfg *config.Config) (Provider, error) {
+	telephonyCfg := cfg.Telephony
+	switch telephonyCfg.Provider {
+	case "":
+		return nil, nil
+	case "twilio":
+		if telephonyCfg.AccountSID == "" || telephonyCfg.AuthToken == "" || telephonyCfg.From == "" {
+			return nil, errors.New("twilio needs an account_sid, auth_token and from number")
+		}
+		return &TwilioClient{
+			BaseURL:    telephonyCfg.BaseURL,
+			AccountSID: telephonyCfg.AccountSID,
+			AuthToken:  telephonyCfg.AuthToken,
+			From:       telephonyCfg.From,
+			HTTPClient: &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(http.DefaultTransport, "twilio")},
+		}, nil
+	case "log":
+		return &LogProvider{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported telephony provider %q", telephonyCfg.Provider)
+	}
+}
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// NormalizeNumber returns the E.164 form of a number typed with spaces, dashes or parentheses
+func NormalizeNumber(number string) (string, error) {
+	normalized := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '(', ')', '.':
+			return -1
+		}
+		return r
+	}, number)
+
+	if !e164.MatchString(normalized) {
+		return "", ErrInvalidNumber
+	}
+	return normalized, nil
+}
+
+// LogProvider writes messages to the log instead of sending them, for local mode
+type LogProvider struct{}
+
+func (p *LogProvider) SendSMS(ctx context.Context, to, body string) error {
+	log.Printf("sms to %s: %s\n", to, body)
+	return nil
+}
+
+func (p *LogProvider) Call(ctx context.Context, to, message string) error {
+	log.Printf("call to %s: %s\n", to, message)
+	return nil
+}
@@ -0,0 +1,87 @@
+package telephony
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const twilioAPIURL = "https://api.twilio.com"
+
+// TwilioClient sends messages and places calls through the Twilio REST API.
+// BaseURL can point at any service implementing the same API.
+type TwilioClient struct {
+	BaseURL    string
+	AccountSID string
+	AuthToken  string
+	From       string
+	HTTPClient *http.Client
+}
+
+// twilioError is the body of failed Twilio API calls
+type twilioError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (t *TwilioClient) SendSMS(ctx context.Context, to, body string) error {
+	return t.post(ctx, "Messages.json", url.Values{
+		"To":   {to},
+		"From": {t.From},
+		"Body": {body},
+	})
+}
+
+// Call reads the message out twice, callers often miss the start of it
+func (t *TwilioClient) Call(ctx context.Context, to, message string) error {
+	var say strings.Builder
+	xml.EscapeText(&say, []byte(message))
+	twiml := fmt.Sprintf(`<Response><Say>%s</Say><Pause length="1"/><Say>%s</Say></Response>`, say.String(), say.String())
+
+	return t.post(ctx, "Calls.json", url.Values{
+		"To":    {to},
+		"From":  {t.From},
+		"Twiml": {twiml},
+	})
+}
+
+func (t *TwilioClient) post(ctx context.Context, resource string, form url.Values) error {
+	baseURL := t.BaseURL
+	if baseURL == "" {
+		baseURL = twilioAPIURL
+	}
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/%s", strings.TrimSuffix(baseURL, "/"), url.PathEscape(t.AccountSID), resource)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	client := t.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var apiErr twilioError
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("twilio error %d: %s", apiErr.Code, apiErr.Message)
+		}
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package telephony_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vdparikh/veriflow/telephony/twiliotest"
+)
+
+func TestTwilioSendSMS(t *testing.T) {
+	server := twiliotest.NewServer()
+	defer server.Close()
+
+	if err := server.Client().SendSMS(context.Background(), "+14155550100", "Your Veriflow code is 123456."); err != nil {
+		t.Fatalf("SendSMS() error = %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("received %d messages, want 1", len(messages))
+	}
+	want := twiliotest.Message{Kind: "Messages", To: "+14155550100", From: twiliotest.From, Body: "Your Veriflow code is 123456."}
+	if messages[0] != want {
+		t.Errorf("received %+v, want %+v", messages[0], want)
+	}
+}
+
+func TestTwilioCall(t *testing.T) {
+	server := twiliotest.NewServer()
+	defer server.Close()
+
+	if err := server.Client().Call(context.Background(), "+14155550100", "Your code is 1, 2, 3 & <more>"); err != nil {
+		t.Fatalf("Call() error = %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 || messages[0].Kind != "Calls" {
+		t.Fatalf("received %+v, want a call", messages)
+	}
+	twiml := messages[0].Body
+	say := "<Say>Your code is 1, 2, 3 &amp; &lt;more&gt;</Say>"
+	if !strings.HasPrefix(twiml, "<Response>") || strings.Count(twiml, say) != 2 {
+		t.Errorf("Twiml = %s, want the escaped message said twice", twiml)
+	}
+}
+
+func TestTwilioErrors(t *testing.T) {
+	server := twiliotest.NewServer()
+	defer server.Close()
+
+	client := server.Client()
+	client.AuthToken = "wrong"
+	err := client.SendSMS(context.Background(), "+14155550100", "hello")
+	if err == nil || err.Error() != "twilio error 20003: Authenticate" {
+		t.Errorf("SendSMS() with a wrong token error = %v", err)
+	}
+
+	server.Fail(http.StatusBadRequest, 21211, "The 'To' number is not a valid phone number.")
+	err = server.Client().Call(context.Background(), "+14155550100", "hello")
+	if err == nil || !strings.Contains(err.Error(), "21211") {
+		t.Errorf("Call() error = %v, want the Twilio error", err)
+	}
+	if len(server.Messages()) != 0 {
+		t.Error("failed requests were recorded")
+	}
+}
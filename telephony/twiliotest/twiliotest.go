@@ -0,0 +1,123 @@
+// Package twiliotest is a fake of the Twilio Messages and Calls API for the
+// tests of code sending texts and placing calls
+package twiliotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/vdparikh/veriflow/telephony"
+)
+
+const (
+	AccountSID = "AC00000000000000000000000000000000"
+	AuthToken  = "test-token"
+	From       = "+15005550006"
+)
+
+// Message is a text or a call received by the server, Body is the Twiml of calls
+type Message struct {
+	Kind string // Messages or Calls
+	To   string
+	From string
+	Body string
+}
+
+// Server accepts the requests of a TwilioClient built with Client
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	messages []Message
+	failure  *failure
+}
+
+type failure struct {
+	status  int
+	code    int
+	message string
+}
+
+func NewServer() *Server {
+	s := &Server{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client sends to the server with its credentials
+func (s *Server) Client() *telephony.TwilioClient {
+	return &telephony.TwilioClient{
+		BaseURL:    s.URL,
+		AccountSID: AccountSID,
+		AuthToken:  AuthToken,
+		From:       From,
+		HTTPClient: s.Server.Client(),
+	}
+}
+
+// Fail makes the next requests fail with the Twilio error
+func (s *Server) Fail(status, code int, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failure = &failure{status: status, code: code, message: message}
+}
+
+// Messages returns what was received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	prefix := "/2010-04-01/Accounts/" + AccountSID + "/"
+	kind := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, prefix), ".json")
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.URL.Path, prefix) || (kind != "Messages" && kind != "Calls") {
+		writeError(w, http.StatusNotFound, 20404, "The requested resource was not found")
+		return
+	}
+
+	if sid, token, ok := r.BasicAuth(); !ok || sid != AccountSID || token != AuthToken {
+		writeError(w, http.StatusUnauthorized, 20003, "Authenticate")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, 21100, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failure != nil {
+		writeError(w, s.failure.status, s.failure.code, s.failure.message)
+		return
+	}
+
+	message := Message{Kind: kind, To: r.PostForm.Get("To"), From: r.PostForm.Get("From"), Body: r.PostForm.Get("Body")}
+	if kind == "Calls" {
+		message.Body = r.PostForm.Get("Twiml")
+	}
+	if message.To == "" || message.From == "" || message.Body == "" {
+		writeError(w, http.StatusBadRequest, 21604, "A 'To', 'From' and 'Body' or 'Twiml' are required")
+		return
+	}
+	s.messages = append(s.messages, message)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"sid":    fmt.Sprintf("SM%032d", len(s.messages)),
+		"status": "queued",
+		"to":     message.To,
+	})
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "message": message, "status": status})
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/vdparikh/veriflow/config"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/vdparikh/veriflow"
+
+// Init installs the global tracer provider. Without tracing enabled the
+// OpenTelemetry no-op provider stays in place and spans cost next to nothing.
+// The returned function exports the spans that are still buffered, Lambda
+// freezes the process between invocations so it has to run after every one.
+func Init(cfg *config.Config) (func(context.Context) error, error) {
+	tracingCfg := cfg.Tracing
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	if !tracingCfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{}
+	if tracingCfg.Endpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(tracingCfg.Endpoint))
+	}
+	if tracingCfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if len(tracingCfg.Headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(tracingCfg.Headers))
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(tracingCfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(tracingCfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.ForceFlush, nil
+}
+
+// Start starts a span named after the operation
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if any, and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Transport wraps an HTTP transport so outgoing calls get a client span,
+// named after the service and the path of the call (e.g. "slack chat.postMessage")
+func Transport(base http.RoundTripper, service string) http.RoundTripper {
+	return otelhttp.NewTransport(base, otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+		return service + " " + strings.TrimPrefix(r.URL.Path, "/api/")
+	}))
+}
@@ -3,8 +3,11 @@ package utils
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"io"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -43,3 +46,13 @@ func RandString(nByte int) (string, error) {
 	}
 	return base64.RawURLEncoding.EncodeToString(b), nil
 }
+
+// SignPayload returns the X-Veriflow-Signature header value for an outgoing
+// webhook: HMAC-SHA256 over "<timestamp>.<body>"
+func SignPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
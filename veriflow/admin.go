@@ -0,0 +1,120 @@
+package veriflow
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vdparikh/veriflow/audit"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/service"
+)
+
+func (veriflow *Veriflow) ListWebhooks(c *gin.Context) {
+	subscriptions, err := veriflow.Webhooks.AllSubscriptions(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"subscriptions": subscriptions, "event_types": service.EventTypes})
+}
+
+func (veriflow *Veriflow) CreateWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	var requestPayload struct {
+		URL    string   `json:"url"`
+		Secret string   `json:"secret"`
+		Events []string `json:"events"`
+	}
+
+	if err := c.ShouldBindJSON(&requestPayload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	parsedURL, err := url.Parse(requestPayload.URL)
+	if err != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "http") || parsedURL.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid url"})
+		return
+	}
+
+	for _, event := range requestPayload.Events {
+		if !isEventType(event) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown event type " + event})
+			return
+		}
+	}
+
+	// Every delivery is signed, Veriflow picks a secret when none is given
+	secret := requestPayload.Secret
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		secret = "whsec_" + hex.EncodeToString(b)
+	}
+
+	subscription := models.WebhookSubscription{
+		ID:        uuid.New().String(),
+		URL:       requestPayload.URL,
+		Secret:    secret,
+		Events:    requestPayload.Events,
+		CreatedBy: c.GetString("userEmail"),
+		CreatedAt: time.Now(),
+	}
+
+	if err := subscription.Save(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(ctx, audit.AdminWebhookCreated, actorOf(c, subscription.CreatedBy), "", subscription.ID, map[string]string{"url": subscription.URL})
+
+	// The secret is only shown here, like the API keys of service accounts
+	c.JSON(http.StatusCreated, gin.H{"subscription": subscription, "secret": secret})
+}
+
+func (veriflow *Veriflow) DeleteWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	if _, err := models.GetWebhookSubscription(ctx, id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := models.DeleteWebhookSubscription(ctx, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(ctx, audit.AdminWebhookDeleted, actorOf(c, c.GetString("userEmail")), "", id, nil)
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (veriflow *Veriflow) ListWebhookDeliveries(c *gin.Context) {
+	deliveries, err := models.GetWebhookDeliveries(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deliveries": deliveries})
+}
+
+func isEventType(event string) bool {
+	if event == "*" {
+		return true
+	}
+	for _, eventType := range service.EventTypes {
+		if eventType == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package veriflow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+func TestCreateWebhookSecret(t *testing.T) {
+	router := newSessionRouter(t)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"given", `{"url": "https://helpdesk.example/hook", "secret": "whsec_given"}`, "whsec_given"},
+		{"generated", `{"url": "https://helpdesk.example/hook"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/admin/webhooks", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			r.Header.Set("X-CSRF-Token", "secret")
+			r.AddCookie(&http.Cookie{Name: "auth_token", Value: "session"})
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "secret"})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != http.StatusCreated {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+			}
+
+			var response struct {
+				Subscription models.WebhookSubscription `json:"subscription"`
+				Secret       string                     `json:"secret"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			switch {
+			case tt.want != "" && response.Secret != tt.want:
+				t.Fatalf("secret = %q, want %q", response.Secret, tt.want)
+			case tt.want == "" && (!strings.HasPrefix(response.Secret, "whsec_") || len(response.Secret) != 70):
+				t.Fatalf("secret = %q", response.Secret)
+			}
+
+			stored, err := models.GetWebhookSubscription(context.Background(), response.Subscription.ID)
+			if err != nil || stored.Secret != response.Secret {
+				t.Fatalf("stored secret = %q, err %v, want %q", stored.Secret, err, response.Secret)
+			}
+		})
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"net/mail"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
+	"github.com/vdparikh/veriflow/audit"
+	"github.com/vdparikh/veriflow/metrics"
 	"github.com/vdparikh/veriflow/models"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // LogrusLogger is the logging middleware using Logrus
@@ -48,7 +52,9 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	router.Use(otelgin.Middleware(veriflow.Cfg.Tracing.ServiceName))
 	router.Use(LogrusLogger())
+	router.Use(metrics.Middleware())
 
 	router.LoadHTMLGlob("templates/*")
 
@@ -56,6 +62,8 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	router.GET("/metrics", veriflow.MetricsAuthMiddleware(), metrics.Handler())
+
 	// Dummy endpoint for Slack interactivity.
 	// If removed it throws 404 when users clicks on any button
 	router.POST("/veriflow", func(c *gin.Context) {
@@ -63,14 +71,14 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 	})
 
 	router.GET("/login", func(c *gin.Context) {
-		authLink, _ := veriflow.Svc.Auth.GenerateAuthLink("login", "")
+		authLink, _ := veriflow.Svc.Auth.GenerateAuthLink(c.Request.Context(), "login", "")
 		c.Redirect(302, authLink)
 		// c.JSON(http.StatusOK, gin.H{})
 	})
 
 	// Web pages behind Aht
 	app := router.Group("")
-	app.Use(veriflow.AuthTokenMiddleware())
+	app.Use(veriflow.AuthTokenMiddleware(), veriflow.CSRFMiddleware())
 
 	app.GET("/veriflow", func(c *gin.Context) {
 		value, exists := c.Get("user")
@@ -88,36 +96,56 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 			"User":   sessionUser,
 			"Config": veriflow.Cfg,
 		}
-		c.HTML(http.StatusOK, "home.html", data)
+		veriflow.renderHTML(c, http.StatusOK, "home.html", data)
 	})
 
-	app.GET("/requests", func(c *gin.Context) {
-		requestsOutgoing, _ := models.GetAllByUser(c.GetString("userEmail"))
-		requestsIncoming, _ := models.GetAllByRecipientEmail(c.GetString("userEmail"))
+	app.GET("/requests", veriflow.RequestsPage)
 
-		data := gin.H{
-			"Sent":     requestsOutgoing,
-			"Recieved": requestsIncoming,
+	app.GET("/requests/:uuid", func(c *gin.Context) {
+		if _, exists := c.Get("user"); !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not find custom data"})
+			return
+		}
+
+		vr, err := models.GetByID(c.Request.Context(), c.Param("uuid"))
+		if err != nil {
+			c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
+			return
+		}
+		userEmail := c.GetString("userEmail")
+		if vr.Requestor.Email != userEmail && vr.Recipient.Email != userEmail {
+			c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
+			return
 		}
 
-		c.HTML(http.StatusOK, "requests.html", data)
+		veriflow.requestPage(c, vr, nil)
 	})
 
-	app.GET("/requests/:uuid", func(c *gin.Context) {
-		value, exists := c.Get("user")
-		if !exists {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not find custom data"})
+	app.GET("/batches/:uuid", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		batch, err := models.GetBatchByID(ctx, c.Param("uuid"))
+		if err != nil || batch.Requestor.Email != c.GetString("userEmail") {
+			c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
 			return
 		}
 
-		sessionUser, ok := value.(models.User)
-		if !ok {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid type"})
+		if err := batch.LoadRequests(ctx); err != nil {
+			c.Data(http.StatusInternalServerError, "text/html", []byte("Failed to load requests"))
 			return
 		}
 
+		data := gin.H{
+			"Batch":  batch,
+			"Counts": batch.Counts(),
+		}
+
+		veriflow.renderHTML(c, http.StatusOK, "batch.html", data)
+	})
+
+	app.POST("/requests/:uuid/report", func(c *gin.Context) {
+		ctx := c.Request.Context()
 		uuid := c.Param("uuid")
-		vr, err := models.GetByID(uuid)
+		vr, err := models.GetByID(ctx, uuid)
 		if err != nil {
 			c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
 			return
@@ -128,58 +156,109 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 			return
 		}
 
-		data := gin.H{
-			"User":    sessionUser,
-			"Request": vr,
+		reported := vr
+		reported.Error = "Incident reported to security. Please avoid communication with the user"
+		if _, err := veriflow.Svc.ReportIncident(ctx, reported, models.NewIncident(&reported, userEmail, c.ClientIP(), c.Request.UserAgent(), nil)); err != nil {
+			veriflow.Logger.Errorf("Error reporting request [%s] %s\n", uuid, err.Error())
+			veriflow.requestPage(c, vr, err)
+			return
 		}
 
-		c.HTML(http.StatusOK, "request.html", data)
+		c.Redirect(http.StatusFound, "/requests/"+uuid)
 	})
 
-	app.GET("/requests/:uuid/report", func(c *gin.Context) {
+	app.POST("/requests/:uuid/cancel", func(c *gin.Context) {
+		ctx := c.Request.Context()
 		uuid := c.Param("uuid")
-		vr, err := models.GetByID(uuid)
-		if err != nil {
+		vr, err := models.GetByID(ctx, uuid)
+		if err != nil || vr.Requestor.Email != c.GetString("userEmail") {
 			c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
 			return
 		}
-		userEmail := c.GetString("userEmail")
-		if vr.Requestor.Email != userEmail && vr.Recipient.Email != userEmail {
+
+		if _, err := veriflow.Svc.CancelVerification(ctx, vr); err != nil {
+			veriflow.Logger.Errorf("Error cancelling request [%s] %s\n", uuid, err.Error())
+			veriflow.requestPage(c, vr, err)
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/requests/"+uuid)
+	})
+
+	app.POST("/requests/:uuid/resend", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		uuid := c.Param("uuid")
+		vr, err := models.GetByID(ctx, uuid)
+		if err != nil || vr.Requestor.Email != c.GetString("userEmail") {
 			c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
 			return
 		}
 
-		vr.Error = "Incident reported to security. Please avoid communication with the user"
-		veriflow.Svc.SendFailure(vr)
+		if _, err := veriflow.Svc.ResendVerification(ctx, vr); err != nil {
+			veriflow.Logger.Errorf("Error resending request [%s] %s\n", uuid, err.Error())
+			veriflow.requestPage(c, vr, err)
+			return
+		}
 
-		redirectURL := "/requests/" + uuid
-		c.Redirect(http.StatusFound, redirectURL)
+		c.Redirect(http.StatusFound, "/requests/"+uuid)
+	})
+
+	app.POST("/requests/:uuid/mute", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		uuid := c.Param("uuid")
+		vr, err := models.GetByID(ctx, uuid)
+		value, _ := c.Get("user")
+		sessionUser, ok := value.(models.User)
+		if err != nil || !ok || vr.Recipient.Email != sessionUser.Email {
+			c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
+			return
+		}
+
+		if err := veriflow.Svc.MuteRequestor(ctx, &sessionUser, vr.Requestor); err != nil {
+			veriflow.Logger.Errorf("Error updating muted users of [%s] %s\n", sessionUser.ID, err.Error())
+			veriflow.requestPage(c, vr, err)
+			return
+		}
+
+		c.Redirect(http.StatusFound, "/requests/"+uuid)
 	})
 
-	app.GET("/requests/:uuid/approve", func(c *gin.Context) {
+	app.POST("/requests/:uuid/approve", func(c *gin.Context) {
+		ctx := c.Request.Context()
 		uuid := c.Param("uuid")
-		vr, err := models.GetByID(uuid)
+		vr, err := models.GetByID(ctx, uuid)
 		if err != nil {
 			c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
 			return
 		}
 		userEmail := c.GetString("userEmail")
 
+		if !vr.IsOpen() {
+			c.Redirect(http.StatusFound, "/requests/"+uuid)
+			return
+		}
+
 		if vr.Recipient.Email != userEmail {
-			if vr.Status != "COMPLETED" && vr.Status != "FAILED" {
-				vr.Error = fmt.Sprintf("Request Failed! The authenticated user email [%s] does not match requestor [%s]  or recipient [%s]", userEmail, vr.Recipient.Email, userEmail)
-				veriflow.Svc.SendFailure(vr)
+			audit.Record(ctx, audit.FactorFailed, actorOf(c, userEmail), vr.ID, vr.Recipient.Email, map[string]string{"factor": "oidc", "reason": "email mismatch"})
+			vr.Error = fmt.Sprintf("Request Failed! The authenticated user email [%s] does not match requestor [%s]  or recipient [%s]", userEmail, vr.Requestor.Email, vr.Recipient.Email)
+			if _, err := veriflow.Svc.SendFailure(ctx, vr); err != nil {
+				veriflow.Logger.Errorf("Error failing request [%s] %s\n", uuid, err.Error())
 			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized Access"})
 			return
 		}
 
 		redirectURL := "/requests/" + uuid
-		if veriflow.Svc.Config.Authenticator.Enabled {
-			vr.Save()
+		if authCfg := veriflow.Svc.Config.Authenticator; authCfg.Enabled || authCfg.EmailOTP.Enabled || authCfg.SMSOTP.Enabled {
+			err = vr.Save(ctx)
 			redirectURL = "/requests/" + uuid + "/verify-code"
 		} else {
-			veriflow.Svc.SendConfirmation(vr)
+			_, err = veriflow.Svc.SendConfirmation(ctx, vr)
+		}
+		if err != nil {
+			veriflow.Logger.Errorf("Error approving request [%s] %s\n", uuid, err.Error())
+			veriflow.requestPage(c, vr, err)
+			return
 		}
 
 		c.Redirect(http.StatusFound, redirectURL)
@@ -188,6 +267,10 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 	// Authenticator endpoints for verification and QR code generation
 	app.GET("/requests/:uuid/verify-code", veriflow.GetVerifyCodeHandler)
 	app.POST("/requests/:uuid/verify-code", veriflow.PostVerifyCodeHandler)
+	app.POST("/requests/:uuid/email-code/send", veriflow.SendEmailCodeHandler)
+	app.POST("/requests/:uuid/email-code", veriflow.PostEmailCodeHandler)
+	app.POST("/requests/:uuid/phone-code/send", veriflow.SendPhoneCodeHandler)
+	app.POST("/requests/:uuid/phone-code", veriflow.PostPhoneCodeHandler)
 
 	// Configuration page for users
 	app.GET("/user/configure", func(c *gin.Context) {
@@ -203,9 +286,10 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 			return
 		}
 
-		data := gin.H{"User": sessionUser}
-		c.HTML(http.StatusOK, "configure-authenticator.html", data)
+		veriflow.renderHTML(c, http.StatusOK, "configure-authenticator.html", veriflow.configurePage(sessionUser))
 	})
+	app.POST("/user/phone", veriflow.StartPhoneEnrollmentHandler)
+	app.POST("/user/phone/verify", veriflow.FinishPhoneEnrollmentHandler)
 
 	// Veriflow Primary Endpoints
 	// Support help, verify and configure subcommands
@@ -217,13 +301,18 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 	auth := router.Group("/auth")
 	auth.GET("/callback", veriflow.AuthCallback)
 
+	// Versioned API with an OpenAPI document, see apiv1.go
+	veriflow.setupAPIv1(router)
+
 	// API endpoints
 	api := router.Group("/api")
-	api.Use(veriflow.AuthTokenMiddleware())
+	api.Use(veriflow.AuthTokenMiddleware(), veriflow.CSRFMiddleware())
 
 	api.POST("/veriflow", func(c *gin.Context) {
 		var requestPayload struct {
-			RecipientID string `json:"recipient_id"`
+			RecipientID    string `json:"recipient_id"`
+			RecipientEmail string `json:"recipient_email"` // recipients without an account on the communication tool
+			Notify         string `json:"notify"`          // email or the communication tool, where the requestor gets updates
 		}
 
 		if err := c.ShouldBindJSON(&requestPayload); err != nil {
@@ -231,6 +320,16 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 			return
 		}
 
+		if requestPayload.RecipientID == "" && requestPayload.RecipientEmail == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "recipient_id or recipient_email is required"})
+			return
+		}
+
+		if notify := requestPayload.Notify; notify != "" && notify != models.ChannelEmail && notify != veriflow.Cfg.Communication.ActiveService {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("notify must be %s or %s", models.ChannelEmail, veriflow.Cfg.Communication.ActiveService)})
+			return
+		}
+
 		value, exists := c.Get("user")
 		if !exists {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not find custom data"})
@@ -243,11 +342,73 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 			return
 		}
 
+		if requestPayload.RecipientEmail != "" {
+			if _, err := mail.ParseAddress(requestPayload.RecipientEmail); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid recipient_email"})
+				return
+			}
+			veriflow.HandleVerify(c, "api", sessionUser.Email, requestPayload.RecipientEmail, requestPayload.Notify, "", "")
+			return
+		}
+
 		// This is temporary to make sure all users are in the system
 		// TODO: this seems redundant now
-		models.GetOrCreateUser(requestPayload.RecipientID)
+		models.GetOrCreateUser(c.Request.Context(), requestPayload.RecipientID)
+
+		veriflow.HandleVerify(c, "api", sessionUser.Email, requestPayload.RecipientID, requestPayload.Notify, "", "")
+	})
+
+	api.GET("/batches/:uuid", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		batch, err := models.GetBatchByID(ctx, c.Param("uuid"))
+		if err != nil || batch.Requestor.Email != c.GetString("userEmail") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "batch not found"})
+			return
+		}
+
+		if err := batch.LoadRequests(ctx); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"batch":  batch,
+			"counts": batch.Counts(),
+		})
+	})
+
+	api.POST("/veriflow/:uuid/cancel", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		vr, err := models.GetByID(ctx, c.Param("uuid"))
+		if err != nil || vr.Requestor.Email != c.GetString("userEmail") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "request not found"})
+			return
+		}
+
+		request, err := veriflow.Svc.CancelVerification(ctx, vr)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 
-		veriflow.HandleVerify(c, "api", sessionUser.Email, requestPayload.RecipientID, "", "")
+		c.JSON(http.StatusOK, request)
+	})
+
+	api.POST("/veriflow/:uuid/resend", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		vr, err := models.GetByID(ctx, c.Param("uuid"))
+		if err != nil || vr.Requestor.Email != c.GetString("userEmail") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "request not found"})
+			return
+		}
+
+		request, err := veriflow.Svc.ResendVerification(ctx, vr)
+		if err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, request)
 	})
 
 	// Enable authenticator support
@@ -265,7 +426,7 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 		}
 
 		if sessionUser.Authenticator.Secret == "" {
-			veriflow.Svc.EnableAuthenticator(&sessionUser)
+			veriflow.Svc.EnableAuthenticator(c.Request.Context(), &sessionUser)
 		}
 
 		decodedData, err := veriflow.Svc.GenerateQRCode(sessionUser.Authenticator.Secret, "Veriflow", sessionUser.ID)
@@ -282,6 +443,7 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 	})
 
 	api.POST("/authenticator/validate", func(c *gin.Context) {
+		ctx := c.Request.Context()
 		value, exists := c.Get("user")
 		if !exists {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not find custom data"})
@@ -304,6 +466,7 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 		}
 		valid := veriflow.Svc.VerifyOTP(sessionUser.Authenticator.Secret, requestPayload.Code)
 		if !valid {
+			metrics.FactorFailures.WithLabelValues("totp", "enroll").Inc()
 			c.JSON(http.StatusOK, gin.H{
 				"error": "invalid code",
 			})
@@ -311,7 +474,8 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 		}
 
 		sessionUser.Authenticator.Validated = true
-		models.SaveUser(sessionUser)
+		models.SaveUser(ctx, sessionUser)
+		veriflow.Svc.UserEnrolled(ctx, sessionUser, "authenticator")
 
 		c.JSON(http.StatusOK, gin.H{
 			"verified": "ok",
@@ -335,7 +499,7 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 			return
 		}
 
-		options, err := veriflow.WebAuthnService.BeginRegistration(sessionUser.ID)
+		options, err := veriflow.WebAuthnService.BeginRegistration(c.Request.Context(), sessionUser.ID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -345,6 +509,7 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 	})
 
 	api.POST("/finish-registration", func(c *gin.Context) {
+		ctx := c.Request.Context()
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
@@ -360,11 +525,13 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 			return
 		}
 
-		err := veriflow.WebAuthnService.FinishRegistration(sessionUser.ID, c.Request)
+		err := veriflow.WebAuthnService.FinishRegistration(ctx, sessionUser.ID, c.Request)
 		if err != nil {
+			metrics.FactorFailures.WithLabelValues("webauthn", "enroll").Inc()
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		veriflow.Svc.UserEnrolled(ctx, sessionUser, "webauthn")
 		c.JSON(http.StatusOK, gin.H{})
 	})
 
@@ -384,7 +551,7 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 			return
 		}
 
-		options, err := veriflow.WebAuthnService.BeginLogin(sessionUser.ID)
+		options, err := veriflow.WebAuthnService.BeginLogin(c.Request.Context(), sessionUser.ID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
@@ -394,6 +561,7 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 	})
 
 	api.POST("/finish-login/:uuid", func(c *gin.Context) {
+		ctx := c.Request.Context()
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Credentials", "true")
 
@@ -409,18 +577,44 @@ func (veriflow *Veriflow) SetupRouter() *gin.Engine {
 			return
 		}
 
-		err := veriflow.WebAuthnService.FinishLogin(sessionUser.ID, c.Request)
+		uuid := c.Param("uuid")
+		err := veriflow.WebAuthnService.FinishLogin(ctx, sessionUser.ID, c.Request)
 		if err != nil {
+			audit.Record(ctx, audit.FactorFailed, actorOf(c, sessionUser.Email), uuid, sessionUser.Email, map[string]string{"factor": "webauthn", "reason": err.Error()})
+			metrics.FactorFailures.WithLabelValues("webauthn", "verify").Inc()
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		uuid := c.Param("uuid")
-		vr, _ := models.GetByID(uuid)
-		veriflow.Svc.SendConfirmation(vr)
+		audit.Record(ctx, audit.FactorPassed, actorOf(c, sessionUser.Email), uuid, sessionUser.Email, map[string]string{"factor": "webauthn"})
+		vr, _ := models.GetByID(ctx, uuid)
+		if vr.IsOpen() {
+			veriflow.Svc.SendConfirmation(ctx, vr)
+		}
 
 		c.JSON(http.StatusOK, gin.H{})
 	})
 
+	// Admin endpoints
+	admin := api.Group("/admin")
+	admin.Use(veriflow.AdminMiddleware())
+
+	admin.GET("/webhooks", veriflow.ListWebhooks)
+	admin.POST("/webhooks", veriflow.CreateWebhook)
+	admin.DELETE("/webhooks/:id", veriflow.DeleteWebhook)
+	admin.GET("/webhooks/:id/deliveries", veriflow.ListWebhookDeliveries)
+
+	admin.GET("/service-accounts", veriflow.ListServiceAccounts)
+	admin.POST("/service-accounts", veriflow.CreateServiceAccount)
+	admin.GET("/service-accounts/:id", veriflow.GetServiceAccount)
+	admin.PUT("/service-accounts/:id/delegators", veriflow.UpdateServiceAccountDelegators)
+	admin.DELETE("/service-accounts/:id", veriflow.DisableServiceAccount)
+	admin.POST("/service-accounts/:id/keys", veriflow.RotateServiceAccountKey)
+	admin.DELETE("/service-accounts/:id/keys/:key_id", veriflow.RevokeServiceAccountKey)
+
+	admin.GET("/audit", veriflow.ListAuditEntries)
+	admin.GET("/audit/export", veriflow.ExportAuditEntries)
+	admin.GET("/audit/verify", veriflow.VerifyAuditChain)
+
 	return router
 }
@@ -0,0 +1,647 @@
+package veriflow
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vdparikh/veriflow/apiv1"
+	"github.com/vdparikh/veriflow/metrics"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/openapi"
+)
+
+// The versioned API. Every endpoint is declared once in apiRoutes, which is
+// used both to register the handlers and to generate the OpenAPI document,
+// so the document can't drift from what is served.
+
+const (
+	apiVersion      = "1.0.0"
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// apiRoute is an endpoint of /api/v1
+type apiRoute struct {
+	method  string
+	path    string
+	id      string // operationId
+	tag     string
+	summary string
+	scope   string // needed by service accounts, empty for endpoints only humans can use
+	query   []openapi.Parameter
+	body    interface{} // request body, nil for none
+	status  int
+	result  interface{} // response body, nil for none
+	handler gin.HandlerFunc
+}
+
+func (veriflow *Veriflow) apiRoutes() []apiRoute {
+	return []apiRoute{
+		{
+			method: http.MethodPost, path: "/requests", id: "createRequest", tag: "requests", scope: models.ScopeRequestsWrite,
+			summary: "Start a verification",
+			body:    apiv1.CreateRequest{}, status: http.StatusAccepted, result: apiv1.Request{},
+			handler: veriflow.apiCreateRequest,
+		},
+		{
+			method: http.MethodGet, path: "/requests", id: "listRequests", tag: "requests", scope: models.ScopeRequestsRead,
+			summary: "List the requests sent or received by the user, newest first",
+			query: []openapi.Parameter{
+				{Name: "role", In: "query", Description: "sent, received or all (default)", Schema: &openapi.Schema{Type: "string", Enum: []string{"all", "sent", "received"}}},
+				{Name: "status", In: "query", Description: "Only requests with this status", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "since", In: "query", Description: "Only requests created at or after this RFC 3339 time or date", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+				{Name: "until", In: "query", Description: "Only requests created at or before this RFC 3339 time, or during this date", Schema: &openapi.Schema{Type: "string", Format: "date-time"}},
+				{Name: "counterparty", In: "query", Description: "Only requests with this other party, matched on email, ID or part of the name", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "order", In: "query", Description: "desc (default) for newest first, asc for oldest first", Schema: &openapi.Schema{Type: "string", Enum: []string{"desc", "asc"}}},
+				{Name: "limit", In: "query", Description: fmt.Sprintf("Page size, %d by default and at most %d", defaultPageSize, maxPageSize), Schema: &openapi.Schema{Type: "integer"}},
+				{Name: "cursor", In: "query", Description: "next_cursor of the previous page, with the same filters", Schema: &openapi.Schema{Type: "string"}},
+				{Name: "on_behalf_of", In: "query", Description: "Email of the user whose requests to list, required for service accounts", Schema: &openapi.Schema{Type: "string"}},
+			},
+			status: http.StatusOK, result: apiv1.RequestList{},
+			handler: veriflow.apiListRequests,
+		},
+		{
+			method: http.MethodGet, path: "/requests/:id", id: "getRequest", tag: "requests", scope: models.ScopeRequestsRead,
+			summary: "Get a request the user sent or received",
+			status:  http.StatusOK, result: apiv1.Request{},
+			handler: veriflow.apiGetRequest,
+		},
+		{
+			method: http.MethodPost, path: "/requests/:id/cancel", id: "cancelRequest", tag: "requests", scope: models.ScopeRequestsWrite,
+			summary: "Cancel a pending request the user sent",
+			status:  http.StatusOK, result: apiv1.Request{},
+			handler: veriflow.apiCancelRequest,
+		},
+		{
+			method: http.MethodPost, path: "/requests/:id/resend", id: "resendRequest", tag: "requests", scope: models.ScopeRequestsWrite,
+			summary: "Send the verification to the recipient again",
+			status:  http.StatusOK, result: apiv1.Request{},
+			handler: veriflow.apiResendRequest,
+		},
+		{
+			method: http.MethodGet, path: "/batches/:id", id: "getBatch", tag: "requests", scope: models.ScopeRequestsRead,
+			summary: "Get a multi-recipient verification and its requests",
+			status:  http.StatusOK, result: apiv1.Batch{},
+			handler: veriflow.apiGetBatch,
+		},
+		{
+			method: http.MethodGet, path: "/enrollment", id: "getEnrollment", tag: "enrollment",
+			summary: "List the second factors of the user",
+			status:  http.StatusOK, result: apiv1.Enrollment{},
+			handler: veriflow.apiGetEnrollment,
+		},
+		{
+			method: http.MethodPost, path: "/enrollment/totp", id: "startTOTPEnrollment", tag: "enrollment",
+			summary: "Create the secret of an authenticator app",
+			status:  http.StatusOK, result: apiv1.TOTPSetup{},
+			handler: veriflow.apiStartTOTPEnrollment,
+		},
+		{
+			method: http.MethodPost, path: "/enrollment/totp/verify", id: "verifyTOTPEnrollment", tag: "enrollment",
+			summary: "Validate the authenticator app with a code it shows",
+			body:    apiv1.Code{}, status: http.StatusOK, result: apiv1.Enrollment{},
+			handler: veriflow.apiVerifyTOTPEnrollment,
+		},
+		{
+			method: http.MethodPost, path: "/enrollment/phone", id: "startPhoneEnrollment", tag: "enrollment",
+			summary: "Text a code to the phone number to enroll",
+			body:    apiv1.PhoneNumber{}, status: http.StatusAccepted,
+			handler: veriflow.apiStartPhoneEnrollment,
+		},
+		{
+			method: http.MethodPost, path: "/enrollment/phone/verify", id: "verifyPhoneEnrollment", tag: "enrollment",
+			summary: "Enroll the phone number with the code it received",
+			body:    apiv1.Code{}, status: http.StatusOK, result: apiv1.Enrollment{},
+			handler: veriflow.apiVerifyPhoneEnrollment,
+		},
+		{
+			method: http.MethodPost, path: "/enrollment/webauthn/begin", id: "beginWebAuthnEnrollment", tag: "enrollment",
+			summary: "Get the options to create a security key credential with",
+			status:  http.StatusOK, result: map[string]interface{}{},
+			handler: veriflow.apiBeginWebAuthnEnrollment,
+		},
+		{
+			method: http.MethodPost, path: "/enrollment/webauthn/finish", id: "finishWebAuthnEnrollment", tag: "enrollment",
+			summary: "Register the credential created by the browser",
+			body:    map[string]interface{}{}, status: http.StatusOK, result: apiv1.Enrollment{},
+			handler: veriflow.apiFinishWebAuthnEnrollment,
+		},
+	}
+}
+
+func (veriflow *Veriflow) setupAPIv1(router *gin.Engine) {
+	routes := veriflow.apiRoutes()
+	document := veriflow.openAPIDocument(routes)
+
+	v1 := router.Group("/api/v1")
+	v1.GET("/openapi.json", func(c *gin.Context) {
+		c.JSON(http.StatusOK, document)
+	})
+
+	authenticated := v1.Group("")
+	authenticated.Use(veriflow.APIAuthMiddleware())
+	for _, route := range routes {
+		authenticated.Handle(route.method, route.path, veriflow.RequireScope(route.scope), route.handler)
+	}
+}
+
+// openAPIDocument describes the routes, every operation can also fail with the error envelope
+func (veriflow *Veriflow) openAPIDocument(routes []apiRoute) *openapi.Document {
+	document := openapi.New("Veriflow API", apiVersion, "Verify the identity of coworkers through a second channel.")
+	document.Servers = []openapi.Server{{URL: strings.TrimSuffix(veriflow.Cfg.BaseURL, "/") + "/api/v1"}}
+	document.Components.SecuritySchemes["cookie"] = openapi.SecurityScheme{Type: "apiKey", In: "cookie", Name: "auth_token", Description: "Set by the OIDC login. Calls other than GET also need the X-CSRF-Token header with the token of the page"}
+	document.Components.SecuritySchemes["bearer"] = openapi.SecurityScheme{Type: "http", Scheme: "bearer", Description: "OIDC access token or service account API key (vf_...)"}
+	document.Security = []map[string][]string{{"cookie": {}}, {"bearer": {}}}
+
+	for _, route := range routes {
+		description := "Not available to service accounts."
+		if route.scope != "" {
+			description = fmt.Sprintf("Service accounts need the %s scope.", route.scope)
+		}
+
+		op := openapi.Operation{
+			OperationID: route.id,
+			Summary:     route.summary,
+			Description: description,
+			Tags:        []string{route.tag},
+			Parameters:  route.query,
+			Responses: map[string]openapi.Response{
+				strconv.Itoa(route.status): document.JSON(http.StatusText(route.status), route.result),
+				"default":                  document.JSON("Error", apiv1.Error{}),
+			},
+		}
+		if route.body != nil {
+			op.RequestBody = document.Body(route.body)
+		}
+		document.Add(route.method, route.path, op)
+	}
+
+	document.Add(http.MethodGet, "/openapi.json", openapi.Operation{
+		OperationID: "getOpenAPI",
+		Summary:     "This document",
+		Responses:   map[string]openapi.Response{"200": {Description: "OK"}},
+		Security:    []map[string][]string{{}}, // no credentials needed
+	})
+
+	return document
+}
+
+// apiError aborts with the error envelope, the code is derived from the status
+func apiError(c *gin.Context, status int, message string) {
+	code := "internal"
+	switch status {
+	case http.StatusBadRequest:
+		code = "bad_request"
+	case http.StatusUnauthorized:
+		code = "unauthorized"
+	case http.StatusForbidden:
+		code = "forbidden"
+	case http.StatusNotFound:
+		code = "not_found"
+	case http.StatusConflict:
+		code = "conflict"
+	case http.StatusUnprocessableEntity:
+		code = "invalid_code"
+	case http.StatusTooManyRequests:
+		code = "rate_limited"
+	}
+
+	c.AbortWithStatusJSON(status, apiv1.Error{Error: apiv1.ErrorDetail{Code: code, Message: message}})
+}
+
+// apiServiceError reports an error of the verification service. Internal
+// errors are logged and not shown to the caller.
+func (veriflow *Veriflow) apiServiceError(c *gin.Context, err error) {
+	status := statusForError(err)
+	if status == http.StatusInternalServerError {
+		veriflow.Logger.Errorf("API error [%s %s] %s\n", c.Request.Method, c.FullPath(), err.Error())
+		apiError(c, status, "internal error")
+		return
+	}
+	apiError(c, status, err.Error())
+}
+
+func apiUser(c *gin.Context) models.User {
+	value, _ := c.Get("user")
+	sessionUser, _ := value.(models.User)
+	return sessionUser
+}
+
+// apiServiceAccount is the service account of the API key of the call, nil for users
+func apiServiceAccount(c *gin.Context) *models.ServiceAccount {
+	value, _ := c.Get("serviceAccount")
+	account, ok := value.(models.ServiceAccount)
+	if !ok {
+		return nil
+	}
+	return &account
+}
+
+// apiRequest loads a request of the caller, the ones of others don't exist for
+// them. Service accounts see the requests they created.
+func apiRequest(c *gin.Context, requestorOnly bool) (models.VerifyRequest, bool) {
+	vr, _ := models.GetByID(c.Request.Context(), c.Param("id"))
+
+	var allowed bool
+	if account := apiServiceAccount(c); account != nil {
+		allowed = vr.ServiceAccountID == account.ID && account.CanActFor(vr.Requestor.Email)
+	} else {
+		userEmail := c.GetString("userEmail")
+		allowed = vr.Requestor.Email == userEmail || !requestorOnly && vr.Recipient.Email == userEmail
+	}
+
+	if vr.ID == "" || !allowed {
+		apiError(c, http.StatusNotFound, "request not found")
+		return vr, false
+	}
+	return vr, true
+}
+
+func (veriflow *Veriflow) apiCreateRequest(c *gin.Context) {
+	var payload apiv1.CreateRequest
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	recipient := payload.RecipientID
+	switch {
+	case payload.RecipientEmail != "":
+		if _, err := mail.ParseAddress(payload.RecipientEmail); err != nil {
+			apiError(c, http.StatusBadRequest, "invalid recipient_email")
+			return
+		}
+		recipient = payload.RecipientEmail
+	case payload.RecipientID == "":
+		apiError(c, http.StatusBadRequest, "recipient_id or recipient_email is required")
+		return
+	}
+
+	if notify := payload.Notify; notify != "" && notify != models.ChannelEmail && notify != veriflow.Cfg.Communication.ActiveService {
+		apiError(c, http.StatusBadRequest, fmt.Sprintf("notify must be %s or %s", models.ChannelEmail, veriflow.Cfg.Communication.ActiveService))
+		return
+	}
+
+	// Service accounts act for a user, who gets the updates and is named in the audit trail
+	requestor := apiUser(c).Email
+	switch account := apiServiceAccount(c); {
+	case account != nil && payload.OnBehalfOf == "":
+		apiError(c, http.StatusBadRequest, "on_behalf_of is required for service accounts")
+		return
+	case account != nil && !account.CanActFor(payload.OnBehalfOf):
+		apiError(c, http.StatusForbidden, "the service account can't act on behalf of "+payload.OnBehalfOf)
+		return
+	case account != nil:
+		user, err := models.GetUserByEmail(c.Request.Context(), payload.OnBehalfOf)
+		if err != nil || user.Email == "" {
+			apiError(c, http.StatusBadRequest, "on_behalf_of must be the email of a Veriflow user")
+			return
+		}
+		requestor = user.Email
+	case payload.OnBehalfOf != "" && payload.OnBehalfOf != requestor:
+		apiError(c, http.StatusForbidden, "only service accounts can act on behalf of other users")
+		return
+	}
+
+	if payload.RecipientEmail == "" {
+		models.GetOrCreateUser(c.Request.Context(), payload.RecipientID)
+	}
+
+	request, err := veriflow.queueVerification(c, "api", requestor, recipient, payload.Notify, "", "")
+	if err != nil {
+		veriflow.apiServiceError(c, err)
+		return
+	}
+
+	c.Header("Location", "/api/v1/requests/"+request.ID)
+	c.JSON(http.StatusAccepted, newAPIRequest(request))
+}
+
+func (veriflow *Veriflow) apiListRequests(c *gin.Context) {
+	query := models.RequestQuery{
+		Email:        c.GetString("userEmail"),
+		Status:       strings.ToUpper(c.Query("status")),
+		Counterparty: c.Query("counterparty"),
+		Limit:        defaultPageSize,
+		Cursor:       c.Query("cursor"),
+	}
+
+	switch role := c.DefaultQuery("role", "all"); role {
+	case models.RoleSent, models.RoleReceived:
+		query.Role = role
+	case "all":
+	default:
+		apiError(c, http.StatusBadRequest, "role must be all, sent or received")
+		return
+	}
+
+	switch order := c.DefaultQuery("order", "desc"); order {
+	case "asc":
+		query.Ascending = true
+	case "desc":
+	default:
+		apiError(c, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 || query.Limit > maxPageSize {
+			apiError(c, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+	}
+
+	var err error
+	if query.Since, err = parseTimeParam(c.Query("since"), false); err != nil {
+		apiError(c, http.StatusBadRequest, "since must be an RFC 3339 time or a date")
+		return
+	}
+	if query.Until, err = parseTimeParam(c.Query("until"), true); err != nil {
+		apiError(c, http.StatusBadRequest, "until must be an RFC 3339 time or a date")
+		return
+	}
+
+	// Service accounts list the requests they sent for a user, who has to be named
+	if account := apiServiceAccount(c); account != nil {
+		query.Email = c.Query("on_behalf_of")
+		if query.Email == "" {
+			apiError(c, http.StatusBadRequest, "on_behalf_of is required for service accounts")
+			return
+		}
+		if !account.CanActFor(query.Email) {
+			apiError(c, http.StatusForbidden, "the service account can't act on behalf of "+query.Email)
+			return
+		}
+		if query.Role == models.RoleReceived {
+			c.JSON(http.StatusOK, newAPIRequestList(nil))
+			return
+		}
+		query.Role = models.RoleSent
+		query.ServiceAccountID = account.ID
+	}
+
+	requests, next, err := models.QueryRequests(c.Request.Context(), query)
+	if err != nil {
+		veriflow.apiServiceError(c, err)
+		return
+	}
+
+	list := newAPIRequestList(requests)
+	list.NextCursor = next
+	c.JSON(http.StatusOK, list)
+}
+
+func (veriflow *Veriflow) apiGetRequest(c *gin.Context) {
+	vr, ok := apiRequest(c, false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newAPIRequest(vr))
+}
+
+func (veriflow *Veriflow) apiCancelRequest(c *gin.Context) {
+	vr, ok := apiRequest(c, true)
+	if !ok {
+		return
+	}
+
+	request, err := veriflow.Svc.CancelVerification(c.Request.Context(), vr)
+	if err != nil {
+		veriflow.apiServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAPIRequest(*request))
+}
+
+func (veriflow *Veriflow) apiResendRequest(c *gin.Context) {
+	vr, ok := apiRequest(c, true)
+	if !ok {
+		return
+	}
+
+	request, err := veriflow.Svc.ResendVerification(c.Request.Context(), vr)
+	if err != nil {
+		veriflow.apiServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAPIRequest(*request))
+}
+
+func (veriflow *Veriflow) apiGetBatch(c *gin.Context) {
+	ctx := c.Request.Context()
+	batch, err := models.GetBatchByID(ctx, c.Param("id"))
+	// Service accounts can't create batches
+	if err != nil || batch.ID == "" || apiServiceAccount(c) != nil || batch.Requestor.Email != c.GetString("userEmail") {
+		apiError(c, http.StatusNotFound, "batch not found")
+		return
+	}
+
+	if err := batch.LoadRequests(ctx); err != nil {
+		veriflow.apiServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAPIBatch(batch))
+}
+
+func (veriflow *Veriflow) apiGetEnrollment(c *gin.Context) {
+	c.JSON(http.StatusOK, newAPIEnrollment(apiUser(c)))
+}
+
+func (veriflow *Veriflow) apiStartTOTPEnrollment(c *gin.Context) {
+	sessionUser := apiUser(c)
+	if sessionUser.Authenticator.Validated {
+		apiError(c, http.StatusConflict, "an authenticator app is already enrolled")
+		return
+	}
+
+	if sessionUser.Authenticator.Secret == "" {
+		if err := veriflow.Svc.EnableAuthenticator(c.Request.Context(), &sessionUser); err != nil {
+			veriflow.apiServiceError(c, err)
+			return
+		}
+	}
+
+	png, err := veriflow.Svc.GenerateQRCode(sessionUser.Authenticator.Secret, "Veriflow", sessionUser.ID)
+	if err != nil {
+		veriflow.apiServiceError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apiv1.TOTPSetup{
+		Secret: sessionUser.Authenticator.Secret,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	})
+}
+
+func (veriflow *Veriflow) apiVerifyTOTPEnrollment(c *gin.Context) {
+	ctx := c.Request.Context()
+	var payload apiv1.Code
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessionUser := apiUser(c)
+	if sessionUser.Authenticator.Secret == "" {
+		apiError(c, http.StatusConflict, "start the enrollment first")
+		return
+	}
+
+	if !veriflow.Svc.VerifyOTP(sessionUser.Authenticator.Secret, strings.TrimSpace(payload.Code)) {
+		metrics.FactorFailures.WithLabelValues("totp", "enroll").Inc()
+		apiError(c, http.StatusUnprocessableEntity, "invalid code")
+		return
+	}
+
+	sessionUser.Authenticator.Validated = true
+	if err := models.SaveUser(ctx, sessionUser); err != nil {
+		veriflow.apiServiceError(c, err)
+		return
+	}
+	veriflow.Svc.UserEnrolled(ctx, sessionUser, "authenticator")
+
+	c.JSON(http.StatusOK, newAPIEnrollment(sessionUser))
+}
+
+func (veriflow *Veriflow) apiStartPhoneEnrollment(c *gin.Context) {
+	if !veriflow.Cfg.Authenticator.SMSOTP.Enabled {
+		apiError(c, http.StatusNotFound, "text message codes are not enabled")
+		return
+	}
+
+	var payload apiv1.PhoneNumber
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessionUser := apiUser(c)
+	if err := veriflow.Svc.StartPhoneEnrollment(c.Request.Context(), &sessionUser, payload.Number); err != nil {
+		veriflow.apiServiceError(c, err)
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func (veriflow *Veriflow) apiVerifyPhoneEnrollment(c *gin.Context) {
+	if !veriflow.Cfg.Authenticator.SMSOTP.Enabled {
+		apiError(c, http.StatusNotFound, "text message codes are not enabled")
+		return
+	}
+
+	var payload apiv1.Code
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sessionUser := apiUser(c)
+	if err := veriflow.Svc.FinishPhoneEnrollment(c.Request.Context(), &sessionUser, strings.TrimSpace(payload.Code)); err != nil {
+		metrics.FactorFailures.WithLabelValues("sms", "enroll").Inc()
+		veriflow.apiServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAPIEnrollment(sessionUser))
+}
+
+func (veriflow *Veriflow) apiBeginWebAuthnEnrollment(c *gin.Context) {
+	options, err := veriflow.WebAuthnService.BeginRegistration(c.Request.Context(), apiUser(c).ID)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, options)
+}
+
+func (veriflow *Veriflow) apiFinishWebAuthnEnrollment(c *gin.Context) {
+	ctx := c.Request.Context()
+	sessionUser := apiUser(c)
+	if err := veriflow.WebAuthnService.FinishRegistration(ctx, sessionUser.ID, c.Request); err != nil {
+		metrics.FactorFailures.WithLabelValues("webauthn", "enroll").Inc()
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	veriflow.Svc.UserEnrolled(ctx, sessionUser, "webauthn")
+
+	// The credential was saved on a fresh copy of the user
+	enrolled, err := models.GetUserByEmail(ctx, sessionUser.Email)
+	if err != nil {
+		veriflow.apiServiceError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, newAPIEnrollment(enrolled))
+}
+
+// newAPIRequest converts a stored request
+func newAPIRequest(vr models.VerifyRequest) apiv1.Request {
+	return apiv1.Request{
+		ID:               vr.ID,
+		Status:           vr.Status,
+		Requestor:        newAPIUser(vr.Requestor),
+		Recipient:        newAPIUser(vr.Recipient),
+		RequestorChannel: vr.RequestorChannel,
+		RecipientChannel: vr.RecipientChannel,
+		Message:          vr.Message,
+		Error:            vr.Error,
+		BatchID:          vr.BatchID,
+		ServiceAccountID: vr.ServiceAccountID,
+		ResendCount:      vr.ResendCount,
+		CreatedAt:        vr.Start,
+		CompletedAt:      timeOrNil(vr.End),
+		AuthenticatedAt:  timeOrNil(vr.AuthenticatedAt),
+	}
+}
+
+// newAPIRequestList converts stored requests
+func newAPIRequestList(requests []models.VerifyRequest) apiv1.RequestList {
+	list := apiv1.RequestList{Requests: make([]apiv1.Request, 0, len(requests))}
+	for _, vr := range requests {
+		list.Requests = append(list.Requests, newAPIRequest(vr))
+	}
+	return list
+}
+
+// newAPIBatch converts a stored batch, its requests have to be loaded
+func newAPIBatch(batch models.VerifyBatch) apiv1.Batch {
+	counts := batch.Counts()
+	return apiv1.Batch{
+		ID:          batch.ID,
+		Status:      batch.Status,
+		Requestor:   newAPIUser(batch.Requestor),
+		Message:     batch.Message,
+		CreatedAt:   batch.Start,
+		CompletedAt: timeOrNil(batch.End),
+		Counts:      apiv1.BatchCounts(counts),
+		Requests:    newAPIRequestList(batch.Requests).Requests,
+	}
+}
+
+func newAPIUser(user models.User) apiv1.User {
+	return apiv1.User{ID: user.ID, Name: user.Name, Email: user.Email}
+}
+
+// newAPIEnrollment lists the factors of a user, credentials have to be loaded
+func newAPIEnrollment(user models.User) apiv1.Enrollment {
+	enrollment := apiv1.Enrollment{
+		TOTP:     user.Authenticator.Validated,
+		WebAuthn: len(user.Credentials),
+	}
+	if user.Phone.Verified {
+		enrollment.Phone = user.Phone.Number
+	}
+	return enrollment
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
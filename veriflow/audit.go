@@ -0,0 +1,124 @@
+package veriflow
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vdparikh/veriflow/audit"
+	"github.com/vdparikh/veriflow/models"
+)
+
+const auditPageLimit = 500
+
+// auditWindow is how far back the audit trail is read when since isn't set
+const auditWindow = 7 * 24 * time.Hour
+
+// actorOf is the audit actor for the user making the web request
+func actorOf(c *gin.Context, id string) audit.Actor {
+	return audit.Actor{ID: id, IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
+// auditFilter reads request_id, actor, action, since and until (RFC3339) and
+// the cursor from the query string
+func auditFilter(c *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		RequestID: c.Query("request_id"),
+		Actor:     c.Query("actor"),
+		Action:    c.Query("action"),
+		Window:    auditWindow,
+	}
+
+	var err error
+	if since := c.Query("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return filter, fmt.Errorf("invalid since: %w", err)
+		}
+	}
+	if until := c.Query("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return filter, fmt.Errorf("invalid until: %w", err)
+		}
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		if filter.Before, err = strconv.ParseInt(cursor, 10, 64); err != nil || filter.Before < 1 {
+			return filter, fmt.Errorf("invalid cursor %q", cursor)
+		}
+	}
+
+	return filter, nil
+}
+
+func (veriflow *Veriflow) ListAuditEntries(c *gin.Context) {
+	filter, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := auditPageLimit
+	if value, err := strconv.Atoi(c.Query("limit")); err == nil && value > 0 && value < limit {
+		limit = value
+	}
+
+	// Newest entries are the most interesting ones, one more tells whether
+	// there is another page
+	filter.Limit = limit + 1
+	entries, err := models.GetAuditEntries(c.Request.Context(), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	more := len(entries) > limit
+	if more {
+		entries = entries[1:]
+	}
+	// Older entries may be outside of the default window
+	if c.Query("since") == "" && len(entries) > 0 && entries[0].Sequence > 1 {
+		more = true
+	}
+
+	response := gin.H{"entries": entries}
+	if more {
+		response["next_cursor"] = strconv.FormatInt(entries[0].Sequence, 10)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportAuditEntries streams the matching entries as JSON Lines
+func (veriflow *Veriflow) ExportAuditEntries(c *gin.Context) {
+	ctx := c.Request.Context()
+	filter, err := auditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries, err := models.GetAuditEntries(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	audit.Record(ctx, audit.AdminAuditExported, actorOf(c, c.GetString("userEmail")), filter.RequestID, "", map[string]string{"entries": strconv.Itoa(len(entries))})
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=veriflow-audit-%s.jsonl", time.Now().Format("20060102150405")))
+	c.Status(http.StatusOK)
+	if err := audit.WriteJSONLines(c.Writer, entries); err != nil {
+		veriflow.Logger.Errorf("Error exporting audit log %s\n", err.Error())
+	}
+}
+
+func (veriflow *Veriflow) VerifyAuditChain(c *gin.Context) {
+	checked, err := models.VerifyAuditChain(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"valid": false, "checked": checked, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"valid": true, "checked": checked})
+}
@@ -0,0 +1,75 @@
+package veriflow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/vdparikh/veriflow/models"
+)
+
+func TestListAuditEntriesPages(t *testing.T) {
+	router := newSessionRouter(t)
+	ctx := context.Background()
+	start := time.Now().UTC().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		entry := &models.AuditEntry{Time: start.Add(time.Duration(i) * time.Minute), Action: "request.created", Actor: sessionAdmin}
+		if err := models.AppendAuditEntry(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list := func(query string) (sequences []int64, next string) {
+		t.Helper()
+		r := httptest.NewRequest(http.MethodGet, "/api/admin/audit?"+query, nil)
+		r.AddCookie(&http.Cookie{Name: "auth_token", Value: "session"})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/admin/audit?%s = %d %s", query, w.Code, w.Body.String())
+		}
+		var response struct {
+			Entries    []models.AuditEntry `json:"entries"`
+			NextCursor string              `json:"next_cursor"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range response.Entries {
+			sequences = append(sequences, entry.Sequence)
+		}
+		return sequences, response.NextCursor
+	}
+
+	var pages [][]int64
+	query := "limit=2"
+	for {
+		sequences, next := list(query)
+		pages = append(pages, sequences)
+		if next == "" || len(pages) > 3 {
+			break
+		}
+		query = "limit=2&cursor=" + next
+	}
+
+	want := [][]int64{{4, 5}, {2, 3}, {1}}
+	if len(pages) != len(want) {
+		t.Fatalf("pages = %v, want %v", pages, want)
+	}
+	for i := range want {
+		if len(pages[i]) != len(want[i]) || pages[i][0] != want[i][0] {
+			t.Errorf("page %d = %v, want %v", i, pages[i], want[i])
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/admin/audit?cursor=abc", nil)
+	r.AddCookie(&http.Cookie{Name: "auth_token", Value: "session"})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("GET /api/admin/audit?cursor=abc = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
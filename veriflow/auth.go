@@ -8,11 +8,14 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vdparikh/veriflow/audit"
 	"github.com/vdparikh/veriflow/models"
 )
 
 // OIDC Auth Callback
 func (veriflow *Veriflow) AuthCallback(c *gin.Context) {
+	ctx := c.Request.Context()
+
 	// TODO: this needs to be changed. ID should be seperate than state
 	state := c.Request.URL.Query().Get("state")
 	stateBytes, _ := base64.StdEncoding.DecodeString(state)
@@ -25,7 +28,7 @@ func (veriflow *Veriflow) AuthCallback(c *gin.Context) {
 
 	fn, uuid := stateSlice[0], stateSlice[1]
 
-	userInfo, oauth2Token, err := veriflow.Svc.Auth.GetAccessToken(c.Request.URL.Query().Get("code"))
+	userInfo, oauth2Token, err := veriflow.Svc.Auth.GetAccessToken(ctx, c.Request.URL.Query().Get("code"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to exchange token: " + err.Error()})
 		return
@@ -35,16 +38,16 @@ func (veriflow *Veriflow) AuthCallback(c *gin.Context) {
 
 	if fn == "login" {
 		redirectURL = "/veriflow"
-		models.GetOrCreateUser(userInfo.Email)
+		models.GetOrCreateUser(ctx, userInfo.Email)
 	} else if fn == "configure" {
-		user, err := models.GetUser(uuid)
+		user, err := models.GetUser(ctx, uuid)
 		if err != nil {
-			user, err = veriflow.Svc.Communicator.GetUserInfo(uuid)
+			user, err = veriflow.Svc.Communicator.GetUserInfo(ctx, uuid)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user: " + err.Error()})
 				return
 			}
-			models.SaveUser(user)
+			models.SaveUser(ctx, user)
 		}
 
 		// Check if the user who autenticated is the same email address from Slack registration
@@ -56,7 +59,7 @@ func (veriflow *Veriflow) AuthCallback(c *gin.Context) {
 		redirectURL = "/requests/" + uuid
 
 		// Get request
-		vr, err := models.GetByID(uuid)
+		vr, err := models.GetByID(ctx, uuid)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get request: " + err.Error()})
 			return
@@ -64,9 +67,10 @@ func (veriflow *Veriflow) AuthCallback(c *gin.Context) {
 
 		// If user is neither requestor or recipient... Error out and don't create session
 		if vr.Recipient.Email != userInfo.Email && vr.Requestor.Email != userInfo.Email {
-			if vr.Status != "COMPLETED" && vr.Status != "FAILED" {
-				vr.Error = fmt.Sprintf("Request Failed! The authenticated user email [%s] does not match requestor [%s]  or recipient [%s]", userInfo.Email, vr.Recipient.Email, userInfo.Email)
-				veriflow.Svc.SendFailure(vr)
+			audit.Record(ctx, audit.FactorFailed, actorOf(c, userInfo.Email), vr.ID, vr.Recipient.Email, map[string]string{"factor": "oidc", "reason": "email mismatch"})
+			if vr.IsOpen() {
+				vr.Error = fmt.Sprintf("Request Failed! The authenticated user email [%s] does not match requestor [%s]  or recipient [%s]", userInfo.Email, vr.Requestor.Email, vr.Recipient.Email)
+				veriflow.Svc.SendFailure(ctx, vr)
 			}
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized Access"})
 			return
@@ -74,14 +78,21 @@ func (veriflow *Veriflow) AuthCallback(c *gin.Context) {
 
 		// If REPORT and Status is not completed and clicked by Recipient
 		if fn == "report" && vr.Status == "SENT" && userInfo.Email == vr.Recipient.Email {
-			//TODO: Trigger security block
+			var claims map[string]interface{}
+			userInfo.Claims(&claims)
+
 			vr.Error = "Reported by recipient. Please refrain from the converation and the incident has been reported to security"
-			veriflow.Svc.SendFailure(vr)
+			veriflow.Svc.ReportIncident(ctx, vr, models.NewIncident(&vr, userInfo.Email, c.ClientIP(), c.Request.UserAgent(), claims))
 		}
 
 		// If Auth and Status is not completed and clicked by Recipient
 		if fn == "auth" && vr.Status == "SENT" && userInfo.Email == vr.Recipient.Email {
 			vr.SetOIDCInfo(userInfo)
+			vr.RecipientIP = c.ClientIP()
+			vr.RecipientUserAgent = c.Request.UserAgent()
+			vr.AuthenticatedAt = time.Now()
+			vr.Save(ctx)
+			audit.Record(ctx, audit.RequestAuthenticated, actorOf(c, userInfo.Email), vr.ID, vr.Recipient.Email, map[string]string{"factor": "oidc", "email": userInfo.Email})
 			redirectURL = "/requests/" + uuid
 		}
 	}
@@ -92,6 +103,7 @@ func (veriflow *Veriflow) AuthCallback(c *gin.Context) {
 		Path:     "/",
 		HttpOnly: true,
 		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
 		MaxAge:   int(time.Until(oauth2Token.Expiry).Seconds()),
 	})
 
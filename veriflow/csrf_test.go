@@ -0,0 +1,205 @@
+package veriflow
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vdparikh/veriflow/auth"
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/i18n"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/queue"
+	"github.com/vdparikh/veriflow/service"
+)
+
+func newCSRFRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use((&Veriflow{}).CSRFMiddleware())
+	router.GET("/page", func(c *gin.Context) { c.String(http.StatusOK, csrfToken(c)) })
+	router.POST("/action", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return router
+}
+
+func TestCSRFTokenCookie(t *testing.T) {
+	router := newCSRFRouter()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/page", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookie || cookies[0].Value != w.Body.String() {
+		t.Fatalf("cookies = %v, token = %q", cookies, w.Body.String())
+	}
+	if !cookies[0].HttpOnly || !cookies[0].Secure || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Errorf("cookie = %+v", cookies[0])
+	}
+
+	// The token of the cookie is kept, every tab posts the same one
+	r := httptest.NewRequest(http.MethodGet, "/page", nil)
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Body.String() != cookies[0].Value || len(w.Result().Cookies()) != 0 {
+		t.Errorf("token = %q, want %q", w.Body.String(), cookies[0].Value)
+	}
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	router := newCSRFRouter()
+	session := &http.Cookie{Name: "auth_token", Value: "token"}
+	csrf := &http.Cookie{Name: csrfCookie, Value: "secret"}
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		form    string
+		header  string
+		want    int
+	}{
+		{"form token", []*http.Cookie{session, csrf}, "secret", "", http.StatusNoContent},
+		{"header token", []*http.Cookie{session, csrf}, "", "secret", http.StatusNoContent},
+		{"no token", []*http.Cookie{session, csrf}, "", "", http.StatusForbidden},
+		{"other token", []*http.Cookie{session, csrf}, "guess", "", http.StatusForbidden},
+		{"no cookie", []*http.Cookie{session}, "secret", "", http.StatusForbidden},
+		{"bearer token", nil, "", "", http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/action", strings.NewReader(url.Values{csrfCookie: {tt.form}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.header != "" {
+				r.Header.Set("X-CSRF-Token", tt.header)
+			}
+			for _, cookie := range tt.cookies {
+				r.AddCookie(cookie)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+const sessionAdmin = "admin@example.com"
+
+// newOIDCServer is an identity provider that knows the access token "session"
+// of the admin
+func newOIDCServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 server.URL,
+				"authorization_endpoint": server.URL + "/authorize",
+				"token_endpoint":         server.URL + "/token",
+				"userinfo_endpoint":      server.URL + "/userinfo",
+				"jwks_uri":               server.URL + "/keys",
+			})
+		case "/userinfo":
+			if r.Header.Get("Authorization") != "Bearer session" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"sub": "admin", "email": sessionAdmin, "email_verified": true})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newSessionRouter serves the real router with the admin signed in through
+// the auth_token cookie holding the access token "session"
+func newSessionRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	memory := db.NewMemoryDB()
+	memory.RangeKeys[models.RequestorIndex] = "start_time"
+	memory.RangeKeys[models.RecipientIndex] = "start_time"
+	memory.RangeKeys[models.AuditDayIndex] = "sequence"
+	models.UseDB(memory)
+	if err := models.SaveUser(context.Background(), models.User{ID: sessionAdmin, Email: sessionAdmin, Name: "Admin"}); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := i18n.NewBundle()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{BaseURL: "http://veriflow.test", Admins: []string{sessionAdmin}}
+	app := &Veriflow{
+		Cfg:    cfg,
+		Svc:    &service.VerificationService{Config: &cfg, Events: service.NewEventBus(), Auth: &auth.OIDCProvider{Issuer: newOIDCServer(t).URL}},
+		Queue:  queue.NewMemoryQueue(100, time.Minute),
+		Logger: log.New(),
+		I18n:   bundle,
+	}
+	return app.SetupRouter()
+}
+
+// Pages of other sites can make the browser of a signed in user send the
+// auth_token cookie, but can't read the CSRF token to send along
+func TestCookieAPIRequiresCSRFToken(t *testing.T) {
+	router := newSessionRouter(t)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodPost, "/api/admin/webhooks", `{"url": "https://attacker.example/hook", "events": ["request.completed"], "secret": "secret"}`},
+		{http.MethodDelete, "/api/admin/webhooks/hook", ""},
+		{http.MethodPost, "/api/v1/requests", `{"recipient_email": "bob@example.com"}`},
+		{http.MethodPost, "/api/v1/requests/request/cancel", ""},
+		{http.MethodPost, "/api/v1/requests/request/resend", ""},
+		{http.MethodPost, "/api/v1/enrollment/totp", ""},
+		{http.MethodPost, "/api/veriflow/request/cancel", ""},
+		{http.MethodPost, "/api/veriflow/request/resend", ""},
+		{http.MethodPost, "/api/admin/service-accounts", `{"name": "attacker", "scopes": ["requests:write"], "allowed_delegators": ["@example.com"]}`},
+		{http.MethodPut, "/api/admin/service-accounts/account/delegators", `{"allowed_delegators": ["@example.com"]}`},
+		{http.MethodPost, "/api/admin/service-accounts/account/keys", ""},
+		{http.MethodDelete, "/api/admin/service-accounts/account/keys/key", ""},
+		{http.MethodDelete, "/api/admin/service-accounts/account", ""},
+	}
+
+	for _, tt := range tests {
+		send := func(header string, cookies ...*http.Cookie) int {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "text/plain")
+			if header != "" {
+				r.Header.Set("X-CSRF-Token", header)
+			}
+			for _, cookie := range cookies {
+				r.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			return w.Code
+		}
+
+		session := &http.Cookie{Name: "auth_token", Value: "session"}
+		csrf := &http.Cookie{Name: csrfCookie, Value: "secret"}
+		if got := send("", session, csrf); got != http.StatusForbidden {
+			t.Errorf("cross-site %s %s = %d, want %d", tt.method, tt.path, got, http.StatusForbidden)
+		}
+		if got := send("secret", session, csrf); got == http.StatusForbidden || got == http.StatusUnauthorized {
+			t.Errorf("%s %s with the CSRF token = %d", tt.method, tt.path, got)
+		}
+	}
+}
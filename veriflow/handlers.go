@@ -1,6 +1,7 @@
 package veriflow
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -9,7 +10,10 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/slack-go/slack"
+	"github.com/vdparikh/veriflow/audit"
+	"github.com/vdparikh/veriflow/metrics"
 	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/service"
 )
 
 // Handle Verification Subcommands
@@ -21,11 +25,33 @@ func (veriflow *Veriflow) HandleVeriflow(c *gin.Context) {
 	case len(args) == 0 || args[0] == "help":
 		veriflow.HandleHelp(c)
 	case args[0] == "verify" && len(args) >= 2:
-		veriflow.HandleVerify(c, "slack", userID, extractUserID(args[1]), responseURL, commandText)
+		// Recipients without Slack get the verification by email
+		if address := extractEmail(args[1]); address != "" {
+			veriflow.HandleVerify(c, "slack", userID, address, "", responseURL, commandText)
+			return
+		}
+		userIDs, groupIDs, message := extractRecipients(args[1:])
+		if len(userIDs)+len(groupIDs) > 1 || len(groupIDs) > 0 {
+			veriflow.HandleBatchVerify(c, userID, userIDs, groupIDs, responseURL, commandText, message)
+			return
+		}
+		veriflow.HandleVerify(c, "slack", userID, extractUserID(args[1]), "", responseURL, commandText)
+	case args[0] == "verify-channel":
+		veriflow.HandleVerifyChannel(c, userID, c.PostForm("channel_id"), responseURL, commandText)
+	case (args[0] == "cancel" || args[0] == "resend") && len(args) >= 2:
+		veriflow.HandleCancelOrResend(c, userID, args[0], args[1])
+	case args[0] == "status":
+		veriflow.HandleStatus(c, userID, args[1:])
+	case args[0] == "history":
+		veriflow.HandleHistory(c, userID, args[1:])
+	case (args[0] == "mute" || args[0] == "unmute") && len(args) >= 2:
+		veriflow.HandleMute(c, userID, args[0], extractUserID(args[1]))
+	case args[0] == "language":
+		veriflow.HandleLanguage(c, userID, args[1:])
 	case args[0] == "configure":
 		veriflow.HandleConfigure(c, userID)
 	default:
-		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": "Unknown subcommand. Available subcommands are `verify` and `configure`."})
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": "Unknown subcommand. Use `/veriflow help` to see the available subcommands."})
 	}
 }
 
@@ -33,48 +59,213 @@ func (veriflow *Veriflow) HandleVeriflow(c *gin.Context) {
 func (veriflow *Veriflow) HandleHelp(c *gin.Context) {
 	helpText := "Here are some things you can do with /veriflow command:\n" +
 		"• `/veriflow verify <user>` - Start a Verification process for a user.\n" +
+		"• `/veriflow verify <email>` - Verify someone who isn't on Slack by email.\n" +
+		"• `/veriflow verify <user> <user> <@group>` - Verify several users or a user group at once.\n" +
+		"• `/veriflow verify-channel` - Verify everyone in the current channel.\n" +
+		"• `/veriflow cancel <id>` - Cancel a verification request you sent.\n" +
+		"• `/veriflow resend <id>` - Send the verification message to the recipient again.\n" +
+		"• `/veriflow status [id]` - Status of a request or of your pending requests.\n" +
+		"• `/veriflow history [user]` - Your recent requests, optionally only the ones with a user.\n" +
+		"• `/veriflow mute <user>` - Stop receiving verification requests from a user, `unmute` to undo.\n" +
+		"• `/veriflow language [code|auto]` - Language of your Veriflow messages, `auto` follows your Slack language.\n" +
 		"• `/veriflow configure` - Configure your Veriflow Setings.\n" +
 		"• `/veriflow help` - Get help on how to use the Veriflow slash command."
 
 	c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": helpText})
 }
 
-// Handle Verification Request
-func (veriflow *Veriflow) HandleVerify(c *gin.Context, service, requestor, recipient, responseURL, commandText string) {
+// Handle Verification Request. The recipient is a user of the communication tool
+// or an email address, notify is the channel the requestor wants updates on.
+func (veriflow *Veriflow) HandleVerify(c *gin.Context, service, requestor, recipient, notify, responseURL, commandText string) {
+	request, err := veriflow.queueVerification(c, service, requestor, recipient, notify, responseURL, commandText)
+	if err != nil {
+		switch service {
+		case "slack":
+			c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Verification Failed with error %s", err.Error())})
+		default:
+			c.JSON(statusForError(err), gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if service == "slack" {
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": "[API] Verification Queued. You will be notified here once it started."})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"id": request.ID, "status": request.Status})
+}
+
+// queueVerification saves a new request and queues it for the worker, which
+// does the lookups and sends the messages
+func (veriflow *Veriflow) queueVerification(c *gin.Context, service, requestor, recipient, notify, responseURL, commandText string) (models.VerifyRequest, error) {
+	ctx := c.Request.Context()
+
 	// The slackrequest model should be just Request which stores details of incoming request
 	// Generic across teams, slack, webex, zoom etc.
 	request := models.VerifyRequest{
 		Start:             time.Now(),
 		ID:                uuid.New().String(),
-		Status:            "RECEIVED",
+		Status:            "QUEUED",
 		CommunicationTool: service,
 		Message:           commandText,
+		Requestor:         models.User{ID: requestor},
+		Recipient:         models.User{ID: recipient},
+		RequestorChannel:  notify,
 		Slack:             models.SlackRequest{UserID: requestor, RecipientID: recipient, Text: commandText, ResponseURL: responseURL},
 	}
 
-	err := veriflow.Svc.InitVerification(&request)
+	// Slash commands come from Slack servers, only API calls tell us where the requestor is
+	if service == "api" {
+		request.Requestor.Email = requestor
+		request.RequestorIP = c.ClientIP()
+		request.ServiceAccountID, request.APIKeyID = c.GetString("serviceAccountID"), c.GetString("apiKeyID")
+	} else {
+		// requestor_email keys the table and its indexes, it has to be known before the first save
+		email, err := veriflow.Svc.EmailOf(ctx, requestor)
+		if err != nil {
+			veriflow.Logger.Errorf("Error getting requestor [%s] %s\n", requestor, err.Error())
+			return request, fmt.Errorf("failed to get your user details")
+		}
+		request.Requestor.Email = email
+	}
+
+	// Slack gives slash commands 3 seconds, the worker does the lookups and sends the messages
+	err := request.Save(ctx)
+	if err == nil {
+		err = veriflow.Enqueue(ctx, VerificationJob{Kind: JobVerify, RequestID: request.ID, ResponseURL: responseURL})
+	}
 
 	if err != nil {
-		request.DoneWithError(err.Error())
-		switch service {
-		case "slack":
-			c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Verification Failed with error %s", err.Error())})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		veriflow.Logger.Errorf("Error queueing verification [%s] %s\n", request.ID, err.Error())
+		request.DoneWithError(ctx, err.Error())
+	}
+
+	return request, err
+}
+
+// Handle Verification Request for multiple recipients and user groups
+func (veriflow *Veriflow) HandleBatchVerify(c *gin.Context, requestor string, recipients, groups []string, responseURL, commandText, message string) {
+	batch := models.VerifyBatch{
+		Start:   time.Now(),
+		ID:      uuid.New().String(),
+		Status:  "RECEIVED",
+		Message: message,
+		Slack:   models.SlackRequest{UserID: requestor, Text: commandText, ResponseURL: responseURL},
+	}
+
+	err := veriflow.Enqueue(c.Request.Context(), VerificationJob{Kind: JobBatch, Batch: &batch, Recipients: recipients, Groups: groups, ResponseURL: responseURL})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Group Verification Failed with error %s", err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": "[API] Group Verification Queued. You will be notified here once it started."})
+}
+
+// Handle Verification Request for every member of a channel
+// Requests are sent at a limited rate by the worker
+func (veriflow *Veriflow) HandleVerifyChannel(c *gin.Context, requestor, channelID, responseURL, commandText string) {
+	batch := models.VerifyBatch{
+		Start:  time.Now(),
+		ID:     uuid.New().String(),
+		Status: "RECEIVED",
+		Slack:  models.SlackRequest{UserID: requestor, Channel: channelID, Text: commandText, ResponseURL: responseURL},
+	}
+
+	err := veriflow.Enqueue(c.Request.Context(), VerificationJob{Kind: JobChannel, Batch: &batch, ResponseURL: responseURL})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Channel Verification Failed with error %s", err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": "[API] Channel Verification Initiated. A roster with the verification status of every member will be posted in this channel."})
+}
+
+// Cancel or Resend a request, only the requestor can do either
+func (veriflow *Veriflow) HandleCancelOrResend(c *gin.Context, userID, action, requestID string) {
+	ctx := c.Request.Context()
+	vr, err := models.GetByID(ctx, requestID)
+	if err != nil || vr.Requestor.ID != userID {
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": "[API] Request not found"})
+		return
+	}
+
+	if action == "cancel" {
+		_, err = veriflow.Svc.CancelVerification(ctx, vr)
+	} else {
+		_, err = veriflow.Svc.ResendVerification(ctx, vr)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Failed to %s request: %s", action, err.Error())})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Request %s: %s done", requestID, action)})
+}
+
+// Mute or Unmute verification requests from a user
+func (veriflow *Veriflow) HandleMute(c *gin.Context, userID, action, requestorID string) {
+	ctx := c.Request.Context()
+	if requestorID == "" {
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Usage: `/veriflow %s <user>`", action)})
+		return
+	}
+
+	// Mutes are keyed on the email of the requestor
+	requestor := models.User{ID: requestorID}
+	user, err := veriflow.Svc.FetchUser(ctx, userID)
+	if err == nil {
+		requestor.Email, err = veriflow.Svc.EmailOf(ctx, requestorID)
+	}
+	if err == nil {
+		if action == "mute" {
+			err = veriflow.Svc.MuteRequestor(ctx, &user, requestor)
+		} else {
+			err = veriflow.Svc.UnmuteRequestor(ctx, &user, requestor)
 		}
+	}
+
+	if err != nil {
+		veriflow.Logger.Errorf("Error updating muted users of [%s] %s\n", userID, err.Error())
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Failed to %s user: %s", action, err.Error())})
 		return
 	}
 
-	// request.Status = "QUEUED"
-	// veriflow.VerificationQueue <- request
-	// veriflow.Svc.NewVerification(&request)
+	c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] <@%s> %sd", requestorID, action)})
+}
+
+// Show or change the language of the messages a user gets
+func (veriflow *Veriflow) HandleLanguage(c *gin.Context, userID string, args []string) {
+	ctx := c.Request.Context()
 
-	c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": "[API] Verification Initiated. Please head on to the Veriflow app to monitor the progress of your verification."})
+	user, err := veriflow.Svc.FetchUser(ctx, userID)
+	if err == nil && len(args) > 0 {
+		language := args[0]
+		if language == "auto" {
+			language = ""
+		}
+		err = veriflow.Svc.SetLanguage(ctx, &user, language)
+	}
+
+	if err != nil {
+		veriflow.Logger.Errorf("Error updating language of [%s] %s\n", userID, err.Error())
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Failed to change language: %s", err.Error())})
+		return
+	}
+
+	current := user.Language
+	if current == "" {
+		current = fmt.Sprintf("auto (%s)", user.Locale)
+	}
+	available := append([]string{"auto"}, veriflow.Svc.Config.Templates.Locales()...)
+	c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": fmt.Sprintf("[API] Language: `%s`. Available: `%s`", current, strings.Join(available, "`, `"))})
 }
 
 // Configure authenticator
 func (veriflow *Veriflow) HandleConfigure(c *gin.Context, userID string) {
-	authLink, err := veriflow.Svc.ConfigureUser(userID)
+	authLink, err := veriflow.Svc.ConfigureUser(c.Request.Context(), userID)
 
 	if err != nil {
 		veriflow.Logger.Errorf("Error configuring user [%s] %s\n", userID, err.Error())
@@ -102,7 +293,7 @@ func (veriflow *Veriflow) HandleConfigure(c *gin.Context, userID string) {
 func (veriflow *Veriflow) GetVerifyCodeHandler(c *gin.Context) {
 
 	uuid := c.Param("uuid")
-	vr, _ := models.GetByID(uuid)
+	vr, _ := models.GetByID(c.Request.Context(), uuid)
 
 	value, exists := c.Get("user")
 	if !exists {
@@ -120,18 +311,46 @@ func (veriflow *Veriflow) GetVerifyCodeHandler(c *gin.Context) {
 		c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
 		return
 	}
+
+	veriflow.renderHTML(c, http.StatusOK, "authenticator.html", veriflow.authenticatorPage(vr, sessionUser, ""))
+}
+
+// authenticatorPage is the data of authenticator.html, listing the factors the
+// recipient can use. message is a catalog key or a text shown as it is.
+func (veriflow *Veriflow) authenticatorPage(vr models.VerifyRequest, user models.User, message string) gin.H {
+	return gin.H{
+		"UUID":     vr.ID,
+		"Request":  vr,
+		"User":     user,
+		"Error":    message,
+		"EmailOTP": veriflow.Cfg.Authenticator.EmailOTP.Enabled,
+		"SMSOTP":   veriflow.Cfg.Authenticator.SMSOTP.Enabled && user.Phone.Verified,
+	}
+}
+
+// requestPage renders request.html, with the error of the action the user
+// took on the request when it failed
+func (veriflow *Veriflow) requestPage(c *gin.Context, vr models.VerifyRequest, err error) {
+	value, _ := c.Get("user")
+	sessionUser, _ := value.(models.User)
+
+	code := http.StatusOK
 	data := gin.H{
-		"UUID":    uuid,
-		"Request": vr,
 		"User":    sessionUser,
+		"Request": vr,
+	}
+	if err != nil {
+		code = statusForError(err)
+		data["Error"] = textForError(err)
 	}
 
-	c.HTML(http.StatusOK, "authenticator.html", data)
+	veriflow.renderHTML(c, code, "request.html", data)
 }
 
 func (veriflow *Veriflow) PostVerifyCodeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
 	uuid := c.Param("uuid")
-	vr, _ := models.GetByID(uuid)
+	vr, _ := models.GetByID(ctx, uuid)
 
 	value, exists := c.Get("user")
 	if !exists {
@@ -150,19 +369,85 @@ func (veriflow *Veriflow) PostVerifyCodeHandler(c *gin.Context) {
 		return
 	}
 
+	if !vr.IsOpen() {
+		c.Redirect(http.StatusFound, "/requests/"+uuid)
+		return
+	}
+
 	code := c.PostForm("code")
 	valid := veriflow.Svc.VerifyOTP(sessionUser.Authenticator.Secret, code)
 	if valid {
-		veriflow.Svc.SendConfirmation(vr)
+		audit.Record(ctx, audit.FactorPassed, actorOf(c, sessionUser.Email), vr.ID, vr.Recipient.Email, map[string]string{"factor": "totp"})
+		veriflow.Svc.SendConfirmation(ctx, vr)
 		c.Redirect(http.StatusFound, "/requests/"+uuid)
 		return
 	}
 
-	data := gin.H{
-		"UUID":  uuid,
-		"User":  sessionUser,
-		"Error": "Invalid Code",
+	audit.Record(ctx, audit.FactorFailed, actorOf(c, sessionUser.Email), vr.ID, vr.Recipient.Email, map[string]string{"factor": "totp", "reason": "invalid code"})
+	metrics.FactorFailures.WithLabelValues("totp", "verify").Inc()
+
+	veriflow.renderHTML(c, http.StatusOK, "authenticator.html", veriflow.authenticatorPage(vr, sessionUser, "error.invalid_code"))
+}
+
+// SendEmailCodeHandler mails a one-time code to the address the recipient authenticated with
+func (veriflow *Veriflow) SendEmailCodeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	vr, sessionUser, ok := veriflow.codeRequest(c, veriflow.Cfg.Authenticator.EmailOTP.Enabled)
+	if !ok {
+		return
+	}
+
+	if err := veriflow.Svc.SendEmailCode(ctx, vr, sessionUser.Email); err != nil {
+		veriflow.Logger.Errorf("Error sending email code [%s] %s\n", vr.ID, err.Error())
+		veriflow.renderHTML(c, http.StatusOK, "authenticator.html", veriflow.authenticatorPage(vr, sessionUser, textForError(err)))
+		return
+	}
+
+	data := veriflow.authenticatorPage(vr, sessionUser, "")
+	data["EmailOTPSent"] = true
+	veriflow.renderHTML(c, http.StatusOK, "authenticator.html", data)
+}
+
+func (veriflow *Veriflow) PostEmailCodeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	vr, sessionUser, ok := veriflow.codeRequest(c, veriflow.Cfg.Authenticator.EmailOTP.Enabled)
+	if !ok {
+		return
+	}
+
+	err := veriflow.Svc.VerifyEmailCode(ctx, vr, sessionUser.Email, strings.TrimSpace(c.PostForm("code")))
+	if err == nil {
+		audit.Record(ctx, audit.FactorPassed, actorOf(c, sessionUser.Email), vr.ID, vr.Recipient.Email, map[string]string{"factor": "email_otp"})
+		veriflow.Svc.SendConfirmation(ctx, vr)
+		c.Redirect(http.StatusFound, "/requests/"+vr.ID)
+		return
+	}
+
+	audit.Record(ctx, audit.FactorFailed, actorOf(c, sessionUser.Email), vr.ID, vr.Recipient.Email, map[string]string{"factor": "email_otp", "reason": err.Error()})
+	metrics.FactorFailures.WithLabelValues("email_otp", "verify").Inc()
+
+	data := veriflow.authenticatorPage(vr, sessionUser, textForError(err))
+	data["EmailOTPSent"] = errors.Is(err, service.ErrCodeInvalid)
+	veriflow.renderHTML(c, http.StatusOK, "authenticator.html", data)
+}
+
+// codeRequest loads the open request the session user is the recipient of,
+// enabled tells whether the factor of the code is turned on
+func (veriflow *Veriflow) codeRequest(c *gin.Context, enabled bool) (models.VerifyRequest, models.User, bool) {
+	uuid := c.Param("uuid")
+	vr, _ := models.GetByID(c.Request.Context(), uuid)
+
+	value, _ := c.Get("user")
+	sessionUser, ok := value.(models.User)
+	if !ok || !enabled || vr.Recipient.Email != sessionUser.Email {
+		c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
+		return vr, sessionUser, false
+	}
+
+	if !vr.IsOpen() {
+		c.Redirect(http.StatusFound, "/requests/"+uuid)
+		return vr, sessionUser, false
 	}
 
-	c.HTML(http.StatusOK, "authenticator.html", data)
+	return vr, sessionUser, true
 }
@@ -0,0 +1,172 @@
+package veriflow
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/slack-go/slack"
+	"github.com/vdparikh/veriflow/models"
+)
+
+const (
+	historyLimit     = 10
+	requestsPageSize = 20
+)
+
+// RequestsPage lists the requests of the user a page at a time. It shows the
+// pending requests they received unless other filters are picked.
+func (veriflow *Veriflow) RequestsPage(c *gin.Context) {
+	params := c.Request.URL.Query()
+	query := models.RequestQuery{
+		Email:        c.GetString("userEmail"),
+		Role:         models.RoleReceived,
+		Status:       "SENT",
+		Counterparty: params.Get("counterparty"),
+		Limit:        requestsPageSize,
+		Cursor:       params.Get("cursor"),
+	}
+	if params.Get("role") == models.RoleSent {
+		query.Role = models.RoleSent
+	}
+	if params.Has("status") {
+		query.Status = strings.ToUpper(params.Get("status"))
+	}
+	// Dates that don't parse are ignored like empty ones
+	query.Since, _ = parseTimeParam(params.Get("since"), false)
+	query.Until, _ = parseTimeParam(params.Get("until"), true)
+
+	requests, next, err := models.QueryRequests(c.Request.Context(), query)
+	if err != nil {
+		veriflow.Logger.Errorf("Error listing requests [%s] %s\n", query.Email, err.Error())
+	}
+
+	data := gin.H{
+		"Requests":     requests,
+		"Role":         query.Role,
+		"Status":       query.Status,
+		"Counterparty": query.Counterparty,
+		"Since":        params.Get("since"),
+		"Until":        params.Get("until"),
+	}
+	if next != "" {
+		params.Set("cursor", next)
+		data["NextPage"] = "/requests?" + params.Encode()
+	}
+	if query.Cursor != "" {
+		params.Del("cursor")
+		data["FirstPage"] = "/requests?" + params.Encode()
+	}
+
+	veriflow.renderHTML(c, http.StatusOK, "requests.html", data)
+}
+
+// Status of a single request, or of the pending requests sent by the user
+func (veriflow *Veriflow) HandleStatus(c *gin.Context, userID string, args []string) {
+	ctx := c.Request.Context()
+	if len(args) > 0 {
+		vr, err := models.GetByID(ctx, args[0])
+		if err != nil || (vr.Requestor.ID != userID && vr.Recipient.ID != userID) {
+			c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": "[API] Request not found"})
+			return
+		}
+
+		veriflow.respondWithRequests(c, fmt.Sprintf("Request %s", vr.ID), []models.VerifyRequest{vr}, userID)
+		return
+	}
+
+	pending, err := veriflow.historyFor(ctx, userID, models.RequestQuery{Role: models.RoleSent, Status: "SENT"})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": err.Error()})
+		return
+	}
+
+	veriflow.respondWithRequests(c, "Pending Requests", pending, userID)
+}
+
+// History of requests sent and received by the user, optionally only the ones with another user
+func (veriflow *Veriflow) HandleHistory(c *gin.Context, userID string, args []string) {
+	counterparty := ""
+	if len(args) > 0 {
+		counterparty = extractUserID(args[0])
+	}
+
+	history, err := veriflow.historyFor(c.Request.Context(), userID, models.RequestQuery{Counterparty: counterparty})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"response_type": "ephemeral", "text": err.Error()})
+		return
+	}
+
+	title := "Verification History"
+	if counterparty != "" {
+		title = fmt.Sprintf("Verification History with <@%s>", counterparty)
+	}
+
+	veriflow.respondWithRequests(c, title, history, userID)
+}
+
+// historyFor looks up the Slack user and returns the first page of their requests matching the query
+func (veriflow *Veriflow) historyFor(ctx context.Context, userID string, query models.RequestQuery) ([]models.VerifyRequest, error) {
+	user, err := veriflow.Svc.Communicator.GetUserInfo(ctx, userID)
+	if err != nil {
+		veriflow.Logger.Errorf("Error getting user [%s] %s\n", userID, err.Error())
+		return nil, fmt.Errorf("[API] Failed to get user details")
+	}
+
+	query.Email = user.Email
+	query.Limit = historyLimit
+	requests, _, err := models.QueryRequests(ctx, query)
+	return requests, err
+}
+
+func (veriflow *Veriflow) respondWithRequests(c *gin.Context, title string, requests []models.VerifyRequest, userID string) {
+	blocks := []slack.Block{
+		slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", fmt.Sprintf("*%s*", title), false, false), nil, nil),
+	}
+
+	if len(requests) == 0 {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject("mrkdwn", "No verification requests found.", false, false)))
+	}
+
+	for _, vr := range requests {
+		blocks = append(blocks, slack.NewDividerBlock(), requestSummaryBlock(vr, userID, veriflow.Cfg.BaseURL))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"response_type": "ephemeral",
+		"blocks":        slack.Blocks{BlockSet: blocks},
+	})
+}
+
+func requestSummaryBlock(vr models.VerifyRequest, userID, baseURL string) *slack.SectionBlock {
+	direction := fmt.Sprintf("Sent to *%s*", vr.Recipient.Name)
+	if vr.Recipient.ID == userID {
+		direction = fmt.Sprintf("Received from *%s*", vr.Requestor.Name)
+	}
+
+	text := fmt.Sprintf("%s `%s`\nStarted %s", direction, vr.Status, vr.Start.Format("2006-01-02 03:04 PM"))
+	if vr.Duration != "" {
+		text += fmt.Sprintf(" • Took %s", vr.Duration)
+	} else {
+		text += fmt.Sprintf(" • Waiting for %s", vr.DurationSinceStart)
+	}
+
+	if vr.Error != "" {
+		text += fmt.Sprintf("\nError: `%s`", vr.Error)
+	}
+
+	statusLink := vr.StatusLink
+	if statusLink == "" {
+		statusLink = fmt.Sprintf("%s/requests/%s", baseURL, vr.ID)
+	}
+
+	links := fmt.Sprintf("\n<%s|Details>", statusLink)
+	if vr.Permalink != "" {
+		links += fmt.Sprintf(" • <%s|Open Message In Slack>", vr.Permalink)
+	}
+	text += links + fmt.Sprintf(" • `%s`", vr.ID)
+
+	return slack.NewSectionBlock(slack.NewTextBlockObject("mrkdwn", text, false, false), nil, nil)
+}
@@ -0,0 +1,14 @@
+package veriflow
+
+import (
+	"os"
+	"testing"
+)
+
+// The router loads the page templates from the working directory
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
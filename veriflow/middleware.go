@@ -2,41 +2,157 @@ package veriflow
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/vdparikh/veriflow/audit"
 	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/service"
 	"golang.org/x/oauth2"
 )
 
 func (veriflow *Veriflow) AuthTokenMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		accessToken, err := c.Cookie("auth_token")
-		if err != nil {
+		if !veriflow.authenticate(c) {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			return
 		}
-		userEmail, isValid := veriflow.ValidateAccessToken(accessToken)
-		if !isValid {
+		c.Next()
+	}
+}
+
+// MetricsAuthMiddleware only lets scrapers with the metrics token through,
+// without a token configured /metrics isn't served at all
+func (veriflow *Veriflow) MetricsAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		want := veriflow.Cfg.Metrics.Token
+		if want == "" {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(want)) != 1 {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			return
 		}
+		c.Next()
+	}
+}
 
-		user, err := models.GetUserByEmail(userEmail)
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+// APIAuthMiddleware is AuthTokenMiddleware for /api/v1. It also takes the
+// access token, or the API key of a service account, as a bearer token and
+// fails with the v1 error envelope. Calls with the auth_token cookie that
+// change anything need the X-CSRF-Token header, like the rest of /api.
+func (veriflow *Veriflow) APIAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found && models.IsAPIKey(token) {
+			veriflow.authenticateAPIKey(c, token)
 			return
 		}
 
-		c.Set("user", user)
-		c.Set("userEmail", user.Email)
+		if !veriflow.authenticate(c) {
+			apiError(c, http.StatusUnauthorized, "missing or invalid access token")
+			return
+		}
+		if !validCSRF(c) {
+			apiError(c, http.StatusForbidden, "missing or invalid X-CSRF-Token header")
+			return
+		}
 		c.Next()
 	}
 }
 
-func (veriflow *Veriflow) ValidateAccessToken(accessToken string) (string, bool) {
-	provider, _, _ := veriflow.Svc.Auth.GetConfig()
-	ctx := context.Background()
+// authenticateAPIKey sets the service account of the key. Everything the call
+// records in the audit trail names the service account and the key.
+func (veriflow *Veriflow) authenticateAPIKey(c *gin.Context, token string) {
+	ctx := c.Request.Context()
+	account, key, err := veriflow.Svc.AuthenticateAPIKey(ctx, token)
+	switch {
+	case errors.Is(err, service.ErrRateLimited):
+		apiError(c, http.StatusTooManyRequests, err.Error())
+		return
+	case errors.Is(err, service.ErrServiceAccountDisabled):
+		apiError(c, http.StatusForbidden, err.Error())
+		return
+	case err != nil:
+		apiError(c, http.StatusUnauthorized, "invalid API key")
+		return
+	}
+
+	c.Set("serviceAccount", account)
+	c.Set("serviceAccountID", account.ID)
+	c.Set("apiKeyID", key.ID)
+	c.Request = c.Request.WithContext(audit.WithServiceAccount(ctx, account.ID, key.ID))
+	c.Next()
+}
+
+// RequireScope lets service accounts through when their account has the
+// scope, an empty scope keeps them out. Users have every scope.
+func (veriflow *Veriflow) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account := apiServiceAccount(c)
+		switch {
+		case account == nil:
+			c.Next()
+		case scope == "":
+			apiError(c, http.StatusForbidden, "not available to service accounts")
+		case !account.HasScope(scope):
+			apiError(c, http.StatusForbidden, fmt.Sprintf("the service account needs the %s scope", scope))
+		default:
+			c.Next()
+		}
+	}
+}
+
+// authenticate sets the user of the access token from the auth_token cookie
+// or the Authorization header
+func (veriflow *Veriflow) authenticate(c *gin.Context) bool {
+	ctx := c.Request.Context()
+	accessToken, err := c.Cookie("auth_token")
+	if err != nil {
+		var found bool
+		accessToken, found = strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !found {
+			return false
+		}
+	}
+
+	userEmail, isValid := veriflow.ValidateAccessToken(ctx, accessToken)
+	if !isValid {
+		return false
+	}
+
+	user, err := models.GetUserByEmail(ctx, userEmail)
+	if err != nil {
+		return false
+	}
+
+	c.Set("user", user)
+	c.Set("userEmail", user.Email)
+	return true
+}
+
+// AdminMiddleware only lets the users listed under admins in the config through.
+// It has to run after AuthTokenMiddleware.
+func (veriflow *Veriflow) AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userEmail := c.GetString("userEmail")
+		for _, admin := range veriflow.Cfg.Admins {
+			if userEmail != "" && admin == userEmail {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+	}
+}
+
+func (veriflow *Veriflow) ValidateAccessToken(ctx context.Context, accessToken string) (string, bool) {
+	provider, _, _ := veriflow.Svc.Auth.GetConfig(ctx)
 	userInfo, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(&oauth2.Token{
 		AccessToken: accessToken,
 	}))
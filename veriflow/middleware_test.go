@@ -0,0 +1,47 @@
+package veriflow
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vdparikh/veriflow/config"
+)
+
+func TestMetricsAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		want          int
+	}{
+		{"no token configured", "", "", http.StatusNotFound},
+		{"no token configured, empty bearer", "", "Bearer ", http.StatusNotFound},
+		{"token", "secret", "Bearer secret", http.StatusOK},
+		{"no token", "secret", "", http.StatusUnauthorized},
+		{"other token", "secret", "Bearer guess", http.StatusUnauthorized},
+		{"token without scheme", "secret", "secret", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			veriflow := &Veriflow{Cfg: config.Config{}}
+			veriflow.Cfg.Metrics.Token = tt.token
+			router := gin.New()
+			router.GET("/metrics", veriflow.MetricsAuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
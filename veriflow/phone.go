@@ -0,0 +1,111 @@
+package veriflow
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vdparikh/veriflow/audit"
+	"github.com/vdparikh/veriflow/metrics"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/service"
+)
+
+// configurePage is the data of configure-authenticator.html
+func (veriflow *Veriflow) configurePage(user models.User) gin.H {
+	return gin.H{
+		"User":   user,
+		"SMSOTP": veriflow.Cfg.Authenticator.SMSOTP.Enabled,
+	}
+}
+
+// StartPhoneEnrollmentHandler texts a code to the number the user wants to enroll
+func (veriflow *Veriflow) StartPhoneEnrollmentHandler(c *gin.Context) {
+	sessionUser, ok := veriflow.phoneUser(c)
+	if !ok {
+		return
+	}
+
+	data := veriflow.configurePage(sessionUser)
+	if err := veriflow.Svc.StartPhoneEnrollment(c.Request.Context(), &sessionUser, c.PostForm("number")); err != nil {
+		veriflow.Logger.Errorf("Error enrolling phone [%s] %s\n", sessionUser.ID, err.Error())
+		data["PhoneError"] = err.Error()
+	} else {
+		data["PhonePending"] = true
+	}
+
+	veriflow.renderHTML(c, http.StatusOK, "configure-authenticator.html", data)
+}
+
+func (veriflow *Veriflow) FinishPhoneEnrollmentHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	sessionUser, ok := veriflow.phoneUser(c)
+	if !ok {
+		return
+	}
+
+	if err := veriflow.Svc.FinishPhoneEnrollment(ctx, &sessionUser, strings.TrimSpace(c.PostForm("code"))); err != nil {
+		metrics.FactorFailures.WithLabelValues("sms", "enroll").Inc()
+
+		data := veriflow.configurePage(sessionUser)
+		data["PhoneError"] = err.Error()
+		data["PhonePending"] = errors.Is(err, service.ErrCodeInvalid)
+		veriflow.renderHTML(c, http.StatusOK, "configure-authenticator.html", data)
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/user/configure")
+}
+
+// SendPhoneCodeHandler sends a code for the request by SMS, or by a call when voice is set
+func (veriflow *Veriflow) SendPhoneCodeHandler(c *gin.Context) {
+	vr, sessionUser, ok := veriflow.codeRequest(c, veriflow.Cfg.Authenticator.SMSOTP.Enabled)
+	if !ok {
+		return
+	}
+
+	err := veriflow.Svc.SendPhoneCode(c.Request.Context(), vr, sessionUser, c.PostForm("voice") != "")
+	if err != nil {
+		veriflow.Logger.Errorf("Error sending phone code [%s] %s\n", vr.ID, err.Error())
+		veriflow.renderHTML(c, http.StatusOK, "authenticator.html", veriflow.authenticatorPage(vr, sessionUser, textForError(err)))
+		return
+	}
+
+	data := veriflow.authenticatorPage(vr, sessionUser, "")
+	data["PhoneCodeSent"] = true
+	veriflow.renderHTML(c, http.StatusOK, "authenticator.html", data)
+}
+
+func (veriflow *Veriflow) PostPhoneCodeHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	vr, sessionUser, ok := veriflow.codeRequest(c, veriflow.Cfg.Authenticator.SMSOTP.Enabled)
+	if !ok {
+		return
+	}
+
+	err := veriflow.Svc.VerifyPhoneCode(ctx, vr, sessionUser, strings.TrimSpace(c.PostForm("code")))
+	if err == nil {
+		audit.Record(ctx, audit.FactorPassed, actorOf(c, sessionUser.Email), vr.ID, vr.Recipient.Email, map[string]string{"factor": "sms"})
+		veriflow.Svc.SendConfirmation(ctx, vr)
+		c.Redirect(http.StatusFound, "/requests/"+vr.ID)
+		return
+	}
+
+	audit.Record(ctx, audit.FactorFailed, actorOf(c, sessionUser.Email), vr.ID, vr.Recipient.Email, map[string]string{"factor": "sms", "reason": err.Error()})
+	metrics.FactorFailures.WithLabelValues("sms", "verify").Inc()
+
+	data := veriflow.authenticatorPage(vr, sessionUser, textForError(err))
+	data["PhoneCodeSent"] = errors.Is(err, service.ErrCodeInvalid)
+	veriflow.renderHTML(c, http.StatusOK, "authenticator.html", data)
+}
+
+func (veriflow *Veriflow) phoneUser(c *gin.Context) (models.User, bool) {
+	value, _ := c.Get("user")
+	sessionUser, ok := value.(models.User)
+	if !ok || !veriflow.Cfg.Authenticator.SMSOTP.Enabled {
+		c.Data(http.StatusUnauthorized, "text/html", []byte("Invalid Request"))
+		return sessionUser, false
+	}
+	return sessionUser, true
+}
@@ -0,0 +1,256 @@
+package veriflow
+
+import (
+	"errors"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vdparikh/veriflow/audit"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/service"
+)
+
+func (veriflow *Veriflow) ListServiceAccounts(c *gin.Context) {
+	accounts, err := models.GetServiceAccounts(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"service_accounts": accounts, "scopes": models.Scopes})
+}
+
+// CreateServiceAccount returns the account with its first API key. The key
+// is only shown here, Veriflow only keeps a hash of it.
+func (veriflow *Veriflow) CreateServiceAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+	var requestPayload struct {
+		Name              string   `json:"name"`
+		Description       string   `json:"description"`
+		Scopes            []string `json:"scopes"`
+		AllowedDelegators []string `json:"allowed_delegators"`
+		RateLimitPerHour  int      `json:"rate_limit_per_hour"`
+	}
+
+	if err := c.ShouldBindJSON(&requestPayload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if strings.TrimSpace(requestPayload.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required"})
+		return
+	}
+	if len(requestPayload.Scopes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "at least one scope is required"})
+		return
+	}
+	for _, scope := range requestPayload.Scopes {
+		if !isScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown scope " + scope})
+			return
+		}
+	}
+	delegators, err := parseDelegators(requestPayload.AllowedDelegators)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if requestPayload.RateLimitPerHour < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "rate_limit_per_hour can't be negative"})
+		return
+	}
+
+	admin := c.GetString("userEmail")
+	account := models.ServiceAccount{
+		ID:                uuid.New().String(),
+		Name:              strings.TrimSpace(requestPayload.Name),
+		Description:       requestPayload.Description,
+		Scopes:            requestPayload.Scopes,
+		AllowedDelegators: delegators,
+		RateLimitPerHour:  requestPayload.RateLimitPerHour,
+		CreatedBy:         admin,
+		CreatedAt:         time.Now(),
+	}
+
+	if err := account.Save(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(ctx, audit.AdminServiceAccountCreated, actorOf(c, admin), "", account.ID, map[string]string{"name": account.Name, "scopes": strings.Join(account.Scopes, ","), "allowed_delegators": strings.Join(account.AllowedDelegators, ",")})
+
+	key, secret, err := veriflow.Svc.RotateAPIKey(ctx, &account, admin, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(ctx, audit.AdminAPIKeyCreated, actorOf(c, admin), "", account.ID, map[string]string{"api_key": key.ID})
+
+	c.JSON(http.StatusCreated, gin.H{"service_account": account, "api_key": secret})
+}
+
+func (veriflow *Veriflow) GetServiceAccount(c *gin.Context) {
+	account, err := models.GetServiceAccount(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// UpdateServiceAccountDelegators replaces the users the account can act on
+// behalf of
+func (veriflow *Veriflow) UpdateServiceAccountDelegators(c *gin.Context) {
+	ctx := c.Request.Context()
+	var requestPayload struct {
+		AllowedDelegators []string `json:"allowed_delegators"`
+	}
+
+	if err := c.ShouldBindJSON(&requestPayload); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	delegators, err := parseDelegators(requestPayload.AllowedDelegators)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := models.GetServiceAccount(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	account.AllowedDelegators = delegators
+	if err := account.Save(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(ctx, audit.AdminServiceAccountUpdated, actorOf(c, c.GetString("userEmail")), "", account.ID, map[string]string{"allowed_delegators": strings.Join(account.AllowedDelegators, ",")})
+
+	c.JSON(http.StatusOK, account)
+}
+
+// DisableServiceAccount stops all keys of the account. The account is kept
+// so the audit trail and its requests still point at it.
+func (veriflow *Veriflow) DisableServiceAccount(c *gin.Context) {
+	ctx := c.Request.Context()
+	account, err := models.GetServiceAccount(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	account.Disabled = true
+	if err := account.Save(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(ctx, audit.AdminServiceAccountDisabled, actorOf(c, c.GetString("userEmail")), "", account.ID, nil)
+
+	c.JSON(http.StatusOK, account)
+}
+
+// RotateServiceAccountKey creates a new API key. The previous keys keep
+// working for grace_hours, rotation_grace_hours from the config by default.
+func (veriflow *Veriflow) RotateServiceAccountKey(c *gin.Context) {
+	ctx := c.Request.Context()
+	var requestPayload struct {
+		GraceHours *int `json:"grace_hours"`
+	}
+
+	if err := c.ShouldBindJSON(&requestPayload); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	graceHours := veriflow.Cfg.ServiceAccounts.RotationGraceHours
+	if requestPayload.GraceHours != nil {
+		graceHours = *requestPayload.GraceHours
+	}
+	if graceHours < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "grace_hours can't be negative"})
+		return
+	}
+
+	account, err := models.GetServiceAccount(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if account.Disabled {
+		c.JSON(http.StatusConflict, gin.H{"error": service.ErrServiceAccountDisabled.Error()})
+		return
+	}
+
+	admin := c.GetString("userEmail")
+	key, secret, err := veriflow.Svc.RotateAPIKey(ctx, &account, admin, time.Duration(graceHours)*time.Hour)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(ctx, audit.AdminAPIKeyCreated, actorOf(c, admin), "", account.ID, map[string]string{"api_key": key.ID, "grace_hours": strconv.Itoa(graceHours)})
+
+	c.JSON(http.StatusCreated, gin.H{"service_account": account, "api_key": secret})
+}
+
+func (veriflow *Veriflow) RevokeServiceAccountKey(c *gin.Context) {
+	ctx := c.Request.Context()
+	account, err := models.GetServiceAccount(ctx, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	keyID := c.Param("key_id")
+	err = veriflow.Svc.RevokeAPIKey(ctx, &account, keyID)
+	if errors.Is(err, service.ErrUnknownAPIKey) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit.Record(ctx, audit.AdminAPIKeyRevoked, actorOf(c, c.GetString("userEmail")), "", account.ID, map[string]string{"api_key": keyID})
+
+	c.JSON(http.StatusOK, account)
+}
+
+func isScope(scope string) bool {
+	for _, s := range models.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDelegators checks the allowed_delegators of a service account, emails
+// or domains written as "@example.com", and lowercases them
+func parseDelegators(delegators []string) ([]string, error) {
+	if len(delegators) == 0 {
+		return nil, errors.New("at least one allowed delegator is required")
+	}
+
+	parsed := make([]string, 0, len(delegators))
+	for _, delegator := range delegators {
+		delegator = strings.ToLower(strings.TrimSpace(delegator))
+		if domain, ok := strings.CutPrefix(delegator, "@"); ok {
+			if domain == "" || strings.ContainsAny(domain, "@ ") || !strings.Contains(domain, ".") {
+				return nil, errors.New("invalid allowed delegator " + delegator)
+			}
+		} else if address, err := mail.ParseAddress(delegator); err != nil || address.Address != delegator {
+			return nil, errors.New("invalid allowed delegator " + delegator)
+		}
+		parsed = append(parsed, delegator)
+	}
+	return parsed, nil
+}
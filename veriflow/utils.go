@@ -1,6 +1,17 @@
 package veriflow
 
-import "regexp"
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/service"
+	"github.com/vdparikh/veriflow/telephony"
+)
 
 // Simple utility function extract user ID for Slack. Format is <@user|name>
 func extractUserID(text string) string {
@@ -11,3 +22,111 @@ func extractUserID(text string) string {
 	}
 	return ""
 }
+
+// Extract an email address for Slack. Format is <mailto:address|address>
+func extractEmail(text string) string {
+	re := regexp.MustCompile(`^<mailto:([^>|]+)`)
+	matches := re.FindStringSubmatch(text)
+	if len(matches) > 1 {
+		return matches[1]
+	}
+	return ""
+}
+
+// Extract user group ID for Slack. Format is <!subteam^group|@handle>
+func extractUserGroupID(text string) string {
+	re := regexp.MustCompile(`<!subteam\^([^>|]+)`)
+	matches := re.FindStringSubmatch(text)
+	if len(matches) > 1 {
+		return matches[1]
+	}
+	return ""
+}
+
+// Split the verify arguments into user and user group mentions. Parsing stops
+// at the first argument that is neither, the rest is the optional message.
+func extractRecipients(args []string) (userIDs, groupIDs []string, message string) {
+	for i, arg := range args {
+		if id := extractUserID(arg); id != "" {
+			userIDs = append(userIDs, id)
+			continue
+		}
+		if id := extractUserGroupID(arg); id != "" {
+			groupIDs = append(groupIDs, id)
+			continue
+		}
+		message = strings.Join(args[i:], " ")
+		break
+	}
+	return userIDs, groupIDs, message
+}
+
+// HTTP status for errors returned by the verification service
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, service.ErrRateLimited), errors.Is(err, service.ErrCodeTooSoon), errors.Is(err, service.ErrCodeAttempts), errors.Is(err, service.ErrResendTooSoon):
+		return http.StatusTooManyRequests
+	case errors.Is(err, service.ErrDuplicateRequest), errors.Is(err, service.ErrNoPhone), errors.Is(err, service.ErrRequestClosed), errors.Is(err, service.ErrResendLimit):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrMuted):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrCodeInvalid), errors.Is(err, service.ErrCodeExpired):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, telephony.ErrInvalidNumber), errors.Is(err, service.ErrUnknownLanguage), errors.Is(err, models.ErrInvalidCursor):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// parseTimeParam reads a time filter, an RFC 3339 time or a date. A date
+// until is the end of that day so the day is included.
+func parseTimeParam(value string, until bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if until {
+		return day.Add(24*time.Hour - time.Nanosecond), nil
+	}
+	return day, nil
+}
+
+// Catalog key of the page text for errors returned by the verification
+// service, other errors are shown as they are
+func textForError(err error) string {
+	switch {
+	case errors.Is(err, service.ErrCodeInvalid):
+		return "error.invalid_code"
+	case errors.Is(err, service.ErrCodeExpired):
+		return "error.code_expired"
+	case errors.Is(err, service.ErrCodeAttempts):
+		return "error.code_attempts"
+	case errors.Is(err, service.ErrRateLimited):
+		return "error.rate_limited"
+	case errors.Is(err, service.ErrNoPhone):
+		return "error.no_phone"
+	default:
+		return err.Error()
+	}
+}
+
+// renderHTML renders a page in the language of the user: the one they chose,
+// else the first available from Accept-Language, else the one of their profile
+func (veriflow *Veriflow) renderHTML(c *gin.Context, code int, name string, data gin.H) {
+	var user models.User
+	if value, exists := c.Get("user"); exists {
+		user, _ = value.(models.User)
+	}
+
+	data["T"] = veriflow.I18n.Translator(user.Language, c.GetHeader("Accept-Language"), user.Locale)
+	data["CSRF"] = csrfToken(c)
+	c.HTML(code, name, data)
+}
@@ -0,0 +1,31 @@
+package veriflow
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/vdparikh/veriflow/service"
+)
+
+func TestStatusForError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{fmt.Errorf("%w, it is already COMPLETED", service.ErrRequestClosed), http.StatusConflict},
+		{fmt.Errorf("%w, it was already resent 3 times", service.ErrResendLimit), http.StatusConflict},
+		{fmt.Errorf("%w, please wait 5 seconds before resending", service.ErrResendTooSoon), http.StatusTooManyRequests},
+		{fmt.Errorf("%w (r1)", service.ErrDuplicateRequest), http.StatusConflict},
+		{service.ErrMuted, http.StatusForbidden},
+		// Failures saving the request or sending the messages are internal
+		{errors.New("error querying: connection reset"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if got := statusForError(tt.err); got != tt.want {
+			t.Errorf("statusForError(%q) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -1,12 +1,21 @@
 package veriflow
 
 import (
+	"context"
 	"net/url"
+	"strings"
 
 	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/vdparikh/veriflow/audit"
 	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/i18n"
+	"github.com/vdparikh/veriflow/metrics"
 	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/queue"
 	"github.com/vdparikh/veriflow/service"
+	"github.com/vdparikh/veriflow/siem"
+	"github.com/vdparikh/veriflow/tracing"
+	"github.com/vdparikh/veriflow/webhooks"
 
 	log "github.com/sirupsen/logrus"
 
@@ -14,12 +23,18 @@ import (
 )
 
 type Veriflow struct {
-	Cfg               config.Config
-	Svc               *service.VerificationService
-	WebAuthnService   *webauthnservice.WebAuthnService
-	VerificationQueue chan models.VerifyRequest
-	UserStore         models.UserStore
-	Logger            *log.Logger
+	Cfg             config.Config
+	Svc             *service.VerificationService
+	WebAuthnService *webauthnservice.WebAuthnService
+	Queue           queue.Queue
+	UserStore       models.UserStore
+	Webhooks        *webhooks.Dispatcher
+	Logger          *log.Logger
+	I18n            *i18n.Bundle         // texts of the web pages
+	SIEM            *siem.SyslogExporter // nil when the SIEM export is disabled
+
+	// FlushTracing exports the spans that haven't been exported yet
+	FlushTracing func(context.Context) error
 }
 
 func New() *Veriflow {
@@ -49,31 +64,67 @@ func New() *Veriflow {
 		log.Fatalf("Failed to create WebAuthn service: %v", err)
 	}
 
+	flushTracing, err := tracing.Init(&cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize tracing: %v", err)
+	}
+
+	exporter, err := siem.NewExporter(&cfg)
+	if err != nil {
+		log.Fatalf("Failed to create SIEM exporter: %v", err)
+	}
+	if exporter != nil {
+		audit.RegisterExporter(exporter)
+	}
+
 	svc, err := service.NewVerificationService(&cfg)
 	if err != nil {
 		log.Fatalf("Failed to create Verification service: %v", err)
 	}
 
+	bundle, err := i18n.NewBundle()
+	if err != nil {
+		log.Fatalf("Failed to load translations: %v", err)
+	}
+
+	jobs, err := queue.NewQueue(&cfg)
+	if err != nil {
+		log.Fatalf("Failed to create verification queue: %v", err)
+	}
+
 	veriflow := Veriflow{
-		Cfg:               cfg,
-		Svc:               svc,
-		WebAuthnService:   webAuthnService,
-		UserStore:         userStore,
-		VerificationQueue: make(chan models.VerifyRequest, 100),
-		Logger:            logger,
+		Cfg:             cfg,
+		Svc:             svc,
+		WebAuthnService: webAuthnService,
+		UserStore:       userStore,
+		Queue:           jobs,
+		Webhooks:        webhooks.NewDispatcher(&cfg),
+		Logger:          logger,
+		I18n:            bundle,
+		SIEM:            exporter,
+		FlushTracing:    flushTracing,
 	}
 
-	// go veriflow.StartVerificationWorker()
+	svc.Events.Subscribe(func(ctx context.Context, event service.Event) {
+		veriflow.Webhooks.Dispatch(ctx, event.ID, event.Type, event)
+	})
+	svc.Events.Subscribe(observeEvent)
 
 	return &veriflow
 }
 
-// // Queue to manage influx of verification requests
-// func (veriflow *Veriflow) StartVerificationWorker() {
-// 	for request := range veriflow.VerificationQueue {
-// 		err := veriflow.Svc.NewVerification(request)
-// 		if err != nil {
-// 			log.Println(err)
-// 		}
-// 	}
-// }
+// observeEvent counts the lifecycle events of requests for /metrics
+func observeEvent(_ context.Context, event service.Event) {
+	if event.Request == nil {
+		return
+	}
+
+	request := event.Request
+	switch event.Type {
+	case service.EventRequestCreated, service.EventRequestReported:
+		metrics.Verifications.WithLabelValues(strings.TrimPrefix(event.Type, "request."), request.CommunicationTool).Inc()
+	case service.EventRequestCompleted, service.EventRequestFailed:
+		metrics.Verifications.WithLabelValues(strings.TrimPrefix(event.Type, "request."), request.CommunicationTool).Inc()
+		metrics.TimeToVerify.WithLabelValues(request.CommunicationTool, request.Status).Observe(request.End.Sub(request.Start).Seconds())
+	}
+}
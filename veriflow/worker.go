@@ -0,0 +1,226 @@
+package veriflow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/slack-go/slack"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/queue"
+	"github.com/vdparikh/veriflow/service"
+)
+
+// Kinds of verification jobs
+const (
+	JobVerify  = "verify"
+	JobBatch   = "batch"
+	JobChannel = "channel"
+)
+
+// Failed verify jobs are retried after this delay, doubled on every attempt
+const jobRetryDelay = 30 * time.Second
+
+// VerificationJob is the work queued by slash commands and API calls. A
+// single verification is saved as QUEUED before it is queued, batches are
+// carried in the job until the worker prepares them.
+type VerificationJob struct {
+	Kind        string              `json:"kind"`
+	RequestID   string              `json:"request_id,omitempty"`
+	Batch       *models.VerifyBatch `json:"batch,omitempty"`
+	Recipients  []string            `json:"recipients,omitempty"`
+	Groups      []string            `json:"groups,omitempty"`
+	ResponseURL string              `json:"response_url,omitempty"`
+}
+
+func (veriflow *Veriflow) Enqueue(ctx context.Context, job VerificationJob) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return veriflow.Queue.Send(ctx, body)
+}
+
+// EnqueueAfter queues a job that is only processed once delay passed
+func (veriflow *Veriflow) EnqueueAfter(ctx context.Context, job VerificationJob, delay time.Duration) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return veriflow.Queue.SendAfter(ctx, body, delay)
+}
+
+// StartVerificationWorker processes jobs from the queue until ctx is done
+func (veriflow *Veriflow) StartVerificationWorker(ctx context.Context) {
+	for ctx.Err() == nil {
+		messages, err := veriflow.Queue.Receive(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				veriflow.Logger.Errorf("Error receiving verification jobs %s\n", err.Error())
+				time.Sleep(jobRetryDelay)
+			}
+			continue
+		}
+
+		for _, msg := range messages {
+			if veriflow.ProcessJob(ctx, msg) {
+				if err := veriflow.Queue.Retry(ctx, msg, retryDelay(msg)); err != nil {
+					veriflow.Logger.Errorf("Error retrying verification job [%s] %s\n", msg.ID, err.Error())
+				}
+				continue
+			}
+			if err := veriflow.Queue.Delete(ctx, msg); err != nil {
+				veriflow.Logger.Errorf("Error deleting verification job [%s] %s\n", msg.ID, err.Error())
+			}
+		}
+	}
+}
+
+// HandleSQSEvent processes the jobs delivered by a Lambda SQS event source.
+// Jobs to retry are reported back so SQS redelivers the same record once its
+// visibility timeout, pushed back by the retry delay, ends. The job is never
+// sent again, that would leave two copies of it in the queue. The other
+// records are deleted by Lambda.
+func (veriflow *Veriflow) HandleSQSEvent(ctx context.Context, event events.SQSEvent) events.SQSEventResponse {
+	var response events.SQSEventResponse
+	for _, record := range event.Records {
+		msg := queue.FromSQSEvent(record)
+		if !veriflow.ProcessJob(ctx, msg) {
+			continue
+		}
+
+		// The records may come from SQS while another provider is configured, their
+		// default visibility timeout applies then
+		if sqsQueue, ok := veriflow.Queue.(*queue.SQSQueue); ok {
+			if err := sqsQueue.Retry(ctx, msg, retryDelay(msg)); err != nil {
+				veriflow.Logger.Errorf("Error delaying verification job [%s] %s\n", msg.ID, err.Error())
+			}
+		}
+		response.BatchItemFailures = append(response.BatchItemFailures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+	}
+	return response
+}
+
+// ProcessJob runs a job and reports whether it should be retried
+func (veriflow *Veriflow) ProcessJob(ctx context.Context, msg queue.Message) bool {
+	var job VerificationJob
+	if err := json.Unmarshal(msg.Body, &job); err != nil {
+		veriflow.Logger.Errorf("Error decoding verification job [%s] %s\n", msg.ID, err.Error())
+		return false
+	}
+
+	switch job.Kind {
+	case JobVerify:
+		return veriflow.processVerify(ctx, job, msg.ReceiveCount)
+	case JobBatch:
+		batch := job.Batch
+		if err := veriflow.Svc.InitBatchVerification(ctx, batch, job.Recipients, job.Groups); err != nil {
+			veriflow.respond(ctx, job.ResponseURL, fmt.Sprintf("[API] Group Verification Failed with error %s", err.Error()))
+			return false
+		}
+		veriflow.startBatch(ctx, batch, 0)
+		veriflow.respond(ctx, job.ResponseURL, fmt.Sprintf("[API] Verification Initiated for %d recipients. Track the progress at %s", len(batch.RequestIDs), batch.StatusLink))
+	case JobChannel:
+		if err := veriflow.Svc.InitChannelVerification(ctx, job.Batch); err != nil {
+			veriflow.Logger.Errorf("Error verifying channel [%s] %s\n", job.Batch.Slack.Channel, err.Error())
+			veriflow.respond(ctx, job.ResponseURL, fmt.Sprintf("[API] Channel Verification Failed with error %s", err.Error()))
+			return false
+		}
+		veriflow.startBatch(ctx, job.Batch, time.Duration(float64(time.Second)/veriflow.Cfg.Verification.Channel.RequestsPerSecond))
+	default:
+		veriflow.Logger.Errorf("Unknown verification job [%s] %s\n", msg.ID, job.Kind)
+	}
+
+	// Batches save their requests as they go, running them twice would verify recipients twice
+	return false
+}
+
+// startBatch queues a verify job for every request of the batch, interval
+// apart. The worker doesn't wait between them, the queue holds the later ones
+// back so a channel job returns right away.
+func (veriflow *Veriflow) startBatch(ctx context.Context, batch *models.VerifyBatch, interval time.Duration) {
+	var failed bool
+	for i, request := range batch.Requests {
+		err := veriflow.EnqueueAfter(ctx, VerificationJob{Kind: JobVerify, RequestID: request.ID}, time.Duration(i)*interval)
+		if err != nil {
+			veriflow.Logger.Errorf("Error queuing request [%s] of batch [%s] %s\n", request.ID, batch.ID, err.Error())
+			request.DoneWithError(ctx, err.Error())
+			failed = true
+		}
+	}
+
+	if failed {
+		veriflow.refreshBatch(ctx, batch.ID)
+	}
+}
+
+func (veriflow *Veriflow) refreshBatch(ctx context.Context, batchID string) {
+	if batchID == "" {
+		return
+	}
+	if err := veriflow.Svc.RefreshBatch(ctx, batchID); err != nil {
+		veriflow.Logger.Errorf("Error refreshing batch [%s] %s\n", batchID, err.Error())
+	}
+}
+
+func (veriflow *Veriflow) processVerify(ctx context.Context, job VerificationJob, attempt int) bool {
+	request, err := models.GetByID(ctx, job.RequestID)
+	if errors.Is(err, models.ErrNotFound) {
+		veriflow.Logger.Errorf("Queued request [%s] not found\n", job.RequestID)
+		return false
+	}
+	if err != nil {
+		veriflow.Logger.Errorf("Error loading queued request [%s] %s\n", job.RequestID, err.Error())
+		return attempt < veriflow.Cfg.Queue.MaxAttempts
+	}
+
+	// Cancelled while it was waiting in the queue
+	if request.Status != "QUEUED" && request.Status != "RECEIVED" {
+		return false
+	}
+
+	request.Status = "RECEIVED"
+	err = veriflow.Svc.InitVerification(ctx, &request)
+	if err == nil {
+		veriflow.refreshBatch(ctx, request.BatchID)
+		veriflow.respond(ctx, job.ResponseURL, "[API] Verification Initiated. Please head on to the Veriflow app to monitor the progress of your verification.")
+		return false
+	}
+
+	if retryable(err) && attempt < veriflow.Cfg.Queue.MaxAttempts {
+		veriflow.Logger.Errorf("Error starting verification [%s] attempt %d %s\n", request.ID, attempt, err.Error())
+		return true
+	}
+
+	request.DoneWithError(ctx, err.Error())
+	veriflow.refreshBatch(ctx, request.BatchID)
+	veriflow.respond(ctx, job.ResponseURL, fmt.Sprintf("[API] Verification Failed with error %s", err.Error()))
+	return false
+}
+
+// respond posts the outcome of a slash command, API calls have no response URL
+func (veriflow *Veriflow) respond(ctx context.Context, responseURL, text string) {
+	if responseURL == "" {
+		return
+	}
+
+	err := slack.PostWebhookContext(ctx, responseURL, &slack.WebhookMessage{ResponseType: "ephemeral", Text: text})
+	if err != nil {
+		veriflow.Logger.Errorf("Error responding to slash command %s\n", err.Error())
+	}
+}
+
+// Limits reject a request for good, anything else (e.g. Slack being down) is worth another try
+func retryable(err error) bool {
+	return !errors.Is(err, service.ErrMuted) && !errors.Is(err, service.ErrDuplicateRequest) && !errors.Is(err, service.ErrRateLimited)
+}
+
+func retryDelay(msg queue.Message) time.Duration {
+	if msg.ReceiveCount < 1 {
+		return jobRetryDelay
+	}
+	return jobRetryDelay << (msg.ReceiveCount - 1)
+}
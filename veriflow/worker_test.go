@@ -0,0 +1,92 @@
+package veriflow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/vdparikh/veriflow/communication"
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/queue"
+	"github.com/vdparikh/veriflow/service"
+)
+
+// channelCommunicator is a Slack workspace with a channel of 100 members
+type channelCommunicator struct {
+	communication.Communicator
+}
+
+func (channelCommunicator) GetChannelMembers(ctx context.Context, channelID string) ([]string, error) {
+	var members []string
+	for i := 0; i < 100; i++ {
+		members = append(members, fmt.Sprint("U", i))
+	}
+	return members, nil
+}
+
+func (channelCommunicator) GetUserInfo(ctx context.Context, userID string) (models.User, error) {
+	return models.User{ID: userID, Email: userID + "@example.com"}, nil
+}
+
+func (channelCommunicator) SendBatchRoster(ctx context.Context, batch *models.VerifyBatch) error {
+	batch.Slack.MessageTS = "1.0"
+	return nil
+}
+
+// The channel job queues the requests of the members and leaves the pacing to
+// the queue, it returns long before the 99 seconds the rate takes
+func TestChannelJobDoesNotWaitOnTheRate(t *testing.T) {
+	models.UseDB(db.NewMemoryDB())
+	cfg := config.Config{}
+	cfg.Verification.Channel.MaxMembers = 100
+	cfg.Verification.Channel.RequestsPerSecond = 1
+	q := queue.NewMemoryQueue(100, time.Minute)
+	veriflow := &Veriflow{
+		Cfg:    cfg,
+		Svc:    &service.VerificationService{Config: &cfg, Communicator: channelCommunicator{}},
+		Queue:  q,
+		Logger: log.New(),
+	}
+
+	body, err := json.Marshal(VerificationJob{Kind: JobChannel, Batch: &models.VerifyBatch{ID: "batch", Slack: models.SlackRequest{UserID: "U0", Channel: "C1"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if veriflow.ProcessJob(context.Background(), queue.Message{ID: "channel", Body: body}) {
+		t.Fatal("ProcessJob() asked for a retry")
+	}
+	if took := time.Since(start); took > 5*time.Second {
+		t.Fatalf("ProcessJob() took %s", took)
+	}
+
+	batch, err := models.GetBatchByID(context.Background(), "batch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch.RequestIDs) != 99 || batch.Slack.MessageTS == "" {
+		t.Fatalf("batch has %d requests and roster %q, want 99 and a roster", len(batch.RequestIDs), batch.Slack.MessageTS)
+	}
+
+	// Only the first request is due right away
+	messages, err := q.Receive(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var job VerificationJob
+	if len(messages) != 1 || json.Unmarshal(messages[0].Body, &job) != nil || job.Kind != JobVerify || job.RequestID != batch.RequestIDs[0] {
+		t.Fatalf("received %d messages, job %+v", len(messages), job)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if messages, _ := q.Receive(ctx); len(messages) != 0 {
+		t.Fatalf("received %d more messages before the next second", len(messages))
+	}
+}
@@ -1,6 +1,7 @@
 package webauthn
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/go-webauthn/webauthn/protocol"
@@ -24,8 +25,8 @@ func NewWebAuthnService(webAuthnConfig *webauthn.Config, userStore models.UserSt
 	}, nil
 }
 
-func (s *WebAuthnService) BeginRegistration(userID string) (interface{}, error) {
-	user, err := s.UserStore.GetUserByID(userID)
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, userID string) (interface{}, error) {
+	user, err := s.UserStore.GetUserByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -36,16 +37,16 @@ func (s *WebAuthnService) BeginRegistration(userID string) (interface{}, error)
 		return nil, err
 	}
 
-	s.UserStore.SaveSessionData(userID, sessionData)
+	s.UserStore.SaveSessionData(ctx, userID, sessionData)
 	return options, nil
 }
 
-func (s *WebAuthnService) FinishRegistration(userID string, response *http.Request) error {
-	user, err := s.UserStore.GetUserByID(userID)
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID string, response *http.Request) error {
+	user, err := s.UserStore.GetUserByID(ctx, userID)
 	if err != nil {
 		return err
 	}
-	sessionData, err := s.UserStore.GetSessionData(userID)
+	sessionData, err := s.UserStore.GetSessionData(ctx, userID)
 	if err != nil {
 		return err
 	}
@@ -55,19 +56,19 @@ func (s *WebAuthnService) FinishRegistration(userID string, response *http.Reque
 		return err
 	}
 
-	s.UserStore.SaveCredentials(userID, parsedCredential)
-	s.UserStore.DeleteSessionData(userID)
+	s.UserStore.SaveCredentials(ctx, userID, parsedCredential)
+	s.UserStore.DeleteSessionData(ctx, userID)
 
 	return nil
 }
 
-func (s *WebAuthnService) BeginLogin(userID string) (interface{}, error) {
-	user, err := s.UserStore.GetUserByID(userID)
+func (s *WebAuthnService) BeginLogin(ctx context.Context, userID string) (interface{}, error) {
+	user, err := s.UserStore.GetUserByID(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
 
-	credentials := s.UserStore.GetCredentials(userID)
+	credentials := s.UserStore.GetCredentials(ctx, userID)
 	allowCredentials := make([]protocol.CredentialDescriptor, len(credentials))
 	for i, cred := range credentials {
 		allowCredentials[i] = protocol.CredentialDescriptor{
@@ -81,22 +82,22 @@ func (s *WebAuthnService) BeginLogin(userID string) (interface{}, error) {
 		return nil, err
 	}
 
-	s.UserStore.SaveSessionData(userID, sessionData)
+	s.UserStore.SaveSessionData(ctx, userID, sessionData)
 	return options, nil
 }
 
-func (s *WebAuthnService) FinishLogin(userID string, response *http.Request) error {
-	user, err := s.UserStore.GetUserByID(userID)
+func (s *WebAuthnService) FinishLogin(ctx context.Context, userID string, response *http.Request) error {
+	user, err := s.UserStore.GetUserByID(ctx, userID)
 	if err != nil {
 		return err
 	}
 
-	sessionData, _ := s.UserStore.GetSessionData(userID)
+	sessionData, _ := s.UserStore.GetSessionData(ctx, userID)
 	_, err = s.WebAuthn.FinishLogin(user, *sessionData, response)
 	if err != nil {
 		return err
 	}
 
-	s.UserStore.DeleteSessionData(userID)
+	s.UserStore.DeleteSessionData(ctx, userID)
 	return nil
 }
@@ -0,0 +1,251 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vdparikh/veriflow/config"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/tracing"
+	"github.com/vdparikh/veriflow/utils"
+)
+
+// Deliveries are kept for a week in the delivery log
+const deliveryRetention = 7 * 24 * time.Hour
+
+// A claimed delivery is handed to another dispatcher when it isn't done by then
+const deliveryLease = 2 * time.Minute
+
+// Dispatcher delivers lifecycle events to every subscription whose filter
+// matches the event type. Bodies are signed like the incident webhook
+// (X-Veriflow-Signature over "<timestamp>.<body>"). Deliveries are stored
+// before they are attempted and failed ones are retried with exponential
+// backoff by DispatchPending. Every attempt is written to the delivery log.
+type Dispatcher struct {
+	Subscriptions []models.WebhookSubscription
+	MaxAttempts   int
+	Backoff       time.Duration
+	Interval      time.Duration
+	Client        *http.Client
+
+	// Waits for the first attempts started by Dispatch
+	attempts sync.WaitGroup
+}
+
+func NewDispatcher(cfg *config.Config) *Dispatcher {
+	dispatcher := &Dispatcher{
+		MaxAttempts: cfg.Webhooks.MaxAttempts,
+		Backoff:     time.Duration(cfg.Webhooks.BackoffSeconds) * time.Second,
+		Interval:    time.Duration(cfg.Outbox.IntervalSeconds) * time.Second,
+		Client:      &http.Client{Timeout: 10 * time.Second, Transport: tracing.Transport(http.DefaultTransport, "webhook")},
+	}
+
+	for _, sub := range cfg.Webhooks.Subscriptions {
+		dispatcher.Subscriptions = append(dispatcher.Subscriptions, models.WebhookSubscription{
+			ID:         sub.ID,
+			URL:        sub.URL,
+			Secret:     sub.Secret,
+			Events:     sub.Events,
+			FromConfig: true,
+		})
+	}
+
+	return dispatcher
+}
+
+// AllSubscriptions returns the subscriptions from the config followed by the ones created through the API
+func (d *Dispatcher) AllSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	stored, err := models.GetWebhookSubscriptions(ctx)
+	if err != nil {
+		return d.Subscriptions, err
+	}
+	return append(append([]models.WebhookSubscription{}, d.Subscriptions...), stored...), nil
+}
+
+// subscription finds a subscription from the config or the API
+func (d *Dispatcher) subscription(ctx context.Context, id string) (models.WebhookSubscription, error) {
+	for _, sub := range d.Subscriptions {
+		if sub.ID == id {
+			return sub, nil
+		}
+	}
+	return models.GetWebhookSubscription(ctx, id)
+}
+
+// Dispatch queues the event for the matching subscriptions and makes the
+// first attempts in the background. Deliveries keep the trace of ctx but
+// outlive its cancellation, the ones an exit interrupts are retried by
+// DispatchPending.
+func (d *Dispatcher) Dispatch(ctx context.Context, eventID, eventType string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("failed to marshal event %s: %v\n", eventID, err)
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	subscriptions, err := d.AllSubscriptions(ctx)
+	if err != nil {
+		log.Printf("failed to load webhook subscriptions: %v\n", err)
+	}
+
+	for _, sub := range subscriptions {
+		if !sub.Matches(eventType) {
+			continue
+		}
+
+		pending := models.NewPendingWebhook(sub.ID, eventID, eventType, body)
+		if err := pending.Create(ctx); err != nil {
+			if !errors.Is(err, db.ErrItemExists) {
+				log.Printf("failed to queue delivery of %s to %s: %v\n", eventID, sub.ID, err)
+			}
+			continue
+		}
+
+		d.attempts.Add(1)
+		go func(sub models.WebhookSubscription) {
+			defer d.attempts.Done()
+			d.deliver(ctx, sub, &pending)
+		}(sub)
+	}
+}
+
+// Wait returns once the first attempts started by Dispatch are done, call it
+// before the process exits or freezes
+func (d *Dispatcher) Wait() {
+	d.attempts.Wait()
+}
+
+// DispatchPending retries the deliveries whose next attempt is due
+func (d *Dispatcher) DispatchPending(ctx context.Context) error {
+	pending, err := models.GetDuePendingWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range pending {
+		sub, err := d.subscription(ctx, pending[i].SubscriptionID)
+		if err != nil {
+			// The subscription was deleted, nobody expects the event anymore
+			log.Printf("dropping delivery %s: %v\n", pending[i].ID, err)
+			if err := pending[i].Failed(ctx, time.Time{}, deliveryRetention); err != nil {
+				log.Printf("failed to drop delivery %s: %v\n", pending[i].ID, err)
+			}
+			continue
+		}
+		d.deliver(ctx, sub, &pending[i])
+	}
+	return nil
+}
+
+// StartDispatcher retries failed deliveries until ctx is done
+func (d *Dispatcher) StartDispatcher(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.DispatchPending(ctx); err != nil {
+				log.Printf("failed to dispatch webhooks: %v\n", err)
+			}
+		}
+	}
+}
+
+// deliver makes one attempt and schedules the next one when it fails
+func (d *Dispatcher) deliver(ctx context.Context, sub models.WebhookSubscription, pending *models.PendingWebhook) {
+	if err := pending.Claim(ctx, deliveryLease); err != nil {
+		if !errors.Is(err, db.ErrConditionFailed) {
+			log.Printf("failed to claim delivery %s: %v\n", pending.ID, err)
+		}
+		return
+	}
+
+	delivery := d.send(ctx, sub, pending.EventID, pending.EventType, []byte(pending.Body))
+	delivery.Attempt = pending.Attempts
+	if err := delivery.Save(ctx); err != nil {
+		log.Printf("failed to log delivery of %s to %s: %v\n", pending.EventID, sub.ID, err)
+	}
+
+	if delivery.Success {
+		if err := pending.Sent(ctx, deliveryRetention); err != nil {
+			log.Printf("failed to mark delivery %s as sent: %v\n", pending.ID, err)
+		}
+		return
+	}
+
+	var next time.Time
+	if pending.Attempts < d.MaxAttempts {
+		next = time.Now().Add(d.Backoff << (pending.Attempts - 1))
+	} else {
+		log.Printf("giving up delivering %s to %s after %d attempts\n", pending.EventID, sub.ID, pending.Attempts)
+	}
+	if err := pending.Failed(ctx, next, deliveryRetention); err != nil {
+		log.Printf("failed to reschedule delivery %s: %v\n", pending.ID, err)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, sub models.WebhookSubscription, eventID, eventType string, body []byte) (delivery models.WebhookDelivery) {
+	start := time.Now()
+	delivery = models.WebhookDelivery{
+		ID:             uuid.New().String(),
+		SubscriptionID: sub.ID,
+		EventID:        eventID,
+		EventType:      eventType,
+		DeliveredAt:    start,
+		ExpiresAt:      start.Add(deliveryRetention).Unix(),
+	}
+	defer func() {
+		delivery.Duration = time.Since(start).String()
+	}()
+
+	// Subscriptions created before secrets were required can't be signed for
+	if sub.Secret == "" {
+		delivery.Error = "the subscription has no secret, create it again to get one"
+		return delivery
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	timestamp := strconv.FormatInt(start.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Veriflow-Event", eventType)
+	req.Header.Set("X-Veriflow-Delivery", eventID)
+	req.Header.Set("X-Veriflow-Timestamp", timestamp)
+	req.Header.Set("X-Veriflow-Signature", utils.SignPayload(sub.Secret, timestamp, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+	defer resp.Body.Close()
+
+	delivery.StatusCode = resp.StatusCode
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		delivery.Error = fmt.Sprintf("unexpected status %d: %s", resp.StatusCode, respBody)
+		return delivery
+	}
+
+	delivery.Success = true
+	return delivery
+}
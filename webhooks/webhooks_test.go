@@ -0,0 +1,214 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/vdparikh/veriflow/db"
+	"github.com/vdparikh/veriflow/models"
+	"github.com/vdparikh/veriflow/utils"
+)
+
+// receiver is a subscriber answering with the queued statuses, then 200
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	received []*http.Request
+	bodies   []string
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.received = append(r.received, req)
+	r.bodies = append(r.bodies, string(body))
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+var memory *db.MemoryDB
+
+func newTestDispatcher(t *testing.T, statuses ...int) (*Dispatcher, *receiver) {
+	t.Helper()
+	memory = db.NewMemoryDB()
+	memory.RangeKeys[models.WebhookDueIndex] = "next_attempt"
+	memory.RangeKeys[models.WebhookSubscriptionIndex] = "delivered_at"
+	models.UseDB(memory)
+
+	r := &receiver{statuses: statuses}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+
+	return &Dispatcher{
+		Subscriptions: []models.WebhookSubscription{
+			{ID: "helpdesk", URL: server.URL, Secret: "whsec_test", Events: []string{"request.completed"}, FromConfig: true},
+		},
+		MaxAttempts: 3,
+		Client:      server.Client(),
+	}, r
+}
+
+// pendingDeliveries returns the deliveries still to be made, due or not
+func pendingDeliveries(t *testing.T) []models.PendingWebhook {
+	t.Helper()
+	var all, pending []models.PendingWebhook
+	if err := memory.Scan(context.Background(), &dynamodb.ScanInput{TableName: aws.String(models.VeriflowWebhookQueueTable)}, &all); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range all {
+		if p.Status == "PENDING" {
+			pending = append(pending, p)
+		}
+	}
+	return pending
+}
+
+func TestDispatchSignsAndDelivers(t *testing.T) {
+	d, r := newTestDispatcher(t)
+	ctx := context.Background()
+
+	d.Dispatch(ctx, "evt_1", "request.completed", map[string]string{"id": "r1"})
+	d.Dispatch(ctx, "evt_2", "request.created", map[string]string{"id": "r1"})
+	d.Wait()
+
+	if r.count() != 1 {
+		t.Fatalf("received %d deliveries, want only the subscribed event", r.count())
+	}
+	req := r.received[0]
+	if req.Header.Get("X-Veriflow-Event") != "request.completed" || req.Header.Get("X-Veriflow-Delivery") != "evt_1" {
+		t.Errorf("headers = %v", req.Header)
+	}
+	want := utils.SignPayload("whsec_test", req.Header.Get("X-Veriflow-Timestamp"), []byte(r.bodies[0]))
+	if got := req.Header.Get("X-Veriflow-Signature"); got != want {
+		t.Errorf("signature = %s, want %s", got, want)
+	}
+
+	// The same event isn't delivered twice
+	d.Dispatch(ctx, "evt_1", "request.completed", map[string]string{"id": "r1"})
+	d.Wait()
+	if r.count() != 1 {
+		t.Errorf("received %d deliveries after dispatching evt_1 again, want 1", r.count())
+	}
+	if pending := pendingDeliveries(t); len(pending) != 0 {
+		t.Errorf("pending deliveries = %+v, want none", pending)
+	}
+}
+
+func TestDispatchPendingRetries(t *testing.T) {
+	d, r := newTestDispatcher(t, http.StatusInternalServerError, http.StatusBadGateway)
+	ctx := context.Background()
+
+	d.Backoff = time.Hour
+	d.Dispatch(ctx, "evt_1", "request.completed", map[string]string{"id": "r1"})
+	d.Wait()
+	if r.count() != 1 {
+		t.Fatalf("received %d deliveries, want the first attempt", r.count())
+	}
+
+	// The retry isn't due before the backoff
+	if err := d.DispatchPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r.count() != 1 {
+		t.Fatalf("retried before the backoff")
+	}
+
+	d.Backoff = 0
+	for _, pending := range pendingDeliveries(t) {
+		pending.NextAttempt = time.Now()
+		pending.Save(ctx)
+	}
+	for attempt := 2; attempt <= 3; attempt++ {
+		if err := d.DispatchPending(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if r.count() != attempt {
+			t.Fatalf("received %d deliveries, want %d", r.count(), attempt)
+		}
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(ctx, "helpdesk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 3 {
+		t.Fatalf("delivery log has %d attempts, want 3", len(deliveries))
+	}
+	if !deliveries[0].Success || deliveries[2].Success {
+		t.Errorf("delivery log isn't newest first: %+v", deliveries)
+	}
+	succeeded := 0
+	for _, delivery := range deliveries {
+		if delivery.Success {
+			succeeded++
+			if delivery.Attempt != 3 {
+				t.Errorf("attempt %d succeeded, want 3", delivery.Attempt)
+			}
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d attempts succeeded, want 1", succeeded)
+	}
+	if pending := pendingDeliveries(t); len(pending) != 0 {
+		t.Errorf("pending deliveries = %+v, want none", pending)
+	}
+}
+
+func TestDispatchPendingGivesUp(t *testing.T) {
+	d, r := newTestDispatcher(t, 500, 500, 500, 500)
+	ctx := context.Background()
+
+	d.Dispatch(ctx, "evt_1", "request.completed", map[string]string{"id": "r1"})
+	d.Wait()
+	for i := 0; i < 5; i++ {
+		if err := d.DispatchPending(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if r.count() != d.MaxAttempts {
+		t.Errorf("received %d deliveries, want MaxAttempts %d", r.count(), d.MaxAttempts)
+	}
+	if pending := pendingDeliveries(t); len(pending) != 0 {
+		t.Errorf("pending deliveries = %+v, want none after giving up", pending)
+	}
+}
+
+// Subscriptions stored before secrets were required get no unsigned deliveries
+func TestDispatchRequiresSecret(t *testing.T) {
+	d, r := newTestDispatcher(t)
+	ctx := context.Background()
+	d.Subscriptions[0].Secret = ""
+
+	d.Dispatch(ctx, "evt_1", "request.completed", map[string]string{"id": "r1"})
+	d.Wait()
+	if r.count() != 0 {
+		t.Fatalf("received %d unsigned deliveries", r.count())
+	}
+
+	deliveries, err := models.GetWebhookDeliveries(ctx, "helpdesk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Success || deliveries[0].Error == "" {
+		t.Fatalf("delivery log = %+v, want the failed attempt", deliveries)
+	}
+}